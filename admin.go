@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AdminState is the document served by GET /admin/state. The schema is
+// kept stable: fields may be added but never renamed or removed.
+type AdminState struct {
+	GeneratedAt time.Time     `json:"generated_at"`
+	Rooms       []AdminRoom   `json:"rooms"`
+	Players     []AdminPlayer `json:"players"`
+}
+
+// AdminRoom describes a room and its Game FSM.
+type AdminRoom struct {
+	ID       string   `json:"id"`
+	Channel  string   `json:"channel"`
+	Owner    string   `json:"owner"`
+	State    string   `json:"state"`
+	Players  []string `json:"players"`
+	Ready    int      `json:"ready"`
+	Presence int      `json:"presence"`
+	Private  bool     `json:"private"`
+}
+
+// AdminPlayer describes a connected player and its Player FSM.
+type AdminPlayer struct {
+	ID       string     `json:"id"`
+	User     string     `json:"user"`
+	Role     string     `json:"role"`
+	State    string     `json:"state"`
+	Room     string     `json:"room"`
+	Client   ClientInfo `json:"client"`
+	Presence string     `json:"presence"`
+}
+
+// State returns a snapshot of all rooms and players. Both registries are
+// locked while it is taken so it is consistent even while games mutate.
+func (s *Server) State() AdminState {
+	state := AdminState{
+		GeneratedAt: time.Now().UTC(),
+		Rooms:       []AdminRoom{},
+		Players:     []AdminPlayer{},
+	}
+
+	s.rooms.mu.Lock()
+	s.players.mu.RLock()
+	presence := make(map[string]string, len(s.rooms.rooms))
+	for id, r := range s.rooms.rooms {
+		presence[id] = r.PresenceChannel()
+		state.Rooms = append(state.Rooms, AdminRoom{
+			ID:      id,
+			Channel: r.Channel(),
+			Owner:   s.rooms.owners[id],
+			// Read before the room lock since guards lock the room under
+			// the FSM lock.
+			State:   r.Game.Current(),
+			Players: r.Players(),
+			Ready:   r.ReadyCount(),
+			Private: r.Private(),
+		})
+	}
+	for _, p := range s.players.players {
+		state.Players = append(state.Players, AdminPlayer{
+			ID:       p.ID(),
+			User:     p.UserID,
+			Role:     s.roles.role(roleKey(p.UserID, p.ID())),
+			State:    p.FSM.Current(),
+			Room:     p.Room(),
+			Client:   p.Info(),
+			Presence: p.Presence(),
+		})
+	}
+	s.players.mu.RUnlock()
+	s.rooms.mu.Unlock()
+
+	// Presence lives in the broker, outside of the registries.
+	for i := range state.Rooms {
+		if stats, err := s.node.PresenceStats(presence[state.Rooms[i].ID]); err == nil {
+			state.Rooms[i].Presence = stats.NumClients
+		}
+	}
+
+	sort.Slice(state.Rooms, func(i, j int) bool { return state.Rooms[i].ID < state.Rooms[j].ID })
+	sort.Slice(state.Players, func(i, j int) bool { return state.Players[i].ID < state.Players[j].ID })
+	return state
+}
+
+// AdminHandler serves the admin API, guarded by Config.AdminToken.
+func (s *Server) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/state", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, s.State())
+	})
+	mux.HandleFunc("/admin/connections", s.serveConnections)
+	mux.HandleFunc("/admin/connections/", s.serveConnections)
+	return s.adminOnly(mux)
+}
+
+// adminOnly rejects requests without the admin token, sent as a Bearer
+// token. The admin API is disabled when no token is configured.
+func (s *Server) adminOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.config.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminToken)) != 1 {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error().Msgf("admin response error: %s", err.Error())
+	}
+}
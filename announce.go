@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// msgAnnouncement is a server-wide announcement, e.g. an upcoming
+// maintenance, which clients show as a banner.
+const msgAnnouncement = "server.announcement"
+
+// Announcement levels.
+const (
+	AnnouncementInfo    = "info"
+	AnnouncementWarning = "warning"
+)
+
+// announcement is the payload of msgAnnouncement.
+type announcement struct {
+	Message string `json:"message"`
+	Level   string `json:"level"`
+}
+
+// Announce publishes message to the lobby, the server channel every client
+// subscribes to, and once to the channel of every room. It returns the
+// number of rooms the announcement was published to.
+func (s *Server) Announce(message, level string) (int, error) {
+	if level == "" {
+		level = AnnouncementInfo
+	}
+	a := announcement{Message: message, Level: level}
+	if err := s.publishMessage(serverChannel, msgAnnouncement, a); err != nil {
+		return 0, err
+	}
+	rooms := 0
+	for _, r := range s.rooms.Rooms() {
+		if err := s.publishMessage(r.Channel(), msgAnnouncement, a); err != nil {
+			log.Warn().Msgf("room %s: announcement not published: %s", r.ID, err.Error())
+			continue
+		}
+		rooms++
+	}
+	log.Info().Msgf("announcement published to the lobby and %d rooms: %s", rooms, message)
+	return rooms, nil
+}
+
+type announceRequest struct {
+	Message string `json:"message"`
+	Level   string `json:"level,omitempty"`
+}
+
+type announceReply struct {
+	Rooms int `json:"rooms"`
+}
+
+// rpcAnnounce publishes a server-wide announcement. Admin only.
+func (s *Server) rpcAnnounce(client *centrifuge.Client, data []byte) ([]byte, error) {
+	if !s.isAdmin(client) {
+		return nil, centrifuge.ErrorPermissionDenied
+	}
+	var req announceRequest
+	if err := json.Unmarshal(data, &req); err != nil || req.Message == "" {
+		return nil, centrifuge.ErrorBadRequest
+	}
+	switch req.Level {
+	case "", AnnouncementInfo, AnnouncementWarning:
+	default:
+		return nil, centrifuge.ErrorBadRequest
+	}
+	rooms, err := s.Announce(req.Message, req.Level)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(announceReply{Rooms: rooms})
+}
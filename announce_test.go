@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// announcements counts the announcements c receives per channel until no
+// publication came for a while.
+func announcements(c *HarnessClient) map[string]int {
+	got := make(map[string]int)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		pub, err := c.Next(ctx)
+		cancel()
+		if err != nil {
+			return got
+		}
+		if pub.Message.Type == msgAnnouncement {
+			got[pub.Channel]++
+		}
+	}
+}
+
+func TestAnnounceToEveryRoomOnce(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.AdminUsers = []string{"admin"} })
+	admin := connect(t, h, "admin")
+	if err := admin.Subscribe(serverChannel); err != nil {
+		t.Fatal(err)
+	}
+	if code := callError(t, connect(t, h, "player"), "announce", announceRequest{Message: "hi"}); code != CodePermissionDenied {
+		t.Errorf("announce from a player: code %d, want %d", code, CodePermissionDenied)
+	}
+
+	// Without any room, only the lobby gets it.
+	var reply announceReply
+	call(t, admin, "announce", announceRequest{Message: "maintenance in 10 minutes"}, &reply)
+	if reply.Rooms != 0 {
+		t.Errorf("announced to %d rooms, want none", reply.Rooms)
+	}
+	if got := announcements(admin); got[serverChannel] != 1 {
+		t.Errorf("lobby got %d announcements, want 1", got[serverChannel])
+	}
+
+	var members []*HarnessClient
+	var channels []string
+	for i := 0; i < 3; i++ {
+		c := connect(t, h, fmt.Sprintf("owner%d", i))
+		room := createRoom(t, c, createRoomRequest{})
+		call(t, c, "joinRoom", roomRequest{Room: room.Room}, nil)
+		if err := c.Subscribe(room.Channel); err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, c)
+		channels = append(channels, room.Channel)
+	}
+	call(t, admin, "announce", announceRequest{Message: "maintenance in 5 minutes", Level: AnnouncementWarning}, &reply)
+	if reply.Rooms != 3 {
+		t.Errorf("announced to %d rooms, want 3", reply.Rooms)
+	}
+	for i, c := range members {
+		if got := announcements(c); got[channels[i]] != 1 || len(got) != 1 {
+			t.Errorf("room %d got announcements %v, want one on %s", i, got, channels[i])
+		}
+	}
+	if got := announcements(admin); got[serverChannel] != 1 {
+		t.Errorf("lobby got %d announcements, want 1", got[serverChannel])
+	}
+}
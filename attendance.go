@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+var (
+	// ErrMatchStarted is returned to the players joining a match of
+	// expected players once its game started.
+	ErrMatchStarted = errors.New("match already started")
+	// ErrTooFewExpected is returned by NewMatch for fewer expected players
+	// than a game needs.
+	ErrTooFewExpected = errors.New("too few expected players")
+)
+
+// NoShowPolicy decides what happens to a match whose expected players
+// didn't all join within AttendanceConfig.Timeout.
+type NoShowPolicy string
+
+const (
+	// NoShowCancel cancels the match, sending its players back to idle.
+	NoShowCancel NoShowPolicy = "cancel"
+	// NoShowStart starts the game short-handed with the players who
+	// joined, and cancels the match if they are fewer than MinPlayers.
+	NoShowStart NoShowPolicy = "start"
+)
+
+func (p NoShowPolicy) validate() error {
+	switch p {
+	case "", NoShowCancel, NoShowStart:
+		return nil
+	}
+	return fmt.Errorf("unknown no-show policy %q", p)
+}
+
+// AttendanceConfig holds the settings of the matches of expected players.
+type AttendanceConfig struct {
+	// Timeout is the time the expected players have to join. Zero waits
+	// for them forever.
+	Timeout time.Duration
+	// NoShow is applied once Timeout elapsed, NoShowCancel when empty.
+	NoShow NoShowPolicy
+}
+
+const msgMatchCancelled = "match.cancelled"
+
+// matchCancelled is the payload of msgMatchCancelled, published on the room
+// channel.
+type matchCancelled struct {
+	Room    string   `json:"room"`
+	Missing []string `json:"missing"`
+}
+
+// expect restricts the room to ownerIDs and waits for them to join. It
+// must be called before the room is handed out.
+func (r *Room) expect(ownerIDs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.invited = make(map[string]bool, len(ownerIDs))
+	r.expected = make(map[string]string, len(ownerIDs))
+	for _, id := range ownerIDs {
+		r.invited[id] = true
+		r.expected[id] = ""
+	}
+	r.attending = true
+}
+
+// Expected returns the owner IDs expected in the room, sorted, or nil if
+// it isn't a match of expected players.
+func (r *Room) Expected() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.expected == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(r.expected))
+	for id := range r.expected {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// admit fails with ErrMatchStarted once the game of a match of expected
+// players left the lobby.
+func (r *Room) admit() error {
+	state := r.Game.Current()
+	r.mu.Lock()
+	expected := r.expected != nil
+	r.mu.Unlock()
+	if expected && state != gameLobby {
+		return fmt.Errorf("%w: %s", ErrMatchStarted, r.ID)
+	}
+	return nil
+}
+
+// arrive records that ownerID joined with clientID and reports whether
+// that completed the attendance of the match, whose wait is then over.
+func (r *Room) arrive(ownerID, clientID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.expected[ownerID]; !ok || !r.attending {
+		return false
+	}
+	r.expected[ownerID] = clientID
+	if len(r.missing()) > 0 {
+		return false
+	}
+	r.stopAttendance()
+	return true
+}
+
+// awaitAttendance calls fn with the missing owner IDs if the expected
+// players didn't all join within timeout.
+func (r *Room) awaitAttendance(timeout time.Duration, fn func(missing []string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var timer Timer
+	timer = r.clock.AfterFunc(timeout, func() {
+		r.mu.Lock()
+		// The last arrival may have ended the wait after the timer fired.
+		current := r.attending && r.attendance == timer
+		var missing []string
+		if current {
+			missing = r.missing()
+			r.attending = false
+			r.attendance = nil
+		}
+		r.mu.Unlock()
+		if current {
+			fn(missing)
+		}
+	})
+	r.attendance = timer
+}
+
+// awaiting reports whether the room still waits for expected players.
+func (r *Room) awaiting() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.attending
+}
+
+// stopAttendance ends the wait for the expected players. It must be
+// called with r.mu held.
+func (r *Room) stopAttendance() {
+	r.attending = false
+	if r.attendance != nil {
+		r.attendance.Stop()
+		r.attendance = nil
+	}
+}
+
+// missing returns the expected owner IDs without a client in the room,
+// sorted. It must be called with r.mu held.
+func (r *Room) missing() []string {
+	var ids []string
+	for owner, client := range r.expected {
+		if _, ok := r.players[client]; client == "" || !ok {
+			ids = append(ids, owner)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// attendees returns the client IDs of the expected players in the room,
+// sorted.
+func (r *Room) attendees() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []string
+	for _, client := range r.expected {
+		if _, ok := r.players[client]; client != "" && ok {
+			ids = append(ids, client)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// NewMatch creates a private match that only expectedUserIDs may join or
+// subscribe to, for scheduled or ranked games. Its game starts as soon as
+// they have all joined, players joining later are rejected. The ones who
+// don't show up within Config.Attendance.Timeout are handled by its NoShow
+// policy.
+func (s *Server) NewMatch(expectedUserIDs []string) (*Room, error) {
+	if err := s.acceptGames(); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(expectedUserIDs))
+	var expected []string
+	for _, id := range expectedUserIDs {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			expected = append(expected, id)
+		}
+	}
+	if len(expected) == 0 || len(expected) < s.config.Room.MinPlayers {
+		return nil, fmt.Errorf("%w: %d, %d needed", ErrTooFewExpected, len(expected), s.config.Room.MinPlayers)
+	}
+	r, err := s.rooms.CreateExpectedMatch(expected)
+	if err != nil {
+		return nil, err
+	}
+	if timeout := s.config.Attendance.Timeout; timeout > 0 {
+		r.awaitAttendance(timeout, func(missing []string) { s.noShow(r, missing) })
+	}
+	log.Info().Msgf("room %s: expecting %v", r.ID, expected)
+	return r, nil
+}
+
+// arrive starts the game of a match of expected players once the last of
+// them joined with client.
+func (s *Server) arrive(client *centrifuge.Client, r *Room) {
+	if !r.arrive(ownerID(client), client.ID()) {
+		return
+	}
+	log.Info().Msgf("room %s: every expected player joined", r.ID)
+	if err := s.startExpected(r); err != nil {
+		log.Warn().Msgf("room %s: expected game can't start: %s", r.ID, err.Error())
+	}
+}
+
+// startExpected seats the expected players in r ready and starts the game.
+func (s *Server) startExpected(r *Room) error {
+	for _, id := range r.attendees() {
+		p, ok := s.players.Get(id)
+		if !ok {
+			continue
+		}
+		if p.FSM.Current() != playerReady {
+			if err := p.FSM.Fire(eventReady); err != nil {
+				log.Warn().Msgf("room %s: expected player %s can't get ready: %s", r.ID, id, err.Error())
+				continue
+			}
+		}
+		r.SetReady(id, true)
+	}
+	return r.Start()
+}
+
+// noShow applies the NoShow policy to r, whose missing players didn't join
+// in time.
+func (s *Server) noShow(r *Room, missing []string) {
+	log.Info().Msgf("room %s: %v didn't show up", r.ID, missing)
+	if s.config.Attendance.NoShow == NoShowStart {
+		err := s.startExpected(r)
+		if err == nil {
+			return
+		}
+		log.Warn().Msgf("room %s: can't start short-handed: %s", r.ID, err.Error())
+	}
+	s.cancelMatch(r, missing)
+}
+
+// cancelMatch sends the players of r back to idle and destroys it.
+func (s *Server) cancelMatch(r *Room, missing []string) {
+	_ = s.publishMessage(r.Channel(), msgMatchCancelled, matchCancelled{Room: r.ID, Missing: missing})
+	for _, id := range r.Players() {
+		_ = s.rooms.LeaveRoom(r.ID, id)
+		if p, ok := s.players.Get(id); ok && p.Room() == r.ID {
+			p.SetRoom("")
+			if err := p.FSM.Fire(eventReset); err != nil {
+				log.Warn().Msgf("room %s: player %s can't reset: %s", r.ID, id, err.Error())
+			}
+		}
+	}
+	s.rooms.DestroyRoom(r.ID)
+	log.Info().Msgf("room %s: match cancelled", r.ID)
+}
+
+type scheduleMatchRequest struct {
+	Players []string `json:"players"`
+}
+
+type scheduleMatchReply struct {
+	Room     string       `json:"room"`
+	Channel  string       `json:"channel"`
+	Chat     string       `json:"chat"`
+	Channels RoomChannels `json:"channels"`
+	Players  []string     `json:"players"`
+}
+
+// rpcScheduleMatch lets admins create a match of expected players with
+// NewMatch. The players then join it with joinRoom.
+func (s *Server) rpcScheduleMatch(client *centrifuge.Client, data []byte) ([]byte, error) {
+	if !s.isAdmin(client) {
+		return nil, centrifuge.ErrorPermissionDenied
+	}
+	var req scheduleMatchRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, centrifuge.ErrorBadRequest
+	}
+	r, err := s.NewMatch(req.Players)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(scheduleMatchReply{Room: r.ID, Channel: r.Channel(), Chat: r.ChatChannel(), Channels: r.Channels(), Players: r.Expected()})
+}
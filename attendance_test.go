@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// scheduleMatch schedules a match of players as the admin of h.
+func scheduleMatch(t *testing.T, h *TestHarness, players ...string) *Room {
+	t.Helper()
+	var reply scheduleMatchReply
+	call(t, connect(t, h, "admin"), "scheduleMatch", scheduleMatchRequest{Players: players}, &reply)
+	r, ok := h.Server.rooms.Room(reply.Room)
+	if !ok {
+		t.Fatalf("match %s not found", reply.Room)
+	}
+	return r
+}
+
+func attendanceHarness(t *testing.T, policy NoShowPolicy) *TestHarness {
+	return newHarness(t, func(c *Config) {
+		c.AdminUsers = []string{"admin"}
+		c.Room.MinPlayers = 2
+		c.Attendance = AttendanceConfig{Timeout: time.Minute, NoShow: policy}
+	})
+}
+
+func TestOnlyAdminsScheduleMatches(t *testing.T) {
+	h := attendanceHarness(t, NoShowCancel)
+	c := connect(t, h, "alice")
+	if code := callError(t, c, "scheduleMatch", scheduleMatchRequest{Players: []string{"alice", "bob"}}); code != CodePermissionDenied {
+		t.Errorf("scheduleMatch from a player: code %d, want %d", code, CodePermissionDenied)
+	}
+}
+
+func TestMatchStartsOnceEveryoneArrived(t *testing.T) {
+	h := attendanceHarness(t, NoShowCancel)
+	r := scheduleMatch(t, h, "alice", "bob")
+	if code := callError(t, connect(t, h, "mallory"), "joinRoom", roomRequest{Room: r.ID}); code != CodePermissionDenied {
+		t.Errorf("join of an unexpected user: code %d, want %d", code, CodePermissionDenied)
+	}
+
+	call(t, connect(t, h, "alice"), "joinRoom", roomRequest{Room: r.ID}, nil)
+	if state := r.Game.Current(); state != gameLobby {
+		t.Fatalf("game %s with bob missing, want %s", state, gameLobby)
+	}
+	call(t, connect(t, h, "bob"), "joinRoom", roomRequest{Room: r.ID}, nil)
+	if state := r.Game.Current(); state != gamePlaying {
+		t.Fatalf("game %s once everyone arrived, want %s", state, gamePlaying)
+	}
+
+	// Past the timeout, nothing happens to the started game, which no one
+	// joins anymore.
+	h.Clock.Advance(time.Minute)
+	if state := r.Game.Current(); state != gamePlaying {
+		t.Errorf("game %s after the attendance timeout, want %s", state, gamePlaying)
+	}
+	if code := callError(t, connect(t, h, "alice"), "joinRoom", roomRequest{Room: r.ID}); code != CodeMatchStarted {
+		t.Errorf("late join: code %d, want %d", code, CodeMatchStarted)
+	}
+}
+
+func TestNoShowCancelsTheMatch(t *testing.T) {
+	h := attendanceHarness(t, NoShowCancel)
+	r := scheduleMatch(t, h, "alice", "bob")
+	alice := connect(t, h, "alice")
+	call(t, alice, "joinRoom", roomRequest{Room: r.ID}, nil)
+
+	h.Clock.Advance(time.Minute - time.Millisecond)
+	if _, ok := h.Server.rooms.Room(r.ID); !ok {
+		t.Fatal("match cancelled before the attendance timeout")
+	}
+	h.Clock.Advance(time.Millisecond)
+	if _, ok := h.Server.rooms.Room(r.ID); ok {
+		t.Error("match not cancelled after the attendance timeout")
+	}
+	if p, _ := h.Server.players.Get(alice.ID); p.Room() != "" || p.FSM.Current() != playerIdle {
+		t.Errorf("attendee in room %q, %s after the cancellation", p.Room(), p.FSM.Current())
+	}
+}
+
+func TestNoShowStartsShortHanded(t *testing.T) {
+	h := attendanceHarness(t, NoShowStart)
+	r := scheduleMatch(t, h, "alice", "bob", "carol")
+	for _, user := range []string{"alice", "bob"} {
+		call(t, connect(t, h, user), "joinRoom", roomRequest{Room: r.ID}, nil)
+	}
+	h.Clock.Advance(time.Minute)
+	if state := r.Game.Current(); state != gamePlaying {
+		t.Fatalf("game %s after the attendance timeout, want %s", state, gamePlaying)
+	}
+	if got := len(r.TurnOrder()); got != 2 {
+		t.Errorf("%d players in the turn order, want 2", got)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/centrifugal/centrifuge"
+	"github.com/rs/zerolog"
+)
+
+// AuditSink selects where the audit records of admin actions are written.
+type AuditSink string
+
+const (
+	// AuditStdout writes the records to the standard output.
+	AuditStdout AuditSink = "stdout"
+	// AuditFile appends the records to AuditConfig.Path.
+	AuditFile AuditSink = "file"
+	// AuditNone discards the records.
+	AuditNone AuditSink = "none"
+)
+
+// AuditConfig holds the settings of the audit log.
+type AuditConfig struct {
+	// Sink is AuditStdout when empty.
+	Sink AuditSink
+	// Path is the file of AuditFile, created if needed.
+	Path string
+	// Writer, when set, receives the records instead of Sink, e.g. to ship
+	// them elsewhere.
+	Writer io.Writer
+}
+
+func (c AuditConfig) validate() error {
+	switch c.Sink {
+	case "", AuditStdout, AuditNone:
+		return nil
+	case AuditFile:
+		if c.Path == "" {
+			return errors.New("audit file sink without a path")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown audit sink %q", c.Sink)
+}
+
+// newAuditLogger returns the logger of the audit records, one JSON object
+// per line, and the file to close on shutdown, if any.
+func newAuditLogger(config AuditConfig) (zerolog.Logger, io.Closer, error) {
+	switch {
+	case config.Writer != nil:
+		return zerolog.New(config.Writer), nil, nil
+	case config.Sink == AuditNone:
+		return zerolog.Nop(), nil, nil
+	case config.Sink == AuditFile:
+		f, err := os.OpenFile(config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return zerolog.Nop(), nil, fmt.Errorf("error opening audit log: %w", err)
+		}
+		return zerolog.New(f), f, nil
+	}
+	return zerolog.New(os.Stdout), nil, nil
+}
+
+// Outcomes of audited actions.
+const (
+	auditOK     = "ok"
+	auditDenied = "denied"
+	auditFailed = "failed"
+)
+
+// auditTarget returns the target of an audited call of client with data,
+// and false if the call isn't an admin action.
+type auditTarget func(client *centrifuge.Client, data []byte) (string, bool)
+
+// auditedRPCs are the admin RPC methods and how to find their target.
+var auditedRPCs = map[string]auditTarget{
+	"reset":         auditOtherPlayer,
+	"traceClient":   auditField(func(r traceRequest) string { return r.Client }),
+	"scheduleMatch": auditField(func(r scheduleMatchRequest) string { return strings.Join(r.Players, ",") }),
+	"dump":          auditServer,
+	"announce":      auditServer,
+	"maintenance":   auditServer,
+}
+
+// auditServer targets the whole server.
+func auditServer(*centrifuge.Client, []byte) (string, bool) {
+	return "server", true
+}
+
+// auditOtherPlayer audits the calls acting on another player than the
+// caller's, which only admins may do.
+func auditOtherPlayer(client *centrifuge.Client, data []byte) (string, bool) {
+	var req playerRequest
+	_ = json.Unmarshal(data, &req)
+	return req.Player, req.Player != "" && req.Player != client.ID()
+}
+
+// auditField targets the field of the request R returned by field.
+func auditField[R any](field func(R) string) auditTarget {
+	return func(_ *centrifuge.Client, data []byte) (string, bool) {
+		var req R
+		_ = json.Unmarshal(data, &req)
+		return field(req), true
+	}
+}
+
+// withAudit records the calls of the method for which target reports an
+// admin action.
+func withAudit(target auditTarget) rpcOption {
+	return func(m *rpcMethod) {
+		m.audit = target
+	}
+}
+
+// auditRPC writes the audit record of an admin RPC: who called it, with
+// which parameters, on what target, and whether it succeeded.
+func (s *Server) auditRPC(client *centrifuge.Client, method string, data []byte, target string, err error) {
+	ev := s.audit.Log().
+		Timestamp().
+		Str("action", method).
+		Str("user", client.UserID()).
+		Str("client", client.ID()).
+		Str("target", target)
+	if json.Valid(data) {
+		ev = ev.RawJSON("params", data)
+	}
+	switch {
+	case err == nil:
+		ev = ev.Str("outcome", auditOK)
+	case errors.Is(err, centrifuge.ErrorPermissionDenied):
+		ev = ev.Str("outcome", auditDenied)
+	default:
+		ev = ev.Str("outcome", auditFailed).Str("error", err.Error())
+	}
+	ev.Send()
+}
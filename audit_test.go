@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// auditBuffer collects the audit records written to it.
+type auditBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *auditBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// records decodes the records written so far.
+func (b *auditBuffer) records(t *testing.T) []map[string]any {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("audit record %s: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestAdminActionsAudited(t *testing.T) {
+	sink := &auditBuffer{}
+	h := newHarness(t, func(c *Config) {
+		c.AdminUsers = []string{"admin"}
+		c.Audit.Writer = sink
+	})
+	admin := connect(t, h, "admin")
+	player := connect(t, h, "player")
+	// Calls that aren't admin actions aren't audited.
+	call(t, player, "reset", nil, nil)
+	call(t, player, "state", nil, nil)
+	if n := len(sink.records(t)); n != 0 {
+		t.Errorf("%d audit records of player calls, want none", n)
+	}
+
+	for _, tc := range []struct {
+		client  *HarnessClient
+		method  string
+		req     any
+		target  string
+		outcome string
+	}{
+		{admin, "announce", announceRequest{Message: "hello"}, "server", auditOK},
+		{admin, "maintenance", maintenanceRequest{On: false}, "server", auditOK},
+		{admin, "dump", dumpRequest{}, "server", auditOK},
+		{admin, "traceClient", traceRequest{Client: player.ID}, player.ID, auditOK},
+		{admin, "reset", playerRequest{Player: player.ID}, player.ID, auditOK},
+		{admin, "scheduleMatch", scheduleMatchRequest{Players: []string{"alice", "bob"}}, "alice,bob", auditOK},
+		{player, "announce", announceRequest{Message: "hi"}, "server", auditDenied},
+		{admin, "announce", announceRequest{}, "server", auditFailed},
+	} {
+		before := len(sink.records(t))
+		_, _ = tc.client.RPC(tc.method, tc.req)
+		records := sink.records(t)
+		if len(records) != before+1 {
+			t.Errorf("%s by %s: %d audit records, want 1", tc.method, tc.client.ID, len(records)-before)
+			continue
+		}
+		rec := records[before]
+		user := "admin"
+		if tc.client == player {
+			user = "player"
+		}
+		if rec["action"] != tc.method || rec["user"] != user || rec["client"] != tc.client.ID ||
+			rec["target"] != tc.target || rec["outcome"] != tc.outcome || rec["time"] == nil {
+			t.Errorf("%s audit record %v, want target %s and outcome %s", tc.method, rec, tc.target, tc.outcome)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// Authentication backends selectable in AuthConfig.
+const (
+	AuthAnonymous = "anonymous"
+	AuthAPIKey    = "apikey"
+	AuthJWT       = "jwt"
+)
+
+// ErrUnauthenticated is returned by authenticators rejecting a request.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// AuthConfig selects and configures the authentication backend.
+type AuthConfig struct {
+	// Backend is one of AuthAnonymous (default), AuthAPIKey or AuthJWT.
+	Backend string
+	// APIKeys maps API keys to user IDs for AuthAPIKey.
+	APIKeys map[string]string
+	// JWTSecret is the HMAC SHA-256 secret of AuthJWT tokens.
+	JWTSecret string
+}
+
+// Authenticator extracts the credentials of a connection request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*centrifuge.Credentials, error)
+}
+
+// NewAuthenticator returns the backend selected by config.
+func NewAuthenticator(config AuthConfig) (Authenticator, error) {
+	switch config.Backend {
+	case "", AuthAnonymous:
+		return AnonymousAuthenticator{}, nil
+	case AuthAPIKey:
+		return APIKeyAuthenticator{Keys: config.APIKeys}, nil
+	case AuthJWT:
+		if config.JWTSecret == "" {
+			return nil, errors.New("jwt authentication requires a secret")
+		}
+		return JWTAuthenticator{Secret: []byte(config.JWTSecret)}, nil
+	default:
+		return nil, fmt.Errorf("unknown authentication backend %q", config.Backend)
+	}
+}
+
+// AnonymousAuthenticator accepts every request as an anonymous user.
+type AnonymousAuthenticator struct{}
+
+// Authenticate implements Authenticator.
+func (AnonymousAuthenticator) Authenticate(_ *http.Request) (*centrifuge.Credentials, error) {
+	// Users with empty ID called anonymous users, in real app you should
+	// decide whether anonymous users allowed to connect to your server or not.
+	return &centrifuge.Credentials{UserID: ""}, nil
+}
+
+// APIKeyAuthenticator maps a static API key, sent in the X-API-Key header or
+// the api_key query parameter, to a user ID.
+type APIKeyAuthenticator struct {
+	Keys map[string]string
+}
+
+// Authenticate implements Authenticator.
+func (a APIKeyAuthenticator) Authenticate(r *http.Request) (*centrifuge.Credentials, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = r.URL.Query().Get("api_key")
+	}
+	userID, ok := a.Keys[key]
+	if key == "" || !ok {
+		return nil, fmt.Errorf("%w: invalid api key", ErrUnauthenticated)
+	}
+	return &centrifuge.Credentials{UserID: userID}, nil
+}
+
+// JWTAuthenticator verifies HS256 JWTs sent as a Bearer token in the
+// Authorization header or in the token query parameter. The user ID is
+// taken from the sub claim.
+type JWTAuthenticator struct {
+	Secret []byte
+}
+
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// Authenticate implements Authenticator.
+func (a JWTAuthenticator) Authenticate(r *http.Request) (*centrifuge.Credentials, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	return a.VerifyToken(token)
+}
+
+// VerifyToken implements TokenVerifier.
+func (a JWTAuthenticator) VerifyToken(token string) (*centrifuge.Credentials, error) {
+	claims, err := a.verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnauthenticated, err.Error())
+	}
+	return &centrifuge.Credentials{UserID: claims.Subject, ExpireAt: claims.ExpiresAt}, nil
+}
+
+func (a JWTAuthenticator) verify(token string) (jwtClaims, error) {
+	var claims jwtClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return claims, errors.New("unsupported token header")
+	}
+
+	mac := hmac.New(sha256.New, a.Secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, mac.Sum(nil)) {
+		return claims, errors.New("invalid signature")
+	}
+
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return claims, errors.New("malformed claims")
+	}
+	if claims.ExpiresAt > 0 && time.Now().Unix() >= claims.ExpiresAt {
+		return claims, errors.New("token expired")
+	}
+	if claims.Subject == "" {
+		return claims, errors.New("missing subject")
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// auth puts the credentials returned by a and the ConnMeta of the request
+// into the request context, rejecting the connection when authentication
+// fails.
+func auth(a Authenticator, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cred, err := a.Authenticate(r)
+		if err != nil {
+			log.Warn().Msgf("authentication failed from %s: %s", r.RemoteAddr, err.Error())
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// Put authentication Credentials into request Context.
+		ctx := centrifuge.SetCredentials(r.Context(), cred)
+		r = r.WithContext(WithConnMeta(ctx, connMetaFromRequest(r)))
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// signJWT returns an HS256 token of claims signed with secret.
+func signJWT(secret string, claims jwtClaims) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	body := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":%q,"exp":%d}`, claims.Subject, claims.ExpiresAt)))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(header + "." + body))
+	return header + "." + body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthenticators(t *testing.T) {
+	const secret = "secret"
+	apiKeys := AuthConfig{Backend: AuthAPIKey, APIKeys: map[string]string{"key1": "alice"}}
+	jwt := AuthConfig{Backend: AuthJWT, JWTSecret: secret}
+	later := time.Now().Add(time.Hour).Unix()
+	for _, tc := range []struct {
+		name   string
+		config AuthConfig
+		header string
+		value  string
+		user   string // empty with err for a rejected request
+		err    error
+	}{
+		{"anonymous", AuthConfig{}, "", "", "", nil},
+		{"valid api key", apiKeys, "X-API-Key", "key1", "alice", nil},
+		{"invalid api key", apiKeys, "X-API-Key", "key2", "", ErrUnauthenticated},
+		{"valid jwt", jwt, "Authorization", "Bearer " + signJWT(secret, jwtClaims{Subject: "bob", ExpiresAt: later}), "bob", nil},
+		{"expired jwt", jwt, "Authorization", "Bearer " + signJWT(secret, jwtClaims{Subject: "bob", ExpiresAt: time.Now().Add(-time.Minute).Unix()}), "", ErrUnauthenticated},
+		{"wrong signature", jwt, "Authorization", "Bearer " + signJWT("other", jwtClaims{Subject: "bob", ExpiresAt: later}), "", ErrUnauthenticated},
+		{"missing header", jwt, "", "", "", ErrUnauthenticated},
+	} {
+		a, err := NewAuthenticator(tc.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", "/connection/websocket", nil)
+		if tc.header != "" {
+			r.Header.Set(tc.header, tc.value)
+		}
+		cred, err := a.Authenticate(r)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: error %v, want %v", tc.name, err, tc.err)
+			continue
+		}
+		if err == nil && cred.UserID != tc.user {
+			t.Errorf("%s: user %q, want %q", tc.name, cred.UserID, tc.user)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// isAdmin reports whether client has the admin role.
+func (s *Server) isAdmin(client *centrifuge.Client) bool {
+	if client.UserID() == "" {
+		return false
+	}
+	for _, id := range s.config.AdminUsers {
+		if id == client.UserID() {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeRoom denies clients access to private matches they aren't
+// invited to, unless they are admins.
+func (s *Server) authorizeRoom(client *centrifuge.Client, r *Room) error {
+	if r.Invited(ownerID(client)) || s.isAdmin(client) {
+		return nil
+	}
+	log.Warn().Msgf("client %s denied access to room %s", client.ID(), r.ID)
+	return centrifuge.ErrorPermissionDenied
+}
+
+// authorize returns the player targetID if client is allowed to drive it:
+// clients may only act on their own player unless they are admins. An
+// empty targetID designates the client's own player.
+func (s *Server) authorize(client *centrifuge.Client, targetID string) (*Player, error) {
+	if targetID == "" {
+		targetID = client.ID()
+	}
+	if targetID != client.ID() && !s.isAdmin(client) {
+		log.Warn().Msgf("client %s denied access to player %s", client.ID(), targetID)
+		return nil, centrifuge.ErrorPermissionDenied
+	}
+	p, ok := s.players.Get(targetID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPlayerNotFound, targetID)
+	}
+	return p, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestPlayersCantDriveOthers(t *testing.T) {
+	h := newHarness(t, nil)
+	alice := connect(t, h, "alice")
+	bob := connect(t, h, "bob")
+	p, _ := h.Server.players.Get(alice.ID)
+
+	for _, method := range []string{"ready", "move", "reset", "state"} {
+		if code := callError(t, bob, method, playerRequest{Player: alice.ID}); code != CodePermissionDenied {
+			t.Errorf("%s of another player: code %d, want %d", method, code, CodePermissionDenied)
+		}
+	}
+	if p.FSM.Current() != playerIdle {
+		t.Errorf("player of alice %s, want %s", p.FSM.Current(), playerIdle)
+	}
+	var reply playerReply
+	call(t, alice, "state", nil, &reply)
+	if reply.Player != alice.ID {
+		t.Errorf("own state of %s, want %s", reply.Player, alice.ID)
+	}
+}
+
+func TestAdminsDriveAnyPlayer(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.AdminUsers = []string{"admin"} })
+	alice := connect(t, h, "alice")
+	admin := connect(t, h, "admin")
+
+	var reply playerReply
+	call(t, admin, "ready", playerRequest{Player: alice.ID}, &reply)
+	if reply.Player != alice.ID || reply.State != playerReady {
+		t.Errorf("admin ready: %+v, want %s %s", reply, alice.ID, playerReady)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// BotDecider is the strategy of a bot: it is called with every message the
+// bot receives, once its machine is updated, and reacts by calling RPCs
+// through the bot. It plays by the difficulty and the parameters of
+// Bot.Strategy, assigned by the server.
+type BotDecider func(b *Bot, msg Message)
+
+// Bot plays with a GameClient. Its FSM mirrors the server player FSM: it is
+// driven by the game events received and by the player RPCs that succeed,
+// so deciders can tell what the player may do next.
+type Bot struct {
+	FSM StateMachine
+
+	client  *GameClient
+	decide  BotDecider
+	timeout time.Duration
+
+	// calls is read-locked by the RPCs in flight, so that events they
+	// cause are handled once the FSM is updated with their result.
+	calls    sync.RWMutex
+	mu       sync.Mutex
+	room     string
+	depth    uint32   // of the message being decided on
+	strategy Strategy // see FetchStrategy
+}
+
+// botCallTimeout bounds the RPCs of bots.
+const botCallTimeout = 5 * time.Second
+
+// NewBot makes client play with decide, starting with a NewPlayerFSM.
+func NewBot(client *GameClient, decide BotDecider) *Bot {
+	b := &Bot{
+		FSM:     NewPlayerFSM(),
+		client:  client,
+		decide:  decide,
+		timeout: botCallTimeout,
+	}
+	client.OnAnyEvent(b.handle)
+	return b
+}
+
+// ID returns the client ID of the bot.
+func (b *Bot) ID() string {
+	return b.client.ID()
+}
+
+// Room returns the ID of the room the bot joined, if any.
+func (b *Bot) Room() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.room
+}
+
+// Call calls the RPC method with data encoded as JSON. A successful player
+// event, such as ready or move, is fired on the bot FSM too. Calls made by
+// the decider carry the causation depth of the message it decides on.
+func (b *Bot) Call(method string, data any) ([]byte, error) {
+	var raw []byte
+	if data != nil {
+		var err error
+		if raw, err = json.Marshal(data); err != nil {
+			return nil, err
+		}
+	}
+	b.mu.Lock()
+	depth := b.depth
+	b.mu.Unlock()
+	raw, err := withCausationDepth(raw, depth)
+	if err != nil {
+		return nil, err
+	}
+	b.calls.RLock()
+	defer b.calls.RUnlock()
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	res, err := b.client.RPC(ctx, method, raw)
+	if err != nil {
+		b.client.log.Warn().Msgf("bot %s: %s failed: %s", b.ID(), method, err.Error())
+		return nil, err
+	}
+	switch method {
+	case eventReady, eventMove, eventForfeit, eventReset:
+		b.fire(method)
+	}
+	return res.Data, nil
+}
+
+// Join joins roomID and subscribes to its channel, then fetches the
+// strategy of the bot in the room.
+func (b *Bot) Join(roomID string) error {
+	data, err := b.Call("joinRoom", roomRequest{Room: roomID})
+	if err != nil {
+		return err
+	}
+	var reply roomReply
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.room = reply.Room
+	b.mu.Unlock()
+	b.client.subscribe(reply.Channel)
+	if _, err := b.FetchStrategy(); err != nil {
+		b.client.log.Warn().Msgf("bot %s: no strategy in room %s, keeping the previous one: %s", b.ID(), reply.Room, err.Error())
+	}
+	return nil
+}
+
+// handle updates the bot FSM from msg, then lets the decider react to it.
+func (b *Bot) handle(msg Message) {
+	// Wait for the calls in flight.
+	b.calls.Lock()
+	b.calls.Unlock()
+	if msg.Type == msgGameState {
+		var ev gameStateEvent
+		// The server makes the ready players play when their game starts.
+		if err := json.Unmarshal(msg.Payload, &ev); err == nil && ev.Room == b.Room() && ev.To == gamePlaying {
+			b.fire(eventPlay)
+		}
+	}
+	b.mu.Lock()
+	b.depth = msg.Depth
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.depth = 0
+		b.mu.Unlock()
+	}()
+	b.decide(b, msg)
+}
+
+// fire fires event on the bot FSM if it can, the server being the
+// authority on the player state.
+func (b *Bot) fire(event string) {
+	if !b.FSM.CanFire(event) {
+		return
+	}
+	if err := b.FSM.Fire(event); err != nil {
+		b.client.log.Warn().Msgf("bot %s: %s", b.ID(), err.Error())
+	}
+}
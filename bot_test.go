@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// servedClient connects a GameClient to the WebSocket endpoint of h,
+// authenticated as main does.
+func servedClient(t *testing.T, h *TestHarness) *GameClient {
+	t.Helper()
+	authenticator, err := NewAuthenticator(h.Server.config.Auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(auth(authenticator, h.Server.WebsocketHandler()))
+	t.Cleanup(ts.Close)
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/connection/websocket"
+	c, err := newClient(&log, url, h.Server.config.Client, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the client to connect", func() bool { return c.ID() != "" })
+	return c
+}
+
+func TestScriptedBotsPlayAGame(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.Referees = 0
+		c.Room.MinPlayers = 2
+	})
+	// Each bot plays three moves on its turns, the first one to be done
+	// forfeits on its next turn, which ends the game.
+	var mu sync.Mutex
+	moves := make(map[string]int)
+	decide := func(b *Bot, msg Message) {
+		var ev gameStateEvent
+		if msg.Type != msgGameState || json.Unmarshal(msg.Payload, &ev) != nil {
+			return
+		}
+		if ev.Turn != b.ID() || b.FSM.Current() != playerPlaying {
+			return
+		}
+		mu.Lock()
+		n := moves[b.ID()]
+		moves[b.ID()]++
+		mu.Unlock()
+		if n < 3 {
+			_, _ = b.Call("move", moveRequest{Move: json.RawMessage(fmt.Sprintf(`{"cell":%d}`, n))})
+			return
+		}
+		_, _ = b.Call("forfeit", nil)
+	}
+
+	var bots []*Bot
+	for i := 0; i < 2; i++ {
+		bots = append(bots, NewBot(servedClient(t, h), decide))
+	}
+	var room roomReply
+	data, err := bots[0].Call("createRoom", createRoomRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &room); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range bots {
+		if err := b.Join(room.Room); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, "the room subscription", func() bool { return subscribed(h, b.ID(), room.Channel) })
+		if _, err := b.Call("ready", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, ok := h.Server.rooms.Room(room.Room)
+	if !ok {
+		t.Fatalf("room %s not found", room.Room)
+	}
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "the game to finish", func() bool { return r.Game.Current() == gameFinished })
+	var forfeited []string
+	for _, b := range bots {
+		p, _ := h.Server.players.Get(b.ID())
+		if p.FSM.Current() == playerForfeited {
+			forfeited = append(forfeited, b.ID())
+			// The bot machine follows the server one once the RPC returns.
+			eventually(t, "the bot to forfeit", func() bool { return b.FSM.Current() == playerForfeited })
+		}
+	}
+	if len(forfeited) != 1 {
+		t.Errorf("forfeited players %v, want one", forfeited)
+	}
+	if moves := r.GameState(bots[0].ID()).Moves; len(moves) != 6 {
+		t.Errorf("%d moves played, want 6", len(moves))
+	}
+}
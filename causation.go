@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// ErrCausationDepth is returned to RPCs whose causation chain is deeper
+// than Config.MaxCausationDepth.
+var ErrCausationDepth = errors.New("causation depth exceeded")
+
+// causationDepth returns the depth field of an RPC payload: the Depth of
+// the message the call reacts to, zero for spontaneous calls.
+func causationDepth(data []byte) uint32 {
+	if len(data) == 0 || data[0] != '{' {
+		return 0
+	}
+	var req struct {
+		Depth uint32 `json:"depth"`
+	}
+	_ = json.Unmarshal(data, &req)
+	return req.Depth
+}
+
+// withCausationDepth sets the depth field of an RPC payload, which must be
+// empty or a JSON object.
+func withCausationDepth(data []byte, depth uint32) ([]byte, error) {
+	if depth == 0 {
+		return data, nil
+	}
+	fields := make(map[string]json.RawMessage)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, fmt.Errorf("rpc payload is not an object, depth not set: %w", err)
+		}
+	}
+	fields["depth"] = json.RawMessage(fmt.Sprint(depth))
+	return json.Marshal(fields)
+}
+
+// checkDepth refuses calls that would publish messages deeper than
+// maxDepth, cutting feedback loops between the server and its clients.
+func (d *rpcDispatcher) checkDepth(client *centrifuge.Client, method string, depth uint32) error {
+	if d.maxDepth <= 0 || depth < uint32(d.maxDepth) {
+		return nil
+	}
+	log.Warn().Msgf("client %s RPC %s cut off at causation depth %d", client.ID(), method, depth)
+	return fmt.Errorf("%w: %d, the limit is %d", ErrCausationDepth, depth, d.maxDepth)
+}
+
+// causeDepth makes the messages published on the room channel of client
+// carry depth until the returned function is called, typically while one
+// of its RPCs is handled.
+func (s *Server) causeDepth(client *centrifuge.Client, depth uint32) func() {
+	p, ok := s.players.Get(client.ID())
+	if !ok {
+		return func() {}
+	}
+	r, ok := s.rooms.Room(p.Room())
+	if !ok {
+		return func() {}
+	}
+	r.seqMu.Lock()
+	r.causes[depth]++
+	r.seqMu.Unlock()
+	return func() {
+		r.seqMu.Lock()
+		defer r.seqMu.Unlock()
+		if r.causes[depth]--; r.causes[depth] <= 0 {
+			delete(r.causes, depth)
+		}
+	}
+}
+
+// causedDepth returns the deepest causation depth of the RPCs being
+// handled for the room. Concurrent calls make it conservative: a message
+// gets the depth of the deepest one. It must be called with r.seqMu held.
+func (r *Room) causedDepth() uint32 {
+	var depth uint32
+	for d := range r.causes {
+		if d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestFeedbackLoopCutOff(t *testing.T) {
+	const max = 3
+	h := newHarness(t, func(c *Config) { c.MaxCausationDepth = max })
+	r, players := startGame(t, h, 2)
+	for _, c := range players {
+		if err := c.Subscribe(r.Channel()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each player answers the move of the other with a move, as a bot
+	// would, passing the depth of the message it reacts to.
+	var depth uint32
+	moves := 0
+	for i := 0; ; i++ {
+		c := players[i%2]
+		if _, err := c.RPC("move", map[string]any{"depth": depth}); err != nil {
+			if code := errorCode(err); code != CodeCausationDepth {
+				t.Fatalf("move %d: %v, want code %d", i, err, CodeCausationDepth)
+			}
+			break
+		}
+		moves++
+		// Both get the broadcast, the other player reacts to it.
+		nextMessage(t, c, "rpc.move")
+		next := nextMessage(t, players[(i+1)%2], "rpc.move").Message.Depth
+		if next != depth+1 {
+			t.Fatalf("move at depth %d broadcast at depth %d, want %d", depth, next, depth+1)
+		}
+		depth = next
+	}
+	if moves != max || depth != max {
+		t.Errorf("loop cut off after %d moves at depth %d, want %d", moves, depth, max)
+	}
+
+	// Spontaneous calls go on.
+	if _, err := players[moves%2].RPC("move", moveRequest{}); err != nil {
+		t.Errorf("move without a cause: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ErrUnknownChannel is returned when publishing to a channel matching none
+// of the configured patterns.
+var ErrUnknownChannel = errors.New("unknown channel")
+
+// channelMatcher matches channel names against path.Match patterns such as
+// "game:*".
+type channelMatcher []string
+
+func newChannelMatcher(patterns []string) (channelMatcher, error) {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid channel pattern %q: %w", p, err)
+		}
+	}
+	return channelMatcher(patterns), nil
+}
+
+// check returns ErrUnknownChannel if channel matches no pattern.
+func (m channelMatcher) check(channel string) error {
+	for _, p := range m {
+		if ok, _ := path.Match(p, channel); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q matches none of %v", ErrUnknownChannel, channel, []string(m))
+}
+
+// ErrInvalidChannel is returned to clients subscribing to a channel of none
+// of the formats of channelFormats.
+var ErrInvalidChannel = errors.New("invalid channel")
+
+// channelKind is the format of a channel name.
+type channelKind string
+
+const (
+	channelLobby    channelKind = "lobby"
+	channelRoom     channelKind = "room"
+	channelChat     channelKind = "chat"
+	channelPresence channelKind = "presence"
+	channelUser     channelKind = "user"
+	channelMonitor  channelKind = "monitor"
+)
+
+// channelFormatList describes the formats accepted by channelFormats.parse
+// in its errors.
+const channelFormatList = "a lobby channel, game:<room>, game:<room>:chat, game:<room>:presence, " + errorChannelPrefix + "<user> or " + monitorNamespace + "<name>"
+
+var (
+	// channelIDPattern matches room IDs and monitor channel names.
+	channelIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+	// userIDPattern matches the user IDs of error channels.
+	userIDPattern = regexp.MustCompile(`^[^\s\x00-\x1f\x7f#]{1,256}$`)
+)
+
+// channelInfo is a channel name parsed by channelFormats.parse.
+type channelInfo struct {
+	kind channelKind
+	// room is the room ID of the room, chat and presence channels.
+	room string
+	// user is the user ID of the user channels.
+	user string
+}
+
+// channelFormats are the formats of the channels clients may subscribe to:
+// the lobby channels of the roles and stats, the room channels game:<room>
+// with their :chat and :presence subchannels, the error channels of the
+// users and the monitor channels. Subscriptions are checked against them
+// before being authorized.
+type channelFormats struct {
+	lobby map[string]bool
+}
+
+func newChannelFormats(config Config) channelFormats {
+	lobby := map[string]bool{serverChannel: true, refereeChannel: true, playersChannel: true}
+	if config.Stats.Channel != "" {
+		lobby[config.Stats.Channel] = true
+	}
+	return channelFormats{lobby: lobby}
+}
+
+// parse returns the kind of channel and the IDs it names, or
+// ErrInvalidChannel if it has none of the known formats.
+func (f channelFormats) parse(channel string) (channelInfo, error) {
+	if f.lobby[channel] {
+		return channelInfo{kind: channelLobby}, nil
+	}
+	if info, ok := parseRoomChannel(channel); ok {
+		return info, nil
+	}
+	if user := strings.TrimPrefix(channel, errorChannelPrefix); user != channel && userIDPattern.MatchString(user) {
+		return channelInfo{kind: channelUser, user: user}, nil
+	}
+	if name := strings.TrimPrefix(channel, monitorNamespace); name != channel && channelIDPattern.MatchString(name) {
+		return channelInfo{kind: channelMonitor}, nil
+	}
+	return channelInfo{}, fmt.Errorf("%w: %q, expected %s", ErrInvalidChannel, channel, channelFormatList)
+}
+
+// parseRoomChannel parses the state, chat and presence channels of a room,
+// which don't depend on the configuration.
+func parseRoomChannel(channel string) (channelInfo, bool) {
+	rest := strings.TrimPrefix(channel, "game:")
+	if rest == channel {
+		return channelInfo{}, false
+	}
+	id, sub, found := strings.Cut(rest, ":")
+	if !channelIDPattern.MatchString(id) {
+		return channelInfo{}, false
+	}
+	switch {
+	case !found:
+		return channelInfo{kind: channelRoom, room: id}, true
+	case ":"+sub == chatSuffix:
+		return channelInfo{kind: channelChat, room: id}, true
+	case ":"+sub == presenceSuffix:
+		return channelInfo{kind: channelPresence, room: id}, true
+	}
+	return channelInfo{}, false
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestChannelFormats(t *testing.T) {
+	formats := newChannelFormats(DefaultConfig())
+	for _, tc := range []struct {
+		channel string
+		want    channelInfo
+	}{
+		{serverChannel, channelInfo{kind: channelLobby}},
+		{playersChannel, channelInfo{kind: channelLobby}},
+		{"com.jtbonhomme.stats", channelInfo{kind: channelLobby}},
+		{"game:r1", channelInfo{kind: channelRoom, room: "r1"}},
+		{"game:r1:chat", channelInfo{kind: channelChat, room: "r1"}},
+		{"game:r1:presence", channelInfo{kind: channelPresence, room: "r1"}},
+		{errorChannelPrefix + "alice@example.com", channelInfo{kind: channelUser, user: "alice@example.com"}},
+		{monitorNamespace + "rooms", channelInfo{kind: channelMonitor}},
+	} {
+		got, err := formats.parse(tc.channel)
+		if err != nil || got != tc.want {
+			t.Errorf("parse(%q) = %+v, %v, want %+v", tc.channel, got, err, tc.want)
+		}
+	}
+	for _, channel := range []string{
+		"",
+		"anything",
+		"com.jtbonhomme.other",
+		"game:",
+		"game:r1:",
+		"game:r1:voice",
+		"game:r1:chat:x",
+		"game:" + strings.Repeat("r", 65),
+		"game:r 1",
+		errorChannelPrefix,
+		errorChannelPrefix + "alice#2",
+		errorChannelPrefix + "al ice",
+		monitorNamespace,
+		monitorNamespace + "a/b",
+	} {
+		if _, err := formats.parse(channel); !errors.Is(err, ErrInvalidChannel) {
+			t.Errorf("parse(%q): %v, want %v", channel, err, ErrInvalidChannel)
+		}
+	}
+}
+
+func TestMalformedSubscriptionRejected(t *testing.T) {
+	h := newHarness(t, nil)
+	c := connect(t, h, "alice")
+	for _, channel := range []string{"anything", "game:r1:voice", errorChannelPrefix + "al ice"} {
+		if err := c.Subscribe(channel); errorCode(err) != CodeInvalidChannel {
+			t.Errorf("subscription to %q: %v, want code %d", channel, err, CodeInvalidChannel)
+		}
+	}
+	// Formats are checked before authorization.
+	if err := c.Subscribe(errorChannelPrefix + "bob"); errorCode(err) != CodePermissionDenied {
+		t.Errorf("subscription to the error channel of bob: %v, want code %d", err, CodePermissionDenied)
+	}
+	room := createRoom(t, c, createRoomRequest{}).Room
+	if err := c.Subscribe("game:" + room + ":presence"); err != nil {
+		t.Errorf("subscription to a room presence channel: %v", err)
+	}
+}
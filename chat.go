@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+var (
+	// ErrChatTooLong is returned for chat messages over ChatConfig.MaxLength.
+	ErrChatTooLong = errors.New("chat message too long")
+	// ErrChatRejected is returned for chat messages refused by the filter.
+	ErrChatRejected = errors.New("chat message rejected")
+)
+
+const (
+	chatSuffix = ":chat"
+	msgChat    = "chat.message"
+)
+
+// ChatConfig holds the moderation settings of the room chats.
+type ChatConfig struct {
+	// MaxLength is the maximum length of a message in characters. Zero
+	// means unlimited.
+	MaxLength int
+	// Filter, when set, returns the text to relay for a message of userID,
+	// e.g. with profanities masked, or an error to reject it.
+	Filter func(userID, text string) (string, error)
+}
+
+// chatMessage is the payload of msgChat. Clients only send Text, the server
+// fills in the sender.
+type chatMessage struct {
+	Client string `json:"client"`
+	User   string `json:"user,omitempty"`
+	Text   string `json:"text"`
+}
+
+// ChatChannel returns the channel the players of the room chat on.
+func (r *Room) ChatChannel() string {
+	if r.Topology() == TopologySingle {
+		return r.Channel()
+	}
+	return r.Channel() + chatSuffix
+}
+
+// chatRoomID returns the ID of the room whose chat channel is channel.
+func chatRoomID(channel string) (string, bool) {
+	info, ok := parseRoomChannel(channel)
+	return info.room, ok && info.kind == channelChat
+}
+
+// moderateChat checks that client may chat in roomID and returns the JSON
+// envelope to relay for its publication data.
+func (s *Server) moderateChat(client *centrifuge.Client, roomID string, data []byte) ([]byte, error) {
+	p, ok := s.players.Get(client.ID())
+	if !ok || p.Room() != roomID {
+		log.Warn().Msgf("client %s denied chat of room %s", client.ID(), roomID)
+		return nil, centrifuge.ErrorPermissionDenied
+	}
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Type != msgChat {
+		return nil, centrifuge.ErrorBadRequest
+	}
+	var chat chatMessage
+	if err := json.Unmarshal(msg.Payload, &chat); err != nil || chat.Text == "" {
+		return nil, centrifuge.ErrorBadRequest
+	}
+	config := s.config.Chat
+	if n := utf8.RuneCountInString(chat.Text); config.MaxLength > 0 && n > config.MaxLength {
+		return nil, clientError(fmt.Errorf("%w: %d characters, at most %d", ErrChatTooLong, n, config.MaxLength))
+	}
+	text := chat.Text
+	if config.Filter != nil {
+		var err error
+		if text, err = config.Filter(client.UserID(), text); err != nil {
+			return nil, clientError(fmt.Errorf("%w: %s", ErrChatRejected, err.Error()))
+		}
+	}
+
+	payload, err := json.Marshal(chatMessage{Client: client.ID(), User: client.UserID(), Text: text})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Message{Type: msgChat, Payload: payload})
+}
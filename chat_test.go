@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// chat publishes text to the chat of room as c.
+func chat(c *HarnessClient, room *Room, text string) error {
+	payload, _ := json.Marshal(chatMessage{Text: text})
+	return c.Publish(room.ChatChannel(), Message{Type: msgChat, Payload: payload})
+}
+
+func TestChatModeration(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.Chat.MaxLength = 5
+		c.Chat.Filter = func(_, text string) (string, error) { return strings.ReplaceAll(text, "darn", "****"), nil }
+	})
+	r, players := startGame(t, h, 2)
+	if err := players[1].Subscribe(r.ChatChannel()); err != nil {
+		t.Fatal(err)
+	}
+	outsider := connect(t, h, "outsider")
+
+	for _, tc := range []struct {
+		name   string
+		client *HarnessClient
+		text   string
+		code   ErrorCode // zero for a relayed message
+	}{
+		{"non-member", outsider, "hi", CodePermissionDenied},
+		{"too long", players[0], "hello!", CodeChatTooLong},
+		{"empty", players[0], "", CodeBadRequest},
+		{"at the limit", players[0], "héllo", 0},
+	} {
+		err := chat(tc.client, r, tc.text)
+		if tc.code == 0 {
+			if err != nil {
+				t.Errorf("%s: %s", tc.name, err)
+			}
+			continue
+		}
+		if code := errorCode(err); code != tc.code {
+			t.Errorf("%s: error %v, want code %d", tc.name, err, tc.code)
+		}
+	}
+	if err := chat(players[0], r, "darn"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the accepted messages are relayed, filtered, with their sender.
+	for _, want := range []string{"héllo", "****"} {
+		var got chatMessage
+		if err := json.Unmarshal(nextMessage(t, players[1], msgChat).Message.Payload, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Text != want || got.Client != players[0].ID {
+			t.Errorf("relayed %q from %s, want %q from %s", got.Text, got.Client, want, players[0].ID)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrClientInfoMissing is returned when a client doesn't report its name
+// and version.
+var ErrClientInfoMissing = errors.New("client name and version are required")
+
+// ClientInfo is the name and version a client reports on connect.
+type ClientInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+func (i ClientInfo) validate() error {
+	if i.Name == "" || i.Version == "" {
+		return ErrClientInfoMissing
+	}
+	return nil
+}
+
+type clientInfoKey struct{}
+
+// withClientInfo carries info from OnConnecting to the client context.
+func withClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+func clientInfoFrom(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+	return info
+}
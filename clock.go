@@ -0,0 +1,189 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and schedules timers. Timeouts and sweepers use it
+// so tests can replace the system clock with a FakeClock.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer created by a Clock.
+type Timer interface {
+	// C returns the channel the time is sent on when the timer expires. It
+	// is nil for AfterFunc timers.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing and reports whether it was
+	// pending.
+	Stop() bool
+}
+
+// systemClock is the Clock of the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return systemTimer{time.AfterFunc(d, f)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time { return t.Timer.C }
+
+// every calls fn with the time of clock after each period returned by
+// next, until done is closed. The periods are AfterFunc timers, so that a
+// FakeClock drives them like the timeouts.
+func every(clock Clock, done <-chan struct{}, next func() time.Duration, fn func(now time.Time)) {
+	var mu sync.Mutex
+	var t Timer
+	var arm func()
+	arm = func() {
+		mu.Lock()
+		defer mu.Unlock()
+		select {
+		case <-done:
+			return
+		default:
+		}
+		t = clock.AfterFunc(next(), func() {
+			fn(clock.Now())
+			arm()
+		})
+	}
+	arm()
+	go func() {
+		<-done
+		mu.Lock()
+		defer mu.Unlock()
+		t.Stop()
+	}()
+}
+
+// orSystemClock returns c, or the system clock when c is nil.
+func orSystemClock(c Clock) Clock {
+	if c == nil {
+		return systemClock{}
+	}
+	return c
+}
+
+// FakeClock is a Clock whose time only moves with Advance, so timeouts fire
+// deterministically and without sleeping.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFakeClock creates a clock stopped at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the current fake time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns the channel of a new timer.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// NewTimer creates a timer sending the time on its channel after d.
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	return c.add(d, nil, make(chan time.Time, 1))
+}
+
+// AfterFunc creates a timer calling f after d. Advance calls f itself and
+// returns once it is done.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	return c.add(d, f, nil)
+}
+
+// Advance moves the time forward by d, expiring the timers due in that
+// window in deadline order, each with the clock set to its deadline.
+// Timers armed by expiring ones fire too if they are due before the end.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for len(c.timers) > 0 && !c.timers[0].when.After(end) {
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		now := c.now
+		c.mu.Unlock()
+		t.expire(now)
+		c.mu.Lock()
+	}
+	c.now = end
+	c.mu.Unlock()
+}
+
+// Pending returns the number of timers not expired nor stopped yet.
+func (c *FakeClock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func (c *FakeClock) add(d time.Duration, f func(), ch chan time.Time) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, when: c.now.Add(d), f: f, ch: ch}
+	c.timers = append(c.timers, t)
+	sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].when.Before(c.timers[j].when) })
+	return t
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+	f     func()
+	ch    chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, pending := range c.timers {
+		if pending == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *fakeTimer) expire(now time.Time) {
+	if t.f != nil {
+		t.f()
+		return
+	}
+	select {
+	case t.ch <- now:
+	default:
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFSMTimeoutFiresOnAdvance(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	f := NewFSM("waiting", []Transition{{Event: "expire", From: "waiting", To: "expired"}})
+	f.SetClock(clock)
+	f.SetTimeout("waiting", time.Minute, "expire")
+	f.ResetTimer()
+
+	clock.Advance(59 * time.Second)
+	if f.Current() != "waiting" {
+		t.Fatalf("timed out early, in %s", f.Current())
+	}
+	if left, ok := f.Remaining(); !ok || left != time.Second {
+		t.Fatalf("remaining %s %v, want 1s", left, ok)
+	}
+	clock.Advance(time.Second)
+	if f.Current() != "expired" {
+		t.Fatalf("in %s after the timeout, want expired", f.Current())
+	}
+	if n := clock.Pending(); n != 0 {
+		t.Errorf("%d timers pending after the timeout", n)
+	}
+}
+
+func TestFakeClockTimers(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	start := clock.Now()
+	after := clock.After(2 * time.Second)
+	stopped := clock.NewTimer(time.Second)
+	if !stopped.Stop() {
+		t.Fatal("pending timer not stopped")
+	}
+
+	clock.Advance(3 * time.Second)
+	select {
+	case at := <-after:
+		if want := start.Add(2 * time.Second); !at.Equal(want) {
+			t.Errorf("expired at %s, want %s", at, want)
+		}
+	default:
+		t.Fatal("timer not expired")
+	}
+	select {
+	case <-stopped.C():
+		t.Error("stopped timer expired")
+	default:
+	}
+	if got := clock.Now().Sub(start); got != 3*time.Second {
+		t.Errorf("clock advanced by %s, want 3s", got)
+	}
+}
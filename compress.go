@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// compressMessage gzips the payload of msg when it is at least threshold
+// bytes long. The compressed payload is sent as a base64 JSON string so
+// the envelope stays valid JSON. A zero threshold disables compression.
+// Encrypted payloads don't compress and are left as is.
+func compressMessage(msg Message, threshold int) (Message, error) {
+	if threshold <= 0 || msg.Compressed || msg.Encrypted || len(msg.Payload) < threshold {
+		return msg, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(msg.Payload); err != nil {
+		return msg, err
+	}
+	if err := zw.Close(); err != nil {
+		return msg, err
+	}
+	payload, err := json.Marshal(buf.Bytes())
+	if err != nil {
+		return msg, err
+	}
+	msg.Payload = payload
+	msg.Compressed = true
+	return msg, nil
+}
+
+// decompressMessage restores the payload of a compressed msg. The other
+// fields of the envelope, such as Depth, are kept.
+func decompressMessage(msg Message) (Message, error) {
+	if !msg.Compressed {
+		return msg, nil
+	}
+	var compressed []byte
+	if err := json.Unmarshal(msg.Payload, &compressed); err != nil {
+		return msg, fmt.Errorf("%w: compressed payload: %s", errInvalidEnvelope, err.Error())
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return msg, fmt.Errorf("%w: compressed payload: %s", errInvalidEnvelope, err.Error())
+	}
+	payload, err := io.ReadAll(zr)
+	if err != nil {
+		return msg, fmt.Errorf("%w: compressed payload: %s", errInvalidEnvelope, err.Error())
+	}
+	msg.Payload = payload
+	msg.Compressed = false
+	return msg, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+func TestCompressMessageKeepsEnvelope(t *testing.T) {
+	msg := Message{
+		Type:      msgGameState,
+		Payload:   json.RawMessage(`{"room":"r1","from":"waiting","to":"playing"}`),
+		Seq:       7,
+		Depth:     3,
+		Signature: []byte("sig"),
+	}
+	compressed, err := compressMessage(msg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !compressed.Compressed {
+		t.Fatal("message not compressed")
+	}
+	if compressed.Seq != 7 || compressed.Depth != 3 || string(compressed.Signature) != "sig" {
+		t.Fatalf("compressed envelope lost fields: %+v", compressed)
+	}
+	back, err := decompressMessage(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Compressed || string(back.Payload) != string(msg.Payload) {
+		t.Fatalf("payload = %s, want %s", back.Payload, msg.Payload)
+	}
+	if back.Seq != 7 || back.Depth != 3 || string(back.Signature) != "sig" {
+		t.Fatalf("decompressed envelope lost fields: %+v", back)
+	}
+}
+
+func TestCompressMessageBelowThreshold(t *testing.T) {
+	msg := Message{Type: "x", Payload: json.RawMessage(`{}`)}
+	got, err := compressMessage(msg, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Compressed {
+		t.Fatal("small payload compressed")
+	}
+}
+
+func TestCompressMessageThresholdBoundary(t *testing.T) {
+	msg := Message{Type: "x", Payload: json.RawMessage(`{"players":[1,2,3]}`)}
+	for _, tc := range []struct {
+		threshold  int
+		compressed bool
+	}{
+		{len(msg.Payload) + 1, false},
+		{len(msg.Payload), true},
+		{0, false},
+	} {
+		got, err := compressMessage(msg, tc.threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Compressed != tc.compressed {
+			t.Errorf("threshold %d: compressed %v, want %v", tc.threshold, got.Compressed, tc.compressed)
+		}
+	}
+}
+
+func TestGameClientDecompresses(t *testing.T) {
+	c, err := newClient(&log, "ws://localhost:0/connection/websocket", DefaultConfig().Client, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	payload := json.RawMessage(`{"roster":["a","b","c"]}`)
+	got := make(chan json.RawMessage, 1)
+	c.OnEvent("roster", func(p json.RawMessage) { got <- p })
+
+	msg, err := compressMessage(Message{Type: "roster", Payload: payload}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := marshalMessage(centrifuge.ProtocolTypeJSON, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.dispatch(serverChannel, data)
+	if p := <-got; string(p) != string(payload) {
+		t.Errorf("handled %s, want %s", p, payload)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import "time"
+
+// Config gathers the server settings.
+type Config struct {
+	// InternalClients is the number of internal clients the server waits for.
+	InternalClients int
+	// InternalClientsTimeout bounds the wait for the internal clients, after
+	// which the server runs degraded without the missing ones. Zero waits
+	// forever.
+	InternalClientsTimeout time.Duration
+	// Room is the default configuration of created rooms.
+	Room RoomConfig
+	// MaxRoomsPerUser caps the rooms a user may own at the same time. A
+	// room left empty stops counting until someone rejoins it. Zero means
+	// no limit.
+	MaxRoomsPerUser int
+	// MaxGames caps the games active at the same time on the node, one per
+	// room, to protect it from overload. Zero means no limit.
+	MaxGames int
+	// ShutdownPhaseTimeout bounds each phase of Shutdown without a timeout
+	// of its own. Zero leaves them bounded by the Shutdown context only.
+	ShutdownPhaseTimeout time.Duration
+	// EmptyRoomGrace delays the destruction of empty rooms, including those
+	// nobody joined yet and the restored ones whose seats nobody claimed
+	// yet, to allow players to join or reconnect.
+	EmptyRoomGrace time.Duration
+	// ConnectRate limits the rate at which new connections are accepted,
+	// to absorb reconnection storms.
+	ConnectRate ConnectRateConfig
+	// ConnectionQuota caps the connections of each user.
+	ConnectionQuota ConnectionQuotaConfig
+	// PresenceGrace keeps the players of disconnected users away instead
+	// of removing them, so a reconnection within it resumes them. Zero
+	// removes them at once, as for anonymous users.
+	PresenceGrace time.Duration
+	// AdminUsers are the user IDs granted the admin role.
+	AdminUsers []string
+	// HTTP configures the HTTP server.
+	HTTP HTTPConfig
+	// Transport configures the WebSocket transport.
+	Transport TransportConfig
+	// Auth selects the authentication backend of WebSocket connections.
+	Auth AuthConfig
+	// Upgrades controls the personal data logged for WebSocket upgrades.
+	Upgrades UpgradeLogConfig
+	// Store persists server state. Nil means an in-memory store.
+	Store StateStore
+	// RosterSnapshotInterval is the period of full roster snapshots written
+	// to Store. Zero disables them.
+	RosterSnapshotInterval time.Duration
+	// Publisher sizes the outbound publish queue.
+	Publisher PublisherConfig
+	// Referees is the number of connections given the referee role, the
+	// others are players.
+	Referees int
+	// BroadcastRPCs lists the RPC methods whose results are also published
+	// to the caller's room channel.
+	BroadcastRPCs []string
+	// AdminToken guards the admin HTTP API. Empty disables it.
+	AdminToken string
+	// MaxIllegalTransitions is the number of consecutive illegal FSM events
+	// after which a client is disconnected. Zero disables the check.
+	MaxIllegalTransitions int
+	// Channels are the path.Match patterns of the channels the server
+	// publishes to, e.g. "game:*".
+	Channels []string
+	// TraceTTL is how long traceClient keeps debug logging on for a client
+	// when the call doesn't say.
+	TraceTTL time.Duration
+	// Stats configures the live stats feed published for monitoring
+	// clients.
+	Stats StatsConfig
+	// RPCAliases maps RPC methods to alternative names they are also
+	// called with.
+	RPCAliases map[string][]string
+	// MaxRPCPayload is the largest RPC request payload in bytes accepted,
+	// larger ones are rejected before being decoded. Zero means no limit.
+	MaxRPCPayload int
+	// MaxCausationDepth is the deepest causation chain of RPCs processed:
+	// calls reacting to messages of this depth are refused, cutting
+	// feedback loops between the server and bots. Zero means no limit.
+	MaxCausationDepth int
+	// MaxReplay is the most events recentEvents replays to a client; a
+	// client further behind is told to fetch the full state instead. Zero
+	// means no limit.
+	MaxReplay int
+	// NormalizeRPC canonicalizes RPC method names before dispatch. Nil
+	// trims and lowercases them.
+	NormalizeRPC func(method string) string
+	// CompressThreshold is the payload size in bytes from which published
+	// payloads are gzipped. Zero disables compression.
+	CompressThreshold int
+	// RestartMessage is sent to the rooms of in-progress games on
+	// shutdown.
+	RestartMessage string
+	// SnapshotCodec names the codec of the games saved on shutdown and of
+	// the roster snapshots, "json" or "gob", empty meaning "json". Saved
+	// games are restored whatever their codec.
+	SnapshotCodec string
+	// RestoreGames recreates on Run the games saved by the previous
+	// shutdown.
+	RestoreGames bool
+	// Client is the name and version reported by the internal clients, each
+	// suffixed with its index, e.g. "name#0".
+	Client ClientInfo
+	// ClientOptions configures the connection tokens and publication
+	// handling of the internal clients.
+	ClientOptions ClientOptions
+	// Idempotency replays the reply of RPCs retried with the same
+	// idempotency_key, e.g. after a reconnection.
+	Idempotency IdempotencyConfig
+	// Chat moderates the chat channels of the rooms.
+	Chat ChatConfig
+	// Attendance bounds the wait for the expected players of NewMatch.
+	Attendance AttendanceConfig
+	// Audit is where the admin actions are recorded.
+	Audit AuditConfig
+	// Inactivity disconnects idle clients.
+	Inactivity InactivityConfig
+	// Signing requires the messages of some roles to be signed.
+	Signing SigningConfig
+	// Strategy chooses the strategies of the bots calling the strategy
+	// RPC.
+	Strategy StrategyConfig
+	// PlayerMachine creates the state machine of each player. It must
+	// handle the states and events of NewPlayerFSM, the default.
+	PlayerMachine func() StateMachine
+	// PlayerRestore handles the player states of restored games that the
+	// player machine no longer has.
+	PlayerRestore RestoreConfig
+	// Rules validates the moves of the game. Nil allows every move.
+	Rules RulesEngine
+	// Clock runs the game timeouts and the room and player sweepers. Nil
+	// means the system clock.
+	Clock Clock
+	// Metrics is the backend of the instrumentation of the process, e.g.
+	// PrometheusMetrics. Nil discards the metrics.
+	Metrics Metrics
+	// TestMode runs the server without any network nor system time, for
+	// hermetic end-to-end tests: Clock defaults to a FakeClock, clients
+	// connect through a TestHarness and main doesn't listen.
+	TestMode bool
+}
+
+// TransportConfig holds the WebSocket transport settings.
+type TransportConfig struct {
+	// WriteTimeout is the time allowed to write a message to a client
+	// before it is disconnected as a slow consumer.
+	WriteTimeout time.Duration
+	// QueueMaxSize is the maximum size in bytes of messages queued for a
+	// client before it is disconnected as a slow consumer.
+	QueueMaxSize int
+	// SendBuffer is the number of messages buffered for each connection
+	// before Overflow applies. Zero leaves the connections to centrifuge's
+	// queue, limited by QueueMaxSize.
+	SendBuffer int
+	// Overflow is the policy applied to the messages sent to a full send
+	// buffer, OverflowDisconnect when empty.
+	Overflow OverflowPolicy
+	// PingInterval is the time between the pings sent to a client, keeping
+	// its connection alive through proxies. PongTimeout is the time allowed
+	// for its pong before it is disconnected with
+	// DisconnectKeepaliveTimeout, and must be shorter than PingInterval.
+	// Zero keeps centrifuge's defaults, -1 disables them.
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+}
+
+// DefaultConfig returns the settings used by main.
+func DefaultConfig() Config {
+	return Config{
+		InternalClients:        4,
+		InternalClientsTimeout: 30 * time.Second,
+		Room:                   DefaultRoomConfig(),
+		MaxRoomsPerUser:        1,
+		ShutdownPhaseTimeout:   5 * time.Second,
+		EmptyRoomGrace:         30 * time.Second,
+		PresenceGrace:          10 * time.Second,
+		ConnectRate: ConnectRateConfig{
+			Rate:    100,
+			Burst:   50,
+			MaxWait: 2 * time.Second,
+		},
+		HTTP: HTTPConfig{
+			Addr:              ":8000",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       10 * time.Second,
+			WriteTimeout:      10 * time.Second,
+			IdleTimeout:       time.Minute,
+		},
+		Transport: TransportConfig{
+			WriteTimeout: time.Second,
+			QueueMaxSize: 1048576,
+			PingInterval: 25 * time.Second,
+			PongTimeout:  10 * time.Second,
+		},
+		Auth:                   AuthConfig{Backend: AuthAnonymous},
+		RosterSnapshotInterval: time.Minute,
+		Publisher: PublisherConfig{
+			Workers:   4,
+			QueueSize: 1024,
+			Policy:    PublishBlock,
+			Priorities: map[string]Priority{
+				msgGameState:      PriorityHigh,
+				msgGameForfeit:    PriorityHigh,
+				msgGameOver:       PriorityHigh,
+				msgGameKicked:     PriorityHigh,
+				msgGameError:      PriorityHigh,
+				msgMatchCancelled: PriorityHigh,
+				msgChat:           PriorityLow,
+				msgServerStats:    PriorityLow,
+				msgSessionSummary: PriorityLow,
+				msgMonitorEvent:   PriorityLow,
+			},
+			MaxSkips: 16,
+		},
+		Referees:              1,
+		BroadcastRPCs:         []string{"move"},
+		MaxIllegalTransitions: 5,
+		MaxRPCPayload:         65536,
+		MaxCausationDepth:     16,
+		MaxReplay:             100,
+		Channels:              []string{"game:*", "com.jtbonhomme.*", "monitor:*"},
+		TraceTTL:              10 * time.Minute,
+		RestartMessage:        "The server is restarting, your game will resume shortly.",
+		RPCAliases: map[string][]string{
+			"move":    {"make_move"},
+			"forfeit": {"leave"},
+		},
+		SnapshotCodec: "json",
+		Chat: ChatConfig{
+			MaxLength: 500,
+		},
+		Attendance: AttendanceConfig{
+			Timeout: 5 * time.Minute,
+			NoShow:  NoShowCancel,
+		},
+		Audit: AuditConfig{
+			Sink: AuditStdout,
+		},
+		Inactivity: InactivityConfig{
+			Warning: 30 * time.Second,
+		},
+		Strategy: StrategyConfig{
+			Levels: []Strategy{
+				{Difficulty: "easy", Params: map[string]float64{"skill": 0.25, "think_ms": 1500}},
+				{Difficulty: "normal", Params: map[string]float64{"skill": 0.5, "think_ms": 800}},
+				{Difficulty: "hard", Params: map[string]float64{"skill": 0.9, "think_ms": 300}},
+			},
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:     5 * time.Minute,
+			MaxKeys: 64,
+		},
+		Stats: StatsConfig{
+			Channel:  "com.jtbonhomme.stats",
+			Interval: 5 * time.Second,
+		},
+		Client: ClientInfo{
+			Name:    "listening-go-client",
+			Version: "0.0.1",
+		},
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// AdminConnection describes a client connection, the operator's view of a
+// socket for troubleshooting.
+type AdminConnection struct {
+	ID           string     `json:"id"`
+	User         string     `json:"user"`
+	Role         string     `json:"role"`
+	RemoteAddr   string     `json:"remote_addr"`
+	UserAgent    string     `json:"user_agent"`
+	Transport    string     `json:"transport"`
+	Protocol     string     `json:"protocol"`
+	Client       ClientInfo `json:"client"`
+	ConnectedAt  time.Time  `json:"connected_at"`
+	LastActivity time.Time  `json:"last_activity"`
+	// Subscriptions are the channels the connection is subscribed to,
+	// sorted.
+	Subscriptions []string `json:"subscriptions"`
+	// SubscribedRooms are the IDs of the rooms whose channels are among
+	// Subscriptions, sorted.
+	SubscribedRooms []string `json:"subscribed_rooms,omitempty"`
+	Room            string   `json:"room,omitempty"`
+	// States are the states of the player's machine and of the game of its
+	// room, keyed by fsm type.
+	States map[string]string `json:"states"`
+}
+
+// Connections returns the connections of the node, sorted by ID. Like
+// State, they are taken with the registries locked.
+func (s *Server) Connections() []AdminConnection {
+	return s.connections(s.node.Hub().Connections())
+}
+
+// Connection returns the connection of clientID.
+func (s *Server) Connection(clientID string) (AdminConnection, bool) {
+	client, ok := s.node.Hub().Connections()[clientID]
+	if !ok {
+		return AdminConnection{}, false
+	}
+	return s.connections(map[string]*centrifuge.Client{clientID: client})[0], true
+}
+
+func (s *Server) connections(clients map[string]*centrifuge.Client) []AdminConnection {
+	conns := make([]AdminConnection, 0, len(clients))
+	s.rooms.mu.Lock()
+	s.players.mu.RLock()
+	s.subs.mu.Lock()
+	for id, client := range clients {
+		transport := client.Transport()
+		c := AdminConnection{
+			ID:            id,
+			User:          client.UserID(),
+			Role:          s.roles.role(roleKey(client.UserID(), id)),
+			Transport:     transport.Name(),
+			Protocol:      string(transport.Protocol()),
+			Subscriptions: []string{},
+			States:        map[string]string{},
+		}
+		if meta, ok := connMeta(client); ok {
+			c.RemoteAddr, c.UserAgent = meta.RemoteAddr, meta.UserAgent
+		}
+		for channel := range s.subs.channels[id] {
+			c.Subscriptions = append(c.Subscriptions, channel)
+		}
+		sort.Strings(c.Subscriptions)
+		c.SubscribedRooms = subscribedRooms(c.Subscriptions)
+		if p, ok := s.players.players[id]; ok {
+			c.Client = p.Info()
+			c.States[fsmTypePlayer] = p.FSM.Current()
+			c.ConnectedAt, c.LastActivity = p.activity()
+			c.Room = p.Room()
+		}
+		if r, ok := s.rooms.rooms[c.Room]; ok {
+			c.States[fsmTypeGame] = r.Game.Current()
+		}
+		conns = append(conns, c)
+	}
+	s.subs.mu.Unlock()
+	s.players.mu.RUnlock()
+	s.rooms.mu.Unlock()
+
+	sort.Slice(conns, func(i, j int) bool { return conns[i].ID < conns[j].ID })
+	return conns
+}
+
+// subscribedRooms returns the IDs of the rooms of the sorted channels,
+// sorted.
+func subscribedRooms(channels []string) []string {
+	var ids []string
+	seen := map[string]bool{}
+	for _, channel := range channels {
+		if id, ok := roomChannelID(channel); ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// serveConnections serves GET /admin/connections and
+// /admin/connections/{clientID}.
+func (s *Server) serveConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin/connections"), "/")
+	if id == "" {
+		writeJSON(w, s.Connections())
+		return
+	}
+	c, ok := s.Connection(id)
+	if !ok {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, c)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// getAdmin requests path from the admin API of h with token, decoding the
+// reply into reply if the request succeeds.
+func getAdmin(t *testing.T, h *TestHarness, path, token string, reply any) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.Server.AdminHandler().ServeHTTP(rec, req)
+	if rec.Code == http.StatusOK && reply != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code
+}
+
+func TestAdminConnections(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.AdminToken = "secret" })
+	c, err := h.ConnectWithMeta("alice", ConnMeta{UserAgent: "bot/1.0", RemoteAddr: "10.0.0.1:4242"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	room := createRoom(t, c, createRoomRequest{})
+	call(t, c, "joinRoom", roomRequest{Room: room.Room}, nil)
+	if err := c.Subscribe(room.Chat); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if code := getAdmin(t, h, "/admin/connections", token, nil); code != http.StatusForbidden {
+			t.Errorf("connections with token %q: status %d, want %d", token, code, http.StatusForbidden)
+		}
+	}
+	var conns []AdminConnection
+	if code := getAdmin(t, h, "/admin/connections", "secret", &conns); code != http.StatusOK {
+		t.Fatalf("connections: status %d", code)
+	}
+	if len(conns) != 1 {
+		t.Fatalf("%d connections, want 1", len(conns))
+	}
+	var conn AdminConnection
+	if code := getAdmin(t, h, "/admin/connections/"+c.ID, "secret", &conn); code != http.StatusOK {
+		t.Fatalf("connection: status %d", code)
+	}
+	if !reflect.DeepEqual(conn, conns[0]) {
+		t.Errorf("connection %+v, listed as %+v", conn, conns[0])
+	}
+
+	if conn.ID != c.ID || conn.User != "alice" || conn.Role != RoleReferee {
+		t.Errorf("connection of %s (%s) as %s, want %s (alice) as %s", conn.ID, conn.User, conn.Role, c.ID, RoleReferee)
+	}
+	if conn.UserAgent != "bot/1.0" || conn.RemoteAddr != "10.0.0.1:4242" {
+		t.Errorf("connection from %s with %s", conn.RemoteAddr, conn.UserAgent)
+	}
+	if conn.Transport != "memory" || conn.Protocol != "json" {
+		t.Errorf("transport %s over %s, want memory over json", conn.Transport, conn.Protocol)
+	}
+	if conn.ConnectedAt.IsZero() || conn.LastActivity.Before(conn.ConnectedAt) {
+		t.Errorf("connected at %s, last active at %s", conn.ConnectedAt, conn.LastActivity)
+	}
+	if want := []string{room.Chat}; !reflect.DeepEqual(conn.Subscriptions, want) {
+		t.Errorf("subscriptions %v, want %v", conn.Subscriptions, want)
+	}
+	if want := []string{room.Room}; conn.Room != room.Room || !reflect.DeepEqual(conn.SubscribedRooms, want) {
+		t.Errorf("in room %s subscribed to %v, want %s", conn.Room, conn.SubscribedRooms, room.Room)
+	}
+	if want := map[string]string{fsmTypePlayer: playerIdle, fsmTypeGame: gameLobby}; !reflect.DeepEqual(conn.States, want) {
+		t.Errorf("states %v, want %v", conn.States, want)
+	}
+
+	if code := getAdmin(t, h, "/admin/connections/missing", "secret", nil); code != http.StatusNotFound {
+		t.Errorf("missing connection: status %d, want %d", code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// ConnMeta is per-connection information taken from the HTTP upgrade
+// request, available to handlers through the client context.
+type ConnMeta struct {
+	// Role is the role requested by the client in the X-Role header. The
+	// role actually granted is decided by the server on connect.
+	Role string
+	// Tenant comes from the X-Tenant header.
+	Tenant string
+	// ClientVersion comes from the X-Client-Version header.
+	ClientVersion string
+	UserAgent     string
+	RemoteAddr    string
+}
+
+type connMetaKey struct{}
+
+// connMetaFromRequest reads the ConnMeta headers of r.
+func connMetaFromRequest(r *http.Request) ConnMeta {
+	return ConnMeta{
+		Role:          r.Header.Get("X-Role"),
+		Tenant:        r.Header.Get("X-Tenant"),
+		ClientVersion: r.Header.Get("X-Client-Version"),
+		UserAgent:     r.UserAgent(),
+		RemoteAddr:    r.RemoteAddr,
+	}
+}
+
+// WithConnMeta returns a copy of ctx carrying meta.
+func WithConnMeta(ctx context.Context, meta ConnMeta) context.Context {
+	return context.WithValue(ctx, connMetaKey{}, meta)
+}
+
+// GetConnMeta returns the ConnMeta carried by ctx.
+func GetConnMeta(ctx context.Context) (ConnMeta, bool) {
+	meta, ok := ctx.Value(connMetaKey{}).(ConnMeta)
+	return meta, ok
+}
+
+// connMeta returns the ConnMeta of client, set by the auth middleware.
+func connMeta(client *centrifuge.Client) (ConnMeta, bool) {
+	return GetConnMeta(client.Context())
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestConnMetaKeptInTheSession(t *testing.T) {
+	h := newHarness(t, nil)
+	header := http.Header{}
+	header.Set("X-Role", RoleReferee)
+	header.Set("X-Tenant", "acme")
+	header.Set("X-Client-Version", "2.1.0")
+	header.Set("User-Agent", "meta-test/1.0")
+	_, client := rawPeer(t, h, header)
+
+	meta, ok := connMeta(client)
+	if !ok {
+		t.Fatal("no connection metadata in the client context")
+	}
+	if meta.Role != RoleReferee || meta.Tenant != "acme" || meta.ClientVersion != "2.1.0" || meta.UserAgent != "meta-test/1.0" {
+		t.Errorf("metadata %+v, want the upgrade request headers", meta)
+	}
+	if !strings.HasPrefix(meta.RemoteAddr, "127.0.0.1:") {
+		t.Errorf("remote address %q, want the loopback peer", meta.RemoteAddr)
+	}
+}
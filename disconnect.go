@@ -0,0 +1,37 @@
+package main
+
+import "github.com/centrifugal/centrifuge"
+
+// Application disconnect codes. Codes in the 4500-4999 range are terminal:
+// clients must not reconnect automatically.
+var (
+	// DisconnectProtocolViolation is issued to clients repeatedly firing
+	// illegal FSM events.
+	DisconnectProtocolViolation = centrifuge.Disconnect{
+		Code:   4500,
+		Reason: "protocol violation",
+	}
+	// DisconnectKeepaliveTimeout is issued by centrifuge to clients that
+	// didn't answer a ping within TransportConfig.PongTimeout. They may
+	// reconnect.
+	DisconnectKeepaliveTimeout = centrifuge.DisconnectNoPong
+	// DisconnectInactive is issued to clients idle for longer than
+	// InactivityConfig.Timeout.
+	DisconnectInactive = centrifuge.Disconnect{
+		Code:   4501,
+		Reason: "inactive",
+	}
+	// DisconnectEvicted is issued to the oldest connections of a user over
+	// ConnectionQuotaConfig.Max, with QuotaEvictOldest.
+	DisconnectEvicted = centrifuge.Disconnect{
+		Code:   4502,
+		Reason: "evicted by a newer connection",
+	}
+	// DisconnectConnectionQuota is issued to the connections over
+	// ConnectionQuotaConfig.Max that connected at the same time as the
+	// ones within it, with QuotaReject.
+	DisconnectConnectionQuota = centrifuge.Disconnect{
+		Code:   4503,
+		Reason: "connection quota exceeded",
+	}
+)
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// defaultDumpLimit is the page size of dump when the call doesn't set one.
+const defaultDumpLimit = 100
+
+// FSMDump is the reply of the dump RPC. The schema is kept stable: fields
+// may be added but never renamed or removed.
+type FSMDump struct {
+	Total  int          `json:"total"`
+	Offset int          `json:"offset"`
+	FSMs   []FSMDumpRow `json:"fsms"`
+}
+
+// FSMDumpRow describes one FSM. Keys are "room:<room ID>" for games and
+// "player:<client ID>" for players.
+type FSMDumpRow struct {
+	Key            string            `json:"key"`
+	State          string            `json:"state"`
+	LastTransition time.Time         `json:"last_transition"`
+	Labels         map[string]string `json:"labels,omitempty"`
+}
+
+type dumpRequest struct {
+	Offset int               `json:"offset,omitempty"`
+	Limit  int               `json:"limit,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Dump returns a page of the FSMs having every label of filter, all of them
+// when it is empty, sorted by key. Like State, the snapshot is taken with
+// both registries locked.
+func (s *Server) Dump(offset, limit int, filter map[string]string) FSMDump {
+	var rows []FSMDumpRow
+	s.rooms.mu.Lock()
+	s.players.mu.RLock()
+	for id, r := range s.rooms.rooms {
+		state, at := r.Game.Snapshot()
+		rows = append(rows, FSMDumpRow{Key: "room:" + id, State: state, LastTransition: at.UTC(), Labels: r.Game.Labels()})
+	}
+	for id, p := range s.players.players {
+		state, at := snapshotState(p.FSM)
+		rows = append(rows, FSMDumpRow{Key: "player:" + id, State: state, LastTransition: at.UTC(), Labels: labelsOf(p.FSM)})
+	}
+	s.players.mu.RUnlock()
+	s.rooms.mu.Unlock()
+
+	if len(filter) > 0 {
+		matching := rows[:0]
+		for _, row := range rows {
+			if matchLabels(row.Labels, filter) {
+				matching = append(matching, row)
+			}
+		}
+		rows = matching
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Key < rows[j].Key })
+	dump := FSMDump{Total: len(rows), Offset: offset, FSMs: []FSMDumpRow{}}
+	if offset < len(rows) {
+		end := len(rows)
+		if offset+limit < end {
+			end = offset + limit
+		}
+		dump.FSMs = rows[offset:end]
+	}
+	return dump
+}
+
+// rpcDump lets admins list every FSM, paginated with offset and limit and
+// filtered by labels.
+func (s *Server) rpcDump(client *centrifuge.Client, data []byte) ([]byte, error) {
+	if !s.isAdmin(client) {
+		return nil, centrifuge.ErrorPermissionDenied
+	}
+	var req dumpRequest
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, centrifuge.ErrorBadRequest
+		}
+	}
+	if req.Offset < 0 || req.Limit < 0 {
+		return nil, centrifuge.ErrorBadRequest
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultDumpLimit
+	}
+	return json.Marshal(s.Dump(req.Offset, req.Limit, req.Labels))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrDecrypt is returned for encrypted messages that can't be
+	// decrypted: without the key of their room, with a wrong one, or
+	// altered.
+	ErrDecrypt = errors.New("message decryption failed")
+	// ErrPublicEncryption is returned for the public rooms asked to be
+	// encrypted: their key would be handed out to anyone joining them.
+	ErrPublicEncryption = errors.New("only private matches can be encrypted")
+)
+
+// roomKeySize is the size of the room keys, for AES-256.
+const roomKeySize = 32
+
+// newRoomKey returns a random room key.
+func newRoomKey() ([]byte, error) {
+	key := make([]byte, roomKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("room key generation error: %w", err)
+	}
+	return key, nil
+}
+
+// Key returns the key encrypting the messages of the room channel, nil if
+// they are sent in clear.
+func (r *Room) Key() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.key
+}
+
+// Encrypt generates the key of the private match, from then on encrypting
+// the payload of the messages the server publishes on the room channel. It
+// must be called before the room is handed out, and only the clients given
+// the key, the invited ones, can read them. The chat and presence of the
+// room aren't encrypted. Public rooms can't be encrypted.
+func (r *Room) Encrypt() error {
+	if !r.Private() {
+		return ErrPublicEncryption
+	}
+	key, err := newRoomKey()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.key = key
+	return nil
+}
+
+// encryptMessage seals the payload of msg, published on channel, with
+// AES-GCM. The sealed payload, prefixed by its nonce, is sent as a base64
+// JSON string so the envelope stays valid JSON. The channel and the type of
+// msg are authenticated with it, so that it can't be replayed as another
+// message.
+func encryptMessage(key []byte, channel string, msg Message) (Message, error) {
+	if msg.Encrypted {
+		return msg, nil
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return msg, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return msg, err
+	}
+	payload, err := json.Marshal(aead.Seal(nonce, nonce, msg.Payload, messageAAD(channel, msg)))
+	if err != nil {
+		return msg, err
+	}
+	msg.Payload = payload
+	msg.Encrypted = true
+	return msg, nil
+}
+
+// decryptMessage restores the payload of an encrypted msg received on
+// channel. key is the key of the room of channel, nil if unknown.
+func decryptMessage(key []byte, channel string, msg Message) (Message, error) {
+	if !msg.Encrypted {
+		return msg, nil
+	}
+	if len(key) == 0 {
+		return msg, fmt.Errorf("%w: no key for %s", ErrDecrypt, channel)
+	}
+	var sealed []byte
+	if err := json.Unmarshal(msg.Payload, &sealed); err != nil {
+		return msg, fmt.Errorf("%w: %s", ErrDecrypt, err.Error())
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return msg, fmt.Errorf("%w: %s", ErrDecrypt, err.Error())
+	}
+	if len(sealed) < aead.NonceSize() {
+		return msg, fmt.Errorf("%w: payload too short", ErrDecrypt)
+	}
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	payload, err := aead.Open(nil, nonce, sealed, messageAAD(channel, msg))
+	if err != nil {
+		return msg, fmt.Errorf("%w: %s", ErrDecrypt, err.Error())
+	}
+	msg.Payload = payload
+	msg.Encrypted = false
+	return msg, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// messageAAD is the data authenticated with the payload of msg.
+func messageAAD(channel string, msg Message) []byte {
+	return []byte(channel + "\x00" + msg.Type)
+}
+
+// encrypt encrypts msg for channel if it is the channel of an encrypted
+// room.
+func (s *Server) encrypt(channel string, msg Message) (Message, error) {
+	r, ok := s.channelRoom(channel)
+	if !ok {
+		return msg, nil
+	}
+	key := r.Key()
+	if key == nil {
+		return msg, nil
+	}
+	return encryptMessage(key, channel, msg)
+}
+
+// SetRoomKey sets the key decrypting the messages of the room roomID,
+// handed out by the replies of the RPCs joining an encrypted room. The
+// client records it by itself from the replies of its RPC calls.
+func (c *GameClient) SetRoomKey(roomID string, key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys[roomID] = key
+}
+
+// roomKey returns the key of the room of channel, nil if unknown.
+func (c *GameClient) roomKey(channel string) []byte {
+	id, ok := roomChannelID(channel)
+	if !ok {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.keys[id]
+}
+
+// recordRoomKey records the room key of the reply to an RPC joining a
+// room, if any.
+func (c *GameClient) recordRoomKey(data []byte) {
+	var reply roomReply
+	if err := json.Unmarshal(data, &reply); err != nil || reply.Room == "" || len(reply.Key) == 0 {
+		return
+	}
+	c.SetRoomKey(reply.Room, reply.Key)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestEncryptMessageRoundTrip(t *testing.T) {
+	key, err := newRoomKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := Message{Type: msgGameState, Payload: json.RawMessage(`{"room":"r1"}`), Seq: 3}
+	sealed, err := encryptMessage(key, "game:r1", msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sealed.Encrypted || bytes.Contains(sealed.Payload, []byte("r1")) {
+		t.Fatalf("payload not sealed: %s", sealed.Payload)
+	}
+	opened, err := decryptMessage(key, "game:r1", sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.Encrypted || string(opened.Payload) != string(msg.Payload) || opened.Seq != msg.Seq {
+		t.Errorf("decrypted %+v, want %+v", opened, msg)
+	}
+	// Bound to its channel.
+	if _, err := decryptMessage(key, "game:r2", sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("decryption on another channel: %v, want %v", err, ErrDecrypt)
+	}
+}
+
+func TestEncryptedRoomsArePrivate(t *testing.T) {
+	h := newHarness(t, nil)
+	owner := connect(t, h, "owner")
+	guest := connect(t, h, "guest")
+	stranger := connect(t, h, "stranger")
+
+	if code := callError(t, owner, "createRoom", createRoomRequest{Encrypted: true}); code != CodeInvalid {
+		t.Errorf("encrypted public room: code %d, want %d", code, CodeInvalid)
+	}
+
+	var match matchReply
+	call(t, owner, "createMatch", createMatchRequest{Encrypted: true}, &match)
+	if len(match.Key) != roomKeySize {
+		t.Fatalf("match key of %d bytes, want %d", len(match.Key), roomKeySize)
+	}
+	var joined roomReply
+	call(t, guest, "joinMatch", inviteRequest{Invite: match.Invite}, &joined)
+	if !bytes.Equal(joined.Key, match.Key) {
+		t.Error("invited player not given the key")
+	}
+	if code := callError(t, stranger, "joinRoom", roomRequest{Room: match.Room}); code != CodePermissionDenied {
+		t.Errorf("join of a stranger: code %d, want %d", code, CodePermissionDenied)
+	}
+}
+
+func TestDecryptWithWrongKeyFails(t *testing.T) {
+	key, _ := newRoomKey()
+	other, _ := newRoomKey()
+	msg := Message{Type: msgGameState, Payload: json.RawMessage(`{"room":"r1"}`)}
+	sealed, err := encryptMessage(key, "game:r1", msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := sealed
+	tampered.Type = msgChat
+	truncated := sealed
+	truncated.Payload = json.RawMessage(`"AAAA"`)
+	for _, tc := range []struct {
+		name string
+		key  []byte
+		msg  Message
+	}{
+		{"wrong key", other, sealed},
+		{"no key", nil, sealed},
+		{"invalid key", []byte("short"), sealed},
+		{"other type", key, tampered},
+		{"truncated", key, truncated},
+	} {
+		got, err := decryptMessage(tc.key, "game:r1", tc.msg)
+		if !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: %v, want %v", tc.name, err, ErrDecrypt)
+		}
+		// The message is left sealed.
+		if !got.Encrypted || string(got.Payload) != string(tc.msg.Payload) {
+			t.Errorf("%s: returned %+v", tc.name, got)
+		}
+	}
+
+	// Messages in clear need no key.
+	if got, err := decryptMessage(nil, "game:r1", msg); err != nil || string(got.Payload) != string(msg.Payload) {
+		t.Errorf("message in clear: %+v, %v", got, err)
+	}
+}
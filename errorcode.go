@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// ErrorCode identifies the errors returned to clients: in RPC replies, in
+// refused subscriptions and publications, and in game error notifications.
+// Codes below 400 are the protocol codes of centrifuge, the others belong to
+// the server. The codes are stable so that clients may switch on them, e.g.
+// to localize messages: they are only ever added.
+type ErrorCode uint32
+
+// Protocol errors, with the codes of centrifuge.
+const (
+	CodeInternal          ErrorCode = 100
+	CodeUnknownChannel    ErrorCode = 102
+	CodePermissionDenied  ErrorCode = 103
+	CodeMethodNotFound    ErrorCode = 104
+	CodeAlreadySubscribed ErrorCode = 105
+	CodeLimitExceeded     ErrorCode = 106
+	CodeBadRequest        ErrorCode = 107
+	CodeTooManyRequests   ErrorCode = 111
+)
+
+// Server errors.
+const (
+	// CodeInvalid is the code of the errors without a code of their own.
+	CodeInvalid ErrorCode = 400
+
+	// Game errors.
+	CodeIllegalTransition ErrorCode = 410
+	CodeGuardFailed       ErrorCode = 411
+	CodeNotYourTurn       ErrorCode = 412
+	CodeInvalidMove       ErrorCode = 413
+	CodeGameOver          ErrorCode = 414
+	CodeFrozen            ErrorCode = 415
+	CodeActionTimeout     ErrorCode = 416
+
+	// Room errors.
+	CodeRoomNotFound     ErrorCode = 420
+	CodeRoomLimitReached ErrorCode = 421
+	CodeInvalidInvite    ErrorCode = 422
+	CodeMatchStarted     ErrorCode = 423
+	CodeTooFewExpected   ErrorCode = 424
+	CodeAlreadyInRoom    ErrorCode = 425
+	CodeNotInRoom        ErrorCode = 426
+
+	// Player errors.
+	CodePlayerNotFound  ErrorCode = 430
+	CodeAlreadyQueued   ErrorCode = 431
+	CodeNotQueued       ErrorCode = 432
+	CodeConnectionQuota ErrorCode = 433
+
+	// Chat errors.
+	CodeChatTooLong  ErrorCode = 440
+	CodeChatRejected ErrorCode = 441
+
+	// Request errors.
+	CodeInvalidChannel  ErrorCode = 450
+	CodePayloadTooLarge ErrorCode = 451
+	CodeCausationDepth  ErrorCode = 452
+	CodeInvalidLabel    ErrorCode = 453
+	CodeUnknownFSMType  ErrorCode = 454
+
+	// Temporary errors, the call may be retried later.
+	CodeMaintenance ErrorCode = 503
+	CodeServerFull  ErrorCode = 507
+)
+
+// errorCodes maps the errors returned to clients to their code. The first
+// match wins, more specific errors come first.
+var errorCodes = []struct {
+	err  error
+	code ErrorCode
+}{
+	{ErrNotYourTurn, CodeNotYourTurn},
+	{ErrInvalidMove, CodeInvalidMove},
+	{ErrGameOver, CodeGameOver},
+	{ErrFrozen, CodeFrozen},
+	{ErrGuardFailed, CodeGuardFailed},
+	{ErrActionTimeout, CodeActionTimeout},
+	{ErrIllegalTransition, CodeIllegalTransition},
+	{ErrRoomNotFound, CodeRoomNotFound},
+	{ErrRoomLimitReached, CodeRoomLimitReached},
+	{ErrInvalidInvite, CodeInvalidInvite},
+	{ErrMatchStarted, CodeMatchStarted},
+	{ErrTooFewExpected, CodeTooFewExpected},
+	{ErrAlreadyInRoom, CodeAlreadyInRoom},
+	{ErrNotInRoom, CodeNotInRoom},
+	{ErrPlayerNotFound, CodePlayerNotFound},
+	{ErrAlreadyQueued, CodeAlreadyQueued},
+	{ErrNotQueued, CodeNotQueued},
+	{ErrChatTooLong, CodeChatTooLong},
+	{ErrChatRejected, CodeChatRejected},
+	{ErrInvalidChannel, CodeInvalidChannel},
+	{ErrRPCPayloadTooLarge, CodePayloadTooLarge},
+	{ErrCausationDepth, CodeCausationDepth},
+	{ErrInvalidLabel, CodeInvalidLabel},
+	{ErrUnknownFSMType, CodeUnknownFSMType},
+}
+
+// errorCode returns the code of err, CodeInvalid if it has none.
+func errorCode(err error) ErrorCode {
+	var cErr *centrifuge.Error
+	if errors.As(err, &cErr) {
+		return ErrorCode(cErr.Code)
+	}
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return CodeInvalid
+}
+
+// clientError exposes err to the client with its code. Centrifuge errors
+// are kept as is.
+func clientError(err error) *centrifuge.Error {
+	var cErr *centrifuge.Error
+	if errors.As(err, &cErr) {
+		return cErr
+	}
+	return &centrifuge.Error{Code: uint32(errorCode(err)), Message: err.Error()}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+func TestErrorCode(t *testing.T) {
+	for _, c := range errorCodes {
+		if got := errorCode(fmt.Errorf("context: %w", c.err)); got != c.code {
+			t.Errorf("code of %v: %d, want %d", c.err, got, c.code)
+		}
+	}
+	if got := errorCode(errors.New("unexpected")); got != CodeInvalid {
+		t.Errorf("code of an unknown error: %d, want %d", got, CodeInvalid)
+	}
+	if got := errorCode(centrifuge.ErrorTooManyRequests); got != CodeTooManyRequests {
+		t.Errorf("code of a centrifuge error: %d, want %d", got, CodeTooManyRequests)
+	}
+	// A move out of turn is also an illegal transition: the more specific
+	// code wins.
+	if got := errorCode(fmt.Errorf("%w: %w", ErrIllegalTransition, ErrNotYourTurn)); got != CodeNotYourTurn {
+		t.Errorf("code of a move out of turn: %d, want %d", got, CodeNotYourTurn)
+	}
+
+	e := clientError(fmt.Errorf("room r1: %w", ErrRoomNotFound))
+	if e.Code != uint32(CodeRoomNotFound) || e.Message != "room r1: room not found" {
+		t.Errorf("client error %d %q", e.Code, e.Message)
+	}
+	if code, ok := ReplyCode(e); !ok || code != CodeRoomNotFound {
+		t.Errorf("reply code %d, %v, want %d", code, ok, CodeRoomNotFound)
+	}
+}
+
+func TestHandlerErrorCodes(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.MaxRoomsPerUser = 1 })
+	r, players := startGame(t, h, 2)
+	idle := connect(t, h, "idle")
+	owner := connect(t, h, "owner")
+	createRoom(t, owner, createRoomRequest{})
+	call(t, idle, "queue", nil, nil)
+
+	for _, tc := range []struct {
+		name   string
+		client *HarnessClient
+		method string
+		req    any
+		want   ErrorCode
+	}{
+		{"unknown method", idle, "fly", nil, CodeMethodNotFound},
+		{"unknown room", owner, "joinRoom", roomRequest{Room: "missing"}, CodeRoomNotFound},
+		{"second room", owner, "createRoom", createRoomRequest{}, CodeRoomLimitReached},
+		{"invalid label", connect(t, h, "labeler"), "createRoom", createRoomRequest{Labels: map[string]string{"bad key": "x"}}, CodeInvalidLabel},
+		{"invalid invite", idle, "joinMatch", inviteRequest{Invite: "forged"}, CodeInvalidInvite},
+		{"transfer to the same room", players[0], "transfer", transferRequest{To: r.ID}, CodeAlreadyInRoom},
+		{"leave another room", players[0], "leaveRoom", roomRequest{Room: "missing"}, CodeRoomNotFound},
+		{"not your turn", players[1], "move", moveRequest{}, CodeNotYourTurn},
+		{"ready twice", players[0], "ready", nil, CodeIllegalTransition},
+		{"queued twice", idle, "queue", nil, CodeAlreadyQueued},
+		{"not queued", owner, "cancelQueue", nil, CodeNotQueued},
+		{"unknown fsm type", idle, "definition", definitionRequest{Type: "robot"}, CodeUnknownFSMType},
+		{"admin call", idle, "announce", announceRequest{Message: "hi"}, CodePermissionDenied},
+	} {
+		if got := callError(t, tc.client, tc.method, tc.req); got != tc.want {
+			t.Errorf("%s: code %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	call(t, players[1], "forfeit", nil, nil)
+	if got := callError(t, players[0], "forfeit", nil); got != CodeGameOver {
+		t.Errorf("forfeit once the game is over: code %d, want %d", got, CodeGameOver)
+	}
+	if got := callError(t, players[0], "move", moveRequest{}); got != CodeIllegalTransition {
+		t.Errorf("move once the game is over: code %d, want %d", got, CodeIllegalTransition)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// GameEvent is a message published on the channel of a room, with its
+// sequence number.
+type GameEvent struct {
+	Seq     uint64          `json:"seq"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Encrypted is set for the events of encrypted rooms, as in Message.
+	Encrypted bool      `json:"encrypted,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// eventLog keeps the last events of a game, evicting the oldest ones past
+// size. It is guarded by the seqMu of its room.
+type eventLog struct {
+	size   int
+	events []GameEvent
+}
+
+func newEventLog(size int) *eventLog {
+	return &eventLog{size: size}
+}
+
+// append records msg, numbered by Room.sequence.
+func (l *eventLog) append(msg Message, at time.Time) {
+	l.events = append(l.events, GameEvent{Seq: msg.Seq, Type: msg.Type, Payload: msg.Payload, Encrypted: msg.Encrypted, At: at})
+	if len(l.events) > l.size {
+		l.events = append(l.events[:0], l.events[len(l.events)-l.size:]...)
+	}
+}
+
+// since returns the retained events after seq.
+func (l *eventLog) since(seq uint64) []GameEvent {
+	i := len(l.events)
+	for i > 0 && l.events[i-1].Seq > seq {
+		i--
+	}
+	return append([]GameEvent{}, l.events[i:]...)
+}
+
+// sequence numbers msg with the next sequence number of the room and passes
+// it to publish, which queues it. Publications are serialized, so that they
+// are queued in sequence order, and a number is only used once publish
+// accepted its message, which is then logged.
+func (r *Room) sequence(msg Message, publish func(Message) error) error {
+	r.seqMu.Lock()
+	defer r.seqMu.Unlock()
+	msg.Seq = r.seq + 1
+	if depth := r.causedDepth(); depth > msg.Depth {
+		msg.Depth = depth
+	}
+	if err := publish(msg); err != nil {
+		return err
+	}
+	r.seq = msg.Seq
+	if r.events != nil {
+		r.events.append(msg, r.clock.Now())
+	}
+	return nil
+}
+
+// Seq returns the sequence number of the last message published on the
+// room channel, zero before the first one.
+func (r *Room) Seq() uint64 {
+	r.seqMu.Lock()
+	defer r.seqMu.Unlock()
+	return r.seq
+}
+
+// EventsSince returns the logged events of the room after seq, and the
+// sequence number of the last event published.
+func (r *Room) EventsSince(seq uint64) ([]GameEvent, uint64) {
+	r.seqMu.Lock()
+	defer r.seqMu.Unlock()
+	if r.events == nil {
+		return nil, r.seq
+	}
+	return r.events.since(seq), r.seq
+}
+
+// gameRoomID returns the ID of the room whose game channel is channel.
+func gameRoomID(channel string) (string, bool) {
+	info, ok := parseRoomChannel(channel)
+	return info.room, ok && info.kind == channelRoom
+}
+
+// channelRoom returns the room whose game channel is channel.
+func (s *Server) channelRoom(channel string) (*Room, bool) {
+	id, ok := gameRoomID(channel)
+	if !ok {
+		return nil, false
+	}
+	return s.rooms.Room(id)
+}
+
+// recentEventsRequest targets a room, the caller's own one when empty.
+type recentEventsRequest struct {
+	Room  string `json:"room,omitempty"`
+	Since uint64 `json:"since"`
+}
+
+// recentEventsReply has no events but ResyncRequired when the client missed
+// more than Config.MaxReplay events: it should fetch the full state, e.g.
+// with the state RPC, and go on from Seq.
+type recentEventsReply struct {
+	Room           string      `json:"room"`
+	Seq            uint64      `json:"seq"`
+	Events         []GameEvent `json:"events"`
+	ResyncRequired bool        `json:"resync_required,omitempty"`
+}
+
+// rpcRecentEvents returns the events of a room published after the since
+// sequence number, so that a reconnecting client catches up on what it
+// missed. Events older than the log were evicted and are not returned.
+// Past Config.MaxReplay missed events, none is and the client must resync.
+func (s *Server) rpcRecentEvents(client *centrifuge.Client, data []byte) ([]byte, error) {
+	var req recentEventsRequest
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, centrifuge.ErrorBadRequest
+		}
+	}
+	if req.Room == "" {
+		p, ok := s.players.Get(client.ID())
+		if !ok {
+			return nil, ErrPlayerNotFound
+		}
+		req.Room = p.Room()
+	}
+	r, ok := s.rooms.Room(req.Room)
+	if !ok {
+		return nil, ErrRoomNotFound
+	}
+	if err := s.authorizeRoom(client, r); err != nil {
+		return nil, err
+	}
+	events, seq := r.EventsSince(req.Since)
+	if max := s.config.MaxReplay; max > 0 && seq > req.Since && seq-req.Since > uint64(max) {
+		metrics().replayResyncs.Add(1)
+		log.Info().Msgf("client %s missed %d events of room %s, more than %d: resync required", client.ID(), seq-req.Since, r.ID, max)
+		return json.Marshal(recentEventsReply{Room: r.ID, Seq: seq, Events: []GameEvent{}, ResyncRequired: true})
+	}
+	return json.Marshal(recentEventsReply{Room: r.ID, Seq: seq, Events: events})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventLogSince(t *testing.T) {
+	l := newEventLog(3)
+	for seq := uint64(1); seq <= 5; seq++ {
+		l.append(Message{Seq: seq, Type: msgGameState}, time.Time{})
+	}
+	seqs := func(events []GameEvent) []uint64 {
+		got := []uint64{}
+		for _, ev := range events {
+			got = append(got, ev.Seq)
+		}
+		return got
+	}
+	for _, tc := range []struct {
+		since uint64
+		want  []uint64
+	}{
+		{0, []uint64{3, 4, 5}}, // 1 and 2 were evicted
+		{3, []uint64{4, 5}},
+		{5, []uint64{}},
+		{9, []uint64{}},
+	} {
+		if got := seqs(l.since(tc.since)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("since %d: %v, want %v", tc.since, got, tc.want)
+		}
+	}
+}
+
+func TestRecentEventsSince(t *testing.T) {
+	h := newHarness(t, nil)
+	_, players := startGame(t, h, 2)
+	var before recentEventsReply
+	call(t, players[0], "recentEvents", recentEventsRequest{}, &before)
+	call(t, players[0], "move", moveRequest{}, nil)
+	call(t, players[1], "move", moveRequest{}, nil)
+
+	var reply recentEventsReply
+	call(t, players[1], "recentEvents", recentEventsRequest{Since: before.Seq}, &reply)
+	if len(reply.Events) == 0 || reply.Seq <= before.Seq {
+		t.Fatalf("no events since %d: %+v", before.Seq, reply)
+	}
+	for _, ev := range reply.Events {
+		if ev.Seq <= before.Seq {
+			t.Errorf("event %d returned since %d", ev.Seq, before.Seq)
+		}
+	}
+	if last := reply.Events[len(reply.Events)-1].Seq; last != reply.Seq {
+		t.Errorf("last event %d, want %d", last, reply.Seq)
+	}
+}
+
+func TestRecentEventsResyncPastMaxReplay(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.MaxReplay = 1 })
+	_, players := startGame(t, h, 2)
+	call(t, players[0], "move", moveRequest{}, nil)
+	call(t, players[1], "move", moveRequest{}, nil)
+
+	var reply recentEventsReply
+	call(t, players[0], "recentEvents", recentEventsRequest{}, &reply)
+	if !reply.ResyncRequired || len(reply.Events) != 0 {
+		t.Errorf("reply %+v far behind, want a resync", reply)
+	}
+	var caught recentEventsReply
+	call(t, players[0], "recentEvents", recentEventsRequest{Since: reply.Seq - 1}, &caught)
+	if caught.ResyncRequired || len(caught.Events) != 1 {
+		t.Errorf("reply %+v one event behind, want that event", caught)
+	}
+}
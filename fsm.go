@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrIllegalTransition is returned by Fire when the event is not defined
+	// from the current state.
+	ErrIllegalTransition = errors.New("illegal transition")
+	// ErrGuardFailed is returned by Fire when a guard rejected the transition.
+	ErrGuardFailed = errors.New("guard failed")
+	// ErrFrozen is returned by Fire while the machine is frozen.
+	ErrFrozen = errors.New("fsm frozen")
+)
+
+// Transition describes a move from one state to another triggered by an event.
+type Transition struct {
+	Event string
+	From  string
+	To    string
+}
+
+// TransitionContext is passed to guards, actions and middleware of a
+// transition. FSM is the machine being transitioned; it stays locked until
+// the actions are done, so they must not call its methods. Fire detects such
+// calls and returns ErrReentrantFire.
+type TransitionContext struct {
+	Transition
+	FSM *FSM
+	// Metadata is set by the caller of FireWith, e.g. metaClient.
+	Metadata map[string]any
+}
+
+// metaClient is the Metadata key of the ID of the client that triggered an
+// event.
+const metaClient = "client"
+
+// Client returns the client ID stored under metaClient, if any.
+func (c *TransitionContext) Client() string {
+	id, _ := c.Metadata[metaClient].(string)
+	return id
+}
+
+// Guard decides whether a transition is allowed to happen.
+type Guard func(ctx *TransitionContext) bool
+
+// Action runs when a state is entered or left.
+type Action func(ctx *TransitionContext)
+
+// TransitionFunc performs a transition.
+type TransitionFunc func(ctx *TransitionContext) error
+
+// Middleware wraps every transition of a machine. It may act before and
+// after calling next, or abort the transition by returning an error
+// without calling it.
+type Middleware func(next TransitionFunc) TransitionFunc
+
+// FSM is a minimal finite state machine. Guards and enter/exit actions run
+// while the machine is locked, transition observers run after it is released.
+// A slow action therefore blocks every other call on the machine, including
+// Current; SetActionTimeout bounds how long it may do so.
+type FSM struct {
+	mu          sync.Mutex
+	rank        uint64 // creation order, see FireAll
+	initial     string
+	current     string
+	transitions map[string]map[string]string // event -> from -> to
+	guards      map[string][]Guard
+	onEnter     map[string][]Action
+	onExit      map[string][]Action
+	observers   []func(Transition)
+	middleware  []Middleware
+	frozen      bool
+	owner       atomic.Uint64 // goroutine firing an event, see lockFire
+	actionOwner atomic.Uint64 // goroutine of a timed action, see runAction
+	changedAt   time.Time     // of the last transition, creation until then
+	labels      map[string]string
+	clock       Clock
+	restore     RestoreConfig // see Restore
+	invariants  []func(*FSM) error
+
+	dataMu sync.RWMutex // leaf lock, see Get
+	data   map[string]any
+
+	actionTimeouts map[string]actionTimeout // event -> timeout, "" for all
+
+	timeouts  map[string]stateTimeout
+	suspendOn map[string]bool
+	suspended map[string]time.Duration // state -> remaining time
+	timer     Timer
+	timerGen  uint64
+	deadline  time.Time
+
+	scheduled map[uint64]Timer // see ScheduleEvent
+	schedules uint64
+	closed    bool
+}
+
+// NewFSM creates a machine in the initial state with the given transitions.
+func NewFSM(initial string, transitions []Transition) *FSM {
+	f := &FSM{
+		rank:        fsmRanks.Add(1),
+		initial:     initial,
+		current:     initial,
+		clock:       systemClock{},
+		changedAt:   time.Now(),
+		transitions: make(map[string]map[string]string),
+		guards:      make(map[string][]Guard),
+		onEnter:     make(map[string][]Action),
+		onExit:      make(map[string][]Action),
+		timeouts:    make(map[string]stateTimeout),
+		suspendOn:   make(map[string]bool),
+		suspended:   make(map[string]time.Duration),
+
+		actionTimeouts: make(map[string]actionTimeout),
+	}
+	for _, t := range transitions {
+		if f.transitions[t.Event] == nil {
+			f.transitions[t.Event] = make(map[string]string)
+		}
+		f.transitions[t.Event][t.From] = t.To
+	}
+	return f
+}
+
+// SetClock makes the machine use c for its timestamps and timeouts. It must
+// be called before the first transition.
+func (f *FSM) SetClock(c Clock) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.clock = c
+	f.changedAt = c.Now()
+}
+
+// Current returns the current state.
+func (f *FSM) Current() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.current
+}
+
+// Snapshot returns the current state and when the machine entered it.
+func (f *FSM) Snapshot() (string, time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.current, f.changedAt
+}
+
+// AddGuard adds a guard that must pass for event to be fired.
+func (f *FSM) AddGuard(event string, g Guard) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.guards[event] = append(f.guards[event], g)
+}
+
+// OnEnter registers an action run when state is entered.
+func (f *FSM) OnEnter(state string, fn Action) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onEnter[state] = append(f.onEnter[state], fn)
+}
+
+// OnExit registers an action run when state is left.
+func (f *FSM) OnExit(state string, fn Action) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onExit[state] = append(f.onExit[state], fn)
+}
+
+// OnTransition registers an observer notified after every transition.
+func (f *FSM) OnTransition(fn func(Transition)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.observers = append(f.observers, fn)
+}
+
+// Use adds middleware around every transition. The first middleware added
+// is the outermost one. Middleware runs while the machine is locked, like
+// guards and actions, and must not call back into it.
+func (f *FSM) Use(mw Middleware) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.middleware = append(f.middleware, mw)
+}
+
+// Freeze makes Fire reject every event with ErrFrozen until Unfreeze.
+func (f *FSM) Freeze() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.frozen = true
+}
+
+// Unfreeze lets Fire process events again.
+func (f *FSM) Unfreeze() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.frozen = false
+}
+
+// Frozen reports whether the machine is frozen.
+func (f *FSM) Frozen() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.frozen
+}
+
+// CanFire reports whether event is defined from the current state and all
+// of its guards pass.
+func (f *FSM) CanFire(event string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err := f.check(event, nil)
+	return err == nil
+}
+
+// Fire triggers event from the current state.
+func (f *FSM) Fire(event string) error {
+	return f.fire(event, nil, 0)
+}
+
+// FireWith triggers event, passing metadata to its guards and actions.
+func (f *FSM) FireWith(event string, metadata map[string]any) error {
+	return f.fire(event, metadata, 0)
+}
+
+// fire triggers event. A non-zero timerGen comes from a state timeout and
+// is ignored if the timer was stopped or re-armed since.
+func (f *FSM) fire(event string, metadata map[string]any, timerGen uint64) error {
+	if err := f.lockFire(event); err != nil {
+		return err
+	}
+	if timerGen != 0 && (f.timer == nil || timerGen != f.timerGen) {
+		f.unlockFire()
+		return nil
+	}
+	ctx, err := f.check(event, metadata)
+	if err != nil {
+		f.unlockFire()
+		return err
+	}
+	apply := f.apply
+	for i := len(f.middleware) - 1; i >= 0; i-- {
+		apply = f.middleware[i](apply)
+	}
+	if err := apply(ctx); err != nil {
+		f.unlockFire()
+		return err
+	}
+	countTransition()
+	f.countLabeled()
+	observers := append([]func(Transition){}, f.observers...)
+	f.unlockFire()
+
+	for _, fn := range observers {
+		fn(ctx.Transition)
+	}
+	return nil
+}
+
+// apply is the innermost TransitionFunc, it must be called with f.mu held.
+// An action timeout with ActionTimeoutRollback puts the machine back in
+// ctx.From, with its timeout re-armed.
+func (f *FSM) apply(ctx *TransitionContext) error {
+	f.stopTimer(ctx.Event)
+	changedAt := f.changedAt
+	rollback := func(err error) error {
+		f.current = ctx.From
+		f.changedAt = changedAt
+		f.armTimer()
+		return err
+	}
+	for _, fn := range f.onExit[ctx.From] {
+		if err := f.runAction(ctx, fn); err != nil {
+			return rollback(err)
+		}
+	}
+	f.current = ctx.To
+	f.changedAt = f.clock.Now()
+	for _, fn := range f.onEnter[ctx.To] {
+		if err := f.runAction(ctx, fn); err != nil {
+			return rollback(err)
+		}
+	}
+	f.armTimer()
+	return nil
+}
+
+// check must be called with f.mu held.
+func (f *FSM) check(event string, metadata map[string]any) (*TransitionContext, error) {
+	if f.frozen {
+		return nil, fmt.Errorf("%w: %s from %s", ErrFrozen, event, f.current)
+	}
+	to, ok := f.transitions[event][f.current]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s from %s", ErrIllegalTransition, event, f.current)
+	}
+	ctx := &TransitionContext{
+		Transition: Transition{Event: event, From: f.current, To: to},
+		FSM:        f,
+		Metadata:   metadata,
+	}
+	for _, g := range f.guards[event] {
+		if !g(ctx) {
+			return nil, fmt.Errorf("%w: %s from %s", ErrGuardFailed, event, f.current)
+		}
+	}
+	return ctx, nil
+}
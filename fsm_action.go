@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrActionTimeout is returned by Fire when an action exceeded its timeout
+// and the transition was rolled back.
+var ErrActionTimeout = errors.New("action timeout")
+
+// ActionTimeoutPolicy tells what a transition does when one of its actions
+// exceeds its timeout.
+type ActionTimeoutPolicy int
+
+const (
+	// ActionTimeoutContinue logs the timeout and completes the transition.
+	ActionTimeoutContinue ActionTimeoutPolicy = iota
+	// ActionTimeoutRollback logs the timeout, puts the machine back in the
+	// state it was leaving and makes Fire return ErrActionTimeout.
+	ActionTimeoutRollback
+)
+
+type actionTimeout struct {
+	after  time.Duration
+	policy ActionTimeoutPolicy
+}
+
+// SetActionTimeout bounds how long each enter and exit action of event may
+// hold the machine. An empty event sets the default of the events without
+// their own timeout; zero d removes the timeout.
+//
+// An action exceeding its timeout is not interrupted: it keeps running in
+// the background while the machine moves on, so it must not rely on the
+// machine being locked past that point.
+func (f *FSM) SetActionTimeout(event string, d time.Duration, policy ActionTimeoutPolicy) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if d <= 0 {
+		delete(f.actionTimeouts, event)
+		return
+	}
+	f.actionTimeouts[event] = actionTimeout{after: d, policy: policy}
+}
+
+// runAction runs fn, waiting at most for the action timeout of the event.
+// It must be called with f.mu held.
+func (f *FSM) runAction(ctx *TransitionContext, fn Action) error {
+	timeout, ok := f.actionTimeouts[ctx.Event]
+	if !ok {
+		timeout, ok = f.actionTimeouts[""]
+	}
+	if !ok {
+		fn(ctx)
+		return nil
+	}
+
+	// The action runs for the goroutine holding f.mu until it times out, so
+	// that it can't fire on f either.
+	started, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		gid := goroutineID()
+		f.actionOwner.Store(gid)
+		close(started)
+		defer f.actionOwner.CompareAndSwap(gid, 0)
+		fn(ctx)
+	}()
+	<-started
+	t := f.clock.NewTimer(timeout.after)
+	defer t.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-t.C():
+	}
+	f.actionOwner.Store(0)
+	log.Error().Msgf("fsm action of %s from %s to %s exceeded %s", ctx.Event, ctx.From, ctx.To, timeout.after)
+	if timeout.policy == ActionTimeoutRollback {
+		return fmt.Errorf("%w: %s from %s", ErrActionTimeout, ctx.Event, ctx.From)
+	}
+	return nil
+}
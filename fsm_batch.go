@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrBatchFailed is returned by FireBatch when an event could not be
+	// fired on every machine, none of them transitioning.
+	ErrBatchFailed = errors.New("batch failed")
+	// ErrBatchRolledBack is the result of the machines of a failed batch
+	// that could have transitioned.
+	ErrBatchRolledBack = errors.New("batch rolled back")
+	// ErrBatchUnsupported is the result of the players of a batch whose
+	// machine isn't an FSM.
+	ErrBatchUnsupported = errors.New("machine does not support batches")
+)
+
+// fsmRanks numbers the FSMs of the process in creation order, the order
+// in which FireAll locks them.
+var fsmRanks atomic.Uint64
+
+// BatchResult is the result of a batch transition for one machine.
+type BatchResult struct {
+	// Player is the client ID of the machine's player, set by FireBatch.
+	Player string
+	// Transition is set if the machine transitioned.
+	Transition
+	Err error
+}
+
+// FireAll fires event on every machine of fsms, which must be distinct,
+// atomically: either all of them transition, or none does. It returns the
+// result of each machine, in the order of fsms, and ErrBatchFailed if any
+// failed, the others then reporting ErrBatchRolledBack.
+//
+// The machines are locked in the order they were created, so that
+// concurrent batches over overlapping sets don't deadlock. Guards, actions
+// and middleware run with all of them locked and must not call any of
+// them; observers run once they are all released. Enter and exit actions
+// of a transition rolled back because another one failed are not undone.
+func FireAll(fsms []*FSM, event string, metadata map[string]any) ([]BatchResult, error) {
+	results := make([]BatchResult, len(fsms))
+	order := make([]int, len(fsms))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return fsms[order[a]].rank < fsms[order[b]].rank })
+
+	locked := 0
+	defer func() {
+		for _, i := range order[:locked] {
+			fsms[i].unlockFire()
+		}
+	}()
+	for _, i := range order {
+		if err := fsms[i].lockFire(event); err != nil {
+			results[i].Err = err
+			return rollBack(results), ErrBatchFailed
+		}
+		locked++
+	}
+
+	ctxs := make([]*TransitionContext, len(fsms))
+	failed := false
+	for _, i := range order {
+		ctxs[i], results[i].Err = fsms[i].check(event, metadata)
+		failed = failed || results[i].Err != nil
+	}
+	if failed {
+		return rollBack(results), ErrBatchFailed
+	}
+
+	changedAt := make([]time.Time, len(fsms))
+	for n, i := range order {
+		f := fsms[i]
+		changedAt[i] = f.changedAt
+		apply := f.apply
+		for j := len(f.middleware) - 1; j >= 0; j-- {
+			apply = f.middleware[j](apply)
+		}
+		if results[i].Err = apply(ctxs[i]); results[i].Err == nil {
+			continue
+		}
+		for _, j := range order[:n] {
+			fsms[j].revert(ctxs[j], changedAt[j])
+		}
+		return rollBack(results), ErrBatchFailed
+	}
+
+	var observers []func()
+	for _, i := range order {
+		f, t := fsms[i], ctxs[i].Transition
+		results[i].Transition = t
+		countTransition()
+		f.countLabeled()
+		for _, fn := range f.observers {
+			fn := fn
+			observers = append(observers, func() { fn(t) })
+		}
+	}
+	for _, i := range order {
+		fsms[i].unlockFire()
+	}
+	locked = 0
+	for _, fn := range observers {
+		fn()
+	}
+	return results, nil
+}
+
+// rollBack sets the missing errors of a failed batch to
+// ErrBatchRolledBack.
+func rollBack(results []BatchResult) []BatchResult {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Err = ErrBatchRolledBack
+		}
+	}
+	return results
+}
+
+// revert puts the machine back in the source state of ctx, entered at
+// changedAt, without running any action. It must be called with f.mu held.
+func (f *FSM) revert(ctx *TransitionContext, changedAt time.Time) {
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	f.current = ctx.From
+	f.changedAt = changedAt
+	f.armTimer()
+}
+
+// FireBatch fires event on the machines of the players ids atomically, as
+// FireAll does, e.g. to move everyone to the next round. It returns the
+// result of each player, in the order of ids, and ErrBatchFailed if any of
+// them couldn't transition, in which case none did. Duplicate IDs are
+// ignored.
+func (g *PlayerRegistry) FireBatch(ids []string, event string, metadata map[string]any) ([]BatchResult, error) {
+	seen := make(map[string]bool, len(ids))
+	var results []BatchResult
+	var fsms []*FSM
+	failed := false
+	g.mu.RLock()
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		res := BatchResult{Player: id}
+		p, ok := g.players[id]
+		if !ok {
+			res.Err = fmt.Errorf("%w: %s", ErrPlayerNotFound, id)
+		} else if f, ok := p.FSM.(*FSM); !ok {
+			res.Err = fmt.Errorf("%w: %s", ErrBatchUnsupported, id)
+		} else {
+			fsms = append(fsms, f)
+		}
+		failed = failed || res.Err != nil
+		results = append(results, res)
+	}
+	g.mu.RUnlock()
+	if failed {
+		return rollBack(results), ErrBatchFailed
+	}
+
+	fired, err := FireAll(fsms, event, metadata)
+	for i := range results {
+		fired[i].Player = results[i].Player
+	}
+	return fired, err
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flipFSMs creates n machines flipping between a and b.
+func flipFSMs(n int) []*FSM {
+	fsms := make([]*FSM, n)
+	for i := range fsms {
+		fsms[i] = NewFSM("a", []Transition{
+			{Event: "flip", From: "a", To: "b"},
+			{Event: "flip", From: "b", To: "a"},
+		})
+	}
+	return fsms
+}
+
+func TestFireAllSucceeds(t *testing.T) {
+	fsms := flipFSMs(3)
+	results, err := FireAll(fsms, "flip", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range results {
+		if res.Err != nil || res.To != "b" || fsms[i].Current() != "b" {
+			t.Errorf("machine %d: %+v in %s, want b", i, res, fsms[i].Current())
+		}
+	}
+}
+
+func TestFireAllRollsBack(t *testing.T) {
+	t.Run("guard", func(t *testing.T) {
+		fsms := flipFSMs(3)
+		fsms[1].AddGuard("flip", func(*TransitionContext) bool { return false })
+		results, err := FireAll(fsms, "flip", nil)
+		if !errors.Is(err, ErrBatchFailed) {
+			t.Fatalf("err %v, want %v", err, ErrBatchFailed)
+		}
+		want := []error{ErrBatchRolledBack, ErrGuardFailed, ErrBatchRolledBack}
+		for i, res := range results {
+			if !errors.Is(res.Err, want[i]) || fsms[i].Current() != "a" {
+				t.Errorf("machine %d: %v in %s, want %v in a", i, res.Err, fsms[i].Current(), want[i])
+			}
+		}
+	})
+	// The machines already transitioned are reverted when a later one
+	// fails while transitioning.
+	t.Run("apply", func(t *testing.T) {
+		fsms := flipFSMs(3)
+		fail := errors.New("fail")
+		fsms[2].Use(func(TransitionFunc) TransitionFunc {
+			return func(*TransitionContext) error { return fail }
+		})
+		results, err := FireAll(fsms, "flip", nil)
+		if !errors.Is(err, ErrBatchFailed) {
+			t.Fatalf("err %v, want %v", err, ErrBatchFailed)
+		}
+		if !errors.Is(results[2].Err, fail) {
+			t.Errorf("failing machine: %v, want %v", results[2].Err, fail)
+		}
+		for i, f := range fsms {
+			if f.Current() != "a" {
+				t.Errorf("machine %d in %s, want a", i, f.Current())
+			}
+		}
+	})
+}
+
+func TestFireAllOverlappingBatches(t *testing.T) {
+	fsms := flipFSMs(16)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for i := 0; i < 200; i++ {
+				batch := make([]*FSM, 0, 6)
+				for _, j := range rnd.Perm(len(fsms))[:6] {
+					batch = append(batch, fsms[j])
+				}
+				if _, err := FireAll(batch, "flip", nil); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(int64(g))
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("overlapping batches deadlocked")
+	}
+}
+
+func TestFireBatchPlayers(t *testing.T) {
+	h := newHarness(t, nil)
+	a, b := connect(t, h, "a"), connect(t, h, "b")
+
+	results, err := h.Server.players.FireBatch([]string{a.ID, b.ID, a.ID}, eventReady, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Player != a.ID || results[1].Player != b.ID {
+		t.Fatalf("results %+v, want one per player", results)
+	}
+
+	results, err = h.Server.players.FireBatch([]string{a.ID, "unknown"}, eventReset, nil)
+	if !errors.Is(err, ErrBatchFailed) || !errors.Is(results[1].Err, ErrPlayerNotFound) {
+		t.Fatalf("unknown player: %v, %+v", err, results)
+	}
+	if p, _ := h.Server.players.Get(a.ID); p.FSM.Current() != playerReady {
+		t.Errorf("player %s in %s after a failed batch, want %s", a.ID, p.FSM.Current(), playerReady)
+	}
+}
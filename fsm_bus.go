@@ -0,0 +1,87 @@
+package main
+
+import "sync"
+
+// transitionBusSize is the number of transitions queued for the central
+// observers before new ones are dropped.
+const transitionBusSize = 1024
+
+type keyedTransition struct {
+	key string
+	Transition
+}
+
+// transitionBus fans the transitions of many machines out to central
+// observers. The machines only queue their transitions, the observers are
+// called in order on the goroutine of the bus, started by the first
+// OnAnyTransition: a slow observer delays the others, never a transition.
+type transitionBus struct {
+	mu        sync.RWMutex
+	observers []func(fsmKey string, t Transition)
+	queue     chan keyedTransition
+	start     sync.Once
+}
+
+func newTransitionBus() *transitionBus {
+	return &transitionBus{queue: make(chan keyedTransition, transitionBusSize)}
+}
+
+// OnAnyTransition registers an observer notified of the transitions of
+// every watched machine, with its key.
+func (b *transitionBus) OnAnyTransition(fn func(fsmKey string, t Transition)) {
+	b.mu.Lock()
+	b.observers = append(b.observers, fn)
+	b.mu.Unlock()
+	b.start.Do(func() { go b.run() })
+}
+
+// watch feeds the transitions of m to the bus, under the key returned by
+// key when they happen.
+func (b *transitionBus) watch(m StateMachine, key func() string) {
+	m.OnTransition(func(t Transition) {
+		b.mu.RLock()
+		observed := len(b.observers) > 0
+		b.mu.RUnlock()
+		if !observed {
+			return
+		}
+		select {
+		case b.queue <- keyedTransition{key: key(), Transition: t}:
+		default:
+			metrics().busDropped.Add(1)
+			log.Warn().Msgf("transition bus full, dropping %s of %s", t.Event, key())
+		}
+	})
+}
+
+func (b *transitionBus) run() {
+	for t := range b.queue {
+		b.mu.RLock()
+		observers := b.observers
+		b.mu.RUnlock()
+		for _, fn := range observers {
+			fn(t.key, t.Transition)
+		}
+	}
+}
+
+// OnAnyTransition registers an observer notified of the transitions of
+// every game and player machine of the server, keyed as in Dump. It is
+// called asynchronously, in order; transitions are dropped rather than
+// delaying the games when observers can't keep up.
+func (s *Server) OnAnyTransition(fn func(fsmKey string, t Transition)) {
+	s.transitions.OnAnyTransition(fn)
+}
+
+// watchRoom feeds the transitions of the game of r to the bus.
+func (s *Server) watchRoom(r *Room) {
+	s.transitions.watch(r.Game, func() string { return "room:" + r.ID })
+}
+
+// watchPlayer feeds the transitions of p to the bus. Its key follows the
+// client ID when a reconnection resumes it.
+func (s *Server) watchPlayer(p *Player) {
+	s.transitions.watch(p.FSM, func() string {
+		return "player:" + p.ID()
+	})
+}
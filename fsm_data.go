@@ -0,0 +1,46 @@
+package main
+
+// Get returns the value stored under key in the data of the machine. Unlike
+// the other methods, Get and Set don't take the machine lock, so guards and
+// actions may call them.
+func (f *FSM) Get(key string) (any, bool) {
+	f.dataMu.RLock()
+	defer f.dataMu.RUnlock()
+	v, ok := f.data[key]
+	return v, ok
+}
+
+// Set stores value under key in the data of the machine.
+func (f *FSM) Set(key string, value any) {
+	f.dataMu.Lock()
+	defer f.dataMu.Unlock()
+	if f.data == nil {
+		f.data = make(map[string]any)
+	}
+	f.data[key] = value
+}
+
+// Delete removes key from the data of the machine.
+func (f *FSM) Delete(key string) {
+	f.dataMu.Lock()
+	defer f.dataMu.Unlock()
+	delete(f.data, key)
+}
+
+// FSMGet returns the value stored under key in the data of f as a T. It
+// returns the zero T and false if there is none or it isn't a T.
+func FSMGet[T any](f *FSM, key string) (T, bool) {
+	v, ok := f.Get(key)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	t, ok := v.(T)
+	return t, ok
+}
+
+// FSMSet stores value under key in the data of f. Reading it back with
+// FSMGet needs the same type argument, e.g. int rather than int64.
+func FSMSet[T any](f *FSM, key string, value T) {
+	f.Set(key, value)
+}
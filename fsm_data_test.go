@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestFSMTypedData(t *testing.T) {
+	f := NewFSM("a", []Transition{{Event: "go", From: "a", To: "b"}})
+	FSMSet(f, "score", 42)
+	FSMSet(f, "board", []string{"x", "o"})
+
+	if score, ok := FSMGet[int](f, "score"); !ok || score != 42 {
+		t.Errorf("score %d, %v, want 42", score, ok)
+	}
+	if board, ok := FSMGet[[]string](f, "board"); !ok || len(board) != 2 {
+		t.Errorf("board %v, %v", board, ok)
+	}
+
+	// A mismatched type or a missing key gives the zero value and false.
+	if score, ok := FSMGet[int64](f, "score"); ok || score != 0 {
+		t.Errorf("score as an int64: %d, %v, want 0, false", score, ok)
+	}
+	if s, ok := FSMGet[string](f, "missing"); ok || s != "" {
+		t.Errorf("missing key: %q, %v, want \"\", false", s, ok)
+	}
+	if v, ok := FSMGet[any](f, "score"); !ok || v != 42 {
+		t.Errorf("score as any: %v, %v", v, ok)
+	}
+
+	// The untyped methods see the same data.
+	if v, ok := f.Get("score"); !ok || v != 42 {
+		t.Errorf("untyped score %v, %v", v, ok)
+	}
+	f.Delete("score")
+	if _, ok := FSMGet[int](f, "score"); ok {
+		t.Error("deleted score still set")
+	}
+}
+
+func TestFSMDataFromActions(t *testing.T) {
+	f := NewFSM("a", []Transition{{Event: "go", From: "a", To: "b"}})
+	f.AddGuard("go", func(*TransitionContext) bool {
+		n, _ := FSMGet[int](f, "attempts")
+		FSMSet(f, "attempts", n+1)
+		return n > 0
+	})
+	if err := f.Fire("go"); err == nil {
+		t.Fatal("first attempt passed the guard")
+	}
+	if err := f.Fire("go"); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := FSMGet[int](f, "attempts"); n != 2 {
+		t.Errorf("%d attempts recorded, want 2", n)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// Types of the machines described by the definition RPC.
+const (
+	fsmTypeGame   = "game"
+	fsmTypePlayer = "player"
+)
+
+// ErrUnknownFSMType is returned by the definition RPC for types without a
+// definition.
+var ErrUnknownFSMType = errors.New("unknown fsm type")
+
+// TransitionDef is a transition of an FSMDefinition.
+type TransitionDef struct {
+	Event string `json:"event"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// FSMDefinition is the static definition of a machine. Like FSMDump, its
+// schema is only ever extended.
+type FSMDefinition struct {
+	Initial     string          `json:"initial"`
+	States      []string        `json:"states"`
+	Events      []string        `json:"events"`
+	Transitions []TransitionDef `json:"transitions"`
+	// Guarded are the events whose transitions are guarded.
+	Guarded []string `json:"guarded,omitempty"`
+}
+
+// Definition returns the initial state and the transitions of the machine,
+// sorted by event then source state.
+func (f *FSM) Definition() FSMDefinition {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	def := FSMDefinition{Initial: f.initial, Transitions: []TransitionDef{}}
+	states := map[string]bool{f.initial: true}
+	for event, froms := range f.transitions {
+		def.Events = append(def.Events, event)
+		for from, to := range froms {
+			def.Transitions = append(def.Transitions, TransitionDef{Event: event, From: from, To: to})
+			states[from], states[to] = true, true
+		}
+		if len(f.guards[event]) > 0 {
+			def.Guarded = append(def.Guarded, event)
+		}
+	}
+	for state := range states {
+		def.States = append(def.States, state)
+	}
+	sort.Strings(def.States)
+	sort.Strings(def.Events)
+	sort.Strings(def.Guarded)
+	sort.Slice(def.Transitions, func(i, j int) bool {
+		a, b := def.Transitions[i], def.Transitions[j]
+		if a.Event != b.Event {
+			return a.Event < b.Event
+		}
+		return a.From < b.From
+	})
+	return def
+}
+
+// definitions encodes the definitions of the machines of config, which
+// don't change once the server is created. Player machines that aren't an
+// FSM have none.
+func definitions(config Config, players *PlayerRegistry) (map[string]json.RawMessage, error) {
+	machines := map[string]StateMachine{
+		fsmTypeGame:   newRoom("", config.Room, systemClock{}).Game,
+		fsmTypePlayer: players.machine(),
+	}
+	defs := make(map[string]json.RawMessage, len(machines))
+	for name, m := range machines {
+		f, ok := m.(interface{ Definition() FSMDefinition })
+		if !ok {
+			continue
+		}
+		data, err := json.Marshal(f.Definition())
+		if err != nil {
+			return nil, fmt.Errorf("%s fsm definition: %w", name, err)
+		}
+		defs[name] = data
+	}
+	return defs, nil
+}
+
+type definitionRequest struct {
+	Type string `json:"type"`
+}
+
+// rpcDefinition returns the FSMDefinition of the game or player machines,
+// so that clients can build generic UIs. The definitions are encoded once
+// by NewServer.
+func (s *Server) rpcDefinition(_ *centrifuge.Client, data []byte) ([]byte, error) {
+	var req definitionRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, centrifuge.ErrorBadRequest
+	}
+	def, ok := s.definitions[req.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFSMType, req.Type)
+	}
+	return def, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlayerDefinition(t *testing.T) {
+	h := newHarness(t, nil)
+	c := connect(t, h, "alice")
+	var def FSMDefinition
+	call(t, c, "definition", definitionRequest{Type: fsmTypePlayer}, &def)
+	want := FSMDefinition{
+		Initial: playerIdle,
+		States:  []string{playerForfeited, playerIdle, playerPlaying, playerReady},
+		Events:  []string{eventForfeit, eventMove, eventPlay, eventReady, eventReset},
+		Transitions: []TransitionDef{
+			{Event: eventForfeit, From: playerPlaying, To: playerForfeited},
+			{Event: eventMove, From: playerPlaying, To: playerPlaying},
+			{Event: eventPlay, From: playerReady, To: playerPlaying},
+			{Event: eventReady, From: playerIdle, To: playerReady},
+			{Event: eventReset, From: playerForfeited, To: playerIdle},
+			{Event: eventReset, From: playerIdle, To: playerIdle},
+			{Event: eventReset, From: playerPlaying, To: playerIdle},
+			{Event: eventReset, From: playerReady, To: playerIdle},
+		},
+	}
+	if !reflect.DeepEqual(def, want) {
+		t.Errorf("player definition %+v, want %+v", def, want)
+	}
+
+	var game FSMDefinition
+	call(t, c, "definition", definitionRequest{Type: fsmTypeGame}, &game)
+	if game.Initial != gameLobby || len(game.Transitions) == 0 {
+		t.Errorf("game definition %+v", game)
+	}
+	if code := callError(t, c, "definition", definitionRequest{Type: "referee"}); code != CodeUnknownFSMType {
+		t.Errorf("definition of an unknown type: code %d, want %d", code, CodeUnknownFSMType)
+	}
+}
+
+func TestNoDefinitionForOtherMachines(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.PlayerMachine = func() StateMachine { return newMapMachine(NewPlayerFSM().(*FSM).Definition()) }
+	})
+	c := connect(t, h, "alice")
+	if code := callError(t, c, "definition", definitionRequest{Type: fsmTypePlayer}); code != CodeUnknownFSMType {
+		t.Errorf("definition of a machine that isn't an FSM: code %d, want %d", code, CodeUnknownFSMType)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvariant is returned when a machine breaks one of its invariants.
+var ErrInvariant = errors.New("fsm invariant violated")
+
+// AddInvariant registers fn, checked by CheckInvariants after the built-in
+// invariants. It runs with the machine unlocked and may call its methods.
+func (f *FSM) AddInvariant(fn func(*FSM) error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.invariants = append(f.invariants, fn)
+}
+
+// CheckInvariants checks that the current state is a state of the machine,
+// then the invariants registered with AddInvariant.
+func (f *FSM) CheckInvariants() error {
+	f.mu.Lock()
+	current, known := f.current, f.hasState(f.current)
+	invariants := append([]func(*FSM) error{}, f.invariants...)
+	f.mu.Unlock()
+	if !known {
+		return fmt.Errorf("%w: current state %q is not a state of the machine", ErrInvariant, current)
+	}
+	for _, fn := range invariants {
+		if err := fn(f); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvariant, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Keys of FSM labels. Labels are exported as metric labels, so the keys
+// are fixed and the values of each key bounded.
+const (
+	FSMLabelMode   = "mode"
+	FSMLabelRegion = "region"
+)
+
+// fsmLabelKeys are the accepted label keys, in metric label order.
+var fsmLabelKeys = []string{FSMLabelMode, FSMLabelRegion}
+
+const (
+	// maxFSMLabelValues bounds the distinct values of each label key
+	// across the process.
+	maxFSMLabelValues = 32
+	// maxFSMLabelLength bounds the length of a label value.
+	maxFSMLabelLength = 64
+)
+
+// ErrInvalidLabel is returned by SetLabels for unknown keys, oversized
+// values and values past the cardinality bound of their key.
+var ErrInvalidLabel = errors.New("invalid fsm label")
+
+// labelValues tracks the values seen per label key to bound their
+// cardinality.
+var labelValues = struct {
+	sync.Mutex
+	seen map[string]map[string]bool
+}{seen: make(map[string]map[string]bool)}
+
+// checkLabels validates labels, recording their values.
+func checkLabels(labels map[string]string) error {
+	labelValues.Lock()
+	defer labelValues.Unlock()
+	for k, v := range labels {
+		if !isFSMLabelKey(k) {
+			return fmt.Errorf("%w: unknown key %q, expected one of %s", ErrInvalidLabel, k, strings.Join(fsmLabelKeys, ", "))
+		}
+		if v == "" || len(v) > maxFSMLabelLength {
+			return fmt.Errorf("%w: %s value must be 1 to %d bytes", ErrInvalidLabel, k, maxFSMLabelLength)
+		}
+		if !labelValues.seen[k][v] && len(labelValues.seen[k]) >= maxFSMLabelValues {
+			return fmt.Errorf("%w: %s already has %d values", ErrInvalidLabel, k, maxFSMLabelValues)
+		}
+	}
+	for k, v := range labels {
+		if labelValues.seen[k] == nil {
+			labelValues.seen[k] = make(map[string]bool)
+		}
+		labelValues.seen[k][v] = true
+	}
+	return nil
+}
+
+func isFSMLabelKey(key string) bool {
+	for _, k := range fsmLabelKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// SetLabels tags the machine with labels, replacing the previous ones. Keys
+// must be one of the FSMLabel constants.
+func (f *FSM) SetLabels(labels map[string]string) error {
+	if err := checkLabels(labels); err != nil {
+		return err
+	}
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.labels = copied
+	return nil
+}
+
+// Labels returns a copy of the labels of the machine.
+func (f *FSM) Labels() map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.labels) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(f.labels))
+	for k, v := range f.labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// countLabeled counts a transition in fsm_labeled_transitions_total. It must be called
+// with f.mu held.
+func (f *FSM) countLabeled() {
+	if len(f.labels) == 0 {
+		return
+	}
+	values := make([]string, len(fsmLabelKeys))
+	for i, k := range fsmLabelKeys {
+		values[i] = f.labels[k]
+	}
+	metrics().labeledTransitions.Add(1, values...)
+}
+
+// labelsOf returns the labels of m, none if it doesn't support them.
+func labelsOf(m StateMachine) map[string]string {
+	if m, ok := m.(interface{ Labels() map[string]string }); ok {
+		return m.Labels()
+	}
+	return nil
+}
+
+// matchLabels reports whether labels has every key and value of filter.
+func matchLabels(labels, filter map[string]string) bool {
+	for k, v := range filter {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// labelCounts counts the rooms per "key=value" label.
+func labelCounts(rooms []*Room) map[string]int {
+	counts := make(map[string]int)
+	for _, r := range rooms {
+		for k, v := range r.Game.Labels() {
+			counts[k+"="+v]++
+		}
+	}
+	return counts
+}
+
+// formatLabels renders labels as sorted "key=value" pairs for logs.
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLabelsFlowToStatsDumpAndMetrics(t *testing.T) {
+	m := &countingMetrics{counts: make(map[string]float64)}
+	h := newHarness(t, func(c *Config) {
+		c.Metrics = m
+		c.AdminUsers = []string{"admin"}
+		c.Stats.Interval = 10 * time.Second
+	})
+	admin := connect(t, h, "admin")
+	if err := admin.Subscribe(h.Server.config.Stats.Channel); err != nil {
+		t.Fatal(err)
+	}
+	casual := createRoom(t, connect(t, h, "owner"), createRoomRequest{Labels: map[string]string{FSMLabelMode: "casual"}}).Room
+	r, players := startGame(t, h, 2)
+	if err := r.Game.SetLabels(map[string]string{FSMLabelMode: "ranked", FSMLabelRegion: "eu"}); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Clock.Advance(10 * time.Second)
+	var stats ServerStats
+	if err := json.Unmarshal(nextMessage(t, admin, msgServerStats).Message.Payload, &stats); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"mode=casual": 1, "mode=ranked": 1, "region=eu": 1}; !reflect.DeepEqual(stats.Labels, want) {
+		t.Errorf("stats labels %v, want %v", stats.Labels, want)
+	}
+
+	var dump FSMDump
+	call(t, admin, "dump", dumpRequest{Labels: map[string]string{FSMLabelMode: "casual"}}, &dump)
+	if len(dump.FSMs) != 1 || dump.FSMs[0].Key != "room:"+casual {
+		t.Errorf("dump of the casual rooms %+v, want room %s", dump.FSMs, casual)
+	}
+
+	call(t, players[0], "forfeit", nil, nil)
+	if n := m.count("fsm_labeled_transitions_total", "ranked", "eu"); n == 0 {
+		t.Error("transition of the labeled game not counted")
+	}
+}
+
+func TestInvalidLabelsRejected(t *testing.T) {
+	labelValues.Lock()
+	saved := labelValues.seen
+	labelValues.seen = make(map[string]map[string]bool)
+	labelValues.Unlock()
+	t.Cleanup(func() {
+		labelValues.Lock()
+		labelValues.seen = saved
+		labelValues.Unlock()
+	})
+
+	f := NewFSM("a", nil)
+	for _, labels := range []map[string]string{
+		{"tenant": "acme"},
+		{FSMLabelMode: ""},
+		{FSMLabelMode: strings.Repeat("x", maxFSMLabelLength+1)},
+	} {
+		if err := f.SetLabels(labels); !errors.Is(err, ErrInvalidLabel) {
+			t.Errorf("labels %v: %v, want %v", labels, err, ErrInvalidLabel)
+		}
+	}
+
+	for i := 0; i < maxFSMLabelValues; i++ {
+		if err := f.SetLabels(map[string]string{FSMLabelRegion: fmt.Sprintf("r%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.SetLabels(map[string]string{FSMLabelRegion: "one-too-many"}); !errors.Is(err, ErrInvalidLabel) {
+		t.Errorf("label past the cardinality bound: %v, want %v", err, ErrInvalidLabel)
+	}
+	// Values already seen are still accepted.
+	if err := f.SetLabels(map[string]string{FSMLabelRegion: "r0"}); err != nil {
+		t.Errorf("known label value rejected: %v", err)
+	}
+}
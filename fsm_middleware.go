@@ -0,0 +1,28 @@
+package main
+
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// LoggingMiddleware logs every transition of the machine named name with
+// its duration, the client that triggered it, and its error if it failed.
+func LoggingMiddleware(l *zerolog.Logger, name string) Middleware {
+	return func(next TransitionFunc) TransitionFunc {
+		return func(t *TransitionContext) error {
+			start := time.Now()
+			err := next(t)
+			by := t.Client()
+			if by == "" {
+				by = "server"
+			}
+			if err != nil {
+				l.Warn().Msgf("%s: %s from %s to %s by %s failed after %s: %s", name, t.Event, t.From, t.To, by, time.Since(start), err.Error())
+				return err
+			}
+			l.Debug().Msgf("%s: %s from %s to %s by %s in %s", name, t.Event, t.From, t.To, by, time.Since(start))
+			return nil
+		}
+	}
+}
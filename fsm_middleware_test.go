@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestMiddlewareChainOrder(t *testing.T) {
+	f := NewFSM("a", []Transition{{Event: "go", From: "a", To: "b"}})
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next TransitionFunc) TransitionFunc {
+			return func(t *TransitionContext) error {
+				calls = append(calls, name+" before")
+				err := next(t)
+				calls = append(calls, name+" after")
+				return err
+			}
+		}
+	}
+	f.Use(record("first"))
+	f.Use(record("second"))
+	f.OnEnter("b", func(*TransitionContext) { calls = append(calls, "enter b") })
+
+	if err := f.Fire("go"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"first before", "second before", "enter b", "second after", "first after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls %v, want %v", calls, want)
+	}
+}
+
+func TestMiddlewareStopsTheTransition(t *testing.T) {
+	f := NewFSM("a", []Transition{{Event: "go", From: "a", To: "b"}})
+	refused := errors.New("refused")
+	f.Use(func(TransitionFunc) TransitionFunc {
+		return func(*TransitionContext) error { return refused }
+	})
+	if err := f.Fire("go"); !errors.Is(err, refused) {
+		t.Errorf("fire through a refusing middleware: %v, want %v", err, refused)
+	}
+	if f.Current() != "a" {
+		t.Errorf("machine moved to %s, want a", f.Current())
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var out strings.Builder
+	l := zerolog.New(&out).Level(zerolog.DebugLevel)
+	f := NewFSM("a", []Transition{{Event: "go", From: "a", To: "b"}})
+	f.Use(LoggingMiddleware(&l, "room r1"))
+	if err := f.FireWith("go", map[string]any{metaClient: "c1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, "room r1: go from a to b by c1") {
+		t.Errorf("logged %q", got)
+	}
+}
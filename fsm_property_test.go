@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// PropertyConfig holds the settings of CheckProperty.
+type PropertyConfig struct {
+	// Runs is the number of sequences fired, 100 when zero.
+	Runs int
+	// Length is the number of events of each sequence, 50 when zero.
+	Length int
+	// Seed seeds the sequences, the current time when zero. Failures report
+	// it so that they can be replayed.
+	Seed int64
+	// Events are drawn from, those of the machine's definition when empty.
+	Events []string
+}
+
+// PropertyFailure is returned by CheckProperty with the shortest sequence
+// of events it found breaking an invariant.
+type PropertyFailure struct {
+	Seed   int64
+	Events []string
+	Err    error
+}
+
+func (e *PropertyFailure) Error() string {
+	return fmt.Sprintf("seed %d: after [%s]: %s", e.Seed, strings.Join(e.Events, " "), e.Err.Error())
+}
+
+func (e *PropertyFailure) Unwrap() error {
+	return e.Err
+}
+
+// CheckProperty fires random sequences of events at fresh machines made by
+// newFSM and checks after each Fire that the machine keeps its invariants:
+// those of CheckInvariants, a failed Fire leaving the state as it was, and
+// a successful one taking a transition of the definition, so that no
+// terminal state ever transitions. The failing sequence is shrunk to a
+// minimal one before being returned in a PropertyFailure. State timeouts
+// should run on a clock the test controls.
+func CheckProperty(newFSM func() *FSM, config PropertyConfig) error {
+	if config.Runs <= 0 {
+		config.Runs = 100
+	}
+	if config.Length <= 0 {
+		config.Length = 50
+	}
+	if config.Seed == 0 {
+		config.Seed = time.Now().UnixNano()
+	}
+	events := config.Events
+	if len(events) == 0 {
+		events = newFSM().Definition().Events
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	rnd := rand.New(rand.NewSource(config.Seed))
+	for run := 0; run < config.Runs; run++ {
+		seq := make([]string, config.Length)
+		for i := range seq {
+			seq[i] = events[rnd.Intn(len(events))]
+		}
+		n, err := replayEvents(newFSM, seq)
+		if err == nil {
+			continue
+		}
+		seq, err = shrinkEvents(newFSM, seq[:n], err)
+		return &PropertyFailure{Seed: config.Seed, Events: seq, Err: err}
+	}
+	return nil
+}
+
+// replayEvents fires seq at a machine made by newFSM and returns the number
+// of events fired up to the first broken invariant, and its error.
+func replayEvents(newFSM func() *FSM, seq []string) (int, error) {
+	f := newFSM()
+	var observed []Transition
+	f.OnTransition(func(t Transition) { observed = append(observed, t) })
+	if err := f.CheckInvariants(); err != nil {
+		return 0, err
+	}
+	for i, event := range seq {
+		before := f.Current()
+		observed = observed[:0]
+		err := f.Fire(event)
+		if err := checkFire(f, event, before, err, observed); err != nil {
+			return i + 1, err
+		}
+		if err := f.CheckInvariants(); err != nil {
+			return i + 1, err
+		}
+	}
+	return len(seq), nil
+}
+
+// checkFire checks the outcome of firing event from the state before.
+func checkFire(f *FSM, event, before string, err error, observed []Transition) error {
+	current := f.Current()
+	if err != nil {
+		if current != before {
+			return fmt.Errorf("%w: failed %s moved %s to %s", ErrInvariant, event, before, current)
+		}
+		return nil
+	}
+	if len(observed) != 1 {
+		return fmt.Errorf("%w: %s observed %d transitions", ErrInvariant, event, len(observed))
+	}
+	t := observed[0]
+	f.mu.Lock()
+	to, ok := f.transitions[event][before]
+	f.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s transitioned from %s, which has none for it", ErrInvariant, event, before)
+	}
+	if t.From != before || t.To != to || current != to {
+		return fmt.Errorf("%w: %s from %s went to %s (observed %s to %s), not %s", ErrInvariant, event, before, current, t.From, t.To, to)
+	}
+	return nil
+}
+
+// shrinkEvents removes events from seq, which fails with err, for as long
+// as it still fails, and returns the shortest sequence and its error.
+func shrinkEvents(newFSM func() *FSM, seq []string, err error) ([]string, error) {
+	for shrunk := true; shrunk; {
+		shrunk = false
+		for i := 0; i < len(seq); i++ {
+			candidate := append(append([]string{}, seq[:i]...), seq[i+1:]...)
+			if n, cerr := replayEvents(newFSM, candidate); cerr != nil {
+				seq, err, shrunk = candidate[:n], cerr, true
+				i--
+			}
+		}
+	}
+	return seq, err
+}
+
+func TestGameMachinesKeepInvariants(t *testing.T) {
+	for name, newFSM := range map[string]func() *FSM{
+		"player": func() *FSM { return NewPlayerFSM().(*FSM) },
+		"game":   func() *FSM { return newRoom("r1", DefaultRoomConfig(), NewFakeClock(time.Now())).Game },
+	} {
+		if err := CheckProperty(newFSM, PropertyConfig{Runs: 200}); err != nil {
+			t.Errorf("%s machine: %s", name, err)
+		}
+	}
+}
+
+func TestCheckPropertyShrinksFailures(t *testing.T) {
+	newFSM := func() *FSM {
+		f := NewFSM("a", []Transition{
+			{Event: "next", From: "a", To: "b"},
+			{Event: "next", From: "b", To: "c"},
+			{Event: "back", From: "b", To: "a"},
+			{Event: "noop", From: "c", To: "c"},
+		})
+		f.AddInvariant(func(f *FSM) error {
+			if f.Current() == "c" {
+				return errors.New("reached c")
+			}
+			return nil
+		})
+		return f
+	}
+	err := CheckProperty(newFSM, PropertyConfig{Seed: 1, Runs: 100, Length: 30})
+	var failure *PropertyFailure
+	if !errors.As(err, &failure) {
+		t.Fatalf("broken invariant not found: %v", err)
+	}
+	if !errors.Is(err, ErrInvariant) {
+		t.Errorf("failure %v doesn't wrap %v", err, ErrInvariant)
+	}
+	if got := strings.Join(failure.Events, " "); got != "next next" {
+		t.Errorf("shrunk to [%s], want [next next]", got)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+)
+
+// ErrReentrantFire is returned by Fire when called from a guard, action or
+// middleware of the same machine, which would otherwise deadlock.
+var ErrReentrantFire = errors.New("re-entrant fire")
+
+// lockFire locks f for firing event. It returns ErrReentrantFire, logging
+// the stack of the offending caller, when the goroutine already holds the
+// lock, or runs an action on behalf of the goroutine holding it.
+func (f *FSM) lockFire(event string) error {
+	gid := goroutineID()
+	if !f.mu.TryLock() {
+		if f.owner.Load() == gid || f.actionOwner.Load() == gid {
+			log.Error().Msgf("fsm: re-entrant fire of %s from a guard, action or middleware of the same machine:\n%s", event, debug.Stack())
+			return ErrReentrantFire
+		}
+		f.mu.Lock()
+	}
+	f.owner.Store(gid)
+	return nil
+}
+
+// unlockFire releases the lock taken by lockFire.
+func (f *FSM) unlockFire() {
+	f.owner.Store(0)
+	f.mu.Unlock()
+}
+
+// goroutineID returns the ID of the calling goroutine, parsed from the
+// "goroutine N [running]:" header of its stack trace.
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReentrantFireRejected(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		hook func(f *FSM, fn func())
+	}{
+		{"on enter", func(f *FSM, fn func()) { f.OnEnter("b", func(*TransitionContext) { fn() }) }},
+		{"on exit", func(f *FSM, fn func()) { f.OnExit("a", func(*TransitionContext) { fn() }) }},
+		{"guard", func(f *FSM, fn func()) { f.AddGuard("go", func(*TransitionContext) bool { fn(); return true }) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := NewFSM("a", []Transition{{Event: "go", From: "a", To: "b"}, {Event: "back", From: "b", To: "a"}})
+			var reentrant error
+			tc.hook(f, func() { reentrant = f.Fire("back") })
+
+			done := make(chan error, 1)
+			go func() { done <- f.Fire("go") }()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("re-entrant fire blocked")
+			}
+			if !errors.Is(reentrant, ErrReentrantFire) {
+				t.Errorf("re-entrant fire: %v, want %v", reentrant, ErrReentrantFire)
+			}
+			if f.Current() != "b" {
+				t.Errorf("state %s, want b", f.Current())
+			}
+		})
+	}
+}
+
+func TestReentrantFireFromTimedAction(t *testing.T) {
+	f := NewFSM("a", []Transition{{Event: "go", From: "a", To: "b"}, {Event: "back", From: "b", To: "a"}})
+	clock := NewFakeClock(time.Now())
+	f.SetClock(clock)
+	f.SetActionTimeout("", time.Second, ActionTimeoutContinue)
+	var reentrant error
+	f.OnEnter("b", func(*TransitionContext) {
+		reentrant = f.Fire("back")
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- f.Fire("go") }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("re-entrant fire from a timed action blocked")
+	}
+	if !errors.Is(reentrant, ErrReentrantFire) {
+		t.Errorf("re-entrant fire: %v, want %v", reentrant, ErrReentrantFire)
+	}
+	if f.Current() != "b" {
+		t.Errorf("state %s, want b", f.Current())
+	}
+}
+
+func TestFireFromActionAfterTimeout(t *testing.T) {
+	f := NewFSM("a", []Transition{{Event: "go", From: "a", To: "b"}, {Event: "back", From: "b", To: "a"}})
+	clock := NewFakeClock(time.Now())
+	f.SetClock(clock)
+	f.SetActionTimeout("", time.Second, ActionTimeoutContinue)
+	release, fired := make(chan struct{}), make(chan error, 1)
+	f.OnEnter("b", func(*TransitionContext) {
+		<-release
+		fired <- f.Fire("back")
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- f.Fire("go") }()
+	for clock.Pending() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// Past its timeout, the action no longer holds the machine.
+	close(release)
+	if err := <-fired; err != nil {
+		t.Fatalf("fire from an action past its timeout: %s", err)
+	}
+	if f.Current() != "a" {
+		t.Errorf("state %s, want a", f.Current())
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnknownTemplate is returned by Instantiate for unregistered names.
+var ErrUnknownTemplate = errors.New("unknown fsm template")
+
+// FSMTemplate is the definition of a machine: its initial state,
+// transitions and guards per event.
+type FSMTemplate struct {
+	Initial     string
+	Transitions []Transition
+	Guards      map[string][]Guard
+}
+
+// FSMRegistry stores named FSM templates and instantiates independent
+// machines from them.
+type FSMRegistry struct {
+	mu        sync.RWMutex
+	templates map[string]FSMTemplate
+	instances map[string]uint64 // template name -> machines instantiated
+	bus       *transitionBus
+}
+
+// NewFSMRegistry creates an empty registry.
+func NewFSMRegistry() *FSMRegistry {
+	return &FSMRegistry{
+		templates: make(map[string]FSMTemplate),
+		instances: make(map[string]uint64),
+		bus:       newTransitionBus(),
+	}
+}
+
+// OnAnyTransition registers an observer notified of the transitions of
+// every machine instantiated by the registry, keyed "<template>:<n>" with n
+// numbering the instances of the template from 1. Like
+// Server.OnAnyTransition, it is called asynchronously and never delays the
+// machines.
+func (g *FSMRegistry) OnAnyTransition(fn func(fsmKey string, t Transition)) {
+	g.bus.OnAnyTransition(fn)
+}
+
+// Register stores t under name, replacing any previous template. t is
+// copied so later changes to its slices and maps don't affect the registry.
+func (g *FSMRegistry) Register(name string, t FSMTemplate) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.templates[name] = t.clone()
+}
+
+// Instantiate creates a machine in the initial state of the template
+// registered under name. Instances share no state with each other.
+func (g *FSMRegistry) Instantiate(name string) (*FSM, error) {
+	g.mu.Lock()
+	t, ok := g.templates[name]
+	if ok {
+		g.instances[name]++
+	}
+	n := g.instances[name]
+	g.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+	f := NewFSM(t.Initial, t.Transitions)
+	for event, guards := range t.Guards {
+		for _, guard := range guards {
+			f.AddGuard(event, guard)
+		}
+	}
+	key := fmt.Sprintf("%s:%d", name, n)
+	g.bus.watch(f, func() string { return key })
+	return f, nil
+}
+
+// Names returns the names of the registered templates.
+func (g *FSMRegistry) Names() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	names := make([]string, 0, len(g.templates))
+	for name := range g.templates {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (t FSMTemplate) clone() FSMTemplate {
+	c := FSMTemplate{
+		Initial:     t.Initial,
+		Transitions: append([]Transition{}, t.Transitions...),
+		Guards:      make(map[string][]Guard, len(t.Guards)),
+	}
+	for event, guards := range t.Guards {
+		c.Guards[event] = append([]Guard{}, guards...)
+	}
+	return c
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInstancesOfATemplateAreIndependent(t *testing.T) {
+	g := NewFSMRegistry()
+	transitions := []Transition{{Event: "go", From: "a", To: "b"}}
+	open := true
+	g.Register("door", FSMTemplate{
+		Initial:     "a",
+		Transitions: transitions,
+		Guards:      map[string][]Guard{"go": {func(*TransitionContext) bool { return open }}},
+	})
+	// The registry keeps its own copy of the template.
+	transitions[0].To = "c"
+
+	first, err := g.Instantiate("door")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := g.Instantiate("door")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Fire("go"); err != nil {
+		t.Fatal(err)
+	}
+	if first.Current() != "b" || second.Current() != "a" {
+		t.Errorf("instances in %s and %s, want b and a", first.Current(), second.Current())
+	}
+	first.AddGuard("go", func(*TransitionContext) bool { return false })
+	if err := second.Fire("go"); err != nil {
+		t.Errorf("guard added to an instance applies to another: %s", err)
+	}
+
+	open = false
+	third, _ := g.Instantiate("door")
+	if err := third.Fire("go"); !errors.Is(err, ErrGuardFailed) {
+		t.Errorf("template guard: %v, want %v", err, ErrGuardFailed)
+	}
+	if _, err := g.Instantiate("window"); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("unknown template: %v, want %v", err, ErrUnknownTemplate)
+	}
+}
+
+func TestOnAnyTransitionSeesEveryMachine(t *testing.T) {
+	g := NewFSMRegistry()
+	g.Register("door", FSMTemplate{Initial: "closed", Transitions: []Transition{{Event: "open", From: "closed", To: "open"}}})
+	g.Register("light", FSMTemplate{Initial: "off", Transitions: []Transition{{Event: "on", From: "off", To: "on"}}})
+	seen := make(chan string, 10)
+	g.OnAnyTransition(func(key string, t Transition) { seen <- key + " " + t.Event })
+
+	fire := func(template, event string) {
+		m, err := g.Instantiate(template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Fire(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fire("door", "open")
+	fire("light", "on")
+	fire("door", "open")
+
+	got := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		select {
+		case s := <-seen:
+			got[s] = true
+		case <-time.After(time.Second):
+			t.Fatalf("observed %v, want 3 transitions", got)
+		}
+	}
+	if want := map[string]bool{"door:1 open": true, "door:2 open": true, "light:1 on": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("observed %v, want %v", got, want)
+	}
+}
+
+func TestBlockedObserverDoesNotDelayMachines(t *testing.T) {
+	g := NewFSMRegistry()
+	g.Register("toggle", FSMTemplate{Initial: "a", Transitions: []Transition{
+		{Event: "flip", From: "a", To: "b"},
+		{Event: "flip", From: "b", To: "a"},
+	}})
+	release := make(chan struct{})
+	defer close(release)
+	g.OnAnyTransition(func(string, Transition) { <-release })
+
+	m, err := g.Instantiate("toggle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2*transitionBusSize; i++ {
+			_ = m.Fire("flip")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("machine blocked by its observer")
+	}
+}
+
+func TestServerOnAnyTransition(t *testing.T) {
+	h := newHarness(t, nil)
+	var mu sync.Mutex
+	keys := make(map[string]bool)
+	h.Server.OnAnyTransition(func(key string, _ Transition) {
+		mu.Lock()
+		keys[key] = true
+		mu.Unlock()
+	})
+	r, players := startGame(t, h, 2)
+	want := []string{"room:" + r.ID, "player:" + players[0].ID, "player:" + players[1].ID}
+	eventually(t, "the transitions of the game and its players", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, key := range want {
+			if !keys[key] {
+				return false
+			}
+		}
+		return true
+	})
+}
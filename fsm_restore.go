@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownState is returned by Restore for states the machine doesn't
+// have, e.g. removed since the snapshot was taken.
+var ErrUnknownState = errors.New("unknown state")
+
+// RestorePolicy decides what Restore does with a state the machine doesn't
+// have.
+type RestorePolicy string
+
+const (
+	// RestoreFail leaves the machine as is and returns ErrUnknownState.
+	RestoreFail RestorePolicy = ""
+	// RestoreFallback restores the fallback state instead.
+	RestoreFallback RestorePolicy = "fallback"
+)
+
+func (p RestorePolicy) validate() error {
+	switch p {
+	case RestoreFail, RestoreFallback:
+		return nil
+	}
+	return fmt.Errorf("unknown restore policy %q", p)
+}
+
+// RestoreConfig holds the restore policy of a machine.
+type RestoreConfig struct {
+	Policy RestorePolicy
+	// Fallback is the state restored instead of unknown ones with
+	// RestoreFallback, the initial state when empty.
+	Fallback string
+}
+
+// SetRestore sets the policy of Restore for unknown states. The fallback
+// must be a state of the machine.
+func (f *FSM) SetRestore(config RestoreConfig) error {
+	if err := config.Policy.validate(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if config.Policy == RestoreFallback && config.Fallback != "" && !f.hasState(config.Fallback) {
+		return fmt.Errorf("%w: fallback %q", ErrUnknownState, config.Fallback)
+	}
+	f.restore = config
+	return nil
+}
+
+// Restore puts the machine in state without a transition: no guard, action
+// or observer runs. It is meant for reloading snapshots; the timeout of
+// state is armed as if it had just been entered. States the machine doesn't
+// have, once the definition changed, are handled by its RestoreConfig.
+func (f *FSM) Restore(state string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.hasState(state) {
+		if f.restore.Policy != RestoreFallback {
+			return fmt.Errorf("%w: %q can't be restored", ErrUnknownState, state)
+		}
+		fallback := f.restore.Fallback
+		if fallback == "" {
+			fallback = f.initial
+		}
+		log.Warn().Msgf("fsm: state %s no longer exists, restoring %s instead", state, fallback)
+		state = fallback
+	}
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	f.current = state
+	f.changedAt = f.clock.Now()
+	f.armTimer()
+	return nil
+}
+
+// validateRestore checks the restore policies of config against the game
+// and player machines.
+func validateRestore(config Config, players *PlayerRegistry) error {
+	if err := newRoom("", config.Room, systemClock{}).Game.SetRestore(config.Room.Restore); err != nil {
+		return fmt.Errorf("game restore: %w", err)
+	}
+	if err := setRestore(players.machine(), config.PlayerRestore); err != nil {
+		return fmt.Errorf("player restore: %w", err)
+	}
+	return nil
+}
+
+// HasState reports whether state is a state of the machine.
+func (f *FSM) HasState(state string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.hasState(state)
+}
+
+// hasState reports whether state is the initial state or that of a
+// transition. It must be called with f.mu held.
+func (f *FSM) hasState(state string) bool {
+	if state == f.initial {
+		return true
+	}
+	for _, froms := range f.transitions {
+		for from, to := range froms {
+			if from == state || to == state {
+				return true
+			}
+		}
+	}
+	return false
+}
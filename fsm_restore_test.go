@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func newDoorFSM() *FSM {
+	return NewFSM("closed", []Transition{
+		{Event: "open", From: "closed", To: "open"},
+		{Event: "close", From: "open", To: "closed"},
+	})
+}
+
+func TestRestoreRemovedState(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		config  RestoreConfig
+		want    string
+		wantErr error
+	}{
+		{"fail", RestoreConfig{}, "open", ErrUnknownState},
+		{"fallback", RestoreConfig{Policy: RestoreFallback, Fallback: "open"}, "open", nil},
+		{"initial fallback", RestoreConfig{Policy: RestoreFallback}, "closed", nil},
+	} {
+		f := newDoorFSM()
+		if err := f.SetRestore(tc.config); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Fire("open"); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Restore("locked"); !errors.Is(err, tc.wantErr) {
+			t.Errorf("%s: restore of a removed state: %v, want %v", tc.name, err, tc.wantErr)
+		}
+		if f.Current() != tc.want {
+			t.Errorf("%s: restored %s, want %s", tc.name, f.Current(), tc.want)
+		}
+		// Known states are restored under any policy.
+		if err := f.Restore("closed"); err != nil || f.Current() != "closed" {
+			t.Errorf("%s: restored %s (%v), want closed", tc.name, f.Current(), err)
+		}
+	}
+}
+
+func TestSetRestoreRejectsUnknownFallback(t *testing.T) {
+	f := newDoorFSM()
+	if err := f.SetRestore(RestoreConfig{Policy: RestoreFallback, Fallback: "locked"}); !errors.Is(err, ErrUnknownState) {
+		t.Errorf("unknown fallback: %v, want %v", err, ErrUnknownState)
+	}
+	if err := f.SetRestore(RestoreConfig{Policy: "guess"}); err == nil {
+		t.Error("unknown policy accepted")
+	}
+	config := DefaultConfig()
+	config.Room.Restore = RestoreConfig{Policy: RestoreFallback, Fallback: "locked"}
+	if _, err := NewServer(config); !errors.Is(err, ErrUnknownState) {
+		t.Errorf("server with an unknown game fallback: %v, want %v", err, ErrUnknownState)
+	}
+}
+
+func TestRestoreGameInRemovedState(t *testing.T) {
+	snap := GameSnapshot{Room: "r1", State: "removed", Players: []PlayerSnapshot{{Client: "c1"}}}
+
+	h := newHarness(t, nil)
+	if _, err := h.Server.rooms.Restore(snap); !errors.Is(err, ErrUnknownState) {
+		t.Fatalf("restore under the fail policy: %v, want %v", err, ErrUnknownState)
+	}
+	if _, ok := h.Server.rooms.Room(snap.Room); ok {
+		t.Error("room in a removed state registered")
+	}
+
+	h = newHarness(t, func(c *Config) {
+		c.Room.Restore = RestoreConfig{Policy: RestoreFallback, Fallback: gameFinished}
+	})
+	r, err := h.Server.rooms.Restore(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Game.Current() != gameFinished {
+		t.Errorf("restored game %s, want the fallback %s", r.Game.Current(), gameFinished)
+	}
+	if _, ok := h.Server.rooms.Room(snap.Room); !ok {
+		t.Error("room restored with the fallback not registered")
+	}
+}
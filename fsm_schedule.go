@@ -0,0 +1,68 @@
+package main
+
+import "time"
+
+// ScheduleEvent fires event at the time at of the machine's clock, whatever
+// the state then, e.g. to end a round at noon. The event is dropped if it
+// can't be fired from the state the machine is in when it is due. Calling
+// cancel before then, or closing the machine, cancels it.
+func (f *FSM) ScheduleEvent(at time.Time, event string) (cancel func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return func() {}
+	}
+	if f.scheduled == nil {
+		f.scheduled = make(map[uint64]Timer)
+	}
+	f.schedules++
+	id := f.schedules
+	d := at.Sub(f.clock.Now())
+	if d < 0 {
+		d = 0
+	}
+	// The timer can't run before it is recorded: it needs f.mu first.
+	f.scheduled[id] = f.clock.AfterFunc(d, func() {
+		f.mu.Lock()
+		_, current := f.scheduled[id]
+		delete(f.scheduled, id)
+		f.mu.Unlock()
+		if !current {
+			return
+		}
+		if err := f.Fire(event); err != nil {
+			log.Info().Msgf("fsm scheduled %s dropped: %s", event, err.Error())
+		}
+	})
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if t, ok := f.scheduled[id]; ok {
+			t.Stop()
+			delete(f.scheduled, id)
+		}
+	}
+}
+
+// Scheduled returns the number of events scheduled and not fired yet.
+func (f *FSM) Scheduled() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.scheduled)
+}
+
+// Close disposes of the machine: it stops the timeout of the current state
+// and cancels the scheduled events, later ones being ignored.
+func (f *FSM) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	for id, t := range f.scheduled {
+		t.Stop()
+		delete(f.scheduled, id)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func scheduledFSM() (*FSM, *FakeClock) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	f := NewFSM("round", []Transition{{Event: "end", From: "round", To: "over"}})
+	f.SetClock(clock)
+	return f, clock
+}
+
+func TestScheduleEventFires(t *testing.T) {
+	f, clock := scheduledFSM()
+	f.ScheduleEvent(clock.Now().Add(time.Hour), "end")
+
+	clock.Advance(time.Hour - time.Second)
+	if f.Current() != "round" || f.Scheduled() != 1 {
+		t.Fatalf("in %s with %d scheduled before the hour, want round and 1", f.Current(), f.Scheduled())
+	}
+	clock.Advance(time.Second)
+	if f.Current() != "over" || f.Scheduled() != 0 {
+		t.Errorf("in %s with %d scheduled at the hour, want over and 0", f.Current(), f.Scheduled())
+	}
+}
+
+func TestScheduleEventPastFiresRightAway(t *testing.T) {
+	f, clock := scheduledFSM()
+	f.ScheduleEvent(clock.Now().Add(-time.Minute), "end")
+	clock.Advance(0)
+	if f.Current() != "over" {
+		t.Errorf("in %s, want over", f.Current())
+	}
+}
+
+func TestScheduleEventCancelled(t *testing.T) {
+	f, clock := scheduledFSM()
+	cancel := f.ScheduleEvent(clock.Now().Add(time.Minute), "end")
+	cancel()
+	cancel()
+	clock.Advance(time.Hour)
+	if f.Current() != "round" || f.Scheduled() != 0 || clock.Pending() != 0 {
+		t.Errorf("in %s with %d scheduled, %d timers, want round and none", f.Current(), f.Scheduled(), clock.Pending())
+	}
+}
+
+func TestScheduleEventDroppedWhenInvalid(t *testing.T) {
+	f, clock := scheduledFSM()
+	f.ScheduleEvent(clock.Now().Add(time.Minute), "end")
+	f.ScheduleEvent(clock.Now().Add(2*time.Minute), "end")
+	clock.Advance(time.Hour)
+	if f.Current() != "over" || f.Scheduled() != 0 {
+		t.Errorf("in %s with %d scheduled, want over and none", f.Current(), f.Scheduled())
+	}
+}
+
+func TestCloseCancelsScheduledEvents(t *testing.T) {
+	f, clock := scheduledFSM()
+	f.ScheduleEvent(clock.Now().Add(time.Minute), "end")
+	f.Close()
+	f.ScheduleEvent(clock.Now().Add(time.Minute), "end")
+	clock.Advance(time.Hour)
+	if f.Current() != "round" || f.Scheduled() != 0 || clock.Pending() != 0 {
+		t.Errorf("closed machine in %s with %d scheduled, %d timers, want round and none", f.Current(), f.Scheduled(), clock.Pending())
+	}
+}
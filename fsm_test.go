@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFrozenFSMRejectsEvents(t *testing.T) {
+	f := NewFSM("a", []Transition{{Event: "go", From: "a", To: "b"}})
+	actions := 0
+	f.OnExit("a", func(*TransitionContext) { actions++ })
+	f.OnEnter("b", func(*TransitionContext) { actions++ })
+
+	f.Freeze()
+	if !f.Frozen() {
+		t.Fatal("not frozen")
+	}
+	if err := f.Fire("go"); !errors.Is(err, ErrFrozen) {
+		t.Fatalf("fire while frozen: %v, want %v", err, ErrFrozen)
+	}
+	if f.Current() != "a" || actions != 0 {
+		t.Fatalf("frozen machine moved to %s, %d actions run", f.Current(), actions)
+	}
+
+	f.Unfreeze()
+	if err := f.Fire("go"); err != nil {
+		t.Fatalf("fire once unfrozen: %s", err)
+	}
+	if f.Current() != "b" || actions != 2 {
+		t.Errorf("unfrozen machine in %s, %d actions run, want b and 2", f.Current(), actions)
+	}
+}
+
+func TestShutdownFreezesGames(t *testing.T) {
+	h := newHarness(t, nil)
+	r, _ := startGame(t, h, 2)
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Game.Fire(eventPause); !errors.Is(err, ErrFrozen) {
+		t.Errorf("fire after shutdown: %v, want %v", err, ErrFrozen)
+	}
+}
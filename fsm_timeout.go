@@ -0,0 +1,93 @@
+package main
+
+import (
+	"time"
+)
+
+type stateTimeout struct {
+	after time.Duration
+	event string
+}
+
+// SetTimeout fires event when the machine stays in state for d. The timer
+// is armed each time state is entered and stopped when it is left.
+func (f *FSM) SetTimeout(state string, d time.Duration, event string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.timeouts[state] = stateTimeout{after: d, event: event}
+}
+
+// SuspendOn makes event keep the remaining time of the state it leaves: the
+// next time that state is entered, its timer resumes with what was left
+// instead of starting over.
+func (f *FSM) SuspendOn(event string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.suspendOn[event] = true
+}
+
+// Remaining returns the time left before the current state times out.
+func (f *FSM) Remaining() (time.Duration, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.timer == nil {
+		return 0, false
+	}
+	return f.deadline.Sub(f.clock.Now()), true
+}
+
+// StopTimer cancels the timeout of the current state, if any.
+func (f *FSM) StopTimer() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+}
+
+// ResetTimer re-arms the timeout of the current state with its full
+// duration, e.g. when the turn changes hands without a transition.
+func (f *FSM) ResetTimer() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	f.armTimer()
+}
+
+// stopTimer must be called with f.mu held when leaving the current state.
+func (f *FSM) stopTimer(event string) {
+	if f.timer == nil {
+		return
+	}
+	f.timer.Stop()
+	f.timer = nil
+	if f.suspendOn[event] {
+		f.suspended[f.current] = f.deadline.Sub(f.clock.Now())
+	}
+}
+
+// armTimer must be called with f.mu held after entering the current state.
+func (f *FSM) armTimer() {
+	timeout, ok := f.timeouts[f.current]
+	if !ok {
+		return
+	}
+	d := timeout.after
+	if remaining, ok := f.suspended[f.current]; ok {
+		d = remaining
+		delete(f.suspended, f.current)
+	}
+
+	f.timerGen++
+	gen := f.timerGen
+	f.deadline = f.clock.Now().Add(d)
+	f.timer = f.clock.AfterFunc(d, func() {
+		if err := f.fire(timeout.event, nil, gen); err != nil {
+			log.Warn().Msgf("fsm timeout of %s: %s", f.Current(), err.Error())
+		}
+	})
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/centrifugal/centrifuge"
+	centrigo "github.com/centrifugal/centrifuge-go"
+	"github.com/rs/zerolog"
+)
+
+// GameClient wraps a centrifuge-go client and dispatches received Message
+// envelopes to handlers registered per event type.
+//
+// Publications are handled by a pool of workers, off the read loop. Every
+// subscription is bound to one worker, so its publications are handled one
+// at a time, in arrival order: a slow handler delays the following
+// publications of its channel and of the channels sharing its worker. With a
+// single worker, the default, all publications are handled in arrival order.
+type GameClient struct {
+	*centrigo.Client
+
+	log      *zerolog.Logger
+	protocol centrifuge.ProtocolType
+
+	mu             sync.RWMutex
+	id             string
+	role           string
+	handlers       map[string]func(payload json.RawMessage)
+	defaultHandler func(msg Message)
+	observers      []func(msg Message)
+	gapHandler     func(channel string, from, to uint64)
+	resyncHandler  func(channel string)
+	seqs           map[string]uint64 // channel -> last sequence number
+	resyncs        map[string]bool   // channels to resync once subscribed
+	gameState      string            // reported by the last game.state event
+	signingKey     []byte            // signs the RPCs and publications, if set
+	keys           map[string][]byte // room ID -> key, see SetRoomKey
+	stateWaiters   map[string][]chan struct{}
+	workers        []chan publication
+	done           chan struct{}
+	closeOnce      sync.Once
+}
+
+// OnEvent registers the handler called for messages of eventType.
+func (c *GameClient) OnEvent(eventType string, handler func(payload json.RawMessage)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[eventType] = handler
+}
+
+// OnDefaultEvent registers the handler called for messages of a type
+// without a registered handler.
+func (c *GameClient) OnDefaultEvent(handler func(msg Message)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.defaultHandler = handler
+}
+
+// OnSequenceGap registers the handler called when messages of a room
+// channel were missed, from and to being the first and last sequence
+// numbers missing. The client may catch up with the recentEvents RPC.
+func (c *GameClient) OnSequenceGap(handler func(channel string, from, to uint64)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gapHandler = handler
+}
+
+// OnResyncRequired registers the handler called when a resync of a room
+// channel missed too many events to replay them, see Config.MaxReplay. The
+// client should then fetch the full state, e.g. with the state RPC.
+func (c *GameClient) OnResyncRequired(handler func(channel string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resyncHandler = handler
+}
+
+// checkSeq records seq, received on channel, reporting the messages missed
+// since the previous one.
+func (c *GameClient) checkSeq(channel string, seq uint64) {
+	c.mu.Lock()
+	last := c.seqs[channel]
+	if seq > last {
+		c.seqs[channel] = seq
+	}
+	handler := c.gapHandler
+	c.mu.Unlock()
+	if last == 0 || seq <= last+1 {
+		return
+	}
+	c.log.Warn().Msgf("[%s] missed messages %d to %d", channel, last+1, seq-1)
+	if handler != nil {
+		handler(channel, last+1, seq-1)
+	}
+}
+
+// OnAnyEvent registers a handler called with every message, before the
+// handler of its type.
+func (c *GameClient) OnAnyEvent(handler func(msg Message)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.observers = append(c.observers, handler)
+}
+
+func (c *GameClient) dispatch(channel string, data []byte) {
+	msg, err := unmarshalMessage(c.protocol, data)
+	if err == nil {
+		msg, err = decryptMessage(c.roomKey(channel), channel, msg)
+	}
+	if err == nil {
+		msg, err = decompressMessage(msg)
+	}
+	if err != nil {
+		c.log.Error().Msgf("[%s] %s", channel, err.Error())
+		return
+	}
+	c.handle(channel, msg)
+}
+
+// handle calls the observers and the handler of msg, received on channel.
+func (c *GameClient) handle(channel string, msg Message) {
+	c.mu.RLock()
+	handler, ok := c.handlers[msg.Type]
+	defaultHandler := c.defaultHandler
+	observers := c.observers
+	c.mu.RUnlock()
+
+	if msg.Seq != 0 {
+		c.checkSeq(channel, msg.Seq)
+	}
+	if msg.Type == msgGameState {
+		c.trackState(msg.Payload)
+	}
+	for _, fn := range observers {
+		fn(msg)
+	}
+	if ok {
+		handler(msg.Payload)
+		return
+	}
+	defaultHandler(msg)
+}
+
+// ClientOptions configures a GameClient.
+type ClientOptions struct {
+	// Token renews the connection token of the client before it expires.
+	Token TokenRefreshConfig
+	// Workers is the number of goroutines handling publications. Zero
+	// means 1, handling publications in arrival order.
+	Workers int
+	// SigningKey signs the RPCs and the publications of PublishMessage,
+	// for servers requiring it, see SigningConfig.
+	SigningKey []byte
+}
+
+// newClient creates a client reporting info.
+func newClient(log *zerolog.Logger, wsURL string, info ClientInfo, opts ClientOptions) (*GameClient, error) {
+	if err := info.validate(); err != nil {
+		return nil, err
+	}
+
+	config := centrigo.Config{
+		Name:    info.Name,
+		Version: info.Version,
+	}
+	if opts.Token.Provider != nil {
+		source := newTokenSource(log, opts.Token)
+		token, err := source.fetch()
+		if err != nil {
+			return nil, fmt.Errorf("connection token: %w", err)
+		}
+		config.Token = token
+		config.Header = source.header
+		config.GetToken = source.getToken
+	}
+
+	c := &GameClient{
+		Client:   centrigo.NewJsonClient(wsURL, config),
+		log:      log,
+		protocol: centrifuge.ProtocolTypeJSON,
+		handlers: make(map[string]func(payload json.RawMessage)),
+		seqs:     make(map[string]uint64),
+		resyncs:  make(map[string]bool),
+		keys:     make(map[string][]byte),
+		done:     make(chan struct{}),
+
+		signingKey:   opts.SigningKey,
+		stateWaiters: make(map[string][]chan struct{}),
+		defaultHandler: func(msg Message) {
+			log.Debug().Msgf("unhandled %s event: %s", msg.Type, string(msg.Payload))
+		},
+	}
+	c.startWorkers(opts.Workers)
+
+	c.OnConnecting(func(_ centrigo.ConnectingEvent) {
+		log.Info().Msg("Connecting")
+	})
+
+	c.OnConnected(func(e centrigo.ConnectedEvent) {
+		log.Info().Msg("Connected")
+
+		var reply roleReply
+		if err := json.Unmarshal(e.Data, &reply); err != nil || reply.Role == "" {
+			log.Warn().Msg("no role assigned by server, acting as player")
+			reply.Role = RolePlayer
+		}
+		c.setIdentity(e.ClientID, reply.Role)
+		for _, ch := range roleChannels(reply.Role) {
+			c.subscribe(ch)
+		}
+	})
+
+	c.OnDisconnected(func(e centrigo.DisconnectedEvent) {
+		log.Info().Msgf("Disconnected event: %d %s", e.Code, e.Reason)
+		// TODO automatic reconnect?
+	})
+
+	c.OnError(func(e centrigo.ErrorEvent) {
+		log.Info().Msgf("error: %s", e.Error.Error())
+	})
+
+	// The server subscribes the client to its error channel.
+	c.OnPublication(func(e centrigo.ServerPublicationEvent) {
+		log.Info().Msgf("[%s] server publication event: %s", e.Channel, string(e.Data))
+		select {
+		case c.queue(e.Channel) <- publication{channel: e.Channel, data: e.Data}:
+		case <-c.done:
+		}
+	})
+
+	// Messages sent to the connection only, such as msgInactive, aren't
+	// part of any channel.
+	c.OnMessage(func(e centrigo.MessageEvent) {
+		log.Info().Msgf("Message received from server %s", string(e.Data))
+		c.dispatch("", e.Data)
+	})
+
+	return c, nil
+}
+
+// Role returns the role assigned by the server on connect.
+func (c *GameClient) Role() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.role
+}
+
+// ID returns the client ID of the current connection.
+func (c *GameClient) ID() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.id
+}
+
+func (c *GameClient) setIdentity(id, role string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.id = id
+	c.role = role
+}
+
+// publicationQueueSize bounds the publications waiting for a worker. Once
+// full, receiving blocks until its handlers catch up.
+const publicationQueueSize = 256
+
+// publication is a publication waiting for a worker.
+type publication struct {
+	channel string
+	data    []byte
+	replay  *Message // fetched by a resync instead of data
+}
+
+// startWorkers starts n workers dispatching publications, at least one.
+func (c *GameClient) startWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	c.workers = make([]chan publication, n)
+	for i := range c.workers {
+		q := make(chan publication, publicationQueueSize)
+		c.workers[i] = q
+		go func() {
+			for {
+				select {
+				case p := <-q:
+					if p.replay != nil {
+						c.replay(p.channel, *p.replay)
+					} else {
+						c.dispatch(p.channel, p.data)
+					}
+				case <-c.done:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// queue returns the queue of the worker channel is bound to.
+func (c *GameClient) queue(channel string) chan<- publication {
+	h := fnv.New32a()
+	h.Write([]byte(channel))
+	return c.workers[h.Sum32()%uint32(len(c.workers))]
+}
+
+// Close closes the connection and stops dispatching publications.
+func (c *GameClient) Close() {
+	c.Client.Close()
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// subscribe subscribes to channel unless already done on a previous
+// connection, centrifuge-go resubscribing by itself after reconnects.
+func (c *GameClient) subscribe(channel string) {
+	if _, ok := c.GetSubscription(channel); ok {
+		return
+	}
+	log := c.log
+
+	sub, err := c.NewSubscription(channel)
+	if err != nil {
+		log.Error().Msgf("subscription creation error: %s", err.Error())
+		return
+	}
+
+	sub.OnJoin(func(e centrigo.JoinEvent) {
+		log.Info().Msgf("[%s] join event: %s", channel, e.ClientInfo.Client)
+	})
+
+	sub.OnError(func(e centrigo.SubscriptionErrorEvent) {
+		log.Info().Msgf("[%s] subscription error event: %s", channel, e.Error.Error())
+	})
+
+	queue := c.queue(channel)
+	sub.OnPublication(func(e centrigo.PublicationEvent) {
+		log.Info().Msgf("[%s] publication event: %s", channel, string(e.Data))
+		select {
+		case queue <- publication{channel: channel, data: e.Data}:
+		case <-c.done:
+		}
+	})
+
+	sub.OnSubscribing(func(e centrigo.SubscribingEvent) {
+		log.Info().Msgf("[%s] subscribing event: %s", channel, e.Reason)
+		c.onSubscribing(channel, e.Code)
+	})
+
+	sub.OnSubscribed(func(e centrigo.SubscribedEvent) {
+		log.Info().Msgf("[%s] subscribed event", channel)
+		c.onSubscribed(channel, e.WasRecovering && !e.Recovered)
+	})
+
+	err = sub.Subscribe()
+	if err != nil {
+		log.Error().Msgf("subscription error: %s", err.Error())
+	}
+}
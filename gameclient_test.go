@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+func TestGameClientDeliversInOrderPerChannel(t *testing.T) {
+	c, err := newClient(&log, "ws://localhost:0/connection/websocket", DefaultConfig().Client, ClientOptions{Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	const channels, n = 8, 200
+	var mu sync.Mutex
+	got := make(map[string][]int)
+	var wg sync.WaitGroup
+	wg.Add(channels * n)
+	c.OnEvent("seq", func(payload json.RawMessage) {
+		var p struct {
+			Channel string `json:"channel"`
+			N       int    `json:"n"`
+		}
+		if err := json.Unmarshal(payload, &p); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		got[p.Channel] = append(got[p.Channel], p.N)
+		mu.Unlock()
+		wg.Done()
+	})
+
+	for i := 0; i < n; i++ {
+		for ch := 0; ch < channels; ch++ {
+			channel := fmt.Sprintf("room:%d", ch)
+			payload, _ := json.Marshal(map[string]any{"channel": channel, "n": i})
+			data, err := marshalMessage(centrifuge.ProtocolTypeJSON, Message{Type: "seq", Payload: payload})
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.queue(channel) <- publication{channel: channel, data: data}
+		}
+	}
+	wg.Wait()
+
+	for channel, seq := range got {
+		for i, v := range seq {
+			if v != i {
+				t.Fatalf("%s: publication %d handled at position %d", channel, v, i)
+			}
+		}
+	}
+}
+
+// handleAll queues a message on each of channels to a client with workers,
+// whose handler runs handle, and returns once they were all handled.
+func handleAll(t *testing.T, workers int, channels []string, handle func(channel string)) {
+	t.Helper()
+	c, err := newClient(&log, "ws://localhost:0/connection/websocket", DefaultConfig().Client, ClientOptions{Workers: workers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var wg sync.WaitGroup
+	wg.Add(len(channels))
+	c.OnEvent("ch", func(payload json.RawMessage) {
+		var channel string
+		if err := json.Unmarshal(payload, &channel); err != nil {
+			t.Error(err)
+		}
+		handle(channel)
+		wg.Done()
+	})
+	for _, channel := range channels {
+		payload, _ := json.Marshal(channel)
+		data, err := marshalMessage(centrifuge.ProtocolTypeJSON, Message{Type: "ch", Payload: payload})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.queue(channel) <- publication{channel: channel, data: data}
+	}
+	wg.Wait()
+}
+
+func TestGameClientSingleWorkerKeepsArrivalOrder(t *testing.T) {
+	var channels []string
+	for i := 0; i < 50; i++ {
+		channels = append(channels, fmt.Sprintf("room:%d", i%7))
+	}
+	var got []string
+	handleAll(t, 0, channels, func(channel string) { got = append(got, channel) })
+	for i := range channels {
+		if got[i] != channels[i] {
+			t.Fatalf("publication %d on %s handled at position %d on %s", i, channels[i], i, got[i])
+		}
+	}
+}
+
+func TestGameClientWorkersHandleChannelsInParallel(t *testing.T) {
+	var channels []string
+	for i := 0; i < 16; i++ {
+		channels = append(channels, fmt.Sprintf("room:%d", i))
+	}
+	slow := func(string) { time.Sleep(20 * time.Millisecond) }
+	elapsed := func(workers int) time.Duration {
+		start := time.Now()
+		handleAll(t, workers, channels, slow)
+		return time.Since(start)
+	}
+	sequential, parallel := elapsed(1), elapsed(8)
+	if parallel*2 > sequential {
+		t.Errorf("8 workers took %s, 1 took %s", parallel, sequential)
+	}
+}
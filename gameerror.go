@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/centrifugal/centrifuge"
+	centrigo "github.com/centrifugal/centrifuge-go"
+)
+
+// msgGameError notifies a user of a game error outside of any RPC reply.
+const msgGameError = "game.error"
+
+// errorChannelPrefix is followed by the user ID in the error channel of a
+// user. Clients are subscribed to theirs by the server on connect.
+const errorChannelPrefix = "com.jtbonhomme.errors#"
+
+// ErrAnonymousUser is returned when notifying a user without an ID, who has
+// no error channel.
+var ErrAnonymousUser = errors.New("anonymous user")
+
+// GameError is the payload of msgGameError. Code identifies the error for
+// clients, as in RPC replies, Message describes it.
+type GameError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// errorChannel returns the error channel of userID.
+func errorChannel(userID string) string {
+	return errorChannelPrefix + userID
+}
+
+// errorSubscriptions returns the server-side subscription of userID to its
+// error channel, none for anonymous users.
+func errorSubscriptions(userID string) map[string]centrifuge.SubscribeOptions {
+	if userID == "" {
+		return nil
+	}
+	return map[string]centrifuge.SubscribeOptions{errorChannel(userID): {}}
+}
+
+// notifyError publishes err as a game error to every connection of userID,
+// e.g. "your move was reverted".
+func (s *Server) notifyError(userID string, err error) error {
+	if userID == "" {
+		return ErrAnonymousUser
+	}
+	e := clientError(err)
+	return s.publishMessage(errorChannel(userID), msgGameError, GameError{Code: ErrorCode(e.Code), Message: e.Message})
+}
+
+// OnGameError registers the handler called with the game errors the server
+// notifies the user of. Transport and protocol errors are reported to the
+// OnError handler of the centrifuge-go client instead.
+func (c *GameClient) OnGameError(handler func(GameError)) {
+	c.OnEvent(msgGameError, func(payload json.RawMessage) {
+		var e GameError
+		if err := json.Unmarshal(payload, &e); err != nil {
+			c.log.Error().Msgf("invalid %s payload: %s", msgGameError, err.Error())
+			return
+		}
+		handler(e)
+	})
+}
+
+// ReplyCode returns the code of an error replied by the server to a call of
+// a GameClient or of a HarnessClient.
+func ReplyCode(err error) (ErrorCode, bool) {
+	var cErr *centrigo.Error
+	if errors.As(err, &cErr) {
+		return ErrorCode(cErr.Code), true
+	}
+	var sErr *centrifuge.Error
+	if errors.As(err, &sErr) {
+		return ErrorCode(sErr.Code), true
+	}
+	return 0, false
+}
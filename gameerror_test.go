@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+func TestGameErrorNotifiesTheUserOnly(t *testing.T) {
+	h := newHarness(t, nil)
+	alice := []*HarnessClient{connect(t, h, "alice"), connect(t, h, "alice")}
+	bob := connect(t, h, "bob")
+	if err := bob.Subscribe(errorChannel("alice")); errorCode(err) != CodePermissionDenied {
+		t.Errorf("subscribe to the error channel of another user: %v, want code %d", err, CodePermissionDenied)
+	}
+
+	reverted := fmt.Errorf("%w: move reverted", ErrIllegalTransition)
+	if err := h.Server.notifyError("alice", reverted); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range alice {
+		pub := nextMessage(t, c, msgGameError)
+		var e GameError
+		if err := json.Unmarshal(pub.Message.Payload, &e); err != nil {
+			t.Fatal(err)
+		}
+		if pub.Channel != errorChannel("alice") || e.Code != CodeIllegalTransition {
+			t.Errorf("connection %s got %+v on %s", c.ID, e, pub.Channel)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if pub, err := bob.Next(ctx); err == nil {
+		t.Errorf("bob got %s on %s", pub.Message.Type, pub.Channel)
+	}
+	if err := h.Server.notifyError("", reverted); !errors.Is(err, ErrAnonymousUser) {
+		t.Errorf("notify an anonymous user: %v, want %v", err, ErrAnonymousUser)
+	}
+}
+
+func TestGameClientOnGameError(t *testing.T) {
+	c, err := newClient(&log, "ws://localhost:0/connection/websocket", DefaultConfig().Client, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	got := make(chan GameError, 1)
+	c.OnGameError(func(e GameError) { got <- e })
+
+	payload, _ := json.Marshal(GameError{Code: CodeIllegalTransition, Message: "move reverted"})
+	data, err := marshalMessage(centrifuge.ProtocolTypeJSON, Message{Type: msgGameError, Payload: payload})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.queue(errorChannel("alice")) <- publication{channel: errorChannel("alice"), data: data}
+	select {
+	case e := <-got:
+		if e.Code != CodeIllegalTransition || e.Message != "move reverted" {
+			t.Errorf("game error %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("game error not handled")
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+type roomReply struct {
+	Room     string       `json:"room"`
+	Channel  string       `json:"channel"`
+	Chat     string       `json:"chat"`
+	Channels RoomChannels `json:"channels"`
+	// Key decrypts the messages of encrypted rooms, see Room.Encrypt.
+	Key []byte `json:"key,omitempty"`
+}
+
+// createRoomRequest optionally labels the Game FSM of the new room and
+// chooses its channel topology, RoomConfig.Topology by default. Encrypted
+// is refused, only private matches are.
+type createRoomRequest struct {
+	Labels    map[string]string `json:"labels,omitempty"`
+	Topology  ChannelTopology   `json:"topology,omitempty"`
+	Encrypted bool              `json:"encrypted,omitempty"`
+}
+
+func (s *Server) rpcCreateRoom(client *centrifuge.Client, data []byte) ([]byte, error) {
+	var req createRoomRequest
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, centrifuge.ErrorBadRequest
+		}
+	}
+	if err := s.acceptGames(); err != nil {
+		return nil, err
+	}
+	if err := checkLabels(req.Labels); err != nil {
+		return nil, err
+	}
+	if err := req.Topology.validate(); err != nil {
+		return nil, clientError(err)
+	}
+	if req.Encrypted {
+		return nil, clientError(ErrPublicEncryption)
+	}
+	r, err := s.rooms.CreateRoom(ownerID(client))
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Game.SetLabels(req.Labels); err != nil {
+		return nil, err
+	}
+	if req.Topology != "" {
+		_ = r.SetTopology(req.Topology)
+	}
+	if len(req.Labels) > 0 {
+		log.Info().Msgf("client %s created room %s (%s)", client.ID(), r.ID, formatLabels(req.Labels))
+	} else {
+		log.Info().Msgf("client %s created room %s", client.ID(), r.ID)
+	}
+	return json.Marshal(newRoomReply(r))
+}
+
+// newRoomReply describes the channels of r.
+func newRoomReply(r *Room) roomReply {
+	return roomReply{Room: r.ID, Channel: r.Channel(), Chat: r.ChatChannel(), Channels: r.Channels(), Key: r.Key()}
+}
+
+type roomRequest struct {
+	Room string `json:"room"`
+}
+
+func (s *Server) rpcJoinRoom(client *centrifuge.Client, data []byte) ([]byte, error) {
+	var req roomRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, centrifuge.ErrorBadRequest
+	}
+	return s.joinRoom(client, req.Room)
+}
+
+// joinRoom moves the client's player to roomID, leaving its previous room.
+func (s *Server) joinRoom(client *centrifuge.Client, roomID string) ([]byte, error) {
+	p, ok := s.players.Get(client.ID())
+	if !ok {
+		return nil, ErrPlayerNotFound
+	}
+	r, ok := s.rooms.Room(roomID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRoomNotFound, roomID)
+	}
+	if err := s.authorizeRoom(client, r); err != nil {
+		return nil, err
+	}
+	if err := r.admit(); err != nil {
+		return nil, err
+	}
+	if p.Room() != "" && p.Room() != roomID {
+		_ = s.rooms.LeaveRoom(p.Room(), p.ID())
+	}
+	r, err := s.rooms.JoinRoom(roomID, client.ID())
+	if err != nil {
+		return nil, err
+	}
+	p.SetRoom(r.ID)
+	s.arrive(client, r)
+	return json.Marshal(newRoomReply(r))
+}
+
+type matchReply struct {
+	Room     string       `json:"room"`
+	Channel  string       `json:"channel"`
+	Chat     string       `json:"chat"`
+	Channels RoomChannels `json:"channels"`
+	Invite   string       `json:"invite"`
+	Key      []byte       `json:"key,omitempty"`
+}
+
+// createMatchRequest optionally encrypts the messages of the match.
+type createMatchRequest struct {
+	Encrypted bool `json:"encrypted,omitempty"`
+}
+
+// rpcCreateMatch creates a private room only invited users may join or
+// subscribe to.
+func (s *Server) rpcCreateMatch(client *centrifuge.Client, data []byte) ([]byte, error) {
+	var req createMatchRequest
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, centrifuge.ErrorBadRequest
+		}
+	}
+	if err := s.acceptGames(); err != nil {
+		return nil, err
+	}
+	r, invite, err := s.rooms.CreateMatch(ownerID(client))
+	if err != nil {
+		return nil, err
+	}
+	if req.Encrypted {
+		if err := r.Encrypt(); err != nil {
+			return nil, err
+		}
+	}
+	log.Info().Msgf("client %s created match %s", client.ID(), r.ID)
+	return json.Marshal(matchReply{Room: r.ID, Channel: r.Channel(), Chat: r.ChatChannel(), Channels: r.Channels(), Invite: invite, Key: r.Key()})
+}
+
+type inviteRequest struct {
+	Invite string `json:"invite"`
+}
+
+// rpcJoinMatch accepts an invite and joins its match.
+func (s *Server) rpcJoinMatch(client *centrifuge.Client, data []byte) ([]byte, error) {
+	var req inviteRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, centrifuge.ErrorBadRequest
+	}
+	r, err := s.rooms.AcceptInvite(req.Invite, ownerID(client))
+	if err != nil {
+		return nil, err
+	}
+	return s.joinRoom(client, r.ID)
+}
+
+func (s *Server) rpcLeaveRoom(client *centrifuge.Client, data []byte) ([]byte, error) {
+	var req roomRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, centrifuge.ErrorBadRequest
+	}
+	if err := s.rooms.LeaveRoom(req.Room, client.ID()); err != nil {
+		return nil, err
+	}
+	if p, ok := s.players.Get(client.ID()); ok && p.Room() == req.Room {
+		p.SetRoom("")
+	}
+	return nil, nil
+}
+
+// playerRequest targets a player, the caller's own one when empty.
+type playerRequest struct {
+	Player string `json:"player,omitempty"`
+}
+
+type playerReply struct {
+	Player string `json:"player"`
+	State  string `json:"state"`
+}
+
+// clientMetadata is the TransitionContext metadata of events fired on
+// behalf of client.
+func clientMetadata(client *centrifuge.Client) map[string]any {
+	return map[string]any{metaClient: client.ID()}
+}
+
+// targetPlayer decodes the player targeted by an RPC and checks that client
+// may act on it.
+func (s *Server) targetPlayer(client *centrifuge.Client, data []byte) (*Player, error) {
+	var req playerRequest
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, centrifuge.ErrorBadRequest
+		}
+	}
+	return s.authorize(client, req.Player)
+}
+
+func (s *Server) firePlayer(client *centrifuge.Client, data []byte, event string) (*Player, error) {
+	p, err := s.targetPlayer(client, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := fireWith(p.FSM, event, clientMetadata(client)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *Server) rpcReady(client *centrifuge.Client, data []byte) ([]byte, error) {
+	p, err := s.firePlayer(client, data, eventReady)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := s.rooms.Room(p.Room()); ok {
+		r.SetReady(p.ID(), true)
+	}
+	return json.Marshal(playerReply{Player: p.ID(), State: p.FSM.Current()})
+}
+
+// moveRequest is a playerRequest carrying the move, left raw for the
+// rules engine.
+type moveRequest struct {
+	Player string          `json:"player,omitempty"`
+	Move   json.RawMessage `json:"move,omitempty"`
+}
+
+// rpcMove plays the turn of the player and passes it to the next one. The
+// move must be legal according to the rules engine. The moves of a room are
+// serialized, and a move whose turn couldn't pass isn't recorded.
+func (s *Server) rpcMove(client *centrifuge.Client, data []byte) ([]byte, error) {
+	var req moveRequest
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, centrifuge.ErrorBadRequest
+		}
+	}
+	p, err := s.authorize(client, req.Player)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := s.rooms.Room(p.Room())
+	if !ok {
+		return nil, fmt.Errorf("%w: player %s is not in a room", ErrRoomNotFound, p.ID())
+	}
+	r.moveMu.Lock()
+	defer r.moveMu.Unlock()
+	// Turns don't progress while the game is paused.
+	if !r.Game.CanFire(eventNextTurn) {
+		return nil, fmt.Errorf("%w: %s from %s", ErrIllegalTransition, eventMove, r.Game.Current())
+	}
+	if turn, _ := r.CurrentTurn(); turn != p.ID() {
+		return nil, ErrNotYourTurn
+	}
+	if err := s.rules.ValidateMove(r.GameState(p.ID()), req.Move); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMove, err.Error())
+	}
+	if err := fireWith(p.FSM, eventMove, clientMetadata(client)); err != nil {
+		return nil, err
+	}
+	r.RecordMove(req.Move)
+	metadata := clientMetadata(client)
+	metadata[metaMover] = p.ID()
+	if err := r.Game.FireWith(eventNextTurn, metadata); err != nil {
+		r.UndoMove()
+		if turn, _ := r.CurrentTurn(); errors.Is(err, ErrGuardFailed) && turn != p.ID() {
+			return nil, ErrNotYourTurn
+		}
+		return nil, err
+	}
+	return json.Marshal(playerReply{Player: p.ID(), State: p.FSM.Current()})
+}
+
+// rpcForfeit takes the player out of its game. The game finishes once fewer
+// than MinPlayers are left.
+func (s *Server) rpcForfeit(client *centrifuge.Client, data []byte) ([]byte, error) {
+	p, err := s.targetPlayer(client, data)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := s.rooms.Room(p.Room())
+	if !ok {
+		return nil, fmt.Errorf("%w: player %s is not in a room", ErrRoomNotFound, p.ID())
+	}
+	state := r.Game.Current()
+	if state != gamePlaying && state != gamePaused {
+		return nil, fmt.Errorf("%w: room %s is %s", ErrGameOver, r.ID, state)
+	}
+	if err := fireWith(p.FSM, eventForfeit, clientMetadata(client)); err != nil {
+		return nil, err
+	}
+	remaining, wasTurn := r.Forfeit(p.ID())
+	log.Info().Msgf("room %s: %s forfeited, %d players left", r.ID, p.ID(), remaining)
+	s.settleForfeit(r, p.ID(), state, remaining, wasTurn, clientMetadata(client))
+	return json.Marshal(playerReply{Player: p.ID(), State: p.FSM.Current()})
+}
+
+// settleForfeit announces that clientID left the turn order of r, while
+// its game was in state, and finishes the game once fewer than MinPlayers
+// are left.
+func (s *Server) settleForfeit(r *Room, clientID, state string, remaining int, wasTurn bool, metadata map[string]any) {
+	_ = s.publishMessage(r.Channel(), msgGameForfeit, forfeitEvent{Room: r.ID, Player: clientID, Remaining: remaining})
+
+	switch {
+	case remaining < r.config.MinPlayers || remaining == 0:
+		if err := r.Game.FireWith(eventFinish, metadata); err != nil {
+			log.Warn().Msgf("room %s: finish after forfeit failed: %s", r.ID, err.Error())
+		}
+	case wasTurn && state == gamePlaying:
+		// The next player gets a full turn.
+		r.Game.ResetTimer()
+	}
+}
+
+// forfeitLeaver forfeits the player clientID, who left r in the middle of
+// its game.
+func (s *Server) forfeitLeaver(r *Room, clientID string, remaining int, wasTurn bool) {
+	state := r.Game.Current()
+	if state != gamePlaying && state != gamePaused {
+		return
+	}
+	if p, ok := s.players.Get(clientID); ok && p.FSM.Current() == playerPlaying {
+		if err := p.FSM.Fire(eventForfeit); err != nil {
+			log.Warn().Msgf("room %s: player %s can't forfeit: %s", r.ID, clientID, err.Error())
+		}
+	}
+	log.Info().Msgf("room %s: %s left the game, %d players left", r.ID, clientID, remaining)
+	s.settleForfeit(r, clientID, state, remaining, wasTurn, nil)
+}
+
+// fireGame fires event on the game of the room client plays in. Only the
+// players in the turn order may, so that the other members of the room
+// can't hold the game paused; a paused game still finishes after
+// RoomConfig.MaxDuration.
+func (s *Server) fireGame(client *centrifuge.Client, event string) ([]byte, error) {
+	p, ok := s.players.Get(client.ID())
+	if !ok {
+		return nil, ErrPlayerNotFound
+	}
+	r, ok := s.rooms.Room(p.Room())
+	if !ok {
+		return nil, fmt.Errorf("%w: player %s is not in a room", ErrRoomNotFound, p.ID())
+	}
+	if !r.Plays(p.ID()) {
+		return nil, fmt.Errorf("%w: %s doesn't play in room %s", ErrPlayerNotFound, p.ID(), r.ID)
+	}
+	if err := r.Game.FireWith(event, clientMetadata(client)); err != nil {
+		return nil, err
+	}
+	return json.Marshal(roomStateReply{Room: r.ID, State: r.Game.Current()})
+}
+
+type roomStateReply struct {
+	Room  string `json:"room"`
+	State string `json:"state"`
+}
+
+func (s *Server) rpcPause(client *centrifuge.Client, _ []byte) ([]byte, error) {
+	return s.fireGame(client, eventPause)
+}
+
+func (s *Server) rpcResume(client *centrifuge.Client, _ []byte) ([]byte, error) {
+	return s.fireGame(client, eventResume)
+}
+
+func (s *Server) rpcReset(client *centrifuge.Client, data []byte) ([]byte, error) {
+	p, err := s.firePlayer(client, data, eventReset)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := s.rooms.Room(p.Room()); ok {
+		r.SetReady(p.ID(), false)
+	}
+	return json.Marshal(playerReply{Player: p.ID(), State: p.FSM.Current()})
+}
+
+func (s *Server) rpcState(client *centrifuge.Client, data []byte) ([]byte, error) {
+	p, err := s.targetPlayer(client, data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(playerReply{Player: p.ID(), State: p.FSM.Current()})
+}
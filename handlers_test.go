@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestMoveSerializedPerRoom(t *testing.T) {
+	h := newHarness(t, nil)
+	r, players := startGame(t, h, 2)
+	first := players[0]
+
+	data, _ := json.Marshal(moveRequest{Move: json.RawMessage(`{"cell":1}`)})
+	errs := make([]error, 8)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = h.Server.rpcMove(first.client, data)
+		}(i)
+	}
+	wg.Wait()
+
+	played := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			played++
+		case !errors.Is(err, ErrNotYourTurn):
+			t.Errorf("concurrent move: %s", err)
+		}
+	}
+	if played != 1 {
+		t.Errorf("%d concurrent moves of the same turn played, want 1", played)
+	}
+	if moves := r.GameState(first.ID).Moves; len(moves) != 1 {
+		t.Errorf("%d moves recorded, want 1", len(moves))
+	}
+	if turn, _ := r.CurrentTurn(); turn != players[1].ID {
+		t.Errorf("turn of %s, want %s", turn, players[1].ID)
+	}
+}
+
+func TestMoveUndoneWhenTurnCantPass(t *testing.T) {
+	h := newHarness(t, nil)
+	r, players := startGame(t, h, 2)
+	r.Game.AddGuard(eventNextTurn, func(*TransitionContext) bool { return false })
+
+	if _, err := players[0].RPC("move", moveRequest{Move: json.RawMessage(`{"cell":1}`)}); err == nil {
+		t.Fatal("move played though its turn couldn't pass")
+	}
+	if moves := r.GameState(players[0].ID).Moves; len(moves) != 0 {
+		t.Errorf("%d moves recorded, want 0", len(moves))
+	}
+	if turn, _ := r.CurrentTurn(); turn != players[0].ID {
+		t.Errorf("turn of %s, want %s", turn, players[0].ID)
+	}
+}
+
+func TestMoveErrors(t *testing.T) {
+	h := newHarness(t, nil)
+	_, players := startGame(t, h, 2)
+	outsider := connect(t, h, "outsider")
+	valid, _ := json.Marshal(moveRequest{Move: json.RawMessage(`{"cell":1}`)})
+
+	// In order: the valid move passes the turn to the second player.
+	for _, tc := range []struct {
+		name   string
+		client *HarnessClient
+		data   []byte
+		code   ErrorCode // zero for a played move
+	}{
+		{"valid move", players[0], valid, 0},
+		{"wrong turn", players[0], valid, CodeNotYourTurn},
+		{"malformed payload", players[1], []byte(`{"move":`), CodeBadRequest},
+		{"not in a room", outsider, valid, CodeRoomNotFound},
+	} {
+		_, err := h.Server.rpcMove(tc.client.client, tc.data)
+		if tc.code == 0 {
+			if err != nil {
+				t.Errorf("%s: %s", tc.name, err)
+			}
+			continue
+		}
+		if code := errorCode(err); code != tc.code {
+			t.Errorf("%s: error %v, want code %d", tc.name, err, tc.code)
+		}
+	}
+}
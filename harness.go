@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+	"github.com/centrifugal/protocol"
+)
+
+// ErrHarnessClosed is returned by harness clients once disconnected.
+var ErrHarnessClosed = errors.New("harness client closed")
+
+// TestHarness runs a Server in-process and attaches clients to it through
+// an in-memory transport, so end-to-end game tests need no network and
+// don't depend on connection timing.
+type TestHarness struct {
+	Server *Server
+	// Clock is the clock of the server in TestMode, nil otherwise.
+	Clock *FakeClock
+
+	mu      sync.Mutex
+	clients []*HarnessClient
+}
+
+// NewTestHarness creates and runs a Server with config. Internal clients
+// are not expected since the harness connects its own. With
+// Config.TestMode, time only moves with Clock.
+func NewTestHarness(config Config) (*TestHarness, error) {
+	config.InternalClients = 0
+	srv, err := NewServer(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := srv.Run(); err != nil {
+		return nil, err
+	}
+	return &TestHarness{Server: srv, Clock: srv.FakeClock()}, nil
+}
+
+// Connect attaches a new client authenticated as userID.
+func (h *TestHarness) Connect(userID string) (*HarnessClient, error) {
+	return h.ConnectWithMeta(userID, ConnMeta{})
+}
+
+// ConnectWithMeta attaches a new client authenticated as userID whose
+// connection carries meta, as set by the auth middleware.
+func (h *TestHarness) ConnectWithMeta(userID string, meta ConnMeta) (*HarnessClient, error) {
+	return h.connect(userID, meta, centrifuge.ProtocolTypeJSON)
+}
+
+// ConnectProtobuf attaches a new client authenticated as userID which uses
+// the Protobuf protocol, so that its envelopes are Protobuf encoded.
+func (h *TestHarness) ConnectProtobuf(userID string) (*HarnessClient, error) {
+	return h.connect(userID, ConnMeta{}, centrifuge.ProtocolTypeProtobuf)
+}
+
+func (h *TestHarness) connect(userID string, meta ConnMeta, proto centrifuge.ProtocolType) (*HarnessClient, error) {
+	t := newMemTransport()
+	t.proto = proto
+	var transport centrifuge.Transport = t
+	config := h.Server.config.Transport
+	var buf *sendBuffer
+	if config.SendBuffer > 0 {
+		buf = newSendBuffer(t, config.SendBuffer, config.Overflow)
+		transport = buf
+	}
+	ctx := centrifuge.SetCredentials(context.Background(), &centrifuge.Credentials{UserID: userID})
+	ctx = WithConnMeta(ctx, meta)
+	client, closeFn, err := centrifuge.NewClient(ctx, h.Server.Node(), transport)
+	if err != nil {
+		return nil, err
+	}
+	if buf != nil {
+		buf.setClient(client.ID())
+	}
+	c := &HarnessClient{
+		client:       client,
+		closeFn:      closeFn,
+		proto:        proto,
+		pending:      make(map[uint32]chan *protocol.Reply),
+		publications: make(chan HarnessPublication, 256),
+		keys:         make(map[string][]byte),
+	}
+	t.onReply = c.handleReply
+	t.onClose = c.handleClose
+
+	info := h.Server.config.Client
+	reply, err := c.command(&protocol.Command{Connect: &protocol.ConnectRequest{Name: info.Name, Version: info.Version}})
+	if err != nil {
+		return nil, err
+	}
+	c.ID = reply.Connect.Client
+	c.ConnectData = reply.Connect.Data
+
+	h.mu.Lock()
+	h.clients = append(h.clients, c)
+	h.mu.Unlock()
+	return c, nil
+}
+
+// Close disconnects all clients and shuts the server down.
+func (h *TestHarness) Close() error {
+	h.mu.Lock()
+	clients := h.clients
+	h.clients = nil
+	h.mu.Unlock()
+	for _, c := range clients {
+		_ = c.Close()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return h.Server.Shutdown(ctx)
+}
+
+// HarnessPublication is a publication received by a HarnessClient. Messages
+// sent to the client alone have an empty Channel.
+type HarnessPublication struct {
+	Channel string
+	Message Message
+}
+
+// HarnessClient is a client connected to a TestHarness.
+type HarnessClient struct {
+	ID          string
+	ConnectData []byte
+
+	client       *centrifuge.Client
+	closeFn      centrifuge.ClientCloseFunc
+	proto        centrifuge.ProtocolType
+	publications chan HarnessPublication
+
+	// cmdMu serializes commands like a connection read loop would.
+	cmdMu   sync.Mutex
+	mu      sync.Mutex
+	nextID  uint32
+	pending map[uint32]chan *protocol.Reply
+	closed  bool
+	keys    map[string][]byte // room ID -> key, see SetRoomKey
+}
+
+// RPC calls method with data encoded as JSON and returns the raw reply. The
+// room keys of the replies are recorded, as GameClient does.
+func (c *HarnessClient) RPC(method string, data any) ([]byte, error) {
+	var raw []byte
+	if data != nil {
+		var err error
+		if raw, err = json.Marshal(data); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.command(&protocol.Command{Rpc: &protocol.RPCRequest{Method: method, Data: raw}})
+	if err != nil {
+		return nil, err
+	}
+	var room roomReply
+	if json.Unmarshal(reply.Rpc.Data, &room) == nil && room.Room != "" && len(room.Key) > 0 {
+		c.SetRoomKey(room.Room, room.Key)
+	}
+	return reply.Rpc.Data, nil
+}
+
+// SetRoomKey sets the key decrypting the messages of the room roomID.
+func (c *HarnessClient) SetRoomKey(roomID string, key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys[roomID] = key
+}
+
+// roomKey returns the key of the room of channel, nil if unknown.
+func (c *HarnessClient) roomKey(channel string) []byte {
+	id, ok := roomChannelID(channel)
+	if !ok {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.keys[id]
+}
+
+// Subscribe subscribes the client to channel.
+func (c *HarnessClient) Subscribe(channel string) error {
+	_, err := c.command(&protocol.Command{Subscribe: &protocol.SubscribeRequest{Channel: channel}})
+	return err
+}
+
+// Publish publishes msg to channel as the client, encoded for its protocol.
+func (c *HarnessClient) Publish(channel string, msg Message) error {
+	data, err := marshalMessage(c.proto, msg)
+	if err != nil {
+		return err
+	}
+	_, err = c.command(&protocol.Command{Publish: &protocol.PublishRequest{Channel: channel, Data: data}})
+	return err
+}
+
+// Next returns the next publication received on any subscribed channel.
+func (c *HarnessClient) Next(ctx context.Context) (HarnessPublication, error) {
+	select {
+	case p, ok := <-c.publications:
+		if !ok {
+			return HarnessPublication{}, ErrHarnessClosed
+		}
+		return p, nil
+	case <-ctx.Done():
+		return HarnessPublication{}, ctx.Err()
+	}
+}
+
+// Close disconnects the client.
+func (c *HarnessClient) Close() error {
+	return c.closeFn()
+}
+
+func (c *HarnessClient) command(cmd *protocol.Command) (*protocol.Reply, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrHarnessClosed
+	}
+	c.nextID++
+	cmd.Id = c.nextID
+	ch := make(chan *protocol.Reply, 1)
+	c.pending[cmd.Id] = ch
+	c.mu.Unlock()
+
+	c.cmdMu.Lock()
+	ok := c.client.HandleCommand(cmd, 0)
+	c.cmdMu.Unlock()
+	if !ok {
+		return nil, ErrHarnessClosed
+	}
+
+	select {
+	case reply, ok := <-ch:
+		if !ok {
+			return nil, ErrHarnessClosed
+		}
+		if reply.Error != nil {
+			return nil, &centrifuge.Error{Code: reply.Error.Code, Message: reply.Error.Message, Temporary: reply.Error.Temporary}
+		}
+		return reply, nil
+	case <-time.After(5 * time.Second):
+		return nil, fmt.Errorf("no reply to command %d", cmd.Id)
+	}
+}
+
+func (c *HarnessClient) handleReply(reply *protocol.Reply) {
+	if reply.Id == 0 {
+		if reply.Push != nil && (reply.Push.Pub != nil || reply.Push.Message != nil) {
+			data := reply.Push.Message.GetData()
+			if reply.Push.Pub != nil {
+				data = reply.Push.Pub.Data
+			}
+			msg, err := unmarshalMessage(c.proto, data)
+			if err == nil {
+				msg, err = decryptMessage(c.roomKey(reply.Push.Channel), reply.Push.Channel, msg)
+			}
+			if err == nil {
+				msg, err = decompressMessage(msg)
+			}
+			if err != nil {
+				log.Warn().Msgf("harness client %s: invalid publication on %s: %s", c.ID, reply.Push.Channel, err.Error())
+				return
+			}
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.closed {
+				return
+			}
+			select {
+			case c.publications <- HarnessPublication{Channel: reply.Push.Channel, Message: msg}:
+			default:
+				log.Warn().Msgf("harness client %s: publication buffer full, dropping", c.ID)
+			}
+		}
+		return
+	}
+
+	c.mu.Lock()
+	ch, ok := c.pending[reply.Id]
+	delete(c.pending, reply.Id)
+	c.mu.Unlock()
+	if ok {
+		ch <- reply
+	}
+}
+
+func (c *HarnessClient) handleClose() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	close(c.publications)
+}
+
+// memTransport is a bidirectional centrifuge.Transport delivering replies
+// to callbacks instead of a socket, JSON unless proto is set.
+type memTransport struct {
+	proto   centrifuge.ProtocolType
+	onReply func(*protocol.Reply)
+	onClose func()
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newMemTransport() *memTransport {
+	return &memTransport{}
+}
+
+func (t *memTransport) Name() string {
+	return "memory"
+}
+
+func (t *memTransport) Protocol() centrifuge.ProtocolType {
+	if t.proto == "" {
+		return centrifuge.ProtocolTypeJSON
+	}
+	return t.proto
+}
+
+func (t *memTransport) ProtocolVersion() centrifuge.ProtocolVersion {
+	return centrifuge.ProtocolVersion2
+}
+
+func (t *memTransport) Unidirectional() bool {
+	return false
+}
+
+func (t *memTransport) Emulation() bool {
+	return false
+}
+
+func (t *memTransport) DisabledPushFlags() uint64 {
+	return 0
+}
+
+// PingPongConfig disables pings, the harness peer never goes away silently.
+func (t *memTransport) PingPongConfig() centrifuge.PingPongConfig {
+	return centrifuge.PingPongConfig{PingInterval: -1, PongTimeout: -1}
+}
+
+func (t *memTransport) Write(data []byte) error {
+	return t.WriteMany(data)
+}
+
+func (t *memTransport) WriteMany(messages ...[]byte) error {
+	t.mu.Lock()
+	closed := t.closed
+	t.mu.Unlock()
+	if closed {
+		return io.EOF
+	}
+	for _, data := range messages {
+		if t.Protocol() == centrifuge.ProtocolTypeProtobuf {
+			// Each message is a single reply, as in a WebSocket frame.
+			var reply protocol.Reply
+			if err := reply.UnmarshalVT(data); err != nil {
+				return err
+			}
+			t.onReply(&reply)
+			continue
+		}
+		dec := protocol.NewJSONReplyDecoder(data)
+		for {
+			reply, err := dec.Decode()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			t.onReply(reply)
+		}
+	}
+	return nil
+}
+
+func (t *memTransport) Close(_ centrifuge.Disconnect) error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	t.mu.Unlock()
+	t.onClose()
+	return nil
+}
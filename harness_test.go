@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newHarness runs a TestHarness on the default config in TestMode, changed
+// by configure if not nil, and closes it when the test ends.
+func newHarness(t *testing.T, configure func(*Config)) *TestHarness {
+	t.Helper()
+	config := DefaultConfig()
+	config.TestMode = true
+	if configure != nil {
+		configure(&config)
+	}
+	h, err := NewTestHarness(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.Close() })
+	return h
+}
+
+// connect attaches a client authenticated as userID to h.
+func connect(t *testing.T, h *TestHarness, userID string) *HarnessClient {
+	t.Helper()
+	c, err := h.Connect(userID)
+	if err != nil {
+		t.Fatalf("connect %s: %s", userID, err)
+	}
+	return c
+}
+
+// call calls method and decodes its reply into reply, if not nil.
+func call(t *testing.T, c *HarnessClient, method string, req, reply any) {
+	t.Helper()
+	data, err := c.RPC(method, req)
+	if err != nil {
+		t.Fatalf("%s: %s", method, err)
+	}
+	if reply != nil {
+		if err := json.Unmarshal(data, reply); err != nil {
+			t.Fatalf("%s reply: %s", method, err)
+		}
+	}
+}
+
+// createRoom creates a room as c and returns its reply.
+func createRoom(t *testing.T, c *HarnessClient, req createRoomRequest) roomReply {
+	t.Helper()
+	var reply roomReply
+	call(t, c, "createRoom", req, &reply)
+	return reply
+}
+
+// startGame connects n players to a new room, readies them and starts the
+// game. The clients are returned in the turn order of the game.
+func startGame(t *testing.T, h *TestHarness, n int) (*Room, []*HarnessClient) {
+	t.Helper()
+	clients := make(map[string]*HarnessClient)
+	var roomID string
+	for i := 0; i < n; i++ {
+		c := connect(t, h, fmt.Sprintf("user%d", i))
+		if i == 0 {
+			roomID = createRoom(t, c, createRoomRequest{}).Room
+		}
+		call(t, c, "joinRoom", roomRequest{Room: roomID}, nil)
+		call(t, c, "ready", nil, nil)
+		clients[c.ID] = c
+	}
+	r, ok := h.Server.rooms.Room(roomID)
+	if !ok {
+		t.Fatalf("room %s not found", roomID)
+	}
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var ordered []*HarnessClient
+	for _, id := range r.TurnOrder() {
+		ordered = append(ordered, clients[id])
+	}
+	return r, ordered
+}
+
+// callError calls method, expecting it to fail, and returns the code of
+// the error.
+func callError(t *testing.T, c *HarnessClient, method string, req any) ErrorCode {
+	t.Helper()
+	_, err := c.RPC(method, req)
+	if err == nil {
+		t.Fatalf("%s succeeded", method)
+	}
+	return errorCode(err)
+}
+
+// eventually waits for cond, failing the test after a few seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// subscribed reports whether the server tracks clientID on channel.
+func subscribed(h *TestHarness, clientID, channel string) bool {
+	h.Server.subs.mu.Lock()
+	defer h.Server.subs.mu.Unlock()
+	return h.Server.subs.channels[clientID][channel]
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// HealthCheck returns an error while a dependency of the server is
+// unhealthy, e.g. a circuit breaker is open.
+type HealthCheck func() error
+
+// healthChecks aggregates the named checks consulted by /readyz.
+type healthChecks struct {
+	mu     sync.RWMutex
+	checks map[string]HealthCheck
+}
+
+func newHealthChecks() *healthChecks {
+	return &healthChecks{checks: make(map[string]HealthCheck)}
+}
+
+// add registers check under name, replacing any previous one.
+func (h *healthChecks) add(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// failing runs every check and returns the errors of the failing ones by
+// name, nil when all of them pass.
+func (h *healthChecks) failing() map[string]string {
+	h.mu.RLock()
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	checks := make([]HealthCheck, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		checks[i] = h.checks[name]
+	}
+	h.mu.RUnlock()
+
+	var failed map[string]string
+	for i, check := range checks {
+		if err := check(); err != nil {
+			if failed == nil {
+				failed = make(map[string]string)
+			}
+			failed[names[i]] = err.Error()
+		}
+	}
+	return failed
+}
+
+// AddHealthCheck makes /readyz answer 503 while check fails, so that load
+// balancers divert traffic until it passes again. Checks run on every
+// request and must be fast.
+func (s *Server) AddHealthCheck(name string, check HealthCheck) {
+	s.health.add(name, check)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReadinessFollowsHealthChecks(t *testing.T) {
+	h := newHarness(t, nil)
+	var open atomic.Bool
+	h.Server.AddHealthCheck("breaker", func() error {
+		if open.Load() {
+			return errors.New("circuit breaker open")
+		}
+		return nil
+	})
+	if code, _ := readyz(t, h); code != http.StatusOK {
+		t.Fatalf("readyz %d with the breaker closed, want %d", code, http.StatusOK)
+	}
+
+	open.Store(true)
+	code, reply := readyz(t, h)
+	if code != http.StatusServiceUnavailable || reply.Ready || reply.Unhealthy["breaker"] != "circuit breaker open" {
+		t.Errorf("readyz %d %+v with the breaker open, want %d", code, reply, http.StatusServiceUnavailable)
+	}
+
+	open.Store(false)
+	if code, reply := readyz(t, h); code != http.StatusOK || reply.Unhealthy != nil {
+		t.Errorf("readyz %d %+v once the breaker closed, want %d", code, reply, http.StatusOK)
+	}
+}
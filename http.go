@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// HTTPConfig configures the HTTP server.
+type HTTPConfig struct {
+	// Addr is the listen address.
+	Addr string
+	// ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout are
+	// those of http.Server. They apply to every request except the ones
+	// wrapped with longLived, such as the WebSocket endpoint.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// CertFile and KeyFile enable TLS when set. Internal clients then
+	// connect with wss://.
+	CertFile string
+	KeyFile  string
+}
+
+// TLS reports whether the server is configured for TLS.
+func (c HTTPConfig) TLS() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// validate checks that a configured certificate and key both exist.
+func (c HTTPConfig) validate() error {
+	if !c.TLS() {
+		return nil
+	}
+	if c.CertFile == "" || c.KeyFile == "" {
+		return errors.New("tls requires both a certificate and a key file")
+	}
+	for _, path := range []string{c.CertFile, c.KeyFile} {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("tls file: %w", err)
+		}
+	}
+	return nil
+}
+
+// newHTTPServer creates the server serving h with config.
+func newHTTPServer(config HTTPConfig, h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              config.Addr,
+		Handler:           h,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+}
+
+// listenAndServe serves s over TLS when config enables it.
+func listenAndServe(s *http.Server, config HTTPConfig) error {
+	if config.TLS() {
+		return s.ListenAndServeTLS(config.CertFile, config.KeyFile)
+	}
+	return s.ListenAndServe()
+}
+
+// websocketURL returns the local WebSocket endpoint URL of a server
+// listening on addr, wss:// when tls is set.
+func websocketURL(addr string, tls bool) string {
+	scheme := "ws://"
+	if tls {
+		scheme = "wss://"
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return scheme + addr + "/connection/websocket"
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return scheme + net.JoinHostPort(host, port) + "/connection/websocket"
+}
+
+// longLived exempts h from the server read and write timeouts by clearing
+// the connection deadlines before h runs. WebSocket connections outlive
+// any request timeout and centrifuge manages their deadlines itself, with
+// pings and TransportConfig.WriteTimeout.
+func longLived(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		if err := rc.SetReadDeadline(time.Time{}); err != nil {
+			log.Warn().Msgf("%s: read deadline not cleared: %s", r.URL.Path, err.Error())
+		}
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			log.Warn().Msgf("%s: write deadline not cleared: %s", r.URL.Path, err.Error())
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestWebsocketURL(t *testing.T) {
+	for _, tc := range []struct {
+		addr string
+		tls  bool
+		want string
+	}{
+		{":8000", false, "ws://localhost:8000/connection/websocket"},
+		{":8443", true, "wss://localhost:8443/connection/websocket"},
+		{"0.0.0.0:8000", false, "ws://localhost:8000/connection/websocket"},
+		{"[::]:8000", true, "wss://localhost:8000/connection/websocket"},
+		{"game.example.com:8000", false, "ws://game.example.com:8000/connection/websocket"},
+		{"game.example.com:8443", true, "wss://game.example.com:8443/connection/websocket"},
+		{"[::1]:8000", false, "ws://[::1]:8000/connection/websocket"},
+		{"game.example.com", true, "wss://game.example.com/connection/websocket"},
+	} {
+		if got := websocketURL(tc.addr, tc.tls); got != tc.want {
+			t.Errorf("websocketURL(%q, %v) = %s, want %s", tc.addr, tc.tls, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// IdempotencyConfig bounds the replies kept for retried RPCs.
+type IdempotencyConfig struct {
+	// TTL is how long the reply to a call is replayed to retries with the
+	// same key. Zero disables idempotency keys.
+	TTL time.Duration
+	// MaxKeys is the number of replies kept per player, the oldest ones
+	// are dropped first.
+	MaxKeys int
+}
+
+// idempotencyKey returns the idempotency_key field of an RPC payload, if
+// any.
+func idempotencyKey(data []byte) string {
+	if len(data) == 0 || data[0] != '{' {
+		return ""
+	}
+	var req struct {
+		Key string `json:"idempotency_key"`
+	}
+	_ = json.Unmarshal(data, &req)
+	return req.Key
+}
+
+// replyCache returns the idempotency cache of the player of client.
+func (s *Server) replyCache(client *centrifuge.Client) *replyCache {
+	p, ok := s.players.Get(client.ID())
+	if !ok {
+		return nil
+	}
+	return p.replyCache(s.config.Idempotency, s.players.clock)
+}
+
+// replyCache keeps the replies to the RPCs of a player by idempotency key,
+// so a call retried after a reconnection isn't executed twice.
+type replyCache struct {
+	config IdempotencyConfig
+	clock  Clock
+
+	mu      sync.Mutex
+	entries map[string]*cachedReply
+	order   []string // oldest first
+}
+
+type cachedReply struct {
+	done    chan struct{} // closed once the call returned
+	data    []byte
+	err     error
+	expires time.Time // zero while the call runs
+}
+
+func newReplyCache(config IdempotencyConfig, clock Clock) *replyCache {
+	return &replyCache{
+		config:  config,
+		clock:   clock,
+		entries: make(map[string]*cachedReply),
+	}
+}
+
+// do runs call unless method was already called with key, in which case it
+// waits for that call if it is still running and returns its reply.
+func (c *replyCache) do(method, key string, call func() ([]byte, error)) ([]byte, bool, error) {
+	id := method + "\x00" + key
+	c.mu.Lock()
+	c.evict(c.clock.Now())
+	if e, ok := c.entries[id]; ok {
+		c.mu.Unlock()
+		<-e.done
+		return e.data, true, e.err
+	}
+	e := &cachedReply{done: make(chan struct{})}
+	c.entries[id] = e
+	c.order = append(c.order, id)
+	for c.config.MaxKeys > 0 && len(c.order) > c.config.MaxKeys {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.mu.Unlock()
+
+	data, err := call()
+	c.mu.Lock()
+	e.data, e.err = data, err
+	e.expires = c.clock.Now().Add(c.config.TTL)
+	c.mu.Unlock()
+	close(e.done)
+	return data, false, err
+}
+
+// evict drops the expired replies. It must be called with c.mu held.
+func (c *replyCache) evict(now time.Time) {
+	for len(c.order) > 0 {
+		e := c.entries[c.order[0]]
+		if e.expires.IsZero() || now.Before(e.expires) {
+			return
+		}
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
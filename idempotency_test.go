@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// keyedMove is a move request carrying an idempotency key.
+func keyedMove(key string) map[string]any {
+	return map[string]any{"move": json.RawMessage(`{"cell":1}`), "idempotency_key": key}
+}
+
+func TestMoveRetriedAfterReconnect(t *testing.T) {
+	h := newHarness(t, nil)
+	r, players := startGame(t, h, 2)
+	first := players[0]
+	p, _ := h.Server.players.Get(first.ID)
+
+	reply, err := first.RPC("move", keyedMove("k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the player to be away", func() bool { return p.Presence() == presenceAway })
+	retry := connect(t, h, p.UserID)
+	if p.ID() != retry.ID {
+		t.Fatalf("player not resumed by %s", retry.ID)
+	}
+
+	replayed, err := retry.RPC("move", keyedMove("k1"))
+	if err != nil {
+		t.Fatalf("retried move: %s", err)
+	}
+	if string(replayed) != string(reply) {
+		t.Errorf("retried move replied %s, want %s", replayed, reply)
+	}
+	if moves := r.GameState(retry.ID).Moves; len(moves) != 1 {
+		t.Errorf("%d moves recorded, want 1", len(moves))
+	}
+	if turn, _ := r.CurrentTurn(); turn != players[1].ID {
+		t.Errorf("turn of %s, want %s", turn, players[1].ID)
+	}
+
+	// A new key is a new move, out of turn.
+	if code := callError(t, retry, "move", keyedMove("k2")); code != CodeNotYourTurn {
+		t.Errorf("new move: code %d, want %d", code, CodeNotYourTurn)
+	}
+}
+
+func TestReplyCacheBounds(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	c := newReplyCache(IdempotencyConfig{TTL: time.Minute, MaxKeys: 2}, clock)
+	calls := 0
+	call := func() ([]byte, error) {
+		calls++
+		return []byte{byte(calls)}, nil
+	}
+
+	c.do("move", "a", call)
+	if data, cached, _ := c.do("move", "a", call); !cached || data[0] != 1 {
+		t.Fatalf("retry replied %v cached %v, want the first reply", data, cached)
+	}
+	if _, cached, _ := c.do("chat", "a", call); cached {
+		t.Error("key shared across methods")
+	}
+	// Over MaxKeys, the oldest reply is dropped.
+	c.do("move", "b", call)
+	if _, cached, _ := c.do("move", "a", call); cached {
+		t.Error("oldest key kept over MaxKeys")
+	}
+
+	clock.Advance(time.Minute)
+	before := calls
+	if _, cached, _ := c.do("move", "b", call); cached || calls != before+1 {
+		t.Error("reply replayed after its TTL")
+	}
+}
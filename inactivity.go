@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// InactivityConfig holds the settings of the disconnection of idle
+// clients.
+type InactivityConfig struct {
+	// Timeout disconnects the clients that neither publish nor call an RPC
+	// for that long, with DisconnectInactive. Zero never does.
+	Timeout time.Duration
+	// Warning is how long before the disconnection clients are nudged with
+	// msgInactive, giving them a chance to act. Zero disconnects them
+	// without warning.
+	Warning time.Duration
+}
+
+// msgInactive warns a client of its disconnection for inactivity. It is
+// sent to the connection only, rather than published.
+const msgInactive = "client.inactive"
+
+// inactivityNudge is the payload of msgInactive.
+type inactivityNudge struct {
+	// In is the time before the disconnection, in seconds.
+	In      float64 `json:"in"`
+	Message string  `json:"message"`
+}
+
+// idleClient is the inactivity timer of a connection.
+type idleClient struct {
+	client *centrifuge.Client
+	timer  Timer
+	warned bool
+}
+
+// inactivity disconnects the idle clients, nudging them first.
+type inactivity struct {
+	config InactivityConfig
+	clock  Clock
+
+	mu      sync.Mutex
+	clients map[string]*idleClient
+	nudge   func(client *centrifuge.Client, in time.Duration)
+}
+
+func newInactivity(config InactivityConfig, clock Clock, nudge func(client *centrifuge.Client, in time.Duration)) *inactivity {
+	if config.Warning > config.Timeout {
+		config.Warning = config.Timeout
+	}
+	return &inactivity{
+		config:  config,
+		clock:   clock,
+		clients: make(map[string]*idleClient),
+		nudge:   nudge,
+	}
+}
+
+// watch starts the inactivity timer of a new connection.
+func (i *inactivity) watch(client *centrifuge.Client) {
+	if i.config.Timeout <= 0 {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	c := &idleClient{client: client}
+	i.clients[client.ID()] = c
+	i.arm(c)
+}
+
+// active restarts the inactivity timer of clientID, cancelling the pending
+// disconnection if it was nudged.
+func (i *inactivity) active(clientID string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	c, ok := i.clients[clientID]
+	if !ok {
+		return
+	}
+	if c.warned {
+		c.warned = false
+		log.Info().Msgf("client %s active again, not disconnected", clientID)
+	}
+	i.arm(c)
+}
+
+// forget stops the inactivity timer of a closed connection.
+func (i *inactivity) forget(clientID string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if c, ok := i.clients[clientID]; ok {
+		c.timer.Stop()
+		delete(i.clients, clientID)
+	}
+}
+
+// arm schedules the nudge of c, or its disconnection once nudged. It must
+// be called with i.mu held.
+func (i *inactivity) arm(c *idleClient) {
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	d := i.config.Timeout
+	switch {
+	case c.warned:
+		d = i.config.Warning
+	case i.config.Warning > 0:
+		d -= i.config.Warning
+	}
+	var timer Timer
+	timer = i.clock.AfterFunc(d, func() {
+		i.mu.Lock()
+		// Activity may have rearmed the timer after it fired.
+		if c.timer != timer {
+			i.mu.Unlock()
+			return
+		}
+		if !c.warned && i.config.Warning > 0 {
+			c.warned = true
+			i.arm(c)
+			i.mu.Unlock()
+			log.Info().Msgf("client %s inactive, disconnecting in %s", c.client.ID(), i.config.Warning)
+			i.nudge(c.client, i.config.Warning)
+			return
+		}
+		delete(i.clients, c.client.ID())
+		i.mu.Unlock()
+		log.Info().Msgf("client %s inactive for %s, disconnecting", c.client.ID(), i.config.Timeout)
+		c.client.Disconnect(DisconnectInactive)
+	})
+	c.timer = timer
+}
+
+// nudgeInactive warns client that it will be disconnected in d unless it
+// acts.
+func (s *Server) nudgeInactive(client *centrifuge.Client, d time.Duration) {
+	payload, err := json.Marshal(inactivityNudge{
+		In:      d.Seconds(),
+		Message: fmt.Sprintf("you will be disconnected in %s due to inactivity", d),
+	})
+	if err != nil {
+		return
+	}
+	data, err := marshalMessage(client.Transport().Protocol(), Message{Type: msgInactive, Payload: payload})
+	if err == nil {
+		err = client.Send(data)
+	}
+	if err != nil {
+		log.Warn().Msgf("client %s not nudged: %s", client.ID(), err.Error())
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// nextNudge returns the next msgInactive sent to c.
+func nextNudge(t *testing.T, c *HarnessClient) inactivityNudge {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for {
+		p, err := c.Next(ctx)
+		if err != nil {
+			t.Fatalf("no nudge: %s", err)
+		}
+		if p.Message.Type != msgInactive {
+			continue
+		}
+		var nudge inactivityNudge
+		if err := json.Unmarshal(p.Message.Payload, &nudge); err != nil {
+			t.Fatal(err)
+		}
+		return nudge
+	}
+}
+
+func TestInactivityNudgeThenDisconnect(t *testing.T) {
+	m := &countingMetrics{counts: make(map[string]float64)}
+	h := newHarness(t, func(c *Config) {
+		c.Metrics = m
+		c.Inactivity = InactivityConfig{Timeout: time.Minute, Warning: 20 * time.Second}
+	})
+	c := connect(t, h, "alice")
+	connected := func() bool {
+		_, ok := h.Server.node.Hub().Connections()[c.ID]
+		return ok
+	}
+
+	h.Clock.Advance(40 * time.Second)
+	if nudge := nextNudge(t, c); nudge.In != 20 {
+		t.Errorf("nudged %vs before the disconnection, want 20s", nudge.In)
+	}
+	// Nudged once only, then disconnected once the warning is over.
+	h.Clock.Advance(20*time.Second - time.Millisecond)
+	if !connected() {
+		t.Fatal("disconnected before the end of the warning")
+	}
+	h.Clock.Advance(time.Millisecond)
+	eventually(t, "the idle client to be disconnected", func() bool {
+		return !connected() && m.count("inactivity_disconnects_total") == 1
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for {
+		p, err := c.Next(ctx)
+		if errors.Is(err, ErrHarnessClosed) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Message.Type == msgInactive {
+			t.Fatal("nudged twice")
+		}
+	}
+}
+
+func TestActivityAfterNudgeCancelsDisconnect(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.Inactivity = InactivityConfig{Timeout: time.Minute, Warning: 20 * time.Second}
+	})
+	c := connect(t, h, "alice")
+	h.Clock.Advance(40 * time.Second)
+	nextNudge(t, c)
+
+	createRoom(t, c, createRoomRequest{})
+	h.Clock.Advance(20 * time.Second)
+	if _, ok := h.Server.node.Hub().Connections()[c.ID]; !ok {
+		t.Fatal("client active after the nudge disconnected")
+	}
+	// The timeout starts over from the activity, nudge included.
+	h.Clock.Advance(20 * time.Second)
+	nextNudge(t, c)
+	h.Clock.Advance(20 * time.Second)
+	eventually(t, "the idle client to be disconnected", func() bool {
+		_, ok := h.Server.node.Hub().Connections()[c.ID]
+		return !ok
+	})
+}
@@ -1,16 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/centrifugal/centrifuge"
-	centrigo "github.com/centrifugal/centrifuge-go"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 )
 
@@ -18,7 +18,6 @@ var log zerolog.Logger
 
 func main() {
 	var err error
-	var wg sync.WaitGroup
 
 	// Init log
 	zerolog.SetGlobalLevel(zerolog.DebugLevel)
@@ -29,78 +28,56 @@ func main() {
 	}
 	log = zerolog.New(output).With().Timestamp().Logger()
 
-	node, err := centrifuge.New(centrifuge.Config{
-		LogLevel: centrifuge.LogLevelDebug,
-	})
+	config := DefaultConfig()
+	config.Metrics = PrometheusMetrics(nil)
+	config.AdminToken = os.Getenv("ADMIN_TOKEN")
+	config.HTTP.CertFile = os.Getenv("TLS_CERT_FILE")
+	config.HTTP.KeyFile = os.Getenv("TLS_KEY_FILE")
+	// The games are saved on shutdown and restored from STATE_DIR.
+	if dir := os.Getenv("STATE_DIR"); dir != "" {
+		config.Store = NewFileStore(dir)
+	}
+	config.RestoreGames = os.Getenv("RESTORE_GAMES") != ""
+	if config.RestoreGames && config.Store == nil {
+		log.Fatal().Msg("RESTORE_GAMES requires STATE_DIR to restore the games from")
+	}
+	config.TestMode = os.Getenv("TEST_MODE") != ""
+	config.Upgrades.HashIPs = os.Getenv("HASH_CLIENT_IPS") != ""
+	config.Upgrades.IPSalt = os.Getenv("CLIENT_IP_SALT")
+	if key := os.Getenv("SIGNING_KEY"); key != "" {
+		// The internal clients sign with the key the server verifies.
+		config.Signing.Key = []byte(key)
+		config.ClientOptions.SigningKey = config.Signing.Key
+		if roles := os.Getenv("SIGNED_ROLES"); roles != "" {
+			config.Signing.Roles = strings.Split(roles, ",")
+		}
+	}
+	if path := os.Getenv("AUDIT_LOG"); path != "" {
+		config.Audit = AuditConfig{Sink: AuditFile, Path: path}
+	}
+	if codec := os.Getenv("SNAPSHOT_CODEC"); codec != "" {
+		config.SnapshotCodec = codec
+	}
+	if err := config.HTTP.validate(); err != nil {
+		log.Fatal().Msgf("invalid http configuration: %s", err.Error())
+	}
+	srv, err := NewServer(config)
 	if err != nil {
-		panic(fmt.Errorf("error instantiating new centrifuge node: %w", err))
+		panic(err)
 	}
-
-	node.OnConnect(func(client *centrifuge.Client) {
-		// In our example transport will always be Websocket but it can also be SockJS.
-		transportName := client.Transport().Name()
-		// In our example clients connect with JSON protocol but it can also be Protobuf.
-		transportProto := client.Transport().Protocol()
-		log.Info().Msgf("client %s (%s) connected via %s (%s)", client.ID(), string(client.Info()), transportName, transportProto)
-
-		client.OnSubscribe(func(e centrifuge.SubscribeEvent, cb centrifuge.SubscribeCallback) {
-			log.Info().Msgf("client %s (%s) subscribes on channel %s", client.ID(), string(client.Info()), e.Channel)
-			cb(centrifuge.SubscribeReply{}, nil)
-		})
-
-		client.OnPublish(func(e centrifuge.PublishEvent, cb centrifuge.PublishCallback) {
-			log.Info().Msgf("client %s (%s) publishes into channel %s: %s", client.ID(), string(client.Info()), e.Channel, string(e.Data))
-			cb(centrifuge.PublishReply{}, nil)
-		})
-
-		client.OnDisconnect(func(e centrifuge.DisconnectEvent) {
-			log.Info().Msgf("client %s (%s) disconnected", client.ID(), string(client.Info()))
-		})
-
-		client.OnRPC(handleRPC)
-		wg.Done()
-	})
-
-	err = node.Run()
+	err = srv.Run()
 	if err != nil {
-		panic(fmt.Errorf("error running centrifuge node: %w", err))
+		panic(err)
 	}
 
-	// Configure HTTP routes.
-	// Serve Websocket connections using WebsocketHandler.
-	wsHandler := centrifuge.NewWebsocketHandler(node, centrifuge.WebsocketConfig{
-		ReadBufferSize: 1024,
-	})
-	http.Handle("/connection/websocket", auth(wsHandler))
-
-	// The second route is for serving index.html file.
-	http.Handle("/", http.FileServer(http.Dir("./public")))
-
-	go func() {
-		log.Info().Msgf("Starting server, visit http://localhost:8000")
-		if err := http.ListenAndServe(":8000", nil); err != nil {
-			panic(fmt.Errorf("error listening on :8000: %w", err))
-		}
-	}()
-
-	clients := make([]*centrigo.Client, 4)
-
-	for i := 0; i < 4; i++ {
-		log.Info().Msgf("create player %d", i)
-		clients[i] = newClient(&log)
-		wg.Add(1)
-		err = clients[i].Connect()
-		if err != nil {
-			log.Panic().Msgf("connect client %d error: %s", i, err.Error())
-		}
+	if config.TestMode {
+		// Nothing connects in test mode, clients would go through a
+		// TestHarness.
+		log.Info().Msg("test mode: not listening")
+	} else {
+		serve(config, srv)
 	}
 
-	log.Info().Msgf("waiting for all clients to connected")
-
-	wg.Wait()
-
-	log.Info().Msgf("all client  connected")
-
 	// Waiting signal
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
@@ -108,89 +85,67 @@ func main() {
 	s := <-interrupt
 	log.Info().Msg("received signal: " + s.String())
 
-	log.Info().Msg("exit")
-}
+	// The phases are bounded by ShutdownPhaseTimeout, this is a backstop.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Error().Msgf("shutdown error: %s", err.Error())
+	}
 
-func handleRPC(e centrifuge.RPCEvent, c centrifuge.RPCCallback) {
-	log.Info().Msgf("client RPC: %s %s", e.Method, string(e.Data))
+	log.Info().Msg("exit")
 }
 
-func newClient(log *zerolog.Logger) *centrigo.Client {
-	wsURL := "ws://localhost:8000/connection/websocket"
-
-	c := centrigo.NewJsonClient(wsURL, centrigo.Config{
-		Name:    "listening-go-client",
-		Version: "0.0.1",
-	})
-
-	c.OnConnecting(func(_ centrigo.ConnectingEvent) {
-		log.Info().Msg("Connecting")
-	})
+// serve starts the HTTP server and connects the internal clients, then
+// waits for them to be ready. Both are closed by srv.Shutdown, the HTTP
+// server right after PhaseStop.
+func serve(config Config, srv *Server) {
+	// Configure HTTP routes.
+	// Serve Websocket connections using WebsocketHandler.
+	authenticator, err := NewAuthenticator(config.Auth)
+	if err != nil {
+		panic(err)
+	}
+	mux := http.NewServeMux()
+	// The WebSocket endpoint is exempted from the HTTP server timeouts.
+	mux.Handle("/connection/websocket", longLived(observeUpgrades(config.Upgrades, auth(authenticator, srv.WebsocketHandler()))))
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/readyz", srv.ReadyzHandler())
+	mux.Handle("/admin/", srv.AdminHandler())
 
-	c.OnConnected(func(_ centrigo.ConnectedEvent) {
-		var err error
-		log.Info().Msg("Connected")
+	// The second route is for serving index.html file.
+	mux.Handle("/", http.FileServer(http.Dir("./public")))
 
-		subServer, err := c.NewSubscription("com.jtbonhomme.server")
-		if err != nil {
-			log.Error().Msgf("subscription creation error: %s", err.Error())
+	httpServer := newHTTPServer(config.HTTP, mux)
+	go func() {
+		log.Info().Msgf("Starting server on %s (tls: %t)", config.HTTP.Addr, config.HTTP.TLS())
+		if err := listenAndServe(httpServer, config.HTTP); err != nil && err != http.ErrServerClosed {
+			panic(fmt.Errorf("error listening on %s: %w", config.HTTP.Addr, err))
 		}
+	}()
+	if err := srv.AddShutdownPhase(PhaseStop, ShutdownPhase{Name: "http", Run: httpServer.Shutdown}); err != nil {
+		panic(err)
+	}
 
-		subServer.OnJoin(func(e centrigo.JoinEvent) {
-			log.Info().Msgf("[com.jtbonhomme.server] join event: %s", e.ClientInfo.Client)
-		})
-
-		subServer.OnError(func(e centrigo.SubscriptionErrorEvent) {
-			log.Info().Msgf("[com.jtbonhomme.server] subscription error event: %s", e.Error.Error())
-		})
-
-		subServer.OnPublication(func(e centrigo.PublicationEvent) {
-			log.Info().Msgf("[com.jtbonhomme.server] publication event: %s", string(e.Data))
-		})
-
-		subServer.OnSubscribing(func(e centrigo.SubscribingEvent) {
-			log.Info().Msgf("[com.jtbonhomme.server] subscribing event: %s", e.Reason)
-		})
-
-		subServer.OnSubscribed(func(e centrigo.SubscribedEvent) {
-			log.Info().Msgf("[com.jtbonhomme.server] subscribed event")
-		})
-
-		err = subServer.Subscribe()
+	// Clients failing to connect are left out, or left reconnecting, and the
+	// server runs degraded without them.
+	for i := 0; i < config.InternalClients; i++ {
+		log.Info().Msgf("create player %d", i)
+		info := config.Client
+		info.Name = internalClientName(info.Name, i)
+		client, err := newClient(&log, websocketURL(config.HTTP.Addr, config.HTTP.TLS()), info, config.ClientOptions)
 		if err != nil {
-			log.Error().Msgf("subscription error: %s", err.Error())
+			log.Error().Msgf("create client %d error: %s", i, err.Error())
+			continue
 		}
-	})
-
-	c.OnDisconnected(func(e centrigo.DisconnectedEvent) {
-		log.Info().Msgf("Disconnected event: %d %s", e.Code, e.Reason)
-		// TODO automatic reconnect?
-	})
-
-	c.OnError(func(e centrigo.ErrorEvent) {
-		log.Info().Msgf("error: %s", e.Error.Error())
-	})
-
-	c.OnMessage(func(e centrigo.MessageEvent) {
-		log.Info().Msgf("Message received from server %s", string(e.Data))
-	})
+		srv.AddInternalClient(client)
+		if err := client.Connect(); err != nil {
+			log.Error().Msgf("connect client %d error: %s", i, err.Error())
+		}
+	}
 
-	return c
-}
+	log.Info().Msgf("waiting for all clients to connected")
 
-func auth(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		// Put authentication Credentials into request Context.
-		// Since we don't have any session backend here we simply
-		// set user ID as empty string. Users with empty ID called
-		// anonymous users, in real app you should decide whether
-		// anonymous users allowed to connect to your server or not.
-		cred := &centrifuge.Credentials{
-			UserID: "",
-		}
-		newCtx := centrifuge.SetCredentials(ctx, cred)
-		r = r.WithContext(newCtx)
-		h.ServeHTTP(w, r)
-	})
+	if srv.WaitReady() {
+		log.Info().Msgf("all client  connected")
+	}
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// ErrMaintenance is returned, as a temporary error, to the calls starting
+// new games while the server is in maintenance.
+var ErrMaintenance = &centrifuge.Error{Code: uint32(CodeMaintenance), Message: "server in maintenance", Temporary: true}
+
+// Maintenance turns the maintenance mode on or off. In maintenance, new
+// rooms, matches and matchmaking are rejected while existing games go on
+// until they finish.
+func (s *Server) Maintenance(on bool) {
+	if s.maintenance.Swap(on) == on {
+		return
+	}
+	if on {
+		log.Info().Msg("maintenance mode on, new games are rejected")
+	} else {
+		log.Info().Msg("maintenance mode off")
+	}
+}
+
+// InMaintenance reports whether the maintenance mode is on.
+func (s *Server) InMaintenance() bool {
+	return s.maintenance.Load()
+}
+
+// acceptGames fails with ErrMaintenance in maintenance, and with
+// ErrServerFull while the node runs Config.MaxGames games.
+func (s *Server) acceptGames() error {
+	if s.InMaintenance() {
+		return ErrMaintenance
+	}
+	if s.rooms.full() {
+		return ErrServerFull
+	}
+	return nil
+}
+
+type maintenanceRequest struct {
+	On bool `json:"on"`
+}
+
+type maintenanceReply struct {
+	Maintenance bool `json:"maintenance"`
+}
+
+// rpcMaintenance toggles the maintenance mode. Admin only.
+func (s *Server) rpcMaintenance(client *centrifuge.Client, data []byte) ([]byte, error) {
+	if !s.isAdmin(client) {
+		return nil, centrifuge.ErrorPermissionDenied
+	}
+	var req maintenanceRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, centrifuge.ErrorBadRequest
+	}
+	s.Maintenance(req.On)
+	return json.Marshal(maintenanceReply{Maintenance: s.InMaintenance()})
+}
+
+type readyzReply struct {
+	Ready       bool `json:"ready"`
+	Maintenance bool `json:"maintenance"`
+	// Degraded is set once the server is ready without every internal
+	// client connected.
+	Degraded bool `json:"degraded,omitempty"`
+	// Unhealthy are the errors of the failing health checks by name.
+	Unhealthy map[string]string `json:"unhealthy,omitempty"`
+}
+
+// ReadyzHandler reports whether the server takes new traffic: it answers
+// 503 until the internal clients are connected, while in maintenance and
+// while a health check fails.
+func (s *Server) ReadyzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reply := readyzReply{Maintenance: s.InMaintenance(), Degraded: s.ready.Degraded(), Unhealthy: s.health.failing()}
+		select {
+		case <-s.Ready():
+			reply.Ready = !reply.Maintenance && reply.Unhealthy == nil
+		default:
+		}
+		if !reply.Ready {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		writeJSON(w, reply)
+	})
+}
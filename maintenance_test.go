@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// readyz returns the status and the reply of the /readyz handler of h.
+func readyz(t *testing.T, h *TestHarness) (int, readyzReply) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.Server.ReadyzHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var reply readyzReply
+	if err := json.Unmarshal(rec.Body.Bytes(), &reply); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, reply
+}
+
+func TestMaintenanceLetsGamesFinish(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.AdminUsers = []string{"admin"} })
+	r, players := startGame(t, h, 2)
+	if code, _ := readyz(t, h); code != http.StatusOK {
+		t.Fatalf("readyz %d before the maintenance, want %d", code, http.StatusOK)
+	}
+
+	if code := callError(t, players[0], "maintenance", maintenanceRequest{On: true}); code != CodePermissionDenied {
+		t.Errorf("maintenance from a player: code %d, want %d", code, CodePermissionDenied)
+	}
+	var reply maintenanceReply
+	call(t, connect(t, h, "admin"), "maintenance", maintenanceRequest{On: true}, &reply)
+	if !reply.Maintenance || !h.Server.InMaintenance() {
+		t.Fatal("maintenance not on")
+	}
+	code, ready := readyz(t, h)
+	if code != http.StatusServiceUnavailable || ready.Ready || !ready.Maintenance {
+		t.Errorf("readyz %d %+v in maintenance, want %d", code, ready, http.StatusServiceUnavailable)
+	}
+
+	// New games are refused with a temporary error.
+	newcomer := connect(t, h, "newcomer")
+	for _, method := range []string{"createRoom", "createMatch", "queue"} {
+		_, err := newcomer.RPC(method, nil)
+		var cerr *centrifuge.Error
+		if !errors.As(err, &cerr) || cerr.Code != uint32(CodeMaintenance) || !cerr.Temporary {
+			t.Errorf("%s in maintenance: %v, want a temporary %d", method, err, CodeMaintenance)
+		}
+	}
+
+	// The game in progress goes on to its end.
+	call(t, players[0], "move", moveRequest{}, nil)
+	call(t, players[1], "forfeit", nil, nil)
+	if state := r.Game.Current(); state != gameFinished {
+		t.Errorf("game %s in maintenance, want %s", state, gameFinished)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+var (
+	// ErrAlreadyQueued is returned by queue for players already searching.
+	ErrAlreadyQueued = errors.New("already queued")
+	// ErrNotQueued is returned by cancelQueue for players not searching.
+	ErrNotQueued = errors.New("not queued")
+)
+
+// Matchmaking ticket FSM states and events.
+const (
+	ticketSearching = "searching"
+	ticketMatched   = "matched"
+	ticketCancelled = "cancelled"
+
+	eventMatch  = "match"
+	eventCancel = "cancel"
+)
+
+// matchmakerOwner owns the rooms created by the matchmaker.
+const matchmakerOwner = "matchmaker"
+
+const msgMatchFound = "match.found"
+
+// ticket is a player waiting in the matchmaking pool.
+type ticket struct {
+	client *centrifuge.Client
+	player *Player
+	FSM    *FSM
+}
+
+func newTicket(client *centrifuge.Client, p *Player) *ticket {
+	return &ticket{
+		client: client,
+		player: p,
+		FSM: NewFSM(ticketSearching, []Transition{
+			{Event: eventMatch, From: ticketSearching, To: ticketMatched},
+			{Event: eventCancel, From: ticketSearching, To: ticketCancelled},
+		}),
+	}
+}
+
+// Matchmaker pools searching players until there are enough of them for a
+// game.
+type Matchmaker struct {
+	size int
+
+	mu    sync.Mutex
+	queue []*ticket
+}
+
+// NewMatchmaker creates a pool matching players by groups of size.
+func NewMatchmaker(size int) *Matchmaker {
+	if size < 1 {
+		size = 1
+	}
+	return &Matchmaker{size: size}
+}
+
+// Enqueue adds t to the pool. Once the pool holds enough players, the
+// oldest ones are matched and returned.
+func (m *Matchmaker) Enqueue(t *ticket) ([]*ticket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, queued := range m.queue {
+		if queued.client.ID() == t.client.ID() {
+			return nil, fmt.Errorf("%w: %s", ErrAlreadyQueued, t.client.ID())
+		}
+	}
+	m.queue = append(m.queue, t)
+	if len(m.queue) < m.size {
+		return nil, nil
+	}
+	matched := append([]*ticket{}, m.queue[:m.size]...)
+	m.queue = append(m.queue[:0], m.queue[m.size:]...)
+	for _, t := range matched {
+		_ = t.FSM.Fire(eventMatch)
+	}
+	return matched, nil
+}
+
+// Cancel takes clientID out of the pool.
+func (m *Matchmaker) Cancel(clientID string) (*ticket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, t := range m.queue {
+		if t.client.ID() != clientID {
+			continue
+		}
+		m.queue = append(m.queue[:i], m.queue[i+1:]...)
+		_ = t.FSM.Fire(eventCancel)
+		return t, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotQueued, clientID)
+}
+
+// Queued returns the number of searching players.
+func (m *Matchmaker) Queued() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.queue)
+}
+
+type queueReply struct {
+	State   string `json:"state"`
+	Queued  int    `json:"queued"`
+	Room    string `json:"room,omitempty"`
+	Channel string `json:"channel,omitempty"`
+}
+
+// matchFound is the payload of msgMatchFound, sent to every matched client.
+type matchFound struct {
+	Room    string   `json:"room"`
+	Channel string   `json:"channel"`
+	Players []string `json:"players"`
+}
+
+// rpcQueue puts the caller's idle player in the matchmaking pool. Completing
+// a group starts its game right away.
+func (s *Server) rpcQueue(client *centrifuge.Client, _ []byte) ([]byte, error) {
+	if err := s.acceptGames(); err != nil {
+		return nil, err
+	}
+	p, ok := s.players.Get(client.ID())
+	if !ok {
+		return nil, ErrPlayerNotFound
+	}
+	if state := p.FSM.Current(); state != playerIdle {
+		return nil, fmt.Errorf("%w: queue from %s", ErrIllegalTransition, state)
+	}
+	t := newTicket(client, p)
+	matched, err := s.matcher.Enqueue(t)
+	if err != nil {
+		return nil, err
+	}
+	reply := queueReply{State: t.FSM.Current(), Queued: s.matcher.Queued()}
+	if matched != nil {
+		r, err := s.startMatch(matched)
+		if err != nil {
+			return nil, err
+		}
+		reply.Room, reply.Channel = r.ID, r.Channel()
+	}
+	return json.Marshal(reply)
+}
+
+// rpcCancelQueue takes the caller out of the matchmaking pool.
+func (s *Server) rpcCancelQueue(client *centrifuge.Client, _ []byte) ([]byte, error) {
+	t, err := s.matcher.Cancel(client.ID())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(queueReply{State: t.FSM.Current(), Queued: s.matcher.Queued()})
+}
+
+// startMatch creates a room for the matched players, seats them ready and
+// starts the game.
+func (s *Server) startMatch(matched []*ticket) (*Room, error) {
+	r, err := s.rooms.CreateRoom(matchmakerOwner)
+	if err != nil {
+		return nil, err
+	}
+	found := matchFound{Room: r.ID, Channel: r.Channel()}
+	for _, t := range matched {
+		p := t.player
+		if p.Room() != "" {
+			_ = s.rooms.LeaveRoom(p.Room(), p.ID())
+		}
+		if _, err := s.rooms.JoinRoom(r.ID, p.ID()); err != nil {
+			return nil, err
+		}
+		p.SetRoom(r.ID)
+		if err := p.FSM.Fire(eventReady); err != nil {
+			log.Warn().Msgf("room %s: matched player %s can't get ready: %s", r.ID, p.ID(), err.Error())
+			continue
+		}
+		r.SetReady(p.ID(), true)
+		found.Players = append(found.Players, p.ID())
+	}
+	log.Info().Msgf("room %s: matched %v", r.ID, found.Players)
+	if err := r.Start(); err != nil {
+		log.Warn().Msgf("room %s: matched game can't start: %s", r.ID, err.Error())
+	}
+
+	data, err := json.Marshal(found)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := json.Marshal(Message{Type: msgMatchFound, Payload: data})
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range matched {
+		if err := t.client.Send(msg); err != nil {
+			log.Warn().Msgf("client %s: match notification failed: %s", t.client.ID(), err.Error())
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPrivateMatchInvites(t *testing.T) {
+	h := newHarness(t, nil)
+	owner := connect(t, h, "owner")
+	guest := connect(t, h, "guest")
+	stranger := connect(t, h, "stranger")
+
+	var match matchReply
+	call(t, owner, "createMatch", nil, &match)
+	if match.Invite == "" || match.Channel == "" {
+		t.Fatalf("match reply %+v without invite or channel", match)
+	}
+	if err := owner.Subscribe(match.Channel); err != nil {
+		t.Fatalf("owner subscribe: %s", err)
+	}
+
+	call(t, guest, "joinMatch", inviteRequest{Invite: match.Invite}, nil)
+	if err := guest.Subscribe(match.Channel); err != nil {
+		t.Fatalf("invited subscribe: %s", err)
+	}
+
+	if code := callError(t, stranger, "joinMatch", inviteRequest{Invite: "forged"}); code != CodeInvalidInvite {
+		t.Errorf("forged invite: code %d, want %d", code, CodeInvalidInvite)
+	}
+	if code := callError(t, stranger, "joinRoom", roomRequest{Room: match.Room}); code != CodePermissionDenied {
+		t.Errorf("uninvited join: code %d, want %d", code, CodePermissionDenied)
+	}
+	if err := stranger.Subscribe(match.Channel); errorCode(err) != CodePermissionDenied {
+		t.Errorf("uninvited subscribe: %v, want code %d", err, CodePermissionDenied)
+	}
+}
+
+func TestQueueMatchesAtRequiredCount(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.Room.MinPlayers = 3 })
+	var reply queueReply
+	for i := 0; i < 2; i++ {
+		call(t, connect(t, h, fmt.Sprintf("user%d", i)), "queue", nil, &reply)
+		if reply.State != ticketSearching || reply.Room != "" {
+			t.Fatalf("queued player %d: %+v, want searching without room", i, reply)
+		}
+	}
+	if n := len(h.Server.rooms.Rooms()); n != 0 {
+		t.Fatalf("%d rooms before the match is complete", n)
+	}
+
+	call(t, connect(t, h, "user2"), "queue", nil, &reply)
+	if reply.State != ticketMatched || reply.Room == "" || reply.Queued != 0 {
+		t.Fatalf("last player: %+v, want matched in a room with an empty queue", reply)
+	}
+	r, ok := h.Server.rooms.Room(reply.Room)
+	if !ok {
+		t.Fatalf("room %s not found", reply.Room)
+	}
+	if r.Game.Current() != gamePlaying || len(r.TurnOrder()) != 3 {
+		t.Errorf("game %s with %d players, want %s with 3", r.Game.Current(), len(r.TurnOrder()), gamePlaying)
+	}
+}
+
+func TestCancelQueue(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.Room.MinPlayers = 2 })
+	c := connect(t, h, "user")
+	call(t, c, "queue", nil, nil)
+	if code := callError(t, c, "queue", nil); code != CodeAlreadyQueued {
+		t.Errorf("queued twice: code %d, want %d", code, CodeAlreadyQueued)
+	}
+
+	var reply queueReply
+	call(t, c, "cancelQueue", nil, &reply)
+	if reply.State != ticketCancelled || reply.Queued != 0 {
+		t.Fatalf("cancel reply %+v, want cancelled with an empty queue", reply)
+	}
+	if code := callError(t, c, "cancelQueue", nil); code != CodeNotQueued {
+		t.Errorf("cancelled twice: code %d, want %d", code, CodeNotQueued)
+	}
+
+	// The cancelled player doesn't complete the next match.
+	call(t, connect(t, h, "other"), "queue", nil, &reply)
+	if reply.State != ticketSearching {
+		t.Errorf("matched with a cancelled player: %+v", reply)
+	}
+}
+
+func TestDisconnectLeavesQueue(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.Room.MinPlayers = 2 })
+	c := connect(t, h, "user")
+	call(t, c, "queue", nil, nil)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the queue to empty", func() bool { return h.Server.matcher.Queued() == 0 })
+}
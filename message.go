@@ -0,0 +1,69 @@
+package main
+
+import "encoding/json"
+
+// Message types published by the server.
+const (
+	msgGameState   = "game.state"
+	msgGamePaused  = "game.paused"
+	msgGameResumed = "game.resumed"
+	msgGameForfeit = "game.forfeit"
+
+	msgCountdownCancelled = "game.countdown_cancelled"
+)
+
+// forfeitEvent is the payload of msgGameForfeit.
+type forfeitEvent struct {
+	Room      string `json:"room"`
+	Player    string `json:"player"`
+	Remaining int    `json:"remaining"`
+}
+
+// roomEvent is the payload of notifications about a room.
+type roomEvent struct {
+	Room string `json:"room"`
+}
+
+// countdownEvent is the payload of msgCountdownCancelled.
+type countdownEvent struct {
+	Room string `json:"room"`
+	// Ready is the number of players left ready, Needed the number to
+	// start the countdown again.
+	Ready  int `json:"ready"`
+	Needed int `json:"needed"`
+}
+
+// gameStateEvent is the payload of msgGameState.
+type gameStateEvent struct {
+	Room  string `json:"room"`
+	Event string `json:"event"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	// Reason explains forced transitions, e.g. "timeout".
+	Reason string `json:"reason,omitempty"`
+	// Turn is the client ID of the player to move while playing.
+	Turn string `json:"turn,omitempty"`
+	// Order is the turn order of the players, set when the game starts.
+	Order []string `json:"order,omitempty"`
+}
+
+// Message is the envelope of every game event published on a channel.
+// Type selects the handler, Payload is left raw for it to decode. When
+// Compressed is set, Payload is a base64 JSON string of the gzipped payload;
+// when Encrypted is set, of the payload sealed with the key of its room, see
+// Room.Encrypt.
+// Seq numbers the messages of a room channel from 1, so that clients can
+// detect the ones they missed; it is zero on other channels. Depth is the
+// length of the causation chain of the message: zero for spontaneous
+// events, n+1 for the ones caused by an RPC reacting to a message of depth
+// n, see Config.MaxCausationDepth. Signature is the HMAC of the messages
+// of trusted clients, see SigningConfig.
+type Message struct {
+	Type       string          `json:"type"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	Compressed bool            `json:"compressed,omitempty"`
+	Seq        uint64          `json:"seq,omitempty"`
+	Depth      uint32          `json:"depth,omitempty"`
+	Signature  []byte          `json:"sig,omitempty"`
+	Encrypted  bool            `json:"encrypted,omitempty"`
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/centrifugal/centrifuge"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of proto/message.proto.
+const (
+	messageFieldType       protowire.Number = 1
+	messageFieldPayload    protowire.Number = 2
+	messageFieldCompressed protowire.Number = 3
+	messageFieldSeq        protowire.Number = 4
+	messageFieldDepth      protowire.Number = 5
+	messageFieldSignature  protowire.Number = 6
+	messageFieldEncrypted  protowire.Number = 7
+)
+
+var errInvalidEnvelope = errors.New("invalid message envelope")
+
+// marshalMessage encodes msg for clients using protocol.
+func marshalMessage(protocol centrifuge.ProtocolType, msg Message) ([]byte, error) {
+	if protocol == centrifuge.ProtocolTypeProtobuf {
+		return marshalMessageProto(msg), nil
+	}
+	return json.Marshal(msg)
+}
+
+// unmarshalMessage decodes an envelope sent by a client using protocol.
+// Channels carry JSON envelopes, which protobuf clients may receive too, so
+// the protobuf decoder accepts them as well.
+func unmarshalMessage(protocol centrifuge.ProtocolType, data []byte) (Message, error) {
+	var msg Message
+	if protocol == centrifuge.ProtocolTypeProtobuf && !isJSONObject(data) {
+		return unmarshalMessageProto(data)
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return msg, fmt.Errorf("%w: %s", errInvalidEnvelope, err.Error())
+	}
+	return msg, nil
+}
+
+// translateMessage re-encodes an envelope from one protocol to another.
+func translateMessage(data []byte, from, to centrifuge.ProtocolType) ([]byte, error) {
+	if from == to {
+		return data, nil
+	}
+	msg, err := unmarshalMessage(from, data)
+	if err != nil {
+		return nil, err
+	}
+	return marshalMessage(to, msg)
+}
+
+func isJSONObject(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return len(data) > 0 && data[0] == '{'
+}
+
+// marshalMessageProto and unmarshalMessageProto implement the wire format of
+// proto/message.proto with protowire, which keeps message.go the single
+// definition of the envelope.
+func marshalMessageProto(msg Message) []byte {
+	var b []byte
+	if msg.Type != "" {
+		b = protowire.AppendTag(b, messageFieldType, protowire.BytesType)
+		b = protowire.AppendString(b, msg.Type)
+	}
+	if len(msg.Payload) > 0 {
+		b = protowire.AppendTag(b, messageFieldPayload, protowire.BytesType)
+		b = protowire.AppendBytes(b, msg.Payload)
+	}
+	if msg.Compressed {
+		b = protowire.AppendTag(b, messageFieldCompressed, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(true))
+	}
+	if msg.Seq != 0 {
+		b = protowire.AppendTag(b, messageFieldSeq, protowire.VarintType)
+		b = protowire.AppendVarint(b, msg.Seq)
+	}
+	if msg.Depth != 0 {
+		b = protowire.AppendTag(b, messageFieldDepth, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(msg.Depth))
+	}
+	if len(msg.Signature) > 0 {
+		b = protowire.AppendTag(b, messageFieldSignature, protowire.BytesType)
+		b = protowire.AppendBytes(b, msg.Signature)
+	}
+	if msg.Encrypted {
+		b = protowire.AppendTag(b, messageFieldEncrypted, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(true))
+	}
+	return b
+}
+
+func unmarshalMessageProto(b []byte) (Message, error) {
+	var msg Message
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return msg, fmt.Errorf("%w: %s", errInvalidEnvelope, protowire.ParseError(n).Error())
+		}
+		b = b[n:]
+
+		switch {
+		case num == messageFieldType && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			if n < 0 {
+				return msg, fmt.Errorf("%w: %s", errInvalidEnvelope, protowire.ParseError(n).Error())
+			}
+			msg.Type = v
+			b = b[n:]
+		case num == messageFieldPayload && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return msg, fmt.Errorf("%w: %s", errInvalidEnvelope, protowire.ParseError(n).Error())
+			}
+			msg.Payload = append(json.RawMessage(nil), v...)
+			b = b[n:]
+		case num == messageFieldCompressed && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return msg, fmt.Errorf("%w: %s", errInvalidEnvelope, protowire.ParseError(n).Error())
+			}
+			msg.Compressed = protowire.DecodeBool(v)
+			b = b[n:]
+		case num == messageFieldSeq && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return msg, fmt.Errorf("%w: %s", errInvalidEnvelope, protowire.ParseError(n).Error())
+			}
+			msg.Seq = v
+			b = b[n:]
+		case num == messageFieldDepth && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return msg, fmt.Errorf("%w: %s", errInvalidEnvelope, protowire.ParseError(n).Error())
+			}
+			msg.Depth = uint32(v)
+			b = b[n:]
+		case num == messageFieldSignature && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return msg, fmt.Errorf("%w: %s", errInvalidEnvelope, protowire.ParseError(n).Error())
+			}
+			msg.Signature = append([]byte(nil), v...)
+			b = b[n:]
+		case num == messageFieldEncrypted && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return msg, fmt.Errorf("%w: %s", errInvalidEnvelope, protowire.ParseError(n).Error())
+			}
+			msg.Encrypted = protowire.DecodeBool(v)
+			b = b[n:]
+		default:
+			// Skip unknown fields for forward compatibility.
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return msg, fmt.Errorf("%w: %s", errInvalidEnvelope, protowire.ParseError(n).Error())
+			}
+			b = b[n:]
+		}
+	}
+	return msg, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+func TestProtobufAndJSONClientsShareARoom(t *testing.T) {
+	h := newHarness(t, nil)
+	owner := connect(t, h, "owner")
+	room := createRoom(t, owner, createRoomRequest{})
+	guest, err := h.ConnectProtobuf("guest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*HarnessClient{owner, guest} {
+		call(t, c, "joinRoom", roomRequest{Room: room.Room}, nil)
+		if err := c.Subscribe(room.Channel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each client publishes in its own encoding and receives the other's.
+	const msgNote = "note"
+	for _, tc := range []struct {
+		from, to *HarnessClient
+		payload  string
+	}{
+		{owner, guest, `{"from":"json"}`},
+		{guest, owner, `{"from":"protobuf"}`},
+	} {
+		if err := tc.from.Publish(room.Channel, Message{Type: msgNote, Payload: json.RawMessage(tc.payload)}); err != nil {
+			t.Fatal(err)
+		}
+		// The receiver got its own publication first, if any.
+		pub := nextMessage(t, tc.to, msgNote)
+		for string(pub.Message.Payload) != tc.payload {
+			pub = nextMessage(t, tc.to, msgNote)
+		}
+	}
+}
+
+func TestMessageProtoRoundTrip(t *testing.T) {
+	msg := Message{Type: msgGameState, Payload: json.RawMessage(`{"turn":"a"}`), Seq: 7, Depth: 2}
+	got, err := unmarshalMessage(centrifuge.ProtocolTypeProtobuf, marshalMessageProto(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Errorf("decoded %+v, want %+v", got, msg)
+	}
+}
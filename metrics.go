@@ -0,0 +1,126 @@
+package main
+
+import "sync/atomic"
+
+const metricsNamespace = "centrifuge_fsm"
+
+// Metrics is the backend of the server instrumentation, set with
+// Config.Metrics: PrometheusMetrics, NopMetrics, the default, or another
+// one, e.g. for StatsD. Instruments are created once per server with their
+// label names, and updated with values for them, in the same order.
+type Metrics interface {
+	Counter(name, help string, labels ...string) Counter
+	Gauge(name, help string, labels ...string) Gauge
+	Histogram(name, help string, buckets []float64, labels ...string) Histogram
+}
+
+// Counter is a metric that only goes up.
+type Counter interface {
+	Add(delta float64, labelValues ...string)
+}
+
+// Gauge is a metric that goes up and down.
+type Gauge interface {
+	Set(value float64, labelValues ...string)
+	Add(delta float64, labelValues ...string)
+}
+
+// Histogram samples observations in buckets.
+type Histogram interface {
+	Observe(value float64, labelValues ...string)
+}
+
+// NopMetrics returns a backend discarding every metric.
+func NopMetrics() Metrics {
+	return nopMetrics{}
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) Counter(string, string, ...string) Counter { return nopInstrument{} }
+func (nopMetrics) Gauge(string, string, ...string) Gauge     { return nopInstrument{} }
+func (nopMetrics) Histogram(string, string, []float64, ...string) Histogram {
+	return nopInstrument{}
+}
+
+type nopInstrument struct{}
+
+func (nopInstrument) Add(float64, ...string)     {}
+func (nopInstrument) Set(float64, ...string)     {}
+func (nopInstrument) Observe(float64, ...string) {}
+
+// instruments are the metrics of the server.
+type instruments struct {
+	connections                 Gauge
+	games                       Gauge
+	maxGames                    Gauge
+	slowConsumerDisconnects     Counter
+	keepaliveTimeoutDisconnects Counter
+	inactivityDisconnects       Counter
+	replayResyncs               Counter
+	transitions                 Counter
+	labeledTransitions          Counter
+	busDropped                  Counter
+	publishDropped              Counter
+	publishQueueDepth           Gauge
+	publishSize                 Histogram
+	rpcDuration                 Histogram
+	sendBufferOverflows         Counter
+	connectAttempts             Counter
+	connectionQuota             Counter
+	websocketUpgrades           Counter
+}
+
+func newInstruments(m Metrics) *instruments {
+	return &instruments{
+		connections:                 m.Gauge("connections", "Number of connected clients."),
+		games:                       m.Gauge("games", "Number of active games."),
+		maxGames:                    m.Gauge("games_max", "Maximum number of active games, zero for no limit."),
+		slowConsumerDisconnects:     m.Counter("slow_consumer_disconnects_total", "Number of clients disconnected because they could not keep up with writes."),
+		keepaliveTimeoutDisconnects: m.Counter("keepalive_timeout_disconnects_total", "Number of clients disconnected because they did not answer a ping in time."),
+		inactivityDisconnects:       m.Counter("inactivity_disconnects_total", "Number of clients disconnected for inactivity."),
+		replayResyncs:               m.Counter("replay_resyncs_total", "Number of recentEvents calls answered with a resync over Config.MaxReplay."),
+		transitions:                 m.Counter("fsm_transitions_total", "Number of FSM transitions."),
+		labeledTransitions:          m.Counter("fsm_labeled_transitions_total", "Number of transitions of labeled FSMs by label.", fsmLabelKeys...),
+		busDropped:                  m.Counter("transition_bus_dropped_total", "Number of transitions not delivered to the central observers because their queue was full."),
+		publishDropped:              m.Counter("publish_dropped_total", "Number of publications dropped because the publish queue was full."),
+		publishQueueDepth:           m.Gauge("publish_queue_depth", "Number of publications waiting in the publish queue.", "node"),
+		publishSize:                 m.Histogram("publish_size_bytes", "Size of the publications queued.", []float64{64, 256, 1024, 4096, 16384, 65536}),
+		rpcDuration:                 m.Histogram("rpc_duration_seconds", "Time taken to handle RPCs by method.", []float64{.001, .005, .01, .05, .1, .5, 1, 5}, "method"),
+		sendBufferOverflows:         m.Counter("send_buffer_overflows_total", "Number of messages sent to a full connection send buffer by policy action.", "action"),
+		connectAttempts:             m.Counter("connect_attempts_total", "Number of connection attempts by rate limiter outcome. Queued attempts are counted again once accepted or rejected.", "outcome"),
+		connectionQuota:             m.Counter("connection_quota_total", "Number of connections rejected or evicted by the per-user connection quota by action.", "action"),
+		websocketUpgrades:           m.Counter("websocket_upgrades_total", "Number of WebSocket upgrade requests by result and failure reason.", "result", "reason"),
+	}
+}
+
+// meters holds the instruments of the process, which outlive servers like
+// the FSMs they count: the last server created sets them.
+var meters atomic.Pointer[instruments]
+
+func init() {
+	meters.Store(newInstruments(NopMetrics()))
+}
+
+// metrics returns the instruments of the process.
+func metrics() *instruments {
+	return meters.Load()
+}
+
+// useMetrics makes m the backend of the process, NopMetrics if nil.
+func useMetrics(m Metrics) {
+	if m == nil {
+		m = NopMetrics()
+	}
+	meters.Store(newInstruments(m))
+}
+
+// fsmTransitions counts the transitions of every FSM in the process, for
+// the stats feed.
+var fsmTransitions atomic.Uint64
+
+// countTransition counts a transition of an FSM.
+func countTransition() {
+	fsmTransitions.Add(1)
+	metrics().transitions.Add(1)
+}
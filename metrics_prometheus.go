@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusMetrics returns a backend registering its metrics with reg,
+// prometheus.DefaultRegisterer when nil. Metrics already registered by a
+// previous server are reused.
+func PrometheusMetrics(reg prometheus.Registerer) Metrics {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	return promMetrics{reg: reg}
+}
+
+type promMetrics struct {
+	reg prometheus.Registerer
+}
+
+func (m promMetrics) Counter(name, help string, labels ...string) Counter {
+	vec := register(m.reg, prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: metricsNamespace, Name: name, Help: help}, labels))
+	if len(labels) == 0 {
+		vec.WithLabelValues() // exported from zero
+	}
+	return promCounter{vec}
+}
+
+func (m promMetrics) Gauge(name, help string, labels ...string) Gauge {
+	vec := register(m.reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: metricsNamespace, Name: name, Help: help}, labels))
+	if len(labels) == 0 {
+		vec.WithLabelValues()
+	}
+	return promGauge{vec}
+}
+
+func (m promMetrics) Histogram(name, help string, buckets []float64, labels ...string) Histogram {
+	vec := register(m.reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{Namespace: metricsNamespace, Name: name, Help: help, Buckets: buckets}, labels))
+	if len(labels) == 0 {
+		vec.WithLabelValues()
+	}
+	return promHistogram{vec}
+}
+
+// register registers c with reg, returning the collector registered before
+// under the same name if any.
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) C {
+	var already prometheus.AlreadyRegisteredError
+	if err := reg.Register(c); errors.As(err, &already) {
+		if existing, ok := already.ExistingCollector.(C); ok {
+			return existing
+		}
+		log.Error().Msgf("metric registration error: %s", err.Error())
+	} else if err != nil {
+		log.Error().Msgf("metric registration error: %s", err.Error())
+	}
+	return c
+}
+
+type promCounter struct{ vec *prometheus.CounterVec }
+
+func (c promCounter) Add(delta float64, labelValues ...string) {
+	c.vec.WithLabelValues(labelValues...).Add(delta)
+}
+
+type promGauge struct{ vec *prometheus.GaugeVec }
+
+func (g promGauge) Set(value float64, labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Set(value)
+}
+
+func (g promGauge) Add(delta float64, labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Add(delta)
+}
+
+type promHistogram struct{ vec *prometheus.HistogramVec }
+
+func (h promHistogram) Observe(value float64, labelValues ...string) {
+	h.vec.WithLabelValues(labelValues...).Observe(value)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// countingMetrics counts the additions to its counters by name and label
+// values, e.g. "send_buffer_overflows_total{drop_newest}".
+type countingMetrics struct {
+	nopMetrics
+
+	mu     sync.Mutex
+	counts map[string]float64
+}
+
+// useCountingMetrics makes a countingMetrics the backend of the process
+// until the test ends.
+func useCountingMetrics(t *testing.T) *countingMetrics {
+	m := &countingMetrics{counts: make(map[string]float64)}
+	useMetrics(m)
+	t.Cleanup(func() { useMetrics(nil) })
+	return m
+}
+
+func (m *countingMetrics) Counter(name, _ string, _ ...string) Counter {
+	return countingCounter{m: m, name: name}
+}
+
+// count returns the count of name with the label values.
+func (m *countingMetrics) count(name string, labelValues ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counts[name+"{"+strings.Join(labelValues, ",")+"}"]
+}
+
+type countingCounter struct {
+	m    *countingMetrics
+	name string
+}
+
+func (c countingCounter) Add(delta float64, labelValues ...string) {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	c.m.counts[c.name+"{"+strings.Join(labelValues, ",")+"}"] += delta
+}
+
+func TestPrometheusMetricsRecord(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := PrometheusMetrics(reg)
+	counter := m.Counter("test_total", "Test counter.", "outcome")
+	gauge := m.Gauge("test_depth", "Test gauge.")
+	histogram := m.Histogram("test_seconds", "Test histogram.", []float64{1, 10})
+	counter.Add(1, "ok")
+	counter.Add(2, "ok")
+	counter.Add(1, "failed")
+	gauge.Set(5)
+	gauge.Add(-2)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	for _, tc := range []struct {
+		name string
+		want float64
+	}{
+		{"centrifuge_fsm_test_total", 4},
+		{"centrifuge_fsm_test_depth", 3},
+		{"centrifuge_fsm_test_seconds", 2},
+	} {
+		if got := gathered(t, reg, tc.name); got != tc.want {
+			t.Errorf("%s %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	h := family(t, reg, "centrifuge_fsm_test_seconds").GetMetric()[0].GetHistogram()
+	if h.GetSampleSum() != 5.5 || h.GetBucket()[0].GetCumulativeCount() != 1 {
+		t.Errorf("histogram %v, want a sum of 5.5 with one sample under 1", h)
+	}
+
+	// A second backend on the same registry, as for a restarted server,
+	// keeps counting on the same metrics.
+	PrometheusMetrics(reg).Counter("test_total", "Test counter.", "outcome").Add(1, "ok")
+	if got := gathered(t, reg, "centrifuge_fsm_test_total"); got != 5 {
+		t.Errorf("counter %v after a second registration, want 5", got)
+	}
+}
+
+func TestPrometheusMetricsOfServer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	h := newHarness(t, func(c *Config) { c.Metrics = PrometheusMetrics(reg) })
+	t.Cleanup(func() { useMetrics(nil) })
+	c := connect(t, h, "alice")
+	call(t, c, "createRoom", createRoomRequest{}, nil)
+
+	if got := gathered(t, reg, "centrifuge_fsm_connections"); got != 1 {
+		t.Errorf("connections %v, want 1", got)
+	}
+	if got := gathered(t, reg, "centrifuge_fsm_rpc_duration_seconds"); got != 1 {
+		t.Errorf("%v RPC durations observed, want 1", got)
+	}
+}
+
+// gathered returns the value of the metric name of reg, its sample count
+// for a histogram, summed over its label values.
+func gathered(t *testing.T, reg *prometheus.Registry, name string) float64 {
+	t.Helper()
+	var sum float64
+	for _, m := range family(t, reg, name).GetMetric() {
+		sum += m.GetGauge().GetValue() + m.GetCounter().GetValue() + float64(m.GetHistogram().GetSampleCount())
+	}
+	return sum
+}
+
+// family returns the metric family name of reg.
+func family(t *testing.T, reg *prometheus.Registry, name string) *dto.MetricFamily {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() == name {
+			return f
+		}
+	}
+	t.Fatalf("metric %s not gathered", name)
+	return nil
+}
+
+func TestNopMetricsDoNotAllocate(t *testing.T) {
+	m := newInstruments(NopMetrics())
+	allocs := testing.AllocsPerRun(1000, func() {
+		m.transitions.Add(1)
+		m.connections.Set(3)
+		m.publishSize.Observe(512)
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocations per update, want none", allocs)
+	}
+}
+
+func BenchmarkNopMetrics(b *testing.B) {
+	m := newInstruments(NopMetrics())
+	for i := 0; i < b.N; i++ {
+		m.rpcDuration.Observe(0.01, "move")
+	}
+}
+
+func BenchmarkPrometheusMetrics(b *testing.B) {
+	m := newInstruments(PrometheusMetrics(prometheus.NewRegistry()))
+	for i := 0; i < b.N; i++ {
+		m.rpcDuration.Observe(0.01, "move")
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Monitor channels live in the monitor: namespace, only admins may
+// subscribe to them.
+const (
+	monitorNamespace = "monitor:"
+	// monitorRoomsChannel mirrors the events published to every room.
+	monitorRoomsChannel = monitorNamespace + "rooms"
+
+	msgMonitorEvent = "monitor.event"
+)
+
+// monitorEvent is the payload of msgMonitorEvent: a message published to
+// Channel.
+type monitorEvent struct {
+	Channel string  `json:"channel"`
+	Message Message `json:"message"`
+}
+
+// mirror copies msg, published to a room channel, to the rooms monitor. It
+// is skipped while nobody monitors so room publishing doesn't pay for it.
+func (s *Server) mirror(channel string, msg Message) {
+	if !strings.HasPrefix(channel, "game:") || s.node.Hub().NumSubscribers(monitorRoomsChannel) == 0 {
+		return
+	}
+	data, err := json.Marshal(monitorEvent{Channel: channel, Message: msg})
+	if err != nil {
+		log.Warn().Msgf("%s not mirrored: %s", msg.Type, err.Error())
+		return
+	}
+	_ = s.publish(monitorRoomsChannel, Message{Type: msgMonitorEvent, Payload: data})
+}
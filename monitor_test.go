@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOnlyAdminsMonitorRooms(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.AdminUsers = []string{"admin"} })
+	for _, user := range []string{"player", ""} {
+		if err := connect(t, h, user).Subscribe(monitorRoomsChannel); errorCode(err) != CodePermissionDenied {
+			t.Errorf("monitor subscription of %q: %v, want code %d", user, err, CodePermissionDenied)
+		}
+	}
+	admin := connect(t, h, "admin")
+	if err := admin.Subscribe(monitorRoomsChannel); err != nil {
+		t.Fatal(err)
+	}
+
+	// The admin sees what is published to the rooms.
+	r, _ := startGame(t, h, 2)
+	var ev monitorEvent
+	if err := json.Unmarshal(nextMessage(t, admin, msgMonitorEvent).Message.Payload, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Channel != r.Channel() || ev.Message.Type != msgGameState {
+		t.Errorf("monitor event %s on %s, want %s on %s", ev.Message.Type, ev.Channel, msgGameState, r.Channel())
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// OverflowPolicy decides what happens to the messages sent to a connection
+// whose send buffer is full.
+type OverflowPolicy string
+
+const (
+	// OverflowDisconnect disconnects the client as a slow consumer.
+	OverflowDisconnect OverflowPolicy = "disconnect"
+	// OverflowDropOldest drops the oldest buffered push, so that the client
+	// gets the latest state once it catches up.
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	// OverflowDropNewest drops the push being sent.
+	OverflowDropNewest OverflowPolicy = "drop_newest"
+)
+
+// overflowEvictForReply is the overflow action of the replies buffered in
+// place of the oldest push, whatever the policy but OverflowDisconnect.
+const overflowEvictForReply = "evict_for_reply"
+
+func (p OverflowPolicy) validate() error {
+	switch p {
+	case "", OverflowDisconnect, OverflowDropOldest, OverflowDropNewest:
+		return nil
+	}
+	return fmt.Errorf("unknown send buffer overflow policy %q", p)
+}
+
+// sendBuffer is a centrifuge.Transport buffering up to size messages for
+// the transport it wraps, written by its own goroutine, and applying policy
+// once full. Only pushes are ever dropped: replies to commands are always
+// buffered, the client waiting for them.
+type sendBuffer struct {
+	centrifuge.Transport
+	size   int
+	policy OverflowPolicy
+
+	mu       sync.Mutex
+	clientID string
+	queue    [][]byte
+	wake     chan struct{}
+	closing  bool
+	err      error // of the last write, the buffer stops writing after it
+	done     chan struct{}
+}
+
+// newSendBuffer wraps t with a buffer of size messages.
+func newSendBuffer(t centrifuge.Transport, size int, policy OverflowPolicy) *sendBuffer {
+	if policy == "" {
+		policy = OverflowDisconnect
+	}
+	b := &sendBuffer{
+		Transport: t,
+		size:      size,
+		policy:    policy,
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// setClient names the connection in logs, once its client is created.
+func (b *sendBuffer) setClient(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clientID = id
+}
+
+// Write buffers data, applying the overflow policy if the buffer is full.
+func (b *sendBuffer) Write(data []byte) error {
+	return b.WriteMany(data)
+}
+
+// WriteMany buffers messages, applying the overflow policy to each one.
+func (b *sendBuffer) WriteMany(messages ...[]byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	if b.closing {
+		return nil
+	}
+	for _, data := range messages {
+		if err := b.add(append([]byte(nil), data...)); err != nil {
+			return err
+		}
+	}
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// add and overflow must be called with b.mu held.
+func (b *sendBuffer) add(data []byte) error {
+	if len(b.queue) < b.size {
+		b.queue = append(b.queue, data)
+		return nil
+	}
+	push := b.isPush(data)
+	switch {
+	case b.policy == OverflowDisconnect:
+		b.overflow("disconnect")
+		return centrifuge.DisconnectSlow
+	case b.policy == OverflowDropNewest && push:
+		b.overflow("drop_newest")
+		return nil
+	}
+	// Replies are buffered anyway, taking the place of the oldest push.
+	action := string(OverflowDropOldest)
+	if !push {
+		action = overflowEvictForReply
+	}
+	for i, queued := range b.queue {
+		if b.isPush(queued) {
+			b.overflow(action)
+			b.queue = append(b.queue[:i], b.queue[i+1:]...)
+			break
+		}
+	}
+	if len(b.queue) >= b.size && push {
+		b.overflow("drop_newest")
+		return nil
+	}
+	b.queue = append(b.queue, data)
+	return nil
+}
+
+func (b *sendBuffer) overflow(action string) {
+	metrics().sendBufferOverflows.Add(1, action)
+	log.Warn().Msgf("client %s: send buffer of %d messages full, %s", b.clientID, b.size, action)
+}
+
+// isPush reports whether data encodes a push rather than a command reply,
+// which would start with its ID.
+func (b *sendBuffer) isPush(data []byte) bool {
+	if b.Protocol() == centrifuge.ProtocolTypeProtobuf {
+		// Field 1, the reply ID, is a varint.
+		return len(data) > 0 && data[0] != 0x08
+	}
+	return bytes.HasPrefix(data, []byte(`{"push"`))
+}
+
+// run writes the buffered messages until the buffer is closed and flushed,
+// or a write fails.
+func (b *sendBuffer) run() {
+	defer close(b.done)
+	for {
+		b.mu.Lock()
+		messages, closing := b.queue, b.closing
+		b.queue = nil
+		b.mu.Unlock()
+		if len(messages) > 0 {
+			if err := b.Transport.WriteMany(messages...); err != nil {
+				b.mu.Lock()
+				b.err = err
+				b.mu.Unlock()
+				return
+			}
+			continue
+		}
+		if closing {
+			return
+		}
+		<-b.wake
+	}
+}
+
+// Close flushes the buffer and closes the wrapped transport with
+// disconnect.
+func (b *sendBuffer) Close(disconnect centrifuge.Disconnect) error {
+	b.mu.Lock()
+	if b.closing {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closing = true
+	b.mu.Unlock()
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	<-b.done
+	return b.Transport.Close(disconnect)
+}
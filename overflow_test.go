@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+const (
+	testPush  = `{"push":{"channel":"game:r1"}}`
+	testReply = `{"id":1,"rpc":{}}`
+)
+
+func TestSendBufferOverflowActions(t *testing.T) {
+	for _, tc := range []struct {
+		policy OverflowPolicy
+		data   string
+		action string
+	}{
+		{OverflowDropNewest, testPush, "drop_newest"},
+		{OverflowDropNewest, testReply, overflowEvictForReply},
+		{OverflowDropOldest, testPush, "drop_oldest"},
+		{OverflowDropOldest, testReply, overflowEvictForReply},
+	} {
+		m := useCountingMetrics(t)
+		b := &sendBuffer{Transport: newMemTransport(), size: 2, policy: tc.policy}
+		b.queue = [][]byte{[]byte(testPush), []byte(`{"push":{"channel":"game:r2"}}`)}
+		if err := b.add([]byte(tc.data)); err != nil {
+			t.Fatal(err)
+		}
+		if n := m.count("send_buffer_overflows_total", tc.action); n != 1 {
+			t.Errorf("%s, %s: %v %s overflows, want 1", tc.policy, tc.data, n, tc.action)
+		}
+		if len(b.queue) != 2 {
+			t.Errorf("%s, %s: %d buffered, want 2", tc.policy, tc.data, len(b.queue))
+		}
+		if last := string(b.queue[len(b.queue)-1]); tc.action != "drop_newest" && last != tc.data {
+			t.Errorf("%s, %s: last buffered %s", tc.policy, tc.data, last)
+		}
+	}
+}
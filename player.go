@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrPlayerNotFound is returned when the referenced player doesn't exist.
+var ErrPlayerNotFound = errors.New("player not found")
+
+// Player FSM states and events.
+const (
+	playerIdle      = "idle"
+	playerReady     = "ready"
+	playerPlaying   = "playing"
+	playerForfeited = "forfeited"
+
+	eventReady   = "ready"
+	eventPlay    = "play"
+	eventMove    = "move"
+	eventForfeit = "forfeit"
+	// eventReset is shared with the Game FSM.
+)
+
+// Player is a connected client and its own FSM.
+type Player struct {
+	UserID string
+	FSM    StateMachine
+
+	mu      sync.Mutex
+	id      string     // client ID, updated when a reconnection resumes the player
+	info    ClientInfo // of the client, updated with id
+	room    string
+	illegal int  // consecutive illegal transitions
+	away    bool // disconnected within the presence grace window
+	session session
+	replies *replyCache // created on the first call with an idempotency key
+	// strategy is the strategy of bots, assigned in strategyRoom.
+	strategy     *Strategy
+	strategyRoom string
+}
+
+// NewPlayerFSM returns the default player state machine.
+func NewPlayerFSM() StateMachine {
+	return NewFSM(playerIdle, []Transition{
+		{Event: eventReady, From: playerIdle, To: playerReady},
+		{Event: eventPlay, From: playerReady, To: playerPlaying},
+		{Event: eventMove, From: playerPlaying, To: playerPlaying},
+		{Event: eventForfeit, From: playerPlaying, To: playerForfeited},
+		{Event: eventReset, From: playerIdle, To: playerIdle},
+		{Event: eventReset, From: playerReady, To: playerIdle},
+		{Event: eventReset, From: playerPlaying, To: playerIdle},
+		{Event: eventReset, From: playerForfeited, To: playerIdle},
+	})
+}
+
+func newPlayer(clientID, userID string, info ClientInfo, machine StateMachine) *Player {
+	p := &Player{
+		id:     clientID,
+		UserID: userID,
+		info:   info,
+		FSM:    machine,
+	}
+	p.FSM.OnTransition(func(Transition) {
+		p.mu.Lock()
+		p.illegal = 0
+		p.mu.Unlock()
+	})
+	return p
+}
+
+// ID returns the client ID of the player, which changes when a reconnection
+// resumes it.
+func (p *Player) ID() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.id
+}
+
+// Info returns the name and version of the client of the player.
+func (p *Player) Info() ClientInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.info
+}
+
+// resume moves the player to the connection clientID of the client info.
+func (p *Player) resume(clientID string, info ClientInfo) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.id = clientID
+	p.info = info
+	p.away = false
+}
+
+// Room returns the ID of the room the player is in, if any.
+func (p *Player) Room() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.room
+}
+
+// SetRoom records the room the player is in.
+func (p *Player) SetRoom(roomID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.room = roomID
+}
+
+// replyCache returns the idempotency cache of the player, creating it with
+// config on first use.
+func (p *Player) replyCache(config IdempotencyConfig, clock Clock) *replyCache {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.replies == nil {
+		p.replies = newReplyCache(config, clock)
+	}
+	return p.replies
+}
+
+// recordIllegal counts an illegal transition attempt and returns the number
+// of consecutive ones since the last successful transition.
+func (p *Player) recordIllegal() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.illegal++
+	return p.illegal
+}
+
+// PlayerRegistry keeps the players of connected clients.
+type PlayerRegistry struct {
+	mu       sync.RWMutex
+	players  map[string]*Player
+	expiries map[string]Timer // client ID -> removal of away player
+	clock    Clock
+	machine  func() StateMachine
+	restore  RestoreConfig
+	onAdd    []func(*Player)
+}
+
+// NewPlayerRegistry creates an empty registry whose players use the state
+// machine and clock of config.
+func NewPlayerRegistry(config Config) *PlayerRegistry {
+	g := &PlayerRegistry{
+		players:  make(map[string]*Player),
+		expiries: make(map[string]Timer),
+		clock:    orSystemClock(config.Clock),
+		machine:  config.PlayerMachine,
+		restore:  config.PlayerRestore,
+	}
+	if g.machine == nil {
+		g.machine = NewPlayerFSM
+	}
+	return g
+}
+
+// OnAdd registers a hook called with every newly added player.
+func (g *PlayerRegistry) OnAdd(fn func(*Player)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.onAdd = append(g.onAdd, fn)
+}
+
+// Add registers a player for clientID, or returns the existing one.
+func (g *PlayerRegistry) Add(clientID, userID string, info ClientInfo) *Player {
+	g.mu.Lock()
+	if p, ok := g.players[clientID]; ok {
+		g.mu.Unlock()
+		return p
+	}
+	p := newPlayer(clientID, userID, info, g.machine())
+	setClock(p.FSM, g.clock)
+	_ = setRestore(p.FSM, g.restore) // validated by NewServer
+	g.players[clientID] = p
+	hooks := append([]func(*Player){}, g.onAdd...)
+	g.mu.Unlock()
+
+	for _, fn := range hooks {
+		fn(p)
+	}
+	return p
+}
+
+// Get returns the player of clientID.
+func (g *PlayerRegistry) Get(clientID string) (*Player, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	p, ok := g.players[clientID]
+	return p, ok
+}
+
+// All returns all the players.
+func (g *PlayerRegistry) All() []*Player {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	players := make([]*Player, 0, len(g.players))
+	for _, p := range g.players {
+		players = append(players, p)
+	}
+	return players
+}
+
+// Remove forgets the player of clientID and closes its machine.
+func (g *PlayerRegistry) Remove(clientID string) {
+	g.mu.Lock()
+	if t, ok := g.expiries[clientID]; ok {
+		t.Stop()
+		delete(g.expiries, clientID)
+	}
+	p, ok := g.players[clientID]
+	delete(g.players, clientID)
+	g.mu.Unlock()
+	if ok {
+		closeState(p.FSM)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import "time"
+
+// Presence of a player in the roster.
+const (
+	presenceOnline = "online"
+	presenceAway   = "away"
+)
+
+// Presence returns presenceAway while the player's client is disconnected
+// within the grace window, presenceOnline otherwise.
+func (p *Player) Presence() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.away {
+		return presenceAway
+	}
+	return presenceOnline
+}
+
+// Away marks the player of clientID away and calls expire once grace
+// elapses unless the player is resumed before.
+func (g *PlayerRegistry) Away(clientID string, grace time.Duration, expire func(*Player)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.players[clientID]
+	if !ok {
+		return
+	}
+	p.mu.Lock()
+	p.away = true
+	p.mu.Unlock()
+
+	var t Timer
+	t = g.clock.AfterFunc(grace, func() {
+		g.mu.Lock()
+		// A resume may have cancelled this timer after it fired.
+		if g.expiries[clientID] != t {
+			g.mu.Unlock()
+			return
+		}
+		delete(g.expiries, clientID)
+		g.mu.Unlock()
+		expire(p)
+	})
+	g.expiries[clientID] = t
+}
+
+// Resume moves an away player of userID to the new connection clientID and
+// returns it with its previous client ID. The state of the player moves with
+// it, see connectPlayer, while the state of the previous connection, its
+// subscriptions, inactivity tracking, quota slot and matchmaking ticket, was
+// dropped on disconnect: the new connection subscribes and queues again.
+func (g *PlayerRegistry) Resume(userID, clientID string, info ClientInfo) (*Player, string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for oldID, p := range g.players {
+		if p.UserID != userID || g.expiries[oldID] == nil {
+			continue
+		}
+		g.expiries[oldID].Stop()
+		delete(g.expiries, oldID)
+		delete(g.players, oldID)
+		p.resume(clientID, info)
+		g.players[clientID] = p
+		return p, oldID, true
+	}
+	return nil, "", false
+}
+
+// connectPlayer registers the player of a new connection, resuming the one
+// its user left away within the grace window or giving it back its seat in
+// a restored game.
+func (s *Server) connectPlayer(clientID, userID string, info ClientInfo) *Player {
+	if userID != "" && s.config.PresenceGrace > 0 {
+		if p, oldID, ok := s.players.Resume(userID, clientID, info); ok {
+			if r, ok := s.rooms.Room(p.Room()); ok {
+				r.Rename(oldID, clientID)
+				if r.Game.Current() == gameLobby && p.FSM.Current() == playerReady {
+					r.SetReady(clientID, true)
+				}
+			}
+			s.tracer.rename(oldID, clientID)
+			log.Info().Msgf("client %s resumed player of %s, previously %s", clientID, userID, oldID)
+			return p
+		}
+	}
+	p := s.players.Add(clientID, userID, info)
+	if userID == "" {
+		return p
+	}
+	if r, st, ok := s.rooms.ClaimSeat(userID, clientID); ok {
+		p.SetRoom(r.ID)
+		if st.state != "" {
+			if err := restoreState(p.FSM, st.state); err != nil {
+				log.Warn().Msgf("client %s: player machine can't restore state %s: %s", clientID, st.state, err.Error())
+			}
+		}
+		log.Info().Msgf("client %s took back the seat of %s in room %s", clientID, userID, r.ID)
+	}
+	return p
+}
+
+// disconnectPlayer removes the player of a closed connection, after the
+// grace window for authenticated users so a quick reconnect resumes it.
+// Away players don't count as ready in the lobby until they resume, so that
+// a countdown doesn't start the game without them.
+func (s *Server) disconnectPlayer(clientID, userID string) {
+	p, ok := s.players.Get(clientID)
+	if userID == "" || s.config.PresenceGrace <= 0 {
+		if ok {
+			s.removePlayer(p)
+		}
+		return
+	}
+	if ok {
+		if r, ok := s.rooms.Room(p.Room()); ok && r.Game.Current() == gameLobby {
+			r.SetReady(clientID, false)
+		}
+	}
+	log.Info().Msgf("client %s away, removing in %s", clientID, s.config.PresenceGrace)
+	s.players.Away(clientID, s.config.PresenceGrace, s.removePlayer)
+}
+
+func (s *Server) removePlayer(p *Player) {
+	id := p.ID()
+	if p.Room() != "" {
+		_ = s.rooms.LeaveRoom(p.Room(), id)
+	}
+	s.tracer.trace(id, 0)
+	s.players.Remove(id)
+}
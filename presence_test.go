@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResumeMovesPlayerState(t *testing.T) {
+	h := newHarness(t, nil)
+	old := connect(t, h, "alice")
+	room := createRoom(t, old, createRoomRequest{})
+	call(t, old, "joinRoom", roomRequest{Room: room.Room}, nil)
+	call(t, old, "ready", nil, nil)
+	p, _ := h.Server.players.Get(old.ID)
+	h.Server.tracer.trace(old.ID, time.Minute)
+
+	if err := old.Close(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the player to be away", func() bool { return p.Presence() == presenceAway })
+	// The player is read while it is resumed.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = h.Server.Roster()
+			}
+		}
+	}()
+	resumed := connect(t, h, "alice")
+
+	if got, ok := h.Server.players.Get(resumed.ID); !ok || got != p {
+		t.Fatal("player not resumed")
+	}
+	if p.ID() != resumed.ID {
+		t.Errorf("player ID %s, want %s", p.ID(), resumed.ID)
+	}
+	if _, ok := h.Server.players.Get(old.ID); ok {
+		t.Error("player still registered under its previous client ID")
+	}
+	r, _ := h.Server.rooms.Room(room.Room)
+	if players := r.Players(); len(players) != 1 || players[0] != resumed.ID {
+		t.Errorf("room players %v, want [%s]", players, resumed.ID)
+	}
+	if r.ReadyCount() != 1 {
+		t.Errorf("%d ready, want 1", r.ReadyCount())
+	}
+	if !h.Server.tracer.enabled(resumed.ID) || h.Server.tracer.enabled(old.ID) {
+		t.Error("trace not moved to the new client ID")
+	}
+}
+
+func TestAwayPlayerRemovedAfterGrace(t *testing.T) {
+	h := newHarness(t, nil)
+	c := connect(t, h, "alice")
+	room := createRoom(t, c, createRoomRequest{})
+	call(t, c, "joinRoom", roomRequest{Room: room.Room}, nil)
+	p, _ := h.Server.players.Get(c.ID)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the player to be away", func() bool { return p.Presence() == presenceAway })
+
+	grace := h.Server.config.PresenceGrace
+	h.Clock.Advance(grace - time.Millisecond)
+	if _, ok := h.Server.players.Get(c.ID); !ok {
+		t.Fatalf("player removed before the end of its %s grace", grace)
+	}
+	h.Clock.Advance(time.Millisecond)
+	if _, ok := h.Server.players.Get(c.ID); ok {
+		t.Errorf("player still registered after its %s grace", grace)
+	}
+	if r, ok := h.Server.rooms.Room(room.Room); ok && r.Has(c.ID) {
+		t.Error("removed player still in its room")
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// Policies applied when the publish queue is full.
+const (
+	// PublishBlock makes Publish wait for room in the queue.
+	PublishBlock = "block"
+	// PublishDrop makes Publish discard the publication.
+	PublishDrop = "drop"
+)
+
+var (
+	// ErrPublishQueueFull is returned by Publish when the publication was
+	// dropped because the queue is full.
+	ErrPublishQueueFull = errors.New("publish queue full")
+	// ErrPublisherClosed is returned by Publish after shutdown.
+	ErrPublisherClosed = errors.New("publisher closed")
+)
+
+// Priority selects the lane of the publish queues a message type goes
+// through.
+type Priority string
+
+const (
+	// PriorityHigh is for the events players wait for, such as turns and
+	// game over.
+	PriorityHigh Priority = "high"
+	// PriorityNormal is the lane of the message types without a priority.
+	PriorityNormal Priority = "normal"
+	// PriorityLow is for chatty messages, such as chat and stats.
+	PriorityLow Priority = "low"
+)
+
+// priorities are the lanes of a queue, highest first.
+var priorities = []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+func (p Priority) validate() error {
+	switch p {
+	case "", PriorityHigh, PriorityNormal, PriorityLow:
+		return nil
+	}
+	return fmt.Errorf("unknown priority %q", p)
+}
+
+// lane returns the index of the lane of p in priorities.
+func (p Priority) lane() int {
+	switch p {
+	case PriorityHigh:
+		return 0
+	case PriorityLow:
+		return 2
+	}
+	return 1
+}
+
+// PublisherConfig sizes the outbound publish worker pool.
+type PublisherConfig struct {
+	// Workers is the number of goroutines publishing to the node. Each
+	// channel is published to by a single worker, in order.
+	Workers int
+	// QueueSize is the number of publications buffered per worker, across
+	// its lanes, before Policy applies. It is at least 1.
+	QueueSize int
+	// Policy is PublishBlock (default) or PublishDrop.
+	Policy string
+	// Priorities maps message types to the lane they are queued in,
+	// PriorityNormal for the others. Workers publish from their higher
+	// lanes first, but the publications of a channel stay in order: one
+	// queued behind a publication of its channel in a lower lane waits for
+	// it.
+	Priorities map[string]Priority
+	// MaxSkips is the number of publications taken from higher lanes in a
+	// row, while a lower lane waits, after which the oldest waiting
+	// publication goes first, so that low lanes aren't starved. Zero lets
+	// higher lanes always go first.
+	MaxSkips int
+}
+
+func (c PublisherConfig) validate() error {
+	for msgType, p := range c.Priorities {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("%s: %w", msgType, err)
+		}
+	}
+	return nil
+}
+
+type publishJob struct {
+	channel string
+	data    []byte
+	opts    []centrifuge.PublishOption
+	n       uint64 // numbers the jobs of a queue in the order they're queued
+}
+
+// publisher routes outbound publications through bounded queues consumed
+// by a fixed pool of workers, so bursts apply backpressure instead of
+// spawning goroutines. The publications of a channel all go through the
+// queue of one worker, which keeps them ordered.
+type publisher struct {
+	node       *centrifuge.Node
+	policy     string
+	priorities map[string]Priority
+	queues     []*laneQueue
+	wg         sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newPublisher(node *centrifuge.Node, config PublisherConfig) *publisher {
+	workers := config.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	p := &publisher{
+		node:       node,
+		policy:     config.Policy,
+		priorities: config.Priorities,
+		queues:     make([]*laneQueue, workers),
+	}
+	p.wg.Add(workers)
+	for i := range p.queues {
+		p.queues[i] = newLaneQueue(config.QueueSize, config.MaxSkips)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+func (p *publisher) work(queue *laneQueue) {
+	defer p.wg.Done()
+	for {
+		job, ok := queue.next()
+		if !ok {
+			return
+		}
+		metrics().publishQueueDepth.Add(-1, p.node.ID())
+		if _, err := p.node.Publish(job.channel, job.data, job.opts...); err != nil {
+			log.Error().Msgf("publish to %s failed: %s", job.channel, err.Error())
+		}
+	}
+}
+
+// Publish queues a publication of msgType in the lane of its priority,
+// blocking or dropping it when the queue is full depending on the policy.
+func (p *publisher) Publish(channel, msgType string, data []byte, opts ...centrifuge.PublishOption) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPublisherClosed
+	}
+
+	job := publishJob{channel: channel, data: data, opts: opts}
+	queue := p.queue(channel)
+	m := metrics()
+	m.publishSize.Observe(float64(len(data)))
+	// Counted before it is queued, so that the worker never takes it first.
+	m.publishQueueDepth.Add(1, p.node.ID())
+	if !queue.push(job, p.priorities[msgType].lane(), p.policy == PublishDrop) {
+		m.publishQueueDepth.Add(-1, p.node.ID())
+		m.publishDropped.Add(1)
+		log.Warn().Msgf("publish queue full, dropping publication to %s", channel)
+		return ErrPublishQueueFull
+	}
+	return nil
+}
+
+// queue returns the queue of the worker publishing to channel.
+func (p *publisher) queue(channel string) *laneQueue {
+	h := fnv.New32a()
+	h.Write([]byte(channel))
+	return p.queues[h.Sum32()%uint32(len(p.queues))]
+}
+
+// health fails once the publisher is closed, and while the queue of a
+// worker is full, its publications then blocking or being dropped.
+func (p *publisher) health() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPublisherClosed
+	}
+	for _, q := range p.queues {
+		if q.full() {
+			return ErrPublishQueueFull
+		}
+	}
+	return nil
+}
+
+// Close stops accepting publications and waits for the queued ones.
+func (p *publisher) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	for _, q := range p.queues {
+		q.close()
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// laneQueue is the bounded queue of a worker, with a lane per priority.
+type laneQueue struct {
+	capacity int
+	maxSkips int
+
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	lanes    [][]publishJob // by priority, highest first
+	size     int
+	queued   uint64
+	pending  map[string]int // channel -> queued jobs
+	skips    int            // jobs taken in a row while a lower lane waits
+	closed   bool
+}
+
+func newLaneQueue(capacity, maxSkips int) *laneQueue {
+	if capacity < 1 {
+		capacity = 1
+	}
+	q := &laneQueue{
+		capacity: capacity,
+		maxSkips: maxSkips,
+		lanes:    make([][]publishJob, len(priorities)),
+		pending:  make(map[string]int),
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// push queues job in lane. When the queue is full, it drops job and
+// returns false if drop is set, or waits for room.
+func (q *laneQueue) push(job publishJob, lane int, drop bool) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.size >= q.capacity {
+		if drop {
+			return false
+		}
+		log.Warn().Msgf("publish queue full, blocking publication to %s", job.channel)
+		for q.size >= q.capacity && !q.closed {
+			q.notFull.Wait()
+		}
+	}
+	q.queued++
+	job.n = q.queued
+	q.lanes[lane] = append(q.lanes[lane], job)
+	q.size++
+	q.pending[job.channel]++
+	q.notEmpty.Signal()
+	return true
+}
+
+// next waits for a job and takes it, from the highest lane unless lower
+// ones waited for maxSkips jobs. It returns false once the queue is closed
+// and drained.
+func (q *laneQueue) next() (publishJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.size == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if q.size == 0 {
+		return publishJob{}, false
+	}
+
+	lane, oldest := -1, -1
+	for i, jobs := range q.lanes {
+		if len(jobs) == 0 {
+			continue
+		}
+		if lane < 0 {
+			lane = i
+		}
+		if oldest < 0 || jobs[0].n < q.lanes[oldest][0].n {
+			oldest = i
+		}
+	}
+	switch {
+	case q.maxSkips > 0 && q.skips >= q.maxSkips && oldest != lane:
+		lane, q.skips = oldest, 0
+	case q.waiting(lane):
+		q.skips++
+	default:
+		q.skips = 0
+	}
+	job := q.take(lane)
+	q.notFull.Signal()
+	return job, true
+}
+
+// waiting reports whether a lane below lane has jobs.
+func (q *laneQueue) waiting(lane int) bool {
+	for _, jobs := range q.lanes[lane+1:] {
+		if len(jobs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// take removes the first job of lane, or the oldest job of its channel
+// queued before it in another lane, which must be published first.
+func (q *laneQueue) take(lane int) publishJob {
+	first := q.lanes[lane][0]
+	from, at := lane, 0
+	if q.pending[first.channel] > 1 {
+		for i, jobs := range q.lanes {
+			for j, job := range jobs {
+				if job.n >= q.lanes[from][at].n {
+					break
+				}
+				if job.channel == first.channel {
+					from, at = i, j
+					break
+				}
+			}
+		}
+	}
+	lane = from
+	job := q.lanes[lane][at]
+	q.lanes[lane] = append(q.lanes[lane][:at], q.lanes[lane][at+1:]...)
+	q.size--
+	if q.pending[job.channel]--; q.pending[job.channel] == 0 {
+		delete(q.pending, job.channel)
+	}
+	return job
+}
+
+// full reports whether the queue has no room left.
+func (q *laneQueue) full() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size >= q.capacity
+}
+
+// close makes next return false once the queue is drained.
+func (q *laneQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
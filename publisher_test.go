@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// drain takes the jobs of q until it is empty and returns their data.
+func drain(q *laneQueue) []string {
+	var got []string
+	q.close()
+	for {
+		job, ok := q.next()
+		if !ok {
+			return got
+		}
+		got = append(got, string(job.data))
+	}
+}
+
+func pushJob(q *laneQueue, channel, data string, p Priority) {
+	q.push(publishJob{channel: channel, data: []byte(data)}, p.lane(), false)
+}
+
+func TestLaneQueueHighPriorityFirst(t *testing.T) {
+	q := newLaneQueue(100, 0)
+	for i := 0; i < 10; i++ {
+		pushJob(q, "game:r1:chat", fmt.Sprintf("chat%d", i), PriorityLow)
+	}
+	pushJob(q, "stats", "stats", PriorityNormal)
+	pushJob(q, "game:r1", "turn", PriorityHigh)
+
+	got := drain(q)
+	want := []string{"turn", "stats"}
+	for i := 0; i < 10; i++ {
+		want = append(want, fmt.Sprintf("chat%d", i))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+}
+
+func TestLaneQueueKeepsChannelOrder(t *testing.T) {
+	q := newLaneQueue(100, 0)
+	pushJob(q, "game:r1", "state", PriorityLow)
+	pushJob(q, "other", "other", PriorityNormal)
+	pushJob(q, "game:r1", "turn", PriorityHigh)
+
+	// turn waits for the publication of its channel queued before it.
+	if got, want := drain(q), []string{"state", "turn", "other"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+}
+
+func TestLaneQueueDoesNotStarveLowLanes(t *testing.T) {
+	q := newLaneQueue(100, 2)
+	pushJob(q, "chat", "chat", PriorityLow)
+	for i := 0; i < 5; i++ {
+		pushJob(q, fmt.Sprintf("game:%d", i), fmt.Sprintf("turn%d", i), PriorityHigh)
+	}
+	want := []string{"turn0", "turn1", "chat", "turn2", "turn3", "turn4"}
+	if got := drain(q); !reflect.DeepEqual(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+}
+
+// idlePublisher returns a publisher of h with a single queue of QueueSize 1
+// and no worker, so that the test takes its jobs.
+func idlePublisher(h *TestHarness, policy string) *publisher {
+	return &publisher{
+		node:   h.Server.node,
+		policy: policy,
+		queues: []*laneQueue{newLaneQueue(1, 0)},
+	}
+}
+
+func TestPublishDropWhenQueueFull(t *testing.T) {
+	p := idlePublisher(newHarness(t, nil), PublishDrop)
+	if err := p.Publish("game:r1", msgGameState, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Publish("game:r1", msgGameState, []byte(`{}`)); !errors.Is(err, ErrPublishQueueFull) {
+		t.Errorf("publish to a full queue: %v, want %v", err, ErrPublishQueueFull)
+	}
+	if err := p.health(); !errors.Is(err, ErrPublishQueueFull) {
+		t.Errorf("health %v, want %v", err, ErrPublishQueueFull)
+	}
+}
+
+func TestPublishBlockUntilDrained(t *testing.T) {
+	p := idlePublisher(newHarness(t, nil), PublishBlock)
+	if err := p.Publish("game:r1", msgGameState, []byte(`first`)); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- p.Publish("game:r1", msgGameState, []byte(`second`)) }()
+	select {
+	case err := <-done:
+		t.Fatalf("publish to a full queue returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Taking a job as the worker would makes room for the blocked one.
+	if job, _ := p.queues[0].next(); string(job.data) != "first" {
+		t.Errorf("took %s, want first", job.data)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("publish still blocked once the queue drained")
+	}
+	if got := drain(p.queues[0]); !reflect.DeepEqual(got, []string{"second"}) {
+		t.Errorf("queued %v, want [second]", got)
+	}
+}
+
+func TestPublisherConfigRejectsUnknownPriority(t *testing.T) {
+	config := PublisherConfig{Priorities: map[string]Priority{msgChat: "urgent"}}
+	if err := config.validate(); err == nil {
+		t.Error("unknown priority accepted")
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// ErrConnectionQuota is returned to the connections of a user already
+// holding ConnectionQuotaConfig.Max connections, with QuotaReject.
+var ErrConnectionQuota = &centrifuge.Error{Code: uint32(CodeConnectionQuota), Message: "connection quota exceeded"}
+
+// QuotaPolicy decides what happens to a connection over
+// ConnectionQuotaConfig.Max.
+type QuotaPolicy string
+
+const (
+	// QuotaReject rejects the new connection.
+	QuotaReject QuotaPolicy = "reject"
+	// QuotaEvictOldest accepts the new connection and disconnects the
+	// oldest one of the user with DisconnectEvicted.
+	QuotaEvictOldest QuotaPolicy = "evict-oldest"
+)
+
+func (p QuotaPolicy) validate() error {
+	switch p {
+	case "", QuotaReject, QuotaEvictOldest:
+		return nil
+	}
+	return fmt.Errorf("unknown connection quota policy %q", p)
+}
+
+// ConnectionQuotaConfig caps the connections of each user, so that a user
+// logging in many times can't skew the games or exhaust the node.
+type ConnectionQuotaConfig struct {
+	// Max is the number of connections a user may hold at once. Zero
+	// disables the quota.
+	Max int
+	// Policy applies to the connections over Max, QuotaReject by default.
+	Policy QuotaPolicy
+	// Anonymous counts the connections without a user ID per remote host.
+	// They are exempt otherwise.
+	Anonymous bool
+}
+
+func (c ConnectionQuotaConfig) validate() error {
+	if c.Max < 0 {
+		return fmt.Errorf("negative connection quota %d", c.Max)
+	}
+	return c.Policy.validate()
+}
+
+// Actions of connectionQuota.
+const (
+	quotaRejected = "rejected"
+	quotaEvicted  = "evicted"
+)
+
+// connQuota tracks the connections of each user against the quota.
+type connQuota struct {
+	config ConnectionQuotaConfig
+
+	mu    sync.Mutex
+	conns map[string][]string // quota key -> client IDs, oldest first
+	keys  map[string]string   // client ID -> quota key
+}
+
+func newConnQuota(config ConnectionQuotaConfig) *connQuota {
+	return &connQuota{config: config, conns: make(map[string][]string), keys: make(map[string]string)}
+}
+
+// key returns the key the connections of userID count against, empty for
+// the exempt ones. ctx carries the ConnMeta of anonymous connections.
+func (q *connQuota) key(ctx context.Context, userID string) string {
+	if q == nil {
+		return ""
+	}
+	if userID != "" {
+		return "user:" + userID
+	}
+	meta, ok := GetConnMeta(ctx)
+	if !q.config.Anonymous || !ok || meta.RemoteAddr == "" {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(meta.RemoteAddr)
+	if err != nil {
+		host = meta.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// full reports whether a new connection of key must be rejected, before it
+// is accepted.
+func (q *connQuota) full(key string) bool {
+	if q == nil || key == "" || q.config.Policy == QuotaEvictOldest {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.conns[key]) >= q.config.Max
+}
+
+// add tracks the connection clientID of key. Over the quota, it returns
+// the oldest connections evicted to make room, no longer tracked, or false
+// if clientID is rejected: connections racing each other passed full.
+func (q *connQuota) add(key, clientID string) ([]string, bool) {
+	if q == nil || key == "" {
+		return nil, true
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	conns := q.conns[key]
+	var evicted []string
+	if over := len(conns) + 1 - q.config.Max; over > 0 {
+		if q.config.Policy != QuotaEvictOldest {
+			return nil, false
+		}
+		evicted = append(evicted, conns[:over]...)
+		for _, id := range evicted {
+			delete(q.keys, id)
+		}
+		conns = conns[over:]
+	}
+	q.conns[key] = append(conns, clientID)
+	q.keys[clientID] = key
+	return evicted, true
+}
+
+// remove stops tracking clientID, once disconnected.
+func (q *connQuota) remove(clientID string) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	key, ok := q.keys[clientID]
+	if !ok {
+		return
+	}
+	delete(q.keys, clientID)
+	conns := q.conns[key]
+	for i, id := range conns {
+		if id == clientID {
+			conns = append(conns[:i:i], conns[i+1:]...)
+			break
+		}
+	}
+	if len(conns) == 0 {
+		delete(q.conns, key)
+	} else {
+		q.conns[key] = conns
+	}
+}
+
+// enforceQuota tracks client against its quota, disconnecting it, or the
+// oldest connections of its user, if it is over. It reports whether client
+// was accepted.
+func (s *Server) enforceQuota(client *centrifuge.Client) bool {
+	evicted, ok := s.quota.add(s.quota.key(client.Context(), client.UserID()), client.ID())
+	if !ok {
+		log.Warn().Msgf("client %s disconnected: connection quota of user %q exceeded", client.ID(), client.UserID())
+		metrics().connectionQuota.Add(1, quotaRejected)
+		client.Disconnect(DisconnectConnectionQuota)
+		return false
+	}
+	clients := s.node.Hub().Connections()
+	for _, id := range evicted {
+		log.Info().Msgf("client %s evicted by the newer connection %s of user %q", id, client.ID(), client.UserID())
+		metrics().connectionQuota.Add(1, quotaEvicted)
+		if old, ok := clients[id]; ok {
+			old.Disconnect(DisconnectEvicted)
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+// userPlayers returns the number of players of userID.
+func userPlayers(s *Server, userID string) int {
+	n := 0
+	for _, p := range s.players.All() {
+		if p.UserID == userID {
+			n++
+		}
+	}
+	return n
+}
+
+func TestConnectionQuotaRejects(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.ConnectionQuota = ConnectionQuotaConfig{Max: 1, Policy: QuotaReject}
+	})
+	first := connect(t, h, "alice")
+	if _, err := h.Connect("alice"); err == nil {
+		t.Fatal("connection over the quota accepted")
+	}
+	if n := userPlayers(h.Server, "alice"); n != 1 {
+		t.Errorf("%d players of alice, want 1", n)
+	}
+	call(t, first, "state", nil, nil)
+	// Other users have their own quota.
+	connect(t, h, "bob")
+}
+
+func TestConnectionQuotaRejectsAfterConnecting(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.ConnectionQuota = ConnectionQuotaConfig{Max: 1, Policy: QuotaReject}
+	})
+	c := connect(t, h, "alice")
+	// As if another connection of alice took the last slot between the
+	// connecting check and the connect of c.
+	h.Server.players.Remove(c.ID)
+	h.Server.onConnect(c.client)
+
+	if _, ok := h.Server.players.Get(c.ID); ok {
+		t.Error("player registered for a connection over the quota")
+	}
+}
+
+func TestConnectionQuotaEvictsOldest(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.ConnectionQuota = ConnectionQuotaConfig{Max: 1, Policy: QuotaEvictOldest}
+		c.PresenceGrace = 0
+	})
+	oldest := connect(t, h, "alice")
+	newest := connect(t, h, "alice")
+
+	// The eviction disconnects the oldest connection asynchronously.
+	eventually(t, "the oldest connection to be evicted", func() bool {
+		_, err := oldest.RPC("state", nil)
+		return err != nil
+	})
+	call(t, newest, "state", nil, nil)
+	eventually(t, "the evicted player to be removed", func() bool {
+		_, ok := h.Server.players.Get(oldest.ID)
+		return !ok
+	})
+	if n := userPlayers(h.Server, "alice"); n != 1 {
+		t.Errorf("%d players of alice, want 1", n)
+	}
+}
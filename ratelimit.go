@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Outcomes of rate limited connection attempts.
+const (
+	connectAccepted = "accepted"
+	connectQueued   = "queued"
+	connectRejected = "rejected"
+)
+
+// ConnectRateConfig smooths the rate of new connections across all clients.
+type ConnectRateConfig struct {
+	// Rate is the sustained number of connections accepted per second.
+	// Zero disables the limit.
+	Rate float64
+	// Burst is the number of connections accepted at once above Rate.
+	Burst int
+	// MaxWait is how long a connection may be queued for a slot before it
+	// is rejected with a retriable error.
+	MaxWait time.Duration
+}
+
+// acceptLimiter is a token bucket. Tokens go negative for queued attempts,
+// each waiting until the bucket refills up to its reservation.
+type acceptLimiter struct {
+	config ConnectRateConfig
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newAcceptLimiter(config ConnectRateConfig) *acceptLimiter {
+	return &acceptLimiter{config: config, tokens: float64(config.Burst), last: time.Now()}
+}
+
+// reserve takes a token and returns how long to wait before using it, or
+// false if that would exceed MaxWait.
+func (l *acceptLimiter) reserve(now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = math.Min(float64(l.config.Burst), l.tokens+now.Sub(l.last).Seconds()*l.config.Rate)
+	l.last = now
+	wait := time.Duration(math.Max(0, 1-l.tokens) / l.config.Rate * float64(time.Second))
+	if wait > l.config.MaxWait {
+		return 0, false
+	}
+	l.tokens--
+	return wait, true
+}
+
+// wait blocks until a connection may be accepted. It returns false when the
+// attempt is rejected or ctx is done first.
+func (l *acceptLimiter) wait(ctx context.Context) bool {
+	if l == nil {
+		return true
+	}
+	d, ok := l.reserve(time.Now())
+	if !ok {
+		metrics().connectAttempts.Add(1, connectRejected)
+		return false
+	}
+	if d > 0 {
+		metrics().connectAttempts.Add(1, connectQueued)
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			metrics().connectAttempts.Add(1, connectRejected)
+			return false
+		}
+	}
+	metrics().connectAttempts.Add(1, connectAccepted)
+	return true
+}
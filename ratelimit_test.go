@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAcceptLimiterBurst(t *testing.T) {
+	l := newAcceptLimiter(ConnectRateConfig{Rate: 10, Burst: 3, MaxWait: 200 * time.Millisecond})
+	now := l.last
+	// The burst is accepted at once, the next attempts queue for a token
+	// each 100ms until that exceeds MaxWait.
+	for i, want := range []time.Duration{0, 0, 0, 100 * time.Millisecond, 200 * time.Millisecond} {
+		wait, ok := l.reserve(now)
+		if !ok || wait != want {
+			t.Errorf("attempt %d: wait %s (accepted %v), want %s", i, wait, ok, want)
+		}
+	}
+	if _, ok := l.reserve(now); ok {
+		t.Error("attempt beyond MaxWait accepted")
+	}
+
+	// A second later the bucket is full again, not above the burst.
+	now = now.Add(time.Second)
+	for i := 0; i < 3; i++ {
+		if wait, ok := l.reserve(now); !ok || wait != 0 {
+			t.Errorf("attempt %d after a refill: wait %s (accepted %v), want none", i, wait, ok)
+		}
+	}
+	if wait, _ := l.reserve(now); wait == 0 {
+		t.Error("bucket refilled above the burst")
+	}
+}
+
+func TestAcceptLimiterWaitCancelled(t *testing.T) {
+	m := useCountingMetrics(t)
+	l := newAcceptLimiter(ConnectRateConfig{Rate: 1, Burst: 1, MaxWait: time.Minute})
+	ctx, cancel := context.WithCancel(context.Background())
+	if !l.wait(ctx) {
+		t.Fatal("first attempt rejected")
+	}
+	cancel()
+	if l.wait(ctx) {
+		t.Error("queued attempt accepted once its context is done")
+	}
+	if n := m.count("connect_attempts_total", connectQueued); n != 1 {
+		t.Errorf("%v attempts queued, want 1", n)
+	}
+	if n := m.count("connect_attempts_total", connectRejected); n != 1 {
+		t.Errorf("%v attempts rejected, want 1", n)
+	}
+}
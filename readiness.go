@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// internalClientName is the name reported by the internal client i of the
+// clients named name, identifying it across its reconnections.
+func internalClientName(name string, i int) string {
+	return fmt.Sprintf("%s#%d", name, i)
+}
+
+// readiness signals once every expected internal client has connected at
+// least once. Internal clients are identified by their name, see
+// internalClientName, rather than by their client ID, which changes on
+// reconnection, so that an internal client reconnecting can't over-signal
+// like a raw WaitGroup would. Other connections are ignored.
+type readiness struct {
+	mu       sync.Mutex
+	expected int
+	info     ClientInfo // of the internal clients, before internalClientName
+	seen     map[string]struct{}
+	ready    chan struct{}
+	closed   bool
+	degraded bool // ready before every expected client connected
+}
+
+func newReadiness(expected int, info ClientInfo) *readiness {
+	r := &readiness{
+		expected: expected,
+		info:     info,
+		seen:     make(map[string]struct{}),
+		ready:    make(chan struct{}),
+	}
+	if expected <= 0 {
+		r.close()
+	}
+	return r
+}
+
+// identity returns the name identifying the internal client reporting
+// info, false for other clients.
+func (r *readiness) identity(info ClientInfo) (string, bool) {
+	if info.Version != r.info.Version || !strings.HasPrefix(info.Name, r.info.Name+"#") {
+		return "", false
+	}
+	return info.Name, true
+}
+
+// markConnected records a connect of a client reporting info and reports
+// whether it was the first one seen of that internal client.
+func (r *readiness) markConnected(info ClientInfo) bool {
+	name, ok := r.identity(info)
+	if !ok {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.seen[name]; ok {
+		return false
+	}
+	r.seen[name] = struct{}{}
+	if len(r.seen) >= r.expected {
+		r.degraded = false
+		r.close()
+	}
+	return true
+}
+
+// close must be called with r.mu held, or before r is shared.
+func (r *readiness) close() {
+	if !r.closed {
+		r.closed = true
+		close(r.ready)
+	}
+}
+
+// wait waits for the expected clients at most timeout, zero meaning no
+// limit, then signals readiness anyway in degraded mode. It reports
+// whether every expected client connected.
+func (r *readiness) wait(timeout time.Duration) bool {
+	if timeout <= 0 {
+		<-r.ready
+		return true
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-r.ready:
+		return true
+	case <-t.C:
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return true
+	}
+	r.degraded = true
+	r.close()
+	return false
+}
+
+// Degraded reports whether readiness was signaled before every expected
+// client connected, until they all did.
+func (r *readiness) Degraded() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.degraded
+}
+
+// connected returns the number of distinct internal clients seen.
+func (r *readiness) connected() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.seen)
+}
+
+// Ready is closed once the expected number of distinct internal clients
+// connected.
+func (r *readiness) Ready() <-chan struct{} {
+	return r.ready
+}
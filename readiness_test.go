@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReadinessCountsInternalClientsOnce(t *testing.T) {
+	h := newHarness(t, nil)
+	info := h.Server.config.Client
+	h.Server.ready = newReadiness(2, info)
+
+	connect(t, h, "browser")
+	connect(t, h, "browser")
+	h.Server.config.Client.Name = internalClientName(info.Name, 0)
+	connect(t, h, "")
+	// The internal client 0 reconnecting.
+	connect(t, h, "")
+	if n := h.Server.ready.connected(); n != 1 {
+		t.Fatalf("%d internal clients connected, want 1", n)
+	}
+	select {
+	case <-h.Server.Ready():
+		t.Fatal("ready before the internal client 1 connected")
+	default:
+	}
+
+	h.Server.config.Client.Name = internalClientName(info.Name, 1)
+	connect(t, h, "")
+	select {
+	case <-h.Server.Ready():
+	default:
+		t.Fatal("not ready once every internal client connected")
+	}
+}
+
+// expectInternalClients makes h wait for n internal clients at most timeout.
+func expectInternalClients(h *TestHarness, n int, timeout time.Duration) {
+	h.Server.config.InternalClients = n
+	h.Server.config.InternalClientsTimeout = timeout
+	h.Server.ready = newReadiness(n, h.Server.config.Client)
+}
+
+func TestAllInternalClientsFailing(t *testing.T) {
+	h := newHarness(t, nil)
+	expectInternalClients(h, 2, 50*time.Millisecond)
+	// Nothing listens there: the clients keep reconnecting.
+	for i := 0; i < 2; i++ {
+		info := h.Server.config.Client
+		info.Name = internalClientName(info.Name, i)
+		c, err := newClient(&log, "ws://127.0.0.1:1/connection/websocket", info, ClientOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(c.Close)
+		_ = c.Connect()
+	}
+
+	if h.Server.WaitReady() {
+		t.Fatal("ready without any internal client")
+	}
+	code, reply := readyz(t, h)
+	if code != http.StatusOK || !reply.Ready || !reply.Degraded {
+		t.Errorf("readyz %d %+v, want ready and degraded", code, reply)
+	}
+}
+
+func TestSomeInternalClientsFailing(t *testing.T) {
+	h := newHarness(t, nil)
+	expectInternalClients(h, 2, 50*time.Millisecond)
+	info := h.Server.config.Client
+	h.Server.config.Client.Name = internalClientName(info.Name, 0)
+	connect(t, h, "")
+
+	if h.Server.WaitReady() {
+		t.Fatal("ready with one of two internal clients, not degraded")
+	}
+	if !h.Server.ready.Degraded() {
+		t.Error("not degraded with one of two internal clients")
+	}
+
+	// The missing client connecting later ends the degraded mode.
+	h.Server.config.Client.Name = internalClientName(info.Name, 1)
+	connect(t, h, "")
+	if h.Server.ready.Degraded() {
+		t.Error("still degraded once every internal client connected")
+	}
+	if _, reply := readyz(t, h); reply.Degraded {
+		t.Errorf("readyz %+v once every internal client connected", reply)
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrRoomNotFound is returned when the referenced room doesn't exist.
+	ErrRoomNotFound = errors.New("room not found")
+	// ErrRoomLimitReached is returned by CreateRoom when the owner already
+	// owns the maximum number of rooms.
+	ErrRoomLimitReached = errors.New("room limit reached")
+	// ErrInvalidInvite is returned by AcceptInvite for unknown tokens.
+	ErrInvalidInvite = errors.New("invalid invite")
+	// ErrNotInRoom is returned to the players leaving a room they aren't in.
+	ErrNotInRoom = errors.New("player not in room")
+	// ErrServerFull is returned, as a temporary error, to the calls
+	// starting new games while the node runs Config.MaxGames games.
+	ErrServerFull = &centrifuge.Error{Code: uint32(CodeServerFull), Message: "server full", Temporary: true}
+)
+
+// RoomRegistry keeps track of the rooms and of who owns them. Rooms left
+// empty, never joined, or restored with seats nobody claims, are destroyed
+// after a grace period unless someone joins.
+type RoomRegistry struct {
+	config          RoomConfig
+	maxRoomsPerUser int
+	maxGames        int
+	emptyRoomGrace  time.Duration
+	clock           Clock
+
+	mu       sync.Mutex
+	rooms    map[string]*Room
+	owners   map[string]string // room ID -> owner ID
+	owned    map[string]int    // owner ID -> owned rooms
+	vacated  map[string]bool   // rooms left empty, not counted in owned
+	destroys map[string]Timer  // room ID -> pending destruction
+	invites  map[string]string // invite token -> room ID
+	seats    map[string]seat   // user ID -> seat in a restored game
+	onCreate []func(*Room)
+}
+
+// NewRoomRegistry creates a registry from the room settings of config.
+func NewRoomRegistry(config Config) *RoomRegistry {
+	return &RoomRegistry{
+		config:          config.Room,
+		maxRoomsPerUser: config.MaxRoomsPerUser,
+		maxGames:        config.MaxGames,
+		emptyRoomGrace:  config.EmptyRoomGrace,
+		clock:           orSystemClock(config.Clock),
+		rooms:           make(map[string]*Room),
+		owners:          make(map[string]string),
+		owned:           make(map[string]int),
+		vacated:         make(map[string]bool),
+		destroys:        make(map[string]Timer),
+		invites:         make(map[string]string),
+		seats:           make(map[string]seat),
+	}
+}
+
+// OnCreate registers a hook called with every newly created room.
+func (g *RoomRegistry) OnCreate(fn func(*Room)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.onCreate = append(g.onCreate, fn)
+}
+
+// CreateRoom creates a room owned by ownerID.
+func (g *RoomRegistry) CreateRoom(ownerID string) (*Room, error) {
+	return g.create(ownerID, "")
+}
+
+// CreateMatch creates a private room owned by ownerID and returns it with
+// the invite token other users join it with.
+func (g *RoomRegistry) CreateMatch(ownerID string) (*Room, string, error) {
+	invite := uuid.NewString()
+	r, err := g.create(ownerID, invite)
+	if err != nil {
+		return nil, "", err
+	}
+	return r, invite, nil
+}
+
+// CreateExpectedMatch creates a private room of the matchmaker that only
+// the expected owner IDs may join. Its invite token is never handed out.
+func (g *RoomRegistry) CreateExpectedMatch(expected []string) (*Room, error) {
+	r, err := g.create(matchmakerOwner, uuid.NewString())
+	if err != nil {
+		return nil, err
+	}
+	r.expect(expected)
+	return r, nil
+}
+
+// AcceptInvite invites ownerID to the match of the invite token.
+func (g *RoomRegistry) AcceptInvite(invite, ownerID string) (*Room, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	r, ok := g.rooms[g.invites[invite]]
+	if !ok {
+		return nil, ErrInvalidInvite
+	}
+	r.Invite(ownerID)
+	log.Info().Msgf("room %s: %s accepted invite", r.ID, ownerID)
+	return r, nil
+}
+
+// create makes a room, private when invite is set. Rooms of the matchmaker
+// don't count against the room limit.
+func (g *RoomRegistry) create(ownerID, invite string) (*Room, error) {
+	g.mu.Lock()
+	if g.maxRoomsPerUser > 0 && ownerID != matchmakerOwner && g.owned[ownerID] >= g.maxRoomsPerUser {
+		n := g.owned[ownerID]
+		g.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s already owns %d rooms", ErrRoomLimitReached, ownerID, n)
+	}
+	if g.atCapacity() {
+		g.mu.Unlock()
+		log.Warn().Msgf("room of %s refused: %d games running", ownerID, g.maxGames)
+		return nil, ErrServerFull
+	}
+	r := newRoom(uuid.NewString(), g.config, g.clock)
+	if invite != "" {
+		r.invite = invite
+		r.invited[ownerID] = true
+		g.invites[invite] = r.ID
+	}
+	hooks := g.insert(r, ownerID)
+	// Until someone joins, so that it doesn't hold the slots of its owner.
+	g.scheduleDestroy(r)
+	g.mu.Unlock()
+
+	log.Info().Msgf("room %s: created by %s", r.ID, ownerID)
+	for _, fn := range hooks {
+		fn(r)
+	}
+	return r, nil
+}
+
+// full reports whether the registry runs as many games as allowed.
+func (g *RoomRegistry) full() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.atCapacity()
+}
+
+// atCapacity must be called with g.mu held.
+func (g *RoomRegistry) atCapacity() bool {
+	return g.maxGames > 0 && len(g.rooms) >= g.maxGames
+}
+
+// insert registers r and returns the hooks to call with it once g.mu is
+// released. Restored games are inserted even at capacity, as they were
+// admitted before. It must be called with g.mu held.
+func (g *RoomRegistry) insert(r *Room, ownerID string) []func(*Room) {
+	g.rooms[r.ID] = r
+	metrics().games.Add(1)
+	g.owners[r.ID] = ownerID
+	g.owned[ownerID]++
+	return append([]func(*Room){}, g.onCreate...)
+}
+
+// Room returns the room with the given ID.
+func (g *RoomRegistry) Room(id string) (*Room, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	r, ok := g.rooms[id]
+	return r, ok
+}
+
+// Rooms returns all the rooms.
+func (g *RoomRegistry) Rooms() []*Room {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	rooms := make([]*Room, 0, len(g.rooms))
+	for _, r := range g.rooms {
+		rooms = append(rooms, r)
+	}
+	return rooms
+}
+
+// JoinRoom adds clientID to the room, cancelling a pending destruction.
+func (g *RoomRegistry) JoinRoom(roomID, clientID string) (*Room, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	r, ok := g.rooms[roomID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRoomNotFound, roomID)
+	}
+	g.join(r, clientID)
+	return r, nil
+}
+
+// join adds clientID to r, cancelling a pending destruction. It must be
+// called with g.mu held.
+func (g *RoomRegistry) join(r *Room, clientID string) {
+	roomID := r.ID
+	g.cancelDestroy(roomID, clientID)
+	if g.vacated[roomID] {
+		delete(g.vacated, roomID)
+		g.owned[g.owners[roomID]]++
+	}
+	r.Join(clientID)
+	log.Info().Msgf("room %s: %s joined", roomID, clientID)
+}
+
+// LeaveRoom removes clientID from the room. Once empty, the room is
+// destroyed after the grace period.
+func (g *RoomRegistry) LeaveRoom(roomID, clientID string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	r, ok := g.rooms[roomID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrRoomNotFound, roomID)
+	}
+	if !r.Has(clientID) {
+		return fmt.Errorf("%w: %s not in %s", ErrNotInRoom, clientID, roomID)
+	}
+	g.leave(r, clientID)
+	return nil
+}
+
+// leave removes clientID from r. Once empty, r no longer holds the slot of
+// its owner, given back if someone rejoins, and is destroyed after the
+// grace period. It must be called with g.mu held.
+func (g *RoomRegistry) leave(r *Room, clientID string) {
+	roomID := r.ID
+	log.Info().Msgf("room %s: %s left", roomID, clientID)
+	if r.Leave(clientID) > 0 {
+		return
+	}
+	if !g.vacated[roomID] {
+		g.vacated[roomID] = true
+		g.release(g.owners[roomID])
+	}
+	g.scheduleDestroy(r)
+}
+
+// release frees a room slot of owner. It must be called with g.mu held.
+func (g *RoomRegistry) release(owner string) {
+	if g.owned[owner]--; g.owned[owner] <= 0 {
+		delete(g.owned, owner)
+	}
+}
+
+// scheduleDestroy destroys the empty room r after the grace period, unless
+// someone joins it. It must be called with g.mu held.
+func (g *RoomRegistry) scheduleDestroy(r *Room) {
+	roomID := r.ID
+	if _, ok := g.destroys[roomID]; ok {
+		return
+	}
+	log.Info().Msgf("room %s: empty, destroying in %s", roomID, g.emptyRoomGrace)
+	var t Timer
+	t = g.clock.AfterFunc(g.emptyRoomGrace, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		// A rejoin may have cancelled this timer after it fired.
+		if g.destroys[roomID] != t {
+			return
+		}
+		g.destroy(roomID)
+	})
+	g.destroys[roomID] = t
+}
+
+// cancelDestroy cancels the pending destruction of the room roomID, which
+// clientID came back to. It must be called with g.mu held.
+func (g *RoomRegistry) cancelDestroy(roomID, clientID string) {
+	if t, ok := g.destroys[roomID]; ok {
+		t.Stop()
+		delete(g.destroys, roomID)
+		log.Info().Msgf("room %s: destruction cancelled, %s rejoined", roomID, clientID)
+	}
+}
+
+// DestroyRoom removes the room and frees its owner's slot.
+func (g *RoomRegistry) DestroyRoom(id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.destroy(id)
+}
+
+// destroy must be called with g.mu held.
+func (g *RoomRegistry) destroy(id string) {
+	if _, ok := g.rooms[id]; !ok {
+		return
+	}
+	if t, ok := g.destroys[id]; ok {
+		t.Stop()
+		delete(g.destroys, id)
+	}
+	r := g.rooms[id]
+	r.Close()
+	if r.invite != "" {
+		delete(g.invites, r.invite)
+	}
+	delete(g.rooms, id)
+	metrics().games.Add(-1)
+	if !g.vacated[id] {
+		g.release(g.owners[id])
+	}
+	delete(g.vacated, id)
+	delete(g.owners, id)
+	for user, st := range g.seats {
+		if st.room == id {
+			delete(g.seats, user)
+		}
+	}
+	log.Info().Msgf("room %s: destroyed", id)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRoomNeverJoinedIsDestroyed(t *testing.T) {
+	h := newHarness(t, nil)
+	owner := connect(t, h, "owner")
+	room := createRoom(t, owner, createRoomRequest{})
+	if code := callError(t, owner, "createRoom", createRoomRequest{}); code != CodeRoomLimitReached {
+		t.Fatalf("second room: code %d, want %d", code, CodeRoomLimitReached)
+	}
+
+	h.Clock.Advance(h.Server.config.EmptyRoomGrace)
+	if _, ok := h.Server.rooms.Room(room.Room); ok {
+		t.Fatal("room never joined not destroyed after the grace period")
+	}
+	createRoom(t, owner, createRoomRequest{})
+}
+
+func TestRoomJoinedIsKept(t *testing.T) {
+	h := newHarness(t, nil)
+	owner := connect(t, h, "owner")
+	room := createRoom(t, owner, createRoomRequest{})
+	call(t, owner, "joinRoom", roomRequest{Room: room.Room}, nil)
+
+	h.Clock.Advance(h.Server.config.EmptyRoomGrace)
+	if _, ok := h.Server.rooms.Room(room.Room); !ok {
+		t.Fatal("joined room destroyed")
+	}
+}
+
+func TestLeaveRoomRejectsNonMembers(t *testing.T) {
+	h := newHarness(t, nil)
+	owner := connect(t, h, "owner")
+	other := connect(t, h, "other")
+	room := createRoom(t, owner, createRoomRequest{})
+	call(t, owner, "joinRoom", roomRequest{Room: room.Room}, nil)
+
+	if code := callError(t, other, "leaveRoom", roomRequest{Room: room.Room}); code != CodeNotInRoom {
+		t.Fatalf("leave of a non-member: code %d, want %d", code, CodeNotInRoom)
+	}
+	r, _ := h.Server.rooms.Room(room.Room)
+	if players := r.Players(); len(players) != 1 || players[0] != owner.ID {
+		t.Errorf("players %v, want [%s]", players, owner.ID)
+	}
+}
+
+func TestRoomLimitExactlyAtCap(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.MaxRoomsPerUser = 2 })
+	owner := connect(t, h, "owner")
+	first := createRoom(t, owner, createRoomRequest{})
+	second := createRoom(t, owner, createRoomRequest{})
+	if code := callError(t, owner, "createRoom", createRoomRequest{}); code != CodeRoomLimitReached {
+		t.Fatalf("room over the cap: code %d, want %d", code, CodeRoomLimitReached)
+	}
+
+	// A room left empty frees its slot right away, and takes it back when
+	// rejoined.
+	call(t, owner, "joinRoom", roomRequest{Room: first.Room}, nil)
+	call(t, owner, "leaveRoom", roomRequest{Room: first.Room}, nil)
+	third := createRoom(t, owner, createRoomRequest{})
+	call(t, owner, "joinRoom", roomRequest{Room: first.Room}, nil)
+	if code := callError(t, owner, "createRoom", createRoomRequest{}); code != CodeRoomLimitReached {
+		t.Fatalf("room over the cap after a rejoin: code %d, want %d", code, CodeRoomLimitReached)
+	}
+
+	// Destroying a room frees its slot once.
+	h.Server.rooms.DestroyRoom(second.Room)
+	h.Server.rooms.DestroyRoom(second.Room)
+	h.Server.rooms.DestroyRoom(third.Room)
+	createRoom(t, owner, createRoomRequest{})
+	if code := callError(t, owner, "createRoom", createRoomRequest{}); code != CodeRoomLimitReached {
+		t.Fatalf("room over the cap after a destroy: code %d, want %d", code, CodeRoomLimitReached)
+	}
+}
+
+func TestRoomDestroyedOnceLeftEmpty(t *testing.T) {
+	h := newHarness(t, nil)
+	grace := h.Server.config.EmptyRoomGrace
+	owner := connect(t, h, "owner")
+	guest := connect(t, h, "guest")
+	room := createRoom(t, owner, createRoomRequest{})
+	call(t, owner, "joinRoom", roomRequest{Room: room.Room}, nil)
+	call(t, guest, "joinRoom", roomRequest{Room: room.Room}, nil)
+
+	call(t, owner, "leaveRoom", roomRequest{Room: room.Room}, nil)
+	h.Clock.Advance(grace)
+	if _, ok := h.Server.rooms.Room(room.Room); !ok {
+		t.Fatal("room destroyed while a player is left")
+	}
+	call(t, guest, "leaveRoom", roomRequest{Room: room.Room}, nil)
+	h.Clock.Advance(grace - time.Second)
+	if _, ok := h.Server.rooms.Room(room.Room); !ok {
+		t.Fatal("empty room destroyed before the grace period")
+	}
+	h.Clock.Advance(time.Second)
+	if _, ok := h.Server.rooms.Room(room.Room); ok {
+		t.Fatal("empty room not destroyed after the grace period")
+	}
+	if code := callError(t, guest, "joinRoom", roomRequest{Room: room.Room}); code != CodeRoomNotFound {
+		t.Errorf("join of a destroyed room: code %d, want %d", code, CodeRoomNotFound)
+	}
+}
+
+func TestRejoinCancelsDestroy(t *testing.T) {
+	h := newHarness(t, nil)
+	grace := h.Server.config.EmptyRoomGrace
+	owner := connect(t, h, "owner")
+	room := createRoom(t, owner, createRoomRequest{})
+	call(t, owner, "joinRoom", roomRequest{Room: room.Room}, nil)
+	call(t, owner, "leaveRoom", roomRequest{Room: room.Room}, nil)
+
+	h.Clock.Advance(grace / 2)
+	call(t, owner, "joinRoom", roomRequest{Room: room.Room}, nil)
+	h.Clock.Advance(grace)
+	if _, ok := h.Server.rooms.Room(room.Room); !ok {
+		t.Fatal("rejoined room destroyed")
+	}
+
+	// Left again, it gets a new grace period.
+	call(t, owner, "leaveRoom", roomRequest{Room: room.Room}, nil)
+	h.Clock.Advance(grace)
+	if _, ok := h.Server.rooms.Room(room.Room); ok {
+		t.Fatal("room left again not destroyed")
+	}
+}
+
+func TestMaxGames(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	h := newHarness(t, func(c *Config) {
+		c.MaxGames = 1
+		c.Metrics = PrometheusMetrics(reg)
+	})
+	t.Cleanup(func() { useMetrics(nil) })
+	r, players := startGame(t, h, 2)
+	if got := gathered(t, reg, "centrifuge_fsm_games"); got != 1 {
+		t.Errorf("games gauge %v, want 1", got)
+	}
+	if got := gathered(t, reg, "centrifuge_fsm_games_max"); got != 1 {
+		t.Errorf("games_max gauge %v, want 1", got)
+	}
+
+	// At capacity, new games are refused with a temporary error.
+	newcomer := connect(t, h, "newcomer")
+	for _, method := range []string{"createRoom", "createMatch", "queue"} {
+		_, err := newcomer.RPC(method, nil)
+		var cerr *centrifuge.Error
+		if !errors.As(err, &cerr) || cerr.Code != uint32(CodeServerFull) || !cerr.Temporary {
+			t.Errorf("%s at capacity: %v, want a temporary %d", method, err, CodeServerFull)
+		}
+	}
+
+	// The game ends and its room goes: there is room for another one.
+	call(t, players[1], "forfeit", nil, nil)
+	if state := r.Game.Current(); state != gameFinished {
+		t.Fatalf("game %s, want %s", state, gameFinished)
+	}
+	for _, c := range players {
+		call(t, c, "leaveRoom", roomRequest{Room: r.ID}, nil)
+	}
+	h.Clock.Advance(h.Server.config.EmptyRoomGrace)
+	if _, ok := h.Server.rooms.Room(r.ID); ok {
+		t.Fatal("finished game left empty not destroyed")
+	}
+	if got := gathered(t, reg, "centrifuge_fsm_games"); got != 0 {
+		t.Errorf("games gauge %v once destroyed, want 0", got)
+	}
+	createRoom(t, newcomer, createRoomRequest{})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// subscribingTransportClosed is the code of centrifuge-go subscribing
+// events caused by a lost connection.
+const subscribingTransportClosed = 1
+
+// resyncTimeout bounds the recentEvents call of a resync.
+const resyncTimeout = 5 * time.Second
+
+// needsResync reports whether a subscription resubscribing for code may
+// have missed publications: the connection was lost, or the server
+// unsubscribed it because its state could not be recovered. Subscribe calls
+// start from the current state.
+func needsResync(code uint32) bool {
+	switch code {
+	case subscribingTransportClosed, centrifuge.UnsubscribeCodeInsufficient:
+		return true
+	}
+	return false
+}
+
+// onSubscribing records whether channel must be resynced once subscribed.
+func (c *GameClient) onSubscribing(channel string, code uint32) {
+	if !needsResync(code) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resyncs[channel] = true
+}
+
+// onSubscribed resyncs channel if it resubscribed after missing
+// publications, or if centrifuge failed to recover them.
+func (c *GameClient) onSubscribed(channel string, recoveryFailed bool) {
+	c.mu.Lock()
+	resync := c.resyncs[channel] || recoveryFailed
+	delete(c.resyncs, channel)
+	c.mu.Unlock()
+	if resync {
+		go c.resync(channel)
+	}
+}
+
+// resync fetches the events of a room channel published after the last
+// one received and replays them to the handlers, in order with the
+// publications of the channel. Events already evicted from the room log
+// are reported by OnSequenceGap, as are the ones overtaken by a live
+// publication.
+func (c *GameClient) resync(channel string) {
+	roomID, ok := gameRoomID(channel)
+	if !ok {
+		c.log.Debug().Msgf("[%s] not a room channel, nothing to resync", channel)
+		return
+	}
+	c.mu.RLock()
+	since := c.seqs[channel]
+	c.mu.RUnlock()
+	data, err := json.Marshal(recentEventsRequest{Room: roomID, Since: since})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resyncTimeout)
+	defer cancel()
+	res, err := c.RPC(ctx, "recentEvents", data)
+	if err != nil {
+		c.log.Warn().Msgf("[%s] resync failed: %s", channel, err.Error())
+		return
+	}
+	var reply recentEventsReply
+	if err := json.Unmarshal(res.Data, &reply); err != nil {
+		c.log.Warn().Msgf("[%s] invalid resync reply: %s", channel, err.Error())
+		return
+	}
+	if reply.ResyncRequired {
+		c.resyncRequired(channel, reply.Seq)
+		return
+	}
+	c.log.Info().Msgf("[%s] resync: %d events after %d", channel, len(reply.Events), since)
+	queue := c.queue(channel)
+	for _, ev := range reply.Events {
+		msg := Message{Type: ev.Type, Payload: ev.Payload, Seq: ev.Seq, Encrypted: ev.Encrypted}
+		select {
+		case queue <- publication{channel: channel, replay: &msg}:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// resyncRequired skips channel to seq, the events up to it being too many
+// to replay, and calls the OnResyncRequired handler.
+func (c *GameClient) resyncRequired(channel string, seq uint64) {
+	c.mu.Lock()
+	if seq > c.seqs[channel] {
+		c.seqs[channel] = seq
+	}
+	handler := c.resyncHandler
+	c.mu.Unlock()
+	c.log.Warn().Msgf("[%s] too many events missed, resync required at %d", channel, seq)
+	if handler != nil {
+		handler(channel)
+	}
+}
+
+// replay handles msg, fetched by resync, unless a publication of channel
+// already brought it or a later one.
+func (c *GameClient) replay(channel string, msg Message) {
+	c.mu.RLock()
+	last := c.seqs[channel]
+	c.mu.RUnlock()
+	if msg.Seq <= last {
+		return
+	}
+	msg, err := decryptMessage(c.roomKey(channel), channel, msg)
+	if err != nil {
+		c.log.Error().Msgf("[%s] %s", channel, err.Error())
+		return
+	}
+	c.handle(channel, msg)
+}
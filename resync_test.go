@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+func TestNeedsResync(t *testing.T) {
+	for _, tc := range []struct {
+		code uint32
+		want bool
+	}{
+		{0, false}, // Subscribe called
+		{subscribingTransportClosed, true},
+		{centrifuge.UnsubscribeCodeInsufficient, true},
+	} {
+		if got := needsResync(tc.code); got != tc.want {
+			t.Errorf("needsResync(%d) = %v, want %v", tc.code, got, tc.want)
+		}
+	}
+}
+
+func TestFailedRecoveryResyncs(t *testing.T) {
+	h := newHarness(t, nil)
+	c := servedClient(t, h)
+	var mu sync.Mutex
+	var replayed []uint64
+	c.OnEvent("test.seq", func(payload json.RawMessage) {
+		var seq uint64
+		_ = json.Unmarshal(payload, &seq)
+		mu.Lock()
+		replayed = append(replayed, seq)
+		mu.Unlock()
+	})
+	res, err := c.RPC(context.Background(), "createRoom", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var room roomReply
+	if err := json.Unmarshal(res.Data, &room); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(roomRequest{Room: room.Room})
+	if _, err := c.RPC(context.Background(), "joinRoom", data); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := h.Server.rooms.Room(room.Room)
+	// Events numbered as their sequence number, which the client missed
+	// after the first.
+	for i := 0; i < 3; i++ {
+		if err := h.Server.publishMessage(room.Channel, "test.seq", r.Seq()+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := r.Seq() - 2
+	c.mu.Lock()
+	c.seqs[room.Channel] = first
+	c.mu.Unlock()
+
+	// Subscribed again without centrifuge recovering the publications.
+	c.onSubscribed(room.Channel, true)
+	eventually(t, "the resync", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(replayed) == 2
+	})
+	if want := []uint64{first + 1, first + 2}; !reflect.DeepEqual(replayed, want) {
+		t.Errorf("replayed %v, want %v", replayed, want)
+	}
+
+	// A subscription started by Subscribe doesn't resync.
+	c.onSubscribing(room.Channel, 0)
+	c.onSubscribed(room.Channel, false)
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	if len(replayed) != 2 {
+		t.Errorf("replayed %v after a plain subscribe", replayed)
+	}
+	mu.Unlock()
+
+	// One the server ended for insufficient state resyncs once subscribed
+	// again.
+	c.mu.Lock()
+	c.seqs[room.Channel] = first + 1
+	c.mu.Unlock()
+	c.onSubscribing(room.Channel, centrifuge.UnsubscribeCodeInsufficient)
+	c.onSubscribed(room.Channel, false)
+	eventually(t, "the resync after insufficient state", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(replayed) == 3
+	})
+	if replayed[2] != first+2 {
+		t.Errorf("replayed %v, want %d last", replayed, first+2)
+	}
+}
+
+func TestResyncPastMaxReplay(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.MaxReplay = 2 })
+	c := servedClient(t, h)
+	var mu sync.Mutex
+	var replayed, resyncs []string
+	c.OnEvent("test.seq", func(payload json.RawMessage) {
+		mu.Lock()
+		replayed = append(replayed, string(payload))
+		mu.Unlock()
+	})
+	c.OnResyncRequired(func(channel string) {
+		mu.Lock()
+		resyncs = append(resyncs, channel)
+		mu.Unlock()
+	})
+	res, err := c.RPC(context.Background(), "createRoom", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var room roomReply
+	if err := json.Unmarshal(res.Data, &room); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(roomRequest{Room: room.Room})
+	if _, err := c.RPC(context.Background(), "joinRoom", data); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := h.Server.rooms.Room(room.Room)
+	// miss publishes n events the client doesn't see and resyncs it.
+	miss := func(n int) uint64 {
+		from := r.Seq()
+		for i := 0; i < n; i++ {
+			if err := h.Server.publishMessage(room.Channel, "test.seq", i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		c.mu.Lock()
+		c.seqs[room.Channel] = from
+		c.mu.Unlock()
+		c.onSubscribed(room.Channel, true)
+		return r.Seq()
+	}
+
+	// A backlog within the cap replays fully.
+	miss(2)
+	eventually(t, "the replay", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(replayed) == 2
+	})
+
+	// A larger one is skipped for a resync.
+	seq := miss(3)
+	eventually(t, "the resync signal", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(resyncs) == 1
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if resyncs[0] != room.Channel || len(replayed) != 2 {
+		t.Errorf("resync of %v after replaying %v, want %s without a replay", resyncs, replayed, room.Channel)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seqs[room.Channel] != seq {
+		t.Errorf("client at %d after the resync signal, want %d", c.seqs[room.Channel], seq)
+	}
+}
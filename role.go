@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// Roles assigned to connections.
+const (
+	RoleReferee = "referee"
+	RolePlayer  = "player"
+)
+
+// Channels subscribed by every client and per role.
+const (
+	serverChannel  = "com.jtbonhomme.server"
+	refereeChannel = "com.jtbonhomme.referee"
+	playersChannel = "com.jtbonhomme.players"
+)
+
+// roleChannels returns the channels a client with role subscribes to.
+func roleChannels(role string) []string {
+	if role == RoleReferee {
+		return []string{serverChannel, refereeChannel}
+	}
+	return []string{serverChannel, playersChannel}
+}
+
+// roleReply is sent in the connect reply data and by the role RPC.
+type roleReply struct {
+	Role string `json:"role"`
+}
+
+// roleAssigner hands out the referee role to the first connections and the
+// player role to the others. A key keeps its role for the process lifetime.
+type roleAssigner struct {
+	referees int
+
+	mu    sync.Mutex
+	roles map[string]string
+	count map[string]int
+}
+
+func newRoleAssigner(referees int) *roleAssigner {
+	return &roleAssigner{
+		referees: referees,
+		roles:    make(map[string]string),
+		count:    make(map[string]int),
+	}
+}
+
+func (a *roleAssigner) assign(key string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if role, ok := a.roles[key]; ok {
+		return role
+	}
+	role := RolePlayer
+	if a.count[RoleReferee] < a.referees {
+		role = RoleReferee
+	}
+	a.roles[key] = role
+	a.count[role]++
+	return role
+}
+
+func (a *roleAssigner) role(key string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.roles[key]
+}
+
+// roleKey identifies a connection for role assignment: its user ID, or its
+// client ID for anonymous users.
+func roleKey(userID, clientID string) string {
+	if userID != "" {
+		return "user:" + userID
+	}
+	return "client:" + clientID
+}
+
+// onConnecting smooths connection bursts and rejects clients that don't
+// report their name and version, then assigns a role to the connection and sends it in the connect reply.
+func (s *Server) onConnecting(ctx context.Context, e centrifuge.ConnectEvent) (centrifuge.ConnectReply, error) {
+	var userID string
+	if cred, ok := centrifuge.GetCredentials(ctx); ok {
+		userID = cred.UserID
+	}
+	if s.stopping.Load() {
+		log.Warn().Msgf("client %s rejected: shutting down", e.ClientID)
+		return centrifuge.ConnectReply{}, centrifuge.DisconnectShutdown
+	}
+	if !s.accept.wait(ctx) {
+		log.Warn().Msgf("client %s rejected: connection rate exceeded", e.ClientID)
+		return centrifuge.ConnectReply{}, centrifuge.ErrorTooManyRequests
+	}
+	info := ClientInfo{Name: e.Name, Version: e.Version}
+	if err := info.validate(); err != nil {
+		log.Warn().Msgf("client %s rejected: %s", e.ClientID, err.Error())
+		return centrifuge.ConnectReply{}, centrifuge.DisconnectBadRequest
+	}
+	if s.quota.full(s.quota.key(ctx, userID)) {
+		log.Warn().Msgf("client %s rejected: connection quota of user %q exceeded", e.ClientID, userID)
+		metrics().connectionQuota.Add(1, quotaRejected)
+		return centrifuge.ConnectReply{}, ErrConnectionQuota
+	}
+	role := s.roles.assign(roleKey(userID, e.ClientID))
+	data, err := json.Marshal(roleReply{Role: role})
+	if err != nil {
+		return centrifuge.ConnectReply{}, err
+	}
+	log.Info().Msgf("client %s assigned role %s", e.ClientID, role)
+	// Clients refresh their own tokens when the backend can verify them.
+	return centrifuge.ConnectReply{
+		Context:           withClientInfo(ctx, info),
+		Data:              data,
+		ClientSideRefresh: s.tokens != nil,
+		Subscriptions:     errorSubscriptions(userID),
+	}, nil
+}
+
+func (s *Server) rpcRole(client *centrifuge.Client, _ []byte) ([]byte, error) {
+	return json.Marshal(roleReply{Role: s.roles.role(roleKey(client.UserID(), client.ID()))})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// connectRole returns the role in the connect reply of c.
+func connectRole(t *testing.T, c *HarnessClient) string {
+	t.Helper()
+	var reply roleReply
+	if err := json.Unmarshal(c.ConnectData, &reply); err != nil {
+		t.Fatal(err)
+	}
+	return reply.Role
+}
+
+func TestRoleKeptAcrossReconnects(t *testing.T) {
+	h := newHarness(t, nil) // one referee
+	referee := connect(t, h, "referee")
+	player := connect(t, h, "player")
+	if connectRole(t, referee) != RoleReferee || connectRole(t, player) != RolePlayer {
+		t.Fatalf("roles %s and %s, want %s and %s", connectRole(t, referee), connectRole(t, player), RoleReferee, RolePlayer)
+	}
+	for _, c := range []*HarnessClient{referee, player} {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The player reconnects first, it doesn't take the referee seat.
+	for _, tc := range []struct{ user, role string }{
+		{"player", RolePlayer},
+		{"referee", RoleReferee},
+	} {
+		c := connect(t, h, tc.user)
+		if got := connectRole(t, c); got != tc.role {
+			t.Errorf("%s reconnected as %s, want %s", tc.user, got, tc.role)
+		}
+		var reply roleReply
+		call(t, c, "role", nil, &reply)
+		if reply.Role != tc.role {
+			t.Errorf("%s role RPC %s, want %s", tc.user, reply.Role, tc.role)
+		}
+	}
+}
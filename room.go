@@ -0,0 +1,593 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Game FSM states and events.
+const (
+	gameLobby    = "lobby"
+	gameSetup    = "setup"
+	gamePlaying  = "playing"
+	gamePaused   = "paused"
+	gameFinished = "finished"
+
+	eventStart    = "start"
+	eventNextTurn = "nextTurn"
+	eventPause    = "pause"
+	eventResume   = "resume"
+	eventFinish   = "finish"
+	eventReset    = "reset"
+	// eventTimeout force-finishes games exceeding RoomConfig.MaxDuration.
+	eventTimeout = "timeout"
+	// eventBegin ends the setup phase once every player submitted a setup,
+	// eventSetupTimeout once RoomConfig.SetupTimeout elapsed.
+	eventBegin        = "begin"
+	eventSetupTimeout = "setupTimeout"
+)
+
+var (
+	// ErrNotYourTurn is returned when a player acts out of turn.
+	ErrNotYourTurn = errors.New("not your turn")
+	// ErrGameOver is returned when acting on a game that isn't running.
+	ErrGameOver = errors.New("game over")
+)
+
+// RoomConfig holds the per-room game settings.
+type RoomConfig struct {
+	// MinPlayers is the number of ready players required to start the game.
+	MinPlayers int
+	// AutoStart fires start automatically once MinPlayers are ready.
+	AutoStart bool
+	// Countdown delays the automatic start.
+	Countdown time.Duration
+	// TurnTimeout passes the turn to the next player when the current one
+	// doesn't play in time. Zero disables it.
+	TurnTimeout time.Duration
+	// MaxDuration force-finishes games still running after it, the time
+	// spent paused included. Zero disables it.
+	MaxDuration time.Duration
+	// ActionTimeout bounds each enter and exit action of the Game FSM. Zero
+	// disables it.
+	ActionTimeout time.Duration
+	// RollbackSlowActions cancels transitions whose actions exceed
+	// ActionTimeout instead of completing them.
+	RollbackSlowActions bool
+	// Setup adds a setup phase between start and play, ending once every
+	// player submitted a setup.
+	Setup bool
+	// SetupTimeout ends the setup phase even if some players didn't submit
+	// a setup. Zero disables it.
+	SetupTimeout time.Duration
+	// SetupDefault is given to the players who didn't submit a setup in
+	// time. Nil kicks them out of the room instead.
+	SetupDefault json.RawMessage
+	// EventLogSize is how many of the last events published on the room
+	// channel are kept for reconnecting clients. Zero disables the log.
+	EventLogSize int
+	// TurnOrder orders the ready players for turns when the game starts.
+	TurnOrder TurnOrder
+	// TurnSeed seeds TurnOrderShuffle, so that the same seats get the same
+	// order. Zero seeds it with the time the game starts.
+	TurnSeed int64
+	// TurnLess, when set, orders the players instead of TurnOrder.
+	TurnLess func(a, b Seat) bool
+	// Topology is the channel topology of the rooms, TopologySplit when
+	// empty. createRoom may choose another one per room.
+	Topology ChannelTopology
+	// Restore handles the states of restored games that the Game FSM no
+	// longer has, e.g. setup once Setup is disabled.
+	Restore RestoreConfig
+}
+
+// DefaultRoomConfig returns the settings used when none are provided.
+func DefaultRoomConfig() RoomConfig {
+	return RoomConfig{
+		MinPlayers:   2,
+		Countdown:    5 * time.Second,
+		TurnTimeout:  30 * time.Second,
+		MaxDuration:  time.Hour,
+		EventLogSize: 100,
+	}
+}
+
+// Room groups players around a single Game FSM.
+type Room struct {
+	ID     string
+	Game   *FSM
+	config RoomConfig
+
+	mu         sync.Mutex
+	players    map[string]bool   // client ID -> ready
+	joined     map[string]uint64 // client ID -> join number, see Seat
+	joins      uint64
+	clock      Clock
+	countdown  Timer
+	onCancel   func(ready int)                                    // called when the countdown is cancelled
+	onLeave    func(clientID string, remaining int, wasTurn bool) // see OnLeaveGame
+	turnOrder  []string
+	turn       int
+	moves      []json.RawMessage          // accepted since the game started
+	setups     map[string]json.RawMessage // client ID -> submitted setup
+	kicked     []string                   // by the setup timeout, until taken
+	expiry     Timer                      // forces the finish after MaxDuration
+	startedAt  time.Time                  // of the game, zero before
+	invite     string                     // token of private matches, empty for public rooms
+	invited    map[string]bool            // owner IDs allowed in a private match
+	expected   map[string]string          // owner ID -> client ID of the players of NewMatch, empty until joined
+	attending  bool                       // until the expected players joined or the wait ended
+	attendance Timer                      // ends the wait after Attendance.Timeout
+	events     *eventLog                  // nil when EventLogSize is zero
+	topology   ChannelTopology            // see Channels
+	key        []byte                     // see Encrypt, nil for rooms in clear
+
+	// moveMu serializes the moves of the room, from the turn check to the
+	// turn passing, see Server.rpcMove.
+	moveMu sync.Mutex
+
+	// seqMu serializes the publications on the room channel, see
+	// Room.sequence.
+	seqMu  sync.Mutex
+	seq    uint64         // of the last message published on the channel
+	causes map[uint32]int // causation depth -> RPCs being handled, see causeDepth
+}
+
+// NewRoom creates a room whose game can start once enough players are ready.
+func NewRoom(id string, config RoomConfig) *Room {
+	return newRoom(id, config, systemClock{})
+}
+
+// newRoom creates a room whose countdown and timeouts run on clock.
+func newRoom(id string, config RoomConfig, clock Clock) *Room {
+	r := &Room{
+		ID:      id,
+		config:  config,
+		clock:   clock,
+		players: make(map[string]bool),
+		joined:  make(map[string]uint64),
+		invited: make(map[string]bool),
+		setups:  make(map[string]json.RawMessage),
+		causes:  make(map[uint32]int),
+	}
+	_ = r.SetTopology(config.Topology) // validated by NewServer
+	if config.EventLogSize > 0 {
+		r.events = newEventLog(config.EventLogSize)
+	}
+	transitions := []Transition{
+		{Event: eventStart, From: gameLobby, To: gamePlaying},
+	}
+	if config.Setup {
+		transitions = []Transition{
+			{Event: eventStart, From: gameLobby, To: gameSetup},
+			{Event: eventBegin, From: gameSetup, To: gamePlaying},
+			{Event: eventSetupTimeout, From: gameSetup, To: gamePlaying},
+			{Event: eventFinish, From: gameSetup, To: gameFinished},
+			{Event: eventTimeout, From: gameSetup, To: gameFinished},
+		}
+	}
+	r.Game = NewFSM(gameLobby, append(transitions, []Transition{
+		{Event: eventNextTurn, From: gamePlaying, To: gamePlaying},
+		{Event: eventPause, From: gamePlaying, To: gamePaused},
+		{Event: eventResume, From: gamePaused, To: gamePlaying},
+		{Event: eventFinish, From: gamePlaying, To: gameFinished},
+		{Event: eventFinish, From: gamePaused, To: gameFinished},
+		{Event: eventTimeout, From: gamePlaying, To: gameFinished},
+		{Event: eventTimeout, From: gamePaused, To: gameFinished},
+		{Event: eventReset, From: gameFinished, To: gameLobby},
+	}...))
+	r.Game.SetClock(clock)
+	_ = r.Game.SetRestore(config.Restore) // validated by NewServer
+	r.Game.AddGuard(eventStart, r.enoughReady)
+	r.Game.AddGuard(eventBegin, r.setupComplete)
+	r.Game.AddGuard(eventNextTurn, r.moverHasTurn)
+	r.Game.OnExit(gameSetup, r.closeSetup)
+	if config.SetupTimeout > 0 {
+		r.Game.SetTimeout(gameSetup, config.SetupTimeout, eventSetupTimeout)
+	}
+	if config.TurnTimeout > 0 {
+		r.Game.SetTimeout(gamePlaying, config.TurnTimeout, eventNextTurn)
+	}
+	policy := ActionTimeoutContinue
+	if config.RollbackSlowActions {
+		policy = ActionTimeoutRollback
+	}
+	r.Game.SetActionTimeout("", config.ActionTimeout, policy)
+	// Pausing keeps what is left of the current turn for the resume.
+	r.Game.SuspendOn(eventPause)
+	r.Game.OnTransition(r.trackTurns)
+	r.Game.OnTransition(r.trackDuration)
+	return r
+}
+
+// enoughReady guards start until MinPlayers are ready, and while the
+// expected players of a match are awaited.
+func (r *Room) enoughReady(*TransitionContext) bool {
+	return r.ReadyCount() >= r.config.MinPlayers && !r.awaiting()
+}
+
+// trackDuration arms the MaxDuration timer when the game starts and stops
+// it once the game is over.
+func (r *Room) trackDuration(t Transition) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case t.Event == eventStart:
+		r.startedAt = r.clock.Now()
+		r.armExpiry(r.config.MaxDuration)
+	case t.To == gameFinished && r.expiry != nil:
+		r.expiry.Stop()
+		r.expiry = nil
+	}
+}
+
+// armExpiry forces the finish of the game in d, what is left of its
+// MaxDuration. It must be called with r.mu held.
+func (r *Room) armExpiry(d time.Duration) {
+	if r.config.MaxDuration <= 0 {
+		return
+	}
+	if r.expiry != nil {
+		r.expiry.Stop()
+	}
+	var timer Timer
+	timer = r.clock.AfterFunc(d, func() {
+		r.mu.Lock()
+		current := r.expiry == timer
+		r.expiry = nil
+		r.mu.Unlock()
+		if !current {
+			return
+		}
+		log.Info().Msgf("room %s: game exceeded %s, finishing", r.ID, r.config.MaxDuration)
+		if err := r.Game.Fire(eventTimeout); err != nil {
+			log.Warn().Msgf("room %s: forced finish failed: %s", r.ID, err.Error())
+		}
+	})
+	r.expiry = timer
+}
+
+func (r *Room) trackTurns(t Transition) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch t.Event {
+	case eventStart:
+		r.turnOrder = r.orderTurns()
+		r.turn = 0
+		r.moves = nil
+		r.setups = make(map[string]json.RawMessage)
+	case eventNextTurn:
+		if len(r.turnOrder) > 0 {
+			r.turn = (r.turn + 1) % len(r.turnOrder)
+		}
+	}
+}
+
+// metaMover is the Metadata key of the ID of the player whose move passes
+// the turn.
+const metaMover = "mover"
+
+// moverHasTurn guards nextTurn fired by a move until it is the mover's
+// turn, so that a turn passed meanwhile, e.g. by its timeout, isn't passed
+// again. Turns passed without a move aren't guarded.
+func (r *Room) moverHasTurn(ctx *TransitionContext) bool {
+	mover, ok := ctx.Metadata[metaMover].(string)
+	if !ok {
+		return true
+	}
+	turn, _ := r.CurrentTurn()
+	return turn == mover
+}
+
+// UndoMove removes the last move recorded, for a move whose turn couldn't
+// pass.
+func (r *Room) UndoMove() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.moves) > 0 {
+		r.moves = r.moves[:len(r.moves)-1]
+	}
+}
+
+// CurrentTurn returns the ID of the player whose turn it is.
+func (r *Room) CurrentTurn() (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.turnOrder) == 0 {
+		return "", false
+	}
+	return r.turnOrder[r.turn], true
+}
+
+// Plays reports whether clientID is in the turn order of the game.
+func (r *Room) Plays(clientID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.inTurnOrder(clientID)
+}
+
+// GameState returns the state of the game for a move of clientID.
+func (r *Room) GameState(clientID string) GameState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	setups := make(map[string]json.RawMessage, len(r.setups))
+	for id, setup := range r.setups {
+		setups[id] = setup
+	}
+	return GameState{
+		Room:    r.ID,
+		Player:  clientID,
+		Players: append([]string{}, r.turnOrder...),
+		Moves:   append([]json.RawMessage{}, r.moves...),
+		Setups:  setups,
+	}
+}
+
+// RecordMove appends an accepted move to the game history.
+func (r *Room) RecordMove(move []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.moves = append(r.moves, append(json.RawMessage{}, move...))
+}
+
+// PlayerCount returns the number of players in the turn order.
+func (r *Room) PlayerCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.turnOrder)
+}
+
+// Channel returns the room's centrifuge channel.
+func (r *Room) Channel() string {
+	return "game:" + r.ID
+}
+
+// Private reports whether the room is a match only invited users may join.
+func (r *Room) Private() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.invite != ""
+}
+
+// Invite allows ownerID in the room.
+func (r *Room) Invite(ownerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.invited[ownerID] = true
+}
+
+// Invited reports whether ownerID may join the room. Everyone may join a
+// public room.
+func (r *Room) Invited(ownerID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.invite == "" || r.invited[ownerID]
+}
+
+// Join adds a player to the room, not ready yet.
+func (r *Room) Join(clientID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.players[clientID]; !ok {
+		r.addPlayer(clientID, false)
+	}
+}
+
+// Has reports whether clientID is in the room.
+func (r *Room) Has(clientID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.players[clientID]
+	return ok
+}
+
+// Players returns the IDs of the players in the room, sorted.
+func (r *Room) Players() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, 0, len(r.players))
+	for id := range r.players {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Rename moves a player to a new client ID, keeping its readiness, setup
+// and place in the turn order.
+func (r *Room) Rename(oldID, newID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ready, ok := r.players[oldID]
+	if !ok {
+		return
+	}
+	delete(r.players, oldID)
+	r.players[newID] = ready
+	r.joined[newID] = r.joined[oldID]
+	delete(r.joined, oldID)
+	if setup, ok := r.setups[oldID]; ok {
+		delete(r.setups, oldID)
+		r.setups[newID] = setup
+	}
+	for i, id := range r.turnOrder {
+		if id == oldID {
+			r.turnOrder[i] = newID
+		}
+	}
+	for owner, id := range r.expected {
+		if id == oldID {
+			r.expected[owner] = newID
+		}
+	}
+}
+
+// Forfeit takes a player out of the turn order and returns how many players
+// are left in it. If it was the player's turn, the turn goes to the next one.
+func (r *Room) Forfeit(clientID string) (remaining int, wasTurn bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	remaining, wasTurn, _ = r.dropTurn(clientID)
+	return remaining, wasTurn
+}
+
+// dropTurn takes a player out of the turn order, reporting whether it was
+// in it. It must be called with r.mu held.
+func (r *Room) dropTurn(clientID string) (remaining int, wasTurn, ok bool) {
+	idx := -1
+	for i, id := range r.turnOrder {
+		if id == clientID {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return len(r.turnOrder), false, false
+	}
+	wasTurn = idx == r.turn
+	r.turnOrder = append(r.turnOrder[:idx], r.turnOrder[idx+1:]...)
+	if idx < r.turn {
+		r.turn--
+	}
+	if r.turn >= len(r.turnOrder) {
+		r.turn = 0
+	}
+	return len(r.turnOrder), wasTurn, true
+}
+
+// Leave removes a player from the room and returns the remaining count. A
+// pending countdown is cancelled if too few players are left ready. A
+// player still in the turn order is taken out of it, see OnLeaveGame.
+func (r *Room) Leave(clientID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.players, clientID)
+	delete(r.joined, clientID)
+	r.checkCountdown()
+	if remaining, wasTurn, ok := r.dropTurn(clientID); ok && r.onLeave != nil {
+		go r.onLeave(clientID, remaining, wasTurn)
+	}
+	return len(r.players)
+}
+
+// OnLeaveGame registers fn, called with the players left in the turn order
+// whenever a player leaves the room without forfeiting first, and whether it
+// was its turn. It is called on its own goroutine, as the room may be left
+// with the registry locked.
+func (r *Room) OnLeaveGame(fn func(clientID string, remaining int, wasTurn bool)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onLeave = fn
+}
+
+// SetReady marks a player ready or not. Once the threshold is reached and
+// AutoStart is enabled, start is fired after the configured countdown,
+// which is cancelled if the count drops below the threshold again.
+func (r *Room) SetReady(clientID string, ready bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.players[clientID]; !ok {
+		return
+	}
+	r.players[clientID] = ready
+	r.checkCountdown()
+
+	if !r.config.AutoStart || r.countdown != nil || r.readyCount() < r.config.MinPlayers {
+		return
+	}
+	log.Info().Msgf("room %s: %d players ready, starting in %s", r.ID, r.readyCount(), r.config.Countdown)
+	var timer Timer
+	timer = r.clock.AfterFunc(r.config.Countdown, func() {
+		r.mu.Lock()
+		current := r.countdown == timer
+		if current {
+			r.countdown = nil
+		}
+		r.mu.Unlock()
+		// A cancelled countdown may have fired before it was stopped.
+		if !current {
+			return
+		}
+		if err := r.Start(); err != nil {
+			log.Warn().Msgf("room %s: auto start failed: %s", r.ID, err.Error())
+		}
+	})
+	r.countdown = timer
+}
+
+// OnCountdownCancel registers fn, called with the ready count whenever a
+// pending countdown is cancelled because players left or unreadied. It is
+// called on its own goroutine, as the room may be left with the registry
+// locked.
+func (r *Room) OnCountdownCancel(fn func(ready int)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onCancel = fn
+}
+
+// checkCountdown cancels the pending countdown once the start guard would
+// no longer pass, the game staying in the lobby. It must be called with
+// r.mu held.
+func (r *Room) checkCountdown() {
+	ready := r.readyCount()
+	if r.countdown == nil || ready >= r.config.MinPlayers {
+		return
+	}
+	r.countdown.Stop()
+	r.countdown = nil
+	log.Info().Msgf("room %s: %d players ready, countdown cancelled", r.ID, ready)
+	if r.onCancel != nil {
+		go r.onCancel(ready)
+	}
+}
+
+// Close stops any pending countdown, game expiry and wait for expected
+// players, and closes the Game FSM.
+func (r *Room) Close() {
+	r.Game.Close()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopAttendance()
+	if r.countdown != nil {
+		r.countdown.Stop()
+		r.countdown = nil
+	}
+	if r.expiry != nil {
+		r.expiry.Stop()
+		r.expiry = nil
+	}
+}
+
+// ReadyCount returns the number of ready players.
+func (r *Room) ReadyCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.readyCount()
+}
+
+func (r *Room) readyCount() int {
+	n := 0
+	for _, ready := range r.players {
+		if ready {
+			n++
+		}
+	}
+	return n
+}
+
+// Start fires start on the Game FSM, cancelling a pending countdown. It
+// fails with ErrGuardFailed while fewer than MinPlayers are ready.
+func (r *Room) Start() error {
+	if err := r.Game.Fire(eventStart); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.countdown != nil {
+		r.countdown.Stop()
+		r.countdown = nil
+	}
+	return nil
+}
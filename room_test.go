@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLeaveForfeitsPlayerOnTurn(t *testing.T) {
+	h := newHarness(t, nil)
+	r, players := startGame(t, h, 3)
+	leaver, next := players[0], players[1]
+	p, _ := h.Server.players.Get(leaver.ID)
+
+	call(t, leaver, "leaveRoom", roomRequest{Room: r.ID}, nil)
+	eventually(t, "the leaver to forfeit", func() bool { return p.FSM.Current() == playerForfeited })
+	if order := r.TurnOrder(); len(order) != 2 || order[0] != next.ID {
+		t.Errorf("turn order %v, want %s first", order, next.ID)
+	}
+	if turn, _ := r.CurrentTurn(); turn != next.ID {
+		t.Errorf("turn of %s, want %s", turn, next.ID)
+	}
+	if r.Game.Current() != gamePlaying {
+		t.Errorf("game %s, want %s", r.Game.Current(), gamePlaying)
+	}
+
+	call(t, next, "move", moveRequest{}, nil)
+	if turn, _ := r.CurrentTurn(); turn != players[2].ID {
+		t.Errorf("turn of %s after a move, want %s", turn, players[2].ID)
+	}
+}
+
+func TestLeaveFinishesGameWithTooFewPlayers(t *testing.T) {
+	h := newHarness(t, nil)
+	r, players := startGame(t, h, 2)
+
+	call(t, players[1], "leaveRoom", roomRequest{Room: r.ID}, nil)
+	eventually(t, "the game to finish", func() bool { return r.Game.Current() == gameFinished })
+}
+
+func TestStartNeedsMinPlayersReady(t *testing.T) {
+	config := DefaultRoomConfig()
+	config.MinPlayers = 3
+	r := newRoom("r1", config, NewFakeClock(time.Now()))
+	for _, id := range []string{"c1", "c2", "c3"} {
+		r.Join(id)
+	}
+	r.SetReady("c1", true)
+	r.SetReady("c2", true)
+	if err := r.Start(); !errors.Is(err, ErrGuardFailed) {
+		t.Fatalf("start one player short: %v, want %v", err, ErrGuardFailed)
+	}
+	r.SetReady("c3", true)
+	if err := r.Start(); err != nil {
+		t.Fatalf("start at the threshold: %s", err)
+	}
+	if r.Game.Current() != gamePlaying {
+		t.Errorf("game %s, want %s", r.Game.Current(), gamePlaying)
+	}
+}
+
+func TestAutoStartAfterCountdown(t *testing.T) {
+	config := DefaultRoomConfig()
+	config.AutoStart = true
+	clock := NewFakeClock(time.Now())
+	r := newRoom("r1", config, clock)
+	r.Join("c1")
+	r.Join("c2")
+	r.SetReady("c1", true)
+	clock.Advance(config.Countdown)
+	if r.Game.Current() != gameLobby {
+		t.Fatalf("game %s below the threshold, want %s", r.Game.Current(), gameLobby)
+	}
+
+	r.SetReady("c2", true)
+	clock.Advance(config.Countdown - time.Millisecond)
+	if r.Game.Current() != gameLobby {
+		t.Fatalf("game %s before the countdown ended", r.Game.Current())
+	}
+	clock.Advance(time.Millisecond)
+	if r.Game.Current() != gamePlaying {
+		t.Errorf("game %s after the countdown, want %s", r.Game.Current(), gamePlaying)
+	}
+}
+
+func TestCountdownCancelledBelowThreshold(t *testing.T) {
+	config := DefaultRoomConfig()
+	config.AutoStart = true
+	clock := NewFakeClock(time.Now())
+	r := newRoom("r1", config, clock)
+	r.Join("c1")
+	r.Join("c2")
+	r.SetReady("c1", true)
+	r.SetReady("c2", true)
+	r.SetReady("c2", false)
+	clock.Advance(config.Countdown)
+	if r.Game.Current() != gameLobby {
+		t.Errorf("game %s after a cancelled countdown, want %s", r.Game.Current(), gameLobby)
+	}
+}
+
+func TestPauseKeepsTheTurnTimeLeft(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.Room.TurnTimeout = 30 * time.Second
+		c.Room.MaxDuration = 100 * time.Second
+	})
+	r, players := startGame(t, h, 2)
+	turn := func() string { id, _ := r.CurrentTurn(); return id }
+
+	h.Clock.Advance(10 * time.Second)
+	call(t, players[0], "pause", nil, nil)
+	h.Clock.Advance(60 * time.Second)
+	if r.Game.Current() != gamePaused || turn() != players[0].ID {
+		t.Fatalf("game %s on the turn of %s while paused, want %s on %s", r.Game.Current(), turn(), gamePaused, players[0].ID)
+	}
+
+	// The turn gets the 20s it had left, MaxDuration counted the pause.
+	call(t, players[1], "resume", nil, nil)
+	h.Clock.Advance(20*time.Second - time.Millisecond)
+	if turn() != players[0].ID {
+		t.Fatalf("turn passed with %s of its time left", time.Millisecond)
+	}
+	h.Clock.Advance(time.Millisecond)
+	if turn() != players[1].ID {
+		t.Fatalf("turn of %s once its time left ran out, want %s", turn(), players[1].ID)
+	}
+	h.Clock.Advance(10*time.Second - time.Millisecond)
+	if r.Game.Current() != gamePlaying {
+		t.Fatalf("game %s before MaxDuration, want %s", r.Game.Current(), gamePlaying)
+	}
+	h.Clock.Advance(time.Millisecond)
+	if r.Game.Current() != gameFinished {
+		t.Errorf("game %s after MaxDuration, want %s", r.Game.Current(), gameFinished)
+	}
+}
+
+func TestOnlyPlayersPause(t *testing.T) {
+	h := newHarness(t, nil)
+	r, _ := startGame(t, h, 2)
+	member := connect(t, h, "member")
+	call(t, member, "joinRoom", roomRequest{Room: r.ID}, nil)
+	if code := callError(t, member, "pause", nil); code != CodePlayerNotFound {
+		t.Errorf("pause by a member out of the turn order: code %d, want %d", code, CodePlayerNotFound)
+	}
+	if r.Game.Current() != gamePlaying {
+		t.Errorf("game %s, want %s", r.Game.Current(), gamePlaying)
+	}
+}
+
+func TestGameShorterThanMaxDuration(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.Room.MinPlayers = 2
+		c.Room.MaxDuration = time.Minute
+	})
+	r, players := startGame(t, h, 2)
+	h.Clock.Advance(10 * time.Second)
+	call(t, players[1], "forfeit", nil, nil)
+	if r.Game.Current() != gameFinished {
+		t.Fatalf("game %s after the forfeit, want %s", r.Game.Current(), gameFinished)
+	}
+
+	// The next game gets a whole MaxDuration, the first one's is stopped.
+	if err := r.Game.Fire(eventReset); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range players {
+		call(t, c, "reset", nil, nil)
+		call(t, c, "ready", nil, nil)
+	}
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	h.Clock.Advance(time.Minute - time.Millisecond)
+	if r.Game.Current() != gamePlaying {
+		t.Fatalf("game %s before its MaxDuration, want %s", r.Game.Current(), gamePlaying)
+	}
+	h.Clock.Advance(time.Millisecond)
+	if r.Game.Current() != gameFinished {
+		t.Errorf("game %s after its MaxDuration, want %s", r.Game.Current(), gameFinished)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// RosterEntry describes a connected player.
+type RosterEntry struct {
+	Player   string `json:"player"`
+	User     string `json:"user,omitempty"`
+	State    string `json:"state"`
+	Room     string `json:"room,omitempty"`
+	Presence string `json:"presence"`
+}
+
+// Roster returns the connected players sorted by ID.
+func (s *Server) Roster() []RosterEntry {
+	players := s.players.All()
+	roster := make([]RosterEntry, 0, len(players))
+	for _, p := range players {
+		roster = append(roster, RosterEntry{
+			Player:   p.ID(),
+			User:     p.UserID,
+			State:    p.FSM.Current(),
+			Room:     p.Room(),
+			Presence: p.Presence(),
+		})
+	}
+	sort.Slice(roster, func(i, j int) bool { return roster[i].Player < roster[j].Player })
+	return roster
+}
+
+// saveRoster writes the current roster to the state store, encoded like
+// the game snapshots, see decodeSnapshot.
+func (s *Server) saveRoster() {
+	data, err := encodeSnapshot(s.codec, s.Roster())
+	if err != nil {
+		log.Error().Msgf("roster serialization error: %s", err.Error())
+		return
+	}
+	if err := s.store.Save("roster:"+s.node.ID(), data); err != nil {
+		log.Error().Msgf("roster snapshot error: %s", err.Error())
+	}
+}
+
+// runRosterSnapshots periodically saves the roster until s.done is closed.
+// Each period is jittered by up to ±10% so instances don't write in sync.
+func (s *Server) runRosterSnapshots(interval time.Duration) {
+	every(s.clock, s.done, func() time.Duration { return jitter(interval) }, func(time.Time) {
+		s.saveRoster()
+	})
+}
+
+func jitter(d time.Duration) time.Duration {
+	spread := int64(d) / 5
+	if spread <= 0 {
+		return d
+	}
+	return d - time.Duration(spread/2) + time.Duration(rand.Int63n(spread))
+}
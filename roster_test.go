@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSaveRosterUsesSnapshotCodec(t *testing.T) {
+	for _, codec := range []string{"json", "gob"} {
+		h := newHarness(t, func(c *Config) { c.SnapshotCodec = codec })
+		c := connect(t, h, "alice")
+		h.Server.saveRoster()
+
+		data, err := h.Server.store.Load("roster:" + h.Server.node.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var roster []RosterEntry
+		if err := decodeSnapshot(data, &roster); err != nil {
+			t.Fatalf("%s roster: %s", codec, err)
+		}
+		if len(roster) != 1 || roster[0].Player != c.ID || roster[0].User != "alice" {
+			t.Errorf("%s roster %+v, want the player of alice", codec, roster)
+		}
+	}
+}
+
+func TestRosterSnapshotsOnTheClock(t *testing.T) {
+	h := newHarness(t, nil)
+	c := connect(t, h, "alice")
+	key := "roster:" + h.Server.node.ID()
+	if _, err := h.Server.store.Load(key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("roster saved before its interval: %v", err)
+	}
+	// The period is jittered by up to 10%.
+	h.Clock.Advance(h.Server.config.RosterSnapshotInterval * 11 / 10)
+	data, err := h.Server.store.Load(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var roster []RosterEntry
+	if err := decodeSnapshot(data, &roster); err != nil {
+		t.Fatal(err)
+	}
+	if len(roster) != 1 || roster[0].Player != c.ID {
+		t.Errorf("roster %+v, want the player of alice", roster)
+	}
+}
+
+func TestStatsOnTheClock(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.Stats.Interval = 10 * time.Second })
+	c := connect(t, h, "alice")
+	if err := c.Subscribe(h.Server.config.Stats.Channel); err != nil {
+		t.Fatal(err)
+	}
+	startGame(t, h, 2)
+	h.Clock.Advance(10 * time.Second)
+	var stats ServerStats
+	if err := json.Unmarshal(nextMessage(t, c, msgServerStats).Message.Payload, &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Clients != 3 || stats.Rooms != 1 || stats.TransitionsPerSec <= 0 {
+		t.Errorf("stats %+v, want 3 clients, 1 room and transitions", stats)
+	}
+}
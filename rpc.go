@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+	"github.com/rs/zerolog"
+)
+
+// rpcHandler handles the payload of an RPC call issued by client and returns
+// the reply payload.
+type rpcHandler func(client *centrifuge.Client, data []byte) ([]byte, error)
+
+// rpcBroadcastFunc returns the channel the result of an RPC issued by client
+// is broadcast to, if any.
+type rpcBroadcastFunc func(client *centrifuge.Client) (string, bool)
+
+var (
+	// ErrRPCConflict is returned when registering a method or alias whose
+	// normalized name is already taken.
+	ErrRPCConflict = errors.New("rpc method conflict")
+	// ErrRPCPayloadTooLarge is returned to calls whose payload exceeds
+	// Config.MaxRPCPayload.
+	ErrRPCPayloadTooLarge = errors.New("rpc payload too large")
+)
+
+type rpcMethod struct {
+	name      string // as registered, aliases resolve to it
+	handler   rpcHandler
+	broadcast rpcBroadcastFunc
+	audit     auditTarget // nil for methods that aren't admin actions
+}
+
+// rpcOption configures a registered RPC method.
+type rpcOption func(*rpcMethod)
+
+// withBroadcast publishes the result of successful calls, in addition to
+// the direct reply, to the channel returned by channel.
+func withBroadcast(channel rpcBroadcastFunc) rpcOption {
+	return func(m *rpcMethod) {
+		m.broadcast = channel
+	}
+}
+
+// rpcDispatcher routes RPC calls to handlers registered by method name.
+type rpcDispatcher struct {
+	publish func(channel, msgType string, payload any) error
+	// onResult, when set, is called with the outcome of every handled call.
+	onResult func(client *centrifuge.Client, method string, err error)
+	// logger, when set, returns the logger used for a client's calls.
+	logger func(clientID string) *zerolog.Logger
+	// normalize canonicalizes method names before registration and
+	// dispatch.
+	normalize func(method string) string
+	// replies, when set, returns the cache replaying the replies of calls
+	// retried by client with the same idempotency key, nil for none.
+	replies func(client *centrifuge.Client) *replyCache
+	// maxPayload bounds the size of call payloads, zero for no limit.
+	maxPayload int
+	// maxDepth bounds the causation depth of calls, zero for no limit.
+	maxDepth int
+	// cause, when set, tags the messages published on behalf of client
+	// with depth until the returned function is called.
+	cause func(client *centrifuge.Client, depth uint32) func()
+	// onAudit, when set, is called with the outcome of the calls that are
+	// admin actions, see withAudit.
+	onAudit func(client *centrifuge.Client, method string, data []byte, target string, err error)
+
+	mu      sync.RWMutex
+	methods map[string]rpcMethod // normalized name -> method
+}
+
+// newRPCDispatcher creates a dispatcher broadcasting results with publish.
+func newRPCDispatcher(publish func(channel, msgType string, payload any) error) *rpcDispatcher {
+	return &rpcDispatcher{
+		publish:   publish,
+		normalize: normalizeMethod,
+		methods:   make(map[string]rpcMethod),
+	}
+}
+
+// normalizeMethod trims and lowercases method so "Move " dispatches to move.
+func normalizeMethod(method string) string {
+	return strings.ToLower(strings.TrimSpace(method))
+}
+
+func (d *rpcDispatcher) register(method string, h rpcHandler, opts ...rpcOption) error {
+	m := rpcMethod{name: method, handler: h}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.add(method, m)
+}
+
+// alias makes alias dispatch to the registered method.
+func (d *rpcDispatcher) alias(alias, method string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	m, ok := d.methods[d.normalize(method)]
+	if !ok {
+		return fmt.Errorf("alias %s of unknown rpc method %s", alias, method)
+	}
+	return d.add(alias, m)
+}
+
+// add must be called with d.mu held.
+func (d *rpcDispatcher) add(name string, m rpcMethod) error {
+	key := d.normalize(name)
+	if other, ok := d.methods[key]; ok {
+		return fmt.Errorf("%w: %s and %s both resolve to %s", ErrRPCConflict, name, other.name, key)
+	}
+	d.methods[key] = m
+	return nil
+}
+
+// handler returns the centrifuge RPC handler bound to client.
+func (d *rpcDispatcher) handler(client *centrifuge.Client) centrifuge.RPCHandler {
+	return func(e centrifuge.RPCEvent, cb centrifuge.RPCCallback) {
+		l := &log
+		if d.logger != nil {
+			l = d.logger(client.ID())
+		}
+		// Oversized payloads are rejected before anything decodes, or even
+		// logs, them.
+		if d.maxPayload > 0 && len(e.Data) > d.maxPayload {
+			l.Warn().Msgf("client %s RPC %s rejected: %d bytes payload", client.ID(), e.Method, len(e.Data))
+			cb(centrifuge.RPCReply{}, clientError(fmt.Errorf("%w: %d bytes, the limit is %d", ErrRPCPayloadTooLarge, len(e.Data), d.maxPayload)))
+			return
+		}
+		l.Info().Msgf("client %s RPC: %s %s", client.ID(), e.Method, string(e.Data))
+
+		d.mu.RLock()
+		m, ok := d.methods[d.normalize(e.Method)]
+		d.mu.RUnlock()
+		if !ok {
+			cb(centrifuge.RPCReply{}, centrifuge.ErrorMethodNotFound)
+			return
+		}
+		depth := causationDepth(e.Data)
+		if err := d.checkDepth(client, e.Method, depth); err != nil {
+			cb(centrifuge.RPCReply{}, clientError(err))
+			return
+		}
+		if d.cause != nil {
+			defer d.cause(client, depth+1)()
+		}
+
+		start := time.Now()
+		data, replayed, err := d.call(client, m, e.Data)
+		metrics().rpcDuration.Observe(time.Since(start).Seconds(), m.name)
+		if replayed {
+			l.Info().Msgf("client %s RPC %s retried, replaying its reply", client.ID(), e.Method)
+			if err != nil {
+				cb(centrifuge.RPCReply{}, clientError(err))
+				return
+			}
+			cb(centrifuge.RPCReply{Data: data}, nil)
+			return
+		}
+		l.Debug().Msgf("client %s RPC %s handled in %s: %s", client.ID(), e.Method, time.Since(start), string(data))
+		if d.onResult != nil {
+			d.onResult(client, m.name, err)
+		}
+		if m.audit != nil && d.onAudit != nil {
+			if target, ok := m.audit(client, e.Data); ok {
+				d.onAudit(client, m.name, e.Data, target, err)
+			}
+		}
+		if err != nil {
+			l.Warn().Msgf("client %s RPC %s failed: %s", client.ID(), e.Method, err.Error())
+			cb(centrifuge.RPCReply{}, clientError(err))
+			return
+		}
+		cb(centrifuge.RPCReply{Data: data}, nil)
+
+		// The reply is already sent, a failed broadcast is only logged.
+		if m.broadcast == nil {
+			return
+		}
+		if channel, ok := m.broadcast(client); ok {
+			if err := d.publish(channel, "rpc."+m.name, json.RawMessage(data)); err != nil {
+				log.Warn().Msgf("client %s RPC %s broadcast to %s failed: %s", client.ID(), e.Method, channel, err.Error())
+			}
+		}
+	}
+}
+
+// call runs the handler of m, or replays the reply to a previous call with
+// the same idempotency key.
+func (d *rpcDispatcher) call(client *centrifuge.Client, m rpcMethod, data []byte) ([]byte, bool, error) {
+	key := idempotencyKey(data)
+	if key == "" || d.replies == nil {
+		reply, err := m.handler(client, data)
+		return reply, false, err
+	}
+	cache := d.replies(client)
+	if cache == nil {
+		reply, err := m.handler(client, data)
+		return reply, false, err
+	}
+	return cache.do(m.name, key, func() ([]byte, error) {
+		return m.handler(client, data)
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRPCAliasesResolve(t *testing.T) {
+	h := newHarness(t, nil)
+	c := connect(t, h, "alice")
+	for _, method := range []string{"state", " State ", "STATE"} {
+		var reply playerReply
+		call(t, c, method, nil, &reply)
+		if reply.Player != c.ID {
+			t.Errorf("%q: player %s, want %s", method, reply.Player, c.ID)
+		}
+	}
+	// make_move is an alias of move, failing the same way out of a room.
+	for _, method := range []string{"move", "Make_Move"} {
+		if code := callError(t, c, method, moveRequest{}); code != CodeRoomNotFound {
+			t.Errorf("%q: code %d, want %d", method, code, CodeRoomNotFound)
+		}
+	}
+	if code := callError(t, c, "teleport", nil); code != CodeMethodNotFound {
+		t.Errorf("unknown method: code %d, want %d", code, CodeMethodNotFound)
+	}
+}
+
+func TestRPCConflicts(t *testing.T) {
+	d := newRPCDispatcher(nil)
+	if err := d.register("move", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.register(" MOVE", nil); !errors.Is(err, ErrRPCConflict) {
+		t.Errorf("method normalized to a registered one: %v, want %v", err, ErrRPCConflict)
+	}
+	if err := d.alias("make_move", "move"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.register("Make_Move", nil); !errors.Is(err, ErrRPCConflict) {
+		t.Errorf("method normalized to an alias: %v, want %v", err, ErrRPCConflict)
+	}
+	if err := d.alias("go", "run"); err == nil {
+		t.Error("alias of an unknown method registered")
+	}
+}
+
+func TestConflictingAliasesRejectedByNewServer(t *testing.T) {
+	config := DefaultConfig()
+	config.TestMode = true
+	config.RPCAliases = map[string][]string{"forfeit": {"Move"}}
+	if _, err := NewServer(config); !errors.Is(err, ErrRPCConflict) {
+		t.Errorf("conflicting alias: %v, want %v", err, ErrRPCConflict)
+	}
+}
+
+func TestRPCBroadcastOnlyListedMethods(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.BroadcastRPCs = []string{"ready"} })
+	player := connect(t, h, "player")
+	room := createRoom(t, player, createRoomRequest{})
+	call(t, player, "joinRoom", roomRequest{Room: room.Room}, nil)
+	watcher := connect(t, h, "watcher")
+	call(t, watcher, "joinRoom", roomRequest{Room: room.Room}, nil)
+	if err := watcher.Subscribe(room.Channel); err != nil {
+		t.Fatal(err)
+	}
+
+	// state is only replied to, ready is also broadcast: the first RPC
+	// result the room gets is the one of ready.
+	call(t, player, "state", nil, nil)
+	reply, err := player.RPC("ready", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		pub, err := watcher.Next(ctx)
+		if err != nil {
+			t.Fatalf("waiting for the broadcast: %s", err)
+		}
+		if !strings.HasPrefix(pub.Message.Type, "rpc.") {
+			continue
+		}
+		if pub.Message.Type != "rpc.ready" {
+			t.Fatalf("%s broadcast, want rpc.ready", pub.Message.Type)
+		}
+		var got, want playerReply
+		if err := json.Unmarshal(pub.Message.Payload, &got); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(reply, &want); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("broadcast %+v, want the reply %+v", got, want)
+		}
+		return
+	}
+}
+
+func TestRPCPayloadLimit(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.MaxRPCPayload = 64 })
+	c := connect(t, h, "alice")
+	// A JSON string of n characters is n+2 bytes long.
+	at := strings.Repeat("x", 64-2)
+	if _, err := c.RPC("role", at); err != nil {
+		t.Errorf("payload of the limit size rejected: %v", err)
+	}
+	if code := callError(t, c, "role", at+"x"); code != CodePayloadTooLarge {
+		t.Errorf("payload over the limit: code %d, want %d", code, CodePayloadTooLarge)
+	}
+	// Even unknown methods are rejected by size first.
+	if code := callError(t, c, "missing", at+"x"); code != CodePayloadTooLarge {
+		t.Errorf("oversized call of an unknown method: code %d, want %d", code, CodePayloadTooLarge)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidMove is returned by move when the rules engine rejects it.
+var ErrInvalidMove = errors.New("invalid move")
+
+// GameState is what a RulesEngine knows of the game a move is played in.
+type GameState struct {
+	Room string
+	// Player is the client ID of the player making the move.
+	Player string
+	// Players is the turn order.
+	Players []string
+	// Moves are the moves accepted since the game started, oldest first.
+	Moves []json.RawMessage
+	// Setups are the setups of the players by client ID, with
+	// RoomConfig.Setup.
+	Setups map[string]json.RawMessage
+}
+
+// RulesEngine decides whether moves are legal in a game. It is consulted
+// once the turn has been checked, before any transition is fired.
+// RulesEngines implementing Scorer also score the finished games.
+type RulesEngine interface {
+	// ValidateMove returns a descriptive error if move is not legal in
+	// state.
+	ValidateMove(state GameState, move []byte) error
+}
+
+// RulesFunc adapts a function to a RulesEngine.
+type RulesFunc func(state GameState, move []byte) error
+
+// ValidateMove calls fn.
+func (fn RulesFunc) ValidateMove(state GameState, move []byte) error {
+	return fn(state, move)
+}
+
+// anyMove is the RulesEngine of games without rules.
+var anyMove = RulesFunc(func(GameState, []byte) error { return nil })
@@ -0,0 +1,42 @@
+package main
+
+import "sort"
+
+const msgGameOver = "game.over"
+
+// Scorer is implemented by the RulesEngines scoring the games they rule.
+type Scorer interface {
+	// Score returns the scores of the players of the finished game in
+	// state, by client ID.
+	Score(state GameState) map[string]int
+}
+
+// scoreboardEvent is the payload of msgGameOver, published once a game
+// finishes. It ranks the players left in the game, highest score first,
+// in turn order for equal scores; the ones who forfeited or left aren't
+// ranked. Scores are zero unless Config.Rules is a Scorer.
+type scoreboardEvent struct {
+	Room   string        `json:"room"`
+	Reason string        `json:"reason,omitempty"`
+	Scores []playerScore `json:"scores"`
+}
+
+type playerScore struct {
+	Player string `json:"player"`
+	Score  int    `json:"score"`
+}
+
+// scoreboard returns the final scoreboard of the game of r.
+func (s *Server) scoreboard(r *Room, reason string) scoreboardEvent {
+	state := r.GameState("")
+	var scores map[string]int
+	if scorer, ok := s.rules.(Scorer); ok {
+		scores = scorer.Score(state)
+	}
+	ev := scoreboardEvent{Room: r.ID, Reason: reason, Scores: make([]playerScore, 0, len(state.Players))}
+	for _, id := range state.Players {
+		ev.Scores = append(ev.Scores, playerScore{Player: id, Score: scores[id]})
+	}
+	sort.SliceStable(ev.Scores, func(i, j int) bool { return ev.Scores[i].Score > ev.Scores[j].Score })
+	return ev
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pointsRules accepts every move and scores each player the points of the
+// moves it played, e.g. {"points":3}.
+type pointsRules struct {
+	mu     sync.Mutex
+	points map[string]int
+}
+
+func (r *pointsRules) ValidateMove(state GameState, move []byte) error {
+	var m struct {
+		Points int `json:"points"`
+	}
+	if err := json.Unmarshal(move, &m); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.points[state.Player] += m.Points
+	return nil
+}
+
+func (r *pointsRules) Score(GameState) map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	scores := make(map[string]int, len(r.points))
+	for id, n := range r.points {
+		scores[id] = n
+	}
+	return scores
+}
+
+func TestFullGameScoreboard(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.Rules = &pointsRules{points: make(map[string]int)}
+		c.Room.MinPlayers = 2
+		c.Room.MaxDuration = time.Minute
+	})
+	r, players := startGame(t, h, 3)
+	watcher := connect(t, h, "watcher")
+	if err := watcher.Subscribe(r.Channel()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two rounds, cut short by the forfeit of the third player and then by
+	// MaxDuration.
+	for i, points := range []int{3, 5, 1, 4} {
+		move := json.RawMessage(fmt.Sprintf(`{"points":%d}`, points))
+		call(t, players[i%3], "move", moveRequest{Move: move}, nil)
+	}
+	call(t, players[2], "forfeit", nil, nil)
+	h.Clock.Advance(time.Minute)
+	if r.Game.Current() != gameFinished {
+		t.Fatalf("game %s after MaxDuration, want %s", r.Game.Current(), gameFinished)
+	}
+
+	var board scoreboardEvent
+	if err := json.Unmarshal(nextMessage(t, watcher, msgGameOver).Message.Payload, &board); err != nil {
+		t.Fatal(err)
+	}
+	want := scoreboardEvent{Room: r.ID, Reason: "timeout", Scores: []playerScore{
+		{Player: players[0].ID, Score: 7},
+		{Player: players[1].ID, Score: 5},
+	}}
+	if !reflect.DeepEqual(board, want) {
+		t.Errorf("scoreboard %+v, want %+v", board, want)
+	}
+}
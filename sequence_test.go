@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestConcurrentPublishesStrictlyIncreasing(t *testing.T) {
+	h := newHarness(t, nil)
+	c := connect(t, h, "player")
+	room := createRoom(t, c, createRoomRequest{})
+	call(t, c, "joinRoom", roomRequest{Room: room.Room}, nil)
+	if err := c.Subscribe(room.Channel); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := h.Server.rooms.Room(room.Room)
+	start := r.Seq()
+
+	const publishers, n = 8, 25
+	var wg sync.WaitGroup
+	for i := 0; i < publishers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				if err := h.Server.publishMessage(room.Channel, "test.seq", struct{}{}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	last := start
+	for i := 0; i < publishers*n; i++ {
+		seq := nextMessage(t, c, "test.seq").Message.Seq
+		if seq <= last {
+			t.Fatalf("message %d received after %d", seq, last)
+		}
+		last = seq
+	}
+	if last != start+publishers*n || r.Seq() != last {
+		t.Errorf("last sequence number %d, room at %d, want %d", last, r.Seq(), start+publishers*n)
+	}
+}
+
+func TestRestoredRoomKeepsItsSequence(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	configure := func(c *Config) {
+		c.Store = store
+		c.RestoreGames = true
+	}
+	h := newHarness(t, configure)
+	r, players := startGame(t, h, 2)
+	call(t, players[0], "move", moveRequest{}, nil)
+	seq := r.Seq()
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	h = newHarness(t, configure)
+	restored, ok := h.Server.rooms.Room(r.ID)
+	if !ok {
+		t.Fatal("game not restored from the file store")
+	}
+	if restored.Seq() < seq {
+		t.Fatalf("restored room at sequence %d, want at least %d", restored.Seq(), seq)
+	}
+	c := connect(t, h, "user0")
+	if err := c.Subscribe(restored.Channel()); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Server.publishMessage(restored.Channel(), "test.seq", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextMessage(t, c, "test.seq").Message.Seq; got != restored.Seq() || got <= seq {
+		t.Errorf("first message after the restart numbered %d, want past %d", got, seq)
+	}
+}
@@ -0,0 +1,621 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/centrifugal/centrifuge"
+	"github.com/rs/zerolog"
+)
+
+// Server ties the centrifuge node to the game registries.
+type Server struct {
+	config   Config
+	node     *centrifuge.Node
+	clock    Clock
+	rooms    *RoomRegistry
+	players  *PlayerRegistry
+	rpc      *rpcDispatcher
+	matcher  *Matchmaker
+	rules    RulesEngine
+	ready    *readiness
+	health   *healthChecks
+	store    StateStore
+	pub      *publisher
+	roles    *roleAssigner
+	channels channelMatcher
+	formats  channelFormats
+	tracer   *tracer
+	subs     *subscriptions
+	codec    SnapshotCodec
+	tokens   TokenVerifier // nil when connections can't be refreshed
+	// definitions are the encoded FSMDefinition of each machine type.
+	definitions map[string]json.RawMessage
+	// maintenance rejects new games, see Maintenance.
+	maintenance atomic.Bool
+	accept      *acceptLimiter // nil without connection rate limit
+	quota       *connQuota     // nil without connection quota
+	done        chan struct{}
+	// stopping rejects new connections once Shutdown started.
+	stopping atomic.Bool
+	// transitions feeds the machines of the server to OnAnyTransition.
+	transitions *transitionBus
+	idle        *inactivity
+
+	// audit records the admin actions, to auditFile if it isn't nil.
+	audit     zerolog.Logger
+	auditFile io.Closer
+
+	// strategyMu serializes the strategy assignments, see AssignStrategy.
+	strategyMu sync.Mutex
+
+	shutdownMu sync.Mutex
+	phases     []ShutdownPhase
+	internal   []*GameClient
+}
+
+// NewServer creates the centrifuge node and registers the game handlers.
+func NewServer(config Config) (*Server, error) {
+	if config.TestMode {
+		config = config.withTestMode()
+	}
+	node, err := centrifuge.New(centrifuge.Config{
+		LogLevel:           centrifuge.LogLevelDebug,
+		ClientQueueMaxSize: config.Transport.QueueMaxSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error instantiating new centrifuge node: %w", err)
+	}
+	if err := config.Transport.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Room.TurnOrder.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Room.Topology.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Attendance.NoShow.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Audit.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Signing.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.ConnectionQuota.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Publisher.validate(); err != nil {
+		return nil, err
+	}
+	channels, err := newChannelMatcher(config.Channels)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := snapshotCodec(config.SnapshotCodec)
+	if err != nil {
+		return nil, err
+	}
+	authenticator, err := NewAuthenticator(config.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	useMetrics(config.Metrics)
+	metrics().maxGames.Set(float64(config.MaxGames))
+	s := &Server{
+		config:   config,
+		node:     node,
+		clock:    orSystemClock(config.Clock),
+		rooms:    NewRoomRegistry(config),
+		players:  NewPlayerRegistry(config),
+		matcher:  NewMatchmaker(config.Room.MinPlayers),
+		rules:    config.Rules,
+		ready:    newReadiness(config.InternalClients, config.Client),
+		health:   newHealthChecks(),
+		store:    config.Store,
+		done:     make(chan struct{}),
+		pub:      newPublisher(node, config.Publisher),
+		roles:    newRoleAssigner(config.Referees),
+		channels: channels,
+		formats:  newChannelFormats(config),
+		tracer:   newTracer(),
+		subs:     newSubscriptions(),
+		codec:    codec,
+
+		transitions: newTransitionBus(),
+	}
+	if err := validateRestore(config, s.players); err != nil {
+		return nil, err
+	}
+	if s.definitions, err = definitions(config, s.players); err != nil {
+		return nil, err
+	}
+	s.AddHealthCheck("publisher", s.pub.health)
+	if s.store == nil {
+		s.store = NewMemoryStore()
+	}
+	s.idle = newInactivity(config.Inactivity, s.clock, s.nudgeInactive)
+	if v, ok := authenticator.(TokenVerifier); ok {
+		s.tokens = v
+	}
+	if s.rules == nil {
+		s.rules = anyMove
+	}
+	if config.ConnectRate.Rate > 0 {
+		s.accept = newAcceptLimiter(config.ConnectRate)
+	}
+	if config.ConnectionQuota.Max > 0 {
+		s.quota = newConnQuota(config.ConnectionQuota)
+	}
+	s.rpc = newRPCDispatcher(s.publishMessage)
+	s.rpc.onResult = s.onRPCResult
+	s.rpc.logger = s.clientLog
+	s.rpc.maxPayload = config.MaxRPCPayload
+	s.rpc.maxDepth = config.MaxCausationDepth
+	s.rpc.cause = s.causeDepth
+	s.rpc.onAudit = s.auditRPC
+	if config.NormalizeRPC != nil {
+		s.rpc.normalize = config.NormalizeRPC
+	}
+	if config.Idempotency.TTL > 0 {
+		s.rpc.replies = s.replyCache
+	}
+	for _, m := range []struct {
+		method  string
+		handler rpcHandler
+	}{
+		{"createRoom", s.rpcCreateRoom},
+		{"joinRoom", s.rpcJoinRoom},
+		{"leaveRoom", s.rpcLeaveRoom},
+		{"transfer", s.rpcTransfer},
+		{"ready", s.rpcReady},
+		{"move", s.rpcMove},
+		{"reset", s.rpcReset},
+		{"state", s.rpcState},
+		{"definition", s.rpcDefinition},
+		{"role", s.rpcRole},
+		{"strategy", s.rpcStrategy},
+		{"createMatch", s.rpcCreateMatch},
+		{"joinMatch", s.rpcJoinMatch},
+		{"scheduleMatch", s.rpcScheduleMatch},
+		{"traceClient", s.rpcTraceClient},
+		{"dump", s.rpcDump},
+		{"forfeit", s.rpcForfeit},
+		{"queue", s.rpcQueue},
+		{"cancelQueue", s.rpcCancelQueue},
+		{"setup", s.rpcSetup},
+		{"recentEvents", s.rpcRecentEvents},
+		{"maintenance", s.rpcMaintenance},
+		{"announce", s.rpcAnnounce},
+		{"pause", s.rpcPause},
+		{"resume", s.rpcResume},
+	} {
+		if err := s.registerRPC(m.method, m.handler); err != nil {
+			return nil, err
+		}
+	}
+	for method, aliases := range config.RPCAliases {
+		for _, alias := range aliases {
+			if err := s.rpc.alias(alias, method); err != nil {
+				return nil, err
+			}
+		}
+	}
+	s.phases = s.shutdownPhases()
+	s.rooms.OnCreate(s.setupRoom)
+	s.rooms.OnCreate(s.watchRoom)
+	s.players.OnAdd(s.watchPlayer)
+
+	node.OnConnecting(s.onConnecting)
+	node.OnConnect(s.onConnect)
+	// Opened last, so that no error leaks the file.
+	if s.audit, s.auditFile, err = newAuditLogger(config.Audit); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// registerRPC registers an RPC method, broadcasting its results to the
+// caller's room when listed in Config.BroadcastRPCs, and auditing the admin
+// actions.
+func (s *Server) registerRPC(method string, h rpcHandler) error {
+	var opts []rpcOption
+	for _, m := range s.config.BroadcastRPCs {
+		if s.rpc.normalize(m) == s.rpc.normalize(method) {
+			opts = append(opts, withBroadcast(s.playerRoomChannel))
+			break
+		}
+	}
+	if target, ok := auditedRPCs[method]; ok {
+		opts = append(opts, withAudit(target))
+	}
+	return s.rpc.register(method, h, opts...)
+}
+
+// onRPCResult disconnects clients firing too many illegal FSM events in a
+// row: they are likely buggy or malicious.
+func (s *Server) onRPCResult(client *centrifuge.Client, method string, err error) {
+	if s.config.MaxIllegalTransitions <= 0 || !errors.Is(err, ErrIllegalTransition) {
+		return
+	}
+	p, ok := s.players.Get(client.ID())
+	if !ok {
+		return
+	}
+	n := p.recordIllegal()
+	if n < s.config.MaxIllegalTransitions {
+		return
+	}
+	log.Warn().Msgf("client %s fired %d illegal transitions in a row (last %s), disconnecting", client.ID(), n, method)
+	client.Disconnect(DisconnectProtocolViolation)
+}
+
+// playerRoomChannel returns the channel of the room client plays in.
+func (s *Server) playerRoomChannel(client *centrifuge.Client) (string, bool) {
+	p, ok := s.players.Get(client.ID())
+	if !ok {
+		return "", false
+	}
+	r, ok := s.rooms.Room(p.Room())
+	if !ok {
+		return "", false
+	}
+	return r.Channel(), true
+}
+
+// Node returns the underlying centrifuge node.
+func (s *Server) Node() *centrifuge.Node {
+	return s.node
+}
+
+// WebsocketHandler returns the handler serving WebSocket connections,
+// through send buffers applying Transport.Overflow when Transport.SendBuffer
+// is set.
+func (s *Server) WebsocketHandler() http.Handler {
+	if s.config.Transport.SendBuffer > 0 {
+		return newBufferedWebsocketHandler(s.node, s.config.Transport)
+	}
+	return centrifuge.NewWebsocketHandler(s.node, centrifuge.WebsocketConfig{
+		ReadBufferSize: 1024,
+		WriteTimeout:   s.config.Transport.WriteTimeout,
+		PingPongConfig: s.config.Transport.pingPong(),
+	})
+}
+
+// Ready is closed once all internal clients connected, or once WaitReady
+// gave up on them.
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready.Ready()
+}
+
+// WaitReady waits for the internal clients to connect, at most
+// Config.InternalClientsTimeout. Past it, the server proceeds in degraded
+// mode: it is ready with the clients connected so far, while the others keep
+// reconnecting in the background. It reports whether all of them connected.
+func (s *Server) WaitReady() bool {
+	if s.ready.wait(s.config.InternalClientsTimeout) {
+		return true
+	}
+	log.Warn().Msgf("only %d of %d internal clients connected after %s, running degraded",
+		s.ready.connected(), s.config.InternalClients, s.config.InternalClientsTimeout)
+	return false
+}
+
+// Run starts the centrifuge node.
+func (s *Server) Run() error {
+	if err := s.node.Run(); err != nil {
+		return fmt.Errorf("error running centrifuge node: %w", err)
+	}
+	if s.config.RosterSnapshotInterval > 0 {
+		s.runRosterSnapshots(s.config.RosterSnapshotInterval)
+	}
+	if s.config.Stats.Interval > 0 {
+		s.runStats(s.config.Stats)
+	}
+	if s.config.RestoreGames {
+		n, err := s.RestoreGames()
+		if err != nil {
+			return fmt.Errorf("error restoring games: %w", err)
+		}
+		log.Info().Msgf("%d games restored", n)
+	}
+	return nil
+}
+
+func (s *Server) freezeAll() {
+	for _, r := range s.rooms.Rooms() {
+		r.Game.Freeze()
+	}
+	for _, p := range s.players.All() {
+		freezeState(p.FSM)
+	}
+	log.Info().Msg("all FSMs frozen")
+}
+
+func (s *Server) onConnect(client *centrifuge.Client) {
+	// In our example transport will always be Websocket but it can also be SockJS.
+	transportName := client.Transport().Name()
+	// In our example clients connect with JSON protocol but it can also be Protobuf.
+	transportProto := client.Transport().Protocol()
+	log.Info().Msgf("client %s (%s) connected via %s (%s)", client.ID(), string(client.Info()), transportName, transportProto)
+	info := clientInfoFrom(client.Context())
+	log.Info().Msgf("client %s runs %s %s", client.ID(), info.Name, info.Version)
+	if meta, ok := connMeta(client); ok {
+		log.Info().Msgf("client %s meta: tenant %q, role %q, version %q, from %s", client.ID(), meta.Tenant, meta.Role, meta.ClientVersion, meta.RemoteAddr)
+	}
+	if !s.enforceQuota(client) {
+		return
+	}
+	s.connectPlayer(client.ID(), client.UserID(), info).startSession()
+	metrics().connections.Add(1)
+
+	if s.tokens != nil {
+		client.OnRefresh(func(e centrifuge.RefreshEvent, cb centrifuge.RefreshCallback) {
+			s.onRefresh(client, e, cb)
+		})
+	}
+
+	client.OnSubscribe(func(e centrifuge.SubscribeEvent, cb centrifuge.SubscribeCallback) {
+		l := s.clientLog(client.ID())
+		l.Info().Msgf("client %s (%s) subscribes on channel %s", client.ID(), string(client.Info()), e.Channel)
+		var opts centrifuge.SubscribeOptions
+		channel, err := s.formats.parse(e.Channel)
+		if err != nil {
+			l.Warn().Msgf("client %s: %s", client.ID(), err.Error())
+			cb(centrifuge.SubscribeReply{}, clientError(err))
+			return
+		}
+		switch channel.kind {
+		case channelMonitor:
+			if !s.isAdmin(client) {
+				l.Warn().Msgf("client %s denied monitor channel %s", client.ID(), e.Channel)
+				cb(centrifuge.SubscribeReply{}, centrifuge.ErrorPermissionDenied)
+				return
+			}
+		case channelUser:
+			if client.UserID() == "" || channel.user != client.UserID() {
+				l.Warn().Msgf("client %s denied error channel %s", client.ID(), e.Channel)
+				cb(centrifuge.SubscribeReply{}, centrifuge.ErrorPermissionDenied)
+				return
+			}
+		case channelRoom, channelChat, channelPresence:
+			if r, ok := s.rooms.Room(channel.room); ok {
+				if err := s.authorizeRoom(client, r); err != nil {
+					l.Debug().Msgf("client %s subscription to %s refused: %s", client.ID(), e.Channel, err.Error())
+					cb(centrifuge.SubscribeReply{}, clientError(err))
+					return
+				}
+				// Room presence counts are reported by the admin API.
+				opts.EmitPresence = e.Channel == r.PresenceChannel()
+			}
+		}
+		s.subs.add(client.ID(), e.Channel)
+		cb(centrifuge.SubscribeReply{Options: opts}, nil)
+	})
+
+	client.OnUnsubscribe(func(e centrifuge.UnsubscribeEvent) {
+		s.clientLog(client.ID()).Info().Msgf("client %s unsubscribed from %s: %s", client.ID(), e.Channel, e.Reason)
+		s.subs.remove(client.ID(), e.Channel)
+	})
+
+	client.OnPublish(func(e centrifuge.PublishEvent, cb centrifuge.PublishCallback) {
+		l := s.clientLog(client.ID())
+		l.Info().Msgf("client %s (%s) publishes into channel %s: %s", client.ID(), string(client.Info()), e.Channel, string(e.Data))
+		s.countActivity(client.ID(), (*Player).countPublish)
+		if err := s.verifyPublication(client, e.Data); err != nil {
+			l.Warn().Msgf("client %s publication to %s rejected: %s", client.ID(), e.Channel, err.Error())
+			cb(centrifuge.PublishReply{}, centrifuge.ErrorPermissionDenied)
+			return
+		}
+		if err := s.channels.check(e.Channel); err != nil {
+			l.Warn().Msgf("client %s: %s", client.ID(), err.Error())
+			cb(centrifuge.PublishReply{}, centrifuge.ErrorUnknownChannel)
+			return
+		}
+		protobuf := client.Transport().Protocol() == centrifuge.ProtocolTypeProtobuf
+		data := e.Data
+		if protobuf {
+			// Channels carry JSON envelopes so JSON and Protobuf clients can
+			// share them: translate before publishing on the client's behalf.
+			var err error
+			data, err = translateMessage(e.Data, centrifuge.ProtocolTypeProtobuf, centrifuge.ProtocolTypeJSON)
+			l.Debug().Msgf("client %s publication translated to %s", client.ID(), string(data))
+			if err != nil {
+				cb(centrifuge.PublishReply{}, centrifuge.ErrorBadRequest)
+				return
+			}
+		}
+		roomID, chat := s.chatRoom(e.Channel, data)
+		if !chat && !protobuf {
+			cb(centrifuge.PublishReply{}, nil)
+			return
+		}
+		if chat {
+			var err error
+			if data, err = s.moderateChat(client, roomID, data); err != nil {
+				cb(centrifuge.PublishReply{}, err)
+				return
+			}
+			// Chat goes through the publish queue, in the lane of its
+			// priority.
+			if err := s.pub.Publish(e.Channel, msgChat, data, centrifuge.WithClientInfo(e.ClientInfo)); err != nil {
+				cb(centrifuge.PublishReply{}, clientError(err))
+				return
+			}
+			cb(centrifuge.PublishReply{Result: &centrifuge.PublishResult{}}, nil)
+			return
+		}
+		res, err := s.node.Publish(e.Channel, data, centrifuge.WithClientInfo(e.ClientInfo))
+		if err != nil {
+			cb(centrifuge.PublishReply{}, err)
+			return
+		}
+		cb(centrifuge.PublishReply{Result: &res}, nil)
+	})
+
+	client.OnDisconnect(func(e centrifuge.DisconnectEvent) {
+		s.clientLog(client.ID()).Info().Msgf("client %s (%s) disconnected: %s", client.ID(), string(client.Info()), e.Reason)
+		metrics().connections.Add(-1)
+		// Unsubscriptions are reported before the disconnect, this only
+		// catches subscriptions that failed after being accepted.
+		s.subs.removeClient(client.ID())
+		s.quota.remove(client.ID())
+		if isSlowConsumer(e.Disconnect) {
+			metrics().slowConsumerDisconnects.Add(1)
+			log.Warn().Msgf("client %s disconnected as slow consumer: %s", client.ID(), e.Reason)
+		}
+		if e.Disconnect.Code == DisconnectKeepaliveTimeout.Code {
+			metrics().keepaliveTimeoutDisconnects.Add(1)
+			log.Warn().Msgf("client %s disconnected after missing a pong", client.ID())
+		}
+		if e.Disconnect.Code == DisconnectInactive.Code {
+			metrics().inactivityDisconnects.Add(1)
+		}
+		s.idle.forget(client.ID())
+		s.summarizeSession(client.ID(), e)
+		if _, err := s.matcher.Cancel(client.ID()); err == nil {
+			log.Info().Msgf("client %s left the matchmaking queue", client.ID())
+		}
+		s.disconnectPlayer(client.ID(), client.UserID())
+	})
+
+	handleRPC := s.rpc.handler(client)
+	client.OnRPC(func(e centrifuge.RPCEvent, cb centrifuge.RPCCallback) {
+		s.countActivity(client.ID(), (*Player).countRPC)
+		if err := s.verifyCall(client, e.Method, e.Data); err != nil {
+			s.clientLog(client.ID()).Warn().Msgf("client %s RPC %s rejected: %s", client.ID(), e.Method, err.Error())
+			cb(centrifuge.RPCReply{}, centrifuge.ErrorPermissionDenied)
+			return
+		}
+		handleRPC(e, cb)
+	})
+	s.idle.watch(client)
+	s.ready.markConnected(info)
+}
+
+// setupRoom publishes the game transitions of r to its channel and moves
+// the ready players to playing once the game starts.
+func (s *Server) setupRoom(r *Room) {
+	r.Game.Use(LoggingMiddleware(&log, "room "+r.ID))
+	r.OnCountdownCancel(func(ready int) {
+		_ = s.publishMessage(r.Channel(), msgCountdownCancelled, countdownEvent{Room: r.ID, Ready: ready, Needed: r.config.MinPlayers})
+	})
+	r.OnLeaveGame(func(clientID string, remaining int, wasTurn bool) {
+		s.forfeitLeaver(r, clientID, remaining, wasTurn)
+	})
+	r.Game.OnTransition(func(t Transition) {
+		ev := gameStateEvent{Room: r.ID, Event: t.Event, From: t.From, To: t.To}
+		if t.Event == eventTimeout {
+			ev.Reason = "timeout"
+		}
+		if t.To == gamePlaying {
+			ev.Turn, _ = r.CurrentTurn()
+		}
+		if t.Event == eventStart {
+			ev.Order = r.TurnOrder()
+		}
+		_ = s.publishMessage(r.Channel(), msgGameState, ev)
+		if t.To == gameFinished {
+			_ = s.publishMessage(r.Channel(), msgGameOver, s.scoreboard(r, ev.Reason))
+		}
+		switch t.Event {
+		case eventSetupTimeout:
+			s.kickPlayers(r)
+		case eventPause:
+			_ = s.publishMessage(r.Channel(), msgGamePaused, roomEvent{Room: r.ID})
+		case eventResume:
+			_ = s.publishMessage(r.Channel(), msgGameResumed, roomEvent{Room: r.ID})
+		}
+	})
+	r.Game.OnTransition(func(t Transition) {
+		if t.To != gamePlaying {
+			return
+		}
+		for _, id := range r.Players() {
+			p, ok := s.players.Get(id)
+			if !ok || p.FSM.Current() != playerReady {
+				continue
+			}
+			if err := p.FSM.Fire(eventPlay); err != nil {
+				log.Warn().Msgf("room %s: player %s can't play: %s", r.ID, id, err.Error())
+			}
+		}
+	})
+}
+
+// publishMessage wraps payload in a Message envelope and queues it for
+// publication on channel.
+func (s *Server) publishMessage(channel, msgType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("%s payload serialization error: %w", msgType, err)
+	}
+	return s.publish(channel, Message{Type: msgType, Payload: data})
+}
+
+// publish validates channel against Config.Channels and queues msg for it.
+// Every server-side publication goes through here. Messages of a room
+// channel are encrypted if the room is, then numbered and logged by the
+// room.
+func (s *Server) publish(channel string, msg Message) error {
+	if err := s.channels.check(channel); err != nil {
+		log.Warn().Msgf("%s not published: %s", msg.Type, err.Error())
+		return err
+	}
+	msg, err := s.encrypt(channel, msg)
+	if err != nil {
+		return fmt.Errorf("%s message encryption error: %w", msg.Type, err)
+	}
+	if r, ok := s.channelRoom(channel); ok {
+		err = r.sequence(msg, func(msg Message) error {
+			return s.enqueue(channel, msg)
+		})
+	} else {
+		err = s.enqueue(channel, msg)
+	}
+	if err != nil {
+		return err
+	}
+	s.mirror(channel, msg)
+	return nil
+}
+
+// enqueue encodes msg and queues it for publication on channel.
+func (s *Server) enqueue(channel string, msg Message) error {
+	compressed, err := compressMessage(msg, s.config.CompressThreshold)
+	if err != nil {
+		return fmt.Errorf("%s message compression error: %w", msg.Type, err)
+	}
+	data, err := json.Marshal(compressed)
+	if err != nil {
+		return fmt.Errorf("%s message serialization error: %w", msg.Type, err)
+	}
+	if err := s.pub.Publish(channel, msg.Type, data); err != nil {
+		log.Warn().Msgf("%s not published to %s: %s", msg.Type, channel, err.Error())
+		return err
+	}
+	return nil
+}
+
+// isSlowConsumer reports whether d was caused by a client that couldn't keep
+// up: its queue overflowed or a write exceeded the write timeout.
+func isSlowConsumer(d centrifuge.Disconnect) bool {
+	return d.Code == centrifuge.DisconnectSlow.Code || d.Code == centrifuge.DisconnectWriteError.Code
+}
+
+// ownerID identifies the user behind client, falling back to the connection
+// ID for anonymous users.
+func ownerID(client *centrifuge.Client) string {
+	if client.UserID() != "" {
+		return client.UserID()
+	}
+	return client.ID()
+}
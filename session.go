@@ -0,0 +1,105 @@
+package main
+
+import (
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+const msgSessionSummary = "client.session"
+
+// session counts the activity of the current connection of a player.
+type session struct {
+	connectedAt  time.Time
+	lastActivity time.Time // of the last publish or RPC, the connection until then
+	publishes    int
+	rpcs         int
+}
+
+// SessionSummary describes a closed client session. It is logged on
+// disconnect and, with StatsConfig.Sessions, is the payload of
+// msgSessionSummary.
+type SessionSummary struct {
+	Client      string    `json:"client"`
+	User        string    `json:"user"`
+	ConnectedAt time.Time `json:"connected_at"`
+	// Duration is the session length in seconds.
+	Duration  float64 `json:"duration"`
+	Publishes int     `json:"publishes"`
+	RPCs      int     `json:"rpcs"`
+	State     string  `json:"state"`
+	Code      uint32  `json:"code"`
+	Reason    string  `json:"reason"`
+}
+
+// startSession resets the activity counters for a new connection.
+func (p *Player) startSession() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	p.session = session{connectedAt: now, lastActivity: now}
+}
+
+func (p *Player) countPublish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.session.publishes++
+	p.session.lastActivity = time.Now()
+}
+
+func (p *Player) countRPC() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.session.rpcs++
+	p.session.lastActivity = time.Now()
+}
+
+// activity returns when the current connection started and when it was
+// last active.
+func (p *Player) activity() (connectedAt, lastActivity time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.session.connectedAt, p.session.lastActivity
+}
+
+// summary returns the summary of the current session, closed for reason.
+func (p *Player) summary(code uint32, reason string) SessionSummary {
+	state := p.FSM.Current()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return SessionSummary{
+		Client:      p.id,
+		User:        p.UserID,
+		ConnectedAt: p.session.connectedAt,
+		Duration:    time.Since(p.session.connectedAt).Seconds(),
+		Publishes:   p.session.publishes,
+		RPCs:        p.session.rpcs,
+		State:       state,
+		Code:        code,
+		Reason:      reason,
+	}
+}
+
+// countActivity calls count with the player of clientID, if any, and
+// restarts its inactivity timer.
+func (s *Server) countActivity(clientID string, count func(*Player)) {
+	s.idle.active(clientID)
+	if p, ok := s.players.Get(clientID); ok {
+		count(p)
+	}
+}
+
+// summarizeSession logs the summary of the session of clientID closed by e
+// and publishes it to the stats channel if configured.
+func (s *Server) summarizeSession(clientID string, e centrifuge.DisconnectEvent) {
+	p, ok := s.players.Get(clientID)
+	if !ok {
+		return
+	}
+	sum := p.summary(e.Disconnect.Code, e.Reason)
+	log.Info().Msgf("client %s session: %.3fs since %s, %d publishes, %d rpcs, player %s, closed with %d (%s)",
+		clientID, sum.Duration, sum.ConnectedAt.Format(time.RFC3339), sum.Publishes, sum.RPCs, sum.State, sum.Code, sum.Reason)
+	if s.config.Stats.Sessions && s.config.Stats.Channel != "" {
+		_ = s.publishMessage(s.config.Stats.Channel, msgSessionSummary, sum)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+const (
+	msgGameSetup  = "game.setup"
+	msgGameKicked = "game.kicked"
+)
+
+// setupEvent is the payload of msgGameSetup. The setups themselves are not
+// published.
+type setupEvent struct {
+	Room      string `json:"room"`
+	Player    string `json:"player"`
+	Submitted int    `json:"submitted"`
+	Players   int    `json:"players"`
+}
+
+// kickedEvent is the payload of msgGameKicked.
+type kickedEvent struct {
+	Room   string `json:"room"`
+	Player string `json:"player"`
+	Reason string `json:"reason"`
+}
+
+// SubmitSetup records the setup of a player of the game and returns how
+// many of them submitted theirs so far.
+func (r *Room) SubmitSetup(clientID string, setup []byte) (submitted, players int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.inTurnOrder(clientID) {
+		return 0, 0, fmt.Errorf("%w: %s doesn't play in room %s", ErrPlayerNotFound, clientID, r.ID)
+	}
+	r.setups[clientID] = append(json.RawMessage{}, setup...)
+	return len(r.setups), len(r.turnOrder), nil
+}
+
+// setupComplete guards begin until every player submitted a setup.
+func (r *Room) setupComplete(*TransitionContext) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range r.turnOrder {
+		if _, ok := r.setups[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// closeSetup runs when the setup phase times out: the players who didn't
+// submit get RoomConfig.SetupDefault or are kicked out of the turn order,
+// and left for the server to take out of the room.
+func (r *Room) closeSetup(ctx *TransitionContext) {
+	if ctx.Event != eventSetupTimeout {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order := r.turnOrder[:0]
+	for _, id := range r.turnOrder {
+		_, ok := r.setups[id]
+		switch {
+		case ok:
+		case r.config.SetupDefault != nil:
+			r.setups[id] = r.config.SetupDefault
+		default:
+			r.kicked = append(r.kicked, id)
+			continue
+		}
+		order = append(order, id)
+	}
+	r.turnOrder = order
+	r.turn = 0
+}
+
+// TakeKicked returns the players kicked since the last call.
+func (r *Room) TakeKicked() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kicked := r.kicked
+	r.kicked = nil
+	return kicked
+}
+
+// inTurnOrder must be called with r.mu held.
+func (r *Room) inTurnOrder(clientID string) bool {
+	for _, id := range r.turnOrder {
+		if id == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+type setupRequest struct {
+	Setup json.RawMessage `json:"setup"`
+}
+
+// rpcSetup submits the setup of the caller's player. The game begins once
+// all the players submitted theirs.
+func (s *Server) rpcSetup(client *centrifuge.Client, data []byte) ([]byte, error) {
+	var req setupRequest
+	if err := json.Unmarshal(data, &req); err != nil || len(req.Setup) == 0 {
+		return nil, centrifuge.ErrorBadRequest
+	}
+	p, ok := s.players.Get(client.ID())
+	if !ok {
+		return nil, ErrPlayerNotFound
+	}
+	r, ok := s.rooms.Room(p.Room())
+	if !ok {
+		return nil, fmt.Errorf("%w: player %s is not in a room", ErrRoomNotFound, p.ID())
+	}
+	if state := r.Game.Current(); state != gameSetup {
+		return nil, fmt.Errorf("%w: setup in %s", ErrIllegalTransition, state)
+	}
+	submitted, players, err := r.SubmitSetup(p.ID(), req.Setup)
+	if err != nil {
+		return nil, err
+	}
+	ev := setupEvent{Room: r.ID, Player: p.ID(), Submitted: submitted, Players: players}
+	_ = s.publishMessage(r.Channel(), msgGameSetup, ev)
+	if submitted == players {
+		if err := r.Game.FireWith(eventBegin, clientMetadata(client)); err != nil {
+			log.Warn().Msgf("room %s: game can't begin: %s", r.ID, err.Error())
+		}
+	}
+	return json.Marshal(ev)
+}
+
+// kickPlayers takes the players kicked out of r by the setup timeout out
+// of the room, and finishes the game if too few are left.
+func (s *Server) kickPlayers(r *Room) {
+	for _, id := range r.TakeKicked() {
+		log.Info().Msgf("room %s: %s kicked, no setup submitted", r.ID, id)
+		if err := s.rooms.LeaveRoom(r.ID, id); err != nil {
+			log.Warn().Msgf("room %s: kicked player %s can't leave: %s", r.ID, id, err.Error())
+		}
+		if p, ok := s.players.Get(id); ok && p.Room() == r.ID {
+			p.SetRoom("")
+			if err := p.FSM.Fire(eventReset); err != nil {
+				log.Warn().Msgf("room %s: kicked player %s can't reset: %s", r.ID, id, err.Error())
+			}
+		}
+		_ = s.publishMessage(r.Channel(), msgGameKicked, kickedEvent{Room: r.ID, Player: id, Reason: "setup timeout"})
+	}
+	if r.PlayerCount() < r.config.MinPlayers {
+		if err := r.Game.Fire(eventFinish); err != nil {
+			log.Warn().Msgf("room %s: finish after setup timeout failed: %s", r.ID, err.Error())
+		}
+	}
+}
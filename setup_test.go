@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSetupBeginsOnceAllSubmitted(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.Room.Setup = true })
+	r, players := startGame(t, h, 2)
+	if state := r.Game.Current(); state != gameSetup {
+		t.Fatalf("game %s once started, want %s", state, gameSetup)
+	}
+
+	var ev setupEvent
+	call(t, players[0], "setup", setupRequest{Setup: json.RawMessage(`{"faction":"red"}`)}, &ev)
+	if ev.Submitted != 1 || ev.Players != 2 {
+		t.Errorf("setup reply %+v, want 1 of 2 submitted", ev)
+	}
+	if r.setupComplete(nil) {
+		t.Error("setup complete with a player missing")
+	}
+	if err := r.Game.Fire(eventBegin); err == nil {
+		t.Error("game began with a player missing")
+	}
+
+	call(t, players[1], "setup", setupRequest{Setup: json.RawMessage(`{"faction":"blue"}`)}, nil)
+	if !r.setupComplete(nil) {
+		t.Error("setup not complete once everyone submitted")
+	}
+	if state := r.Game.Current(); state != gamePlaying {
+		t.Errorf("game %s once everyone submitted, want %s", state, gamePlaying)
+	}
+	if code := callError(t, players[0], "setup", setupRequest{Setup: json.RawMessage(`{}`)}); code != CodeIllegalTransition {
+		t.Errorf("setup while playing: code %d, want %d", code, CodeIllegalTransition)
+	}
+}
+
+func TestSetupTimeoutDefaults(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.Room.Setup = true
+		c.Room.SetupTimeout = time.Minute
+		c.Room.SetupDefault = json.RawMessage(`{"faction":"grey"}`)
+	})
+	r, players := startGame(t, h, 2)
+	call(t, players[0], "setup", setupRequest{Setup: json.RawMessage(`{"faction":"red"}`)}, nil)
+	h.Clock.Advance(time.Minute)
+
+	if state := r.Game.Current(); state != gamePlaying {
+		t.Fatalf("game %s after the setup timeout, want %s", state, gamePlaying)
+	}
+	if got := r.PlayerCount(); got != 2 {
+		t.Errorf("%d players after the setup timeout, want 2", got)
+	}
+}
+
+func TestSetupTimeoutKicksEveryone(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.Room.Setup = true
+		c.Room.SetupTimeout = time.Minute
+	})
+	r, players := startGame(t, h, 2)
+	h.Clock.Advance(time.Minute)
+
+	if state := r.Game.Current(); state != gameFinished {
+		t.Errorf("game %s once every player was kicked, want %s", state, gameFinished)
+	}
+	if got := r.PlayerCount(); got != 0 {
+		t.Errorf("%d players left in the room, want none", got)
+	}
+	for _, c := range players {
+		p, _ := h.Server.players.Get(c.ID)
+		if p.Room() != "" || p.FSM.Current() != playerIdle {
+			t.Errorf("kicked player %s in room %q, %s", c.ID, p.Room(), p.FSM.Current())
+		}
+	}
+
+	h.Clock.Advance(h.Server.config.EmptyRoomGrace)
+	if _, ok := h.Server.rooms.Room(r.ID); ok {
+		t.Error("room of the kicked players not destroyed after the grace period")
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// ErrUnknownPhase is returned by AddShutdownPhase when inserting after a
+// phase that doesn't exist.
+var ErrUnknownPhase = errors.New("unknown shutdown phase")
+
+// Phases of Server.Shutdown, in the order they run.
+const (
+	// PhaseStop rejects new connections and stops the periodic tasks.
+	PhaseStop = "stop"
+	// PhaseFreeze freezes every FSM so that no transition starts.
+	PhaseFreeze = "freeze"
+	// PhaseFlush flushes the metrics and the audit log.
+	PhaseFlush = "flush"
+	// PhaseSnapshot saves the games in progress, warns their players and
+	// drains the publish queues.
+	PhaseSnapshot = "snapshot"
+	// PhaseDisconnect disconnects the clients.
+	PhaseDisconnect = "disconnect"
+	// PhaseInternalClients closes the clients of AddInternalClient.
+	PhaseInternalClients = "internal-clients"
+	// PhaseNode shuts the node down, with its in-memory broker, and closes
+	// the audit log.
+	PhaseNode = "node"
+)
+
+// ShutdownPhase is a step of Server.Shutdown.
+type ShutdownPhase struct {
+	Name string
+	// Timeout bounds the phase, Config.ShutdownPhaseTimeout when zero.
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// metricsFlusher is implemented by the Metrics backends buffering their
+// measures, which PhaseFlush flushes.
+type metricsFlusher interface {
+	Flush() error
+}
+
+// shutdownPhases returns the built-in phases of s.
+func (s *Server) shutdownPhases() []ShutdownPhase {
+	return []ShutdownPhase{
+		{Name: PhaseStop, Run: s.stop},
+		{Name: PhaseFreeze, Run: func(context.Context) error {
+			s.freezeAll()
+			return nil
+		}},
+		{Name: PhaseFlush, Run: s.flush},
+		{Name: PhaseSnapshot, Run: func(context.Context) error {
+			// The restart warnings are published before the queues close.
+			defer s.pub.Close()
+			return s.snapshotGames()
+		}},
+		{Name: PhaseDisconnect, Run: s.disconnectClients},
+		{Name: PhaseInternalClients, Run: s.closeInternalClients},
+		{Name: PhaseNode, Run: func(ctx context.Context) error {
+			err := s.node.Shutdown(ctx)
+			if s.auditFile != nil {
+				if cerr := s.auditFile.Close(); cerr != nil {
+					log.Warn().Msgf("error closing audit log: %s", cerr.Error())
+				}
+			}
+			return err
+		}},
+	}
+}
+
+// AddShutdownPhase inserts phase right after the phase named after, or
+// first if after is empty, e.g. to close an external broker after
+// PhaseNode.
+func (s *Server) AddShutdownPhase(after string, phase ShutdownPhase) error {
+	if phase.Name == "" || phase.Run == nil {
+		return errors.New("shutdown phase without a name or a function")
+	}
+	s.shutdownMu.Lock()
+	defer s.shutdownMu.Unlock()
+	at := -1
+	if after == "" {
+		at = 0
+	}
+	for i, p := range s.phases {
+		if p.Name == phase.Name {
+			return fmt.Errorf("shutdown phase %q already exists", phase.Name)
+		}
+		if p.Name == after {
+			at = i + 1
+		}
+	}
+	if at < 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownPhase, after)
+	}
+	s.phases = append(s.phases[:at], append([]ShutdownPhase{phase}, s.phases[at:]...)...)
+	return nil
+}
+
+// ShutdownPhases returns the names of the phases of Shutdown, in order.
+func (s *Server) ShutdownPhases() []string {
+	s.shutdownMu.Lock()
+	defer s.shutdownMu.Unlock()
+	names := make([]string, len(s.phases))
+	for i, p := range s.phases {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// AddInternalClient registers a client of the server itself, closed by
+// PhaseInternalClients.
+func (s *Server) AddInternalClient(c *GameClient) {
+	s.shutdownMu.Lock()
+	defer s.shutdownMu.Unlock()
+	s.internal = append(s.internal, c)
+}
+
+// Shutdown runs the shutdown phases in order, each within its timeout and
+// the deadline of ctx. A phase failing or timing out is logged and the
+// next ones still run, so that everything is cleaned up. It returns the
+// errors of the failed phases.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownMu.Lock()
+	phases := append([]ShutdownPhase{}, s.phases...)
+	s.shutdownMu.Unlock()
+
+	var errs []error
+	for _, phase := range phases {
+		start := time.Now()
+		if err := s.runPhase(ctx, phase); err != nil {
+			log.Error().Msgf("shutdown phase %s failed after %s: %s", phase.Name, time.Since(start), err.Error())
+			errs = append(errs, fmt.Errorf("%s: %w", phase.Name, err))
+			continue
+		}
+		log.Info().Msgf("shutdown phase %s done in %s", phase.Name, time.Since(start))
+	}
+	return errors.Join(errs...)
+}
+
+// runPhase runs phase, giving up on it once its timeout elapsed. A phase
+// given up on goes on in the background.
+func (s *Server) runPhase(ctx context.Context, phase ShutdownPhase) error {
+	timeout := phase.Timeout
+	if timeout == 0 {
+		timeout = s.config.ShutdownPhaseTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- phase.Run(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stop rejects new connections and stops the periodic tasks.
+func (s *Server) stop(context.Context) error {
+	if !s.stopping.Swap(true) {
+		close(s.done)
+	}
+	return nil
+}
+
+// flush flushes the metrics backend and syncs the audit log to disk.
+func (s *Server) flush(context.Context) error {
+	var errs []error
+	if f, ok := s.config.Metrics.(metricsFlusher); ok {
+		if err := f.Flush(); err != nil {
+			errs = append(errs, fmt.Errorf("metrics: %w", err))
+		}
+	}
+	if f, ok := s.auditFile.(interface{ Sync() error }); ok {
+		if err := f.Sync(); err != nil {
+			errs = append(errs, fmt.Errorf("audit log: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// disconnectClients disconnects every client of the node.
+func (s *Server) disconnectClients(context.Context) error {
+	clients := s.node.Hub().Connections()
+	for _, client := range clients {
+		client.Disconnect(centrifuge.DisconnectShutdown)
+	}
+	log.Info().Msgf("%d clients disconnected", len(clients))
+	return nil
+}
+
+// closeInternalClients closes the clients of AddInternalClient.
+func (s *Server) closeInternalClients(context.Context) error {
+	s.shutdownMu.Lock()
+	clients := s.internal
+	s.internal = nil
+	s.shutdownMu.Unlock()
+	for _, c := range clients {
+		c.Close()
+	}
+	return nil
+}
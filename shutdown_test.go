@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAddShutdownPhase(t *testing.T) {
+	h := newHarness(t, nil)
+	noop := func(context.Context) error { return nil }
+	if err := h.Server.AddShutdownPhase(PhaseNode, ShutdownPhase{Name: "broker", Run: noop}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Server.AddShutdownPhase("", ShutdownPhase{Name: "drain", Run: noop}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"drain", PhaseStop, PhaseFreeze, PhaseFlush, PhaseSnapshot, PhaseDisconnect, PhaseInternalClients, PhaseNode, "broker"}
+	if got := h.Server.ShutdownPhases(); !reflect.DeepEqual(got, want) {
+		t.Errorf("phases %v, want %v", got, want)
+	}
+
+	if err := h.Server.AddShutdownPhase("missing", ShutdownPhase{Name: "x", Run: noop}); !errors.Is(err, ErrUnknownPhase) {
+		t.Errorf("after a missing phase: %v, want %v", err, ErrUnknownPhase)
+	}
+	if err := h.Server.AddShutdownPhase(PhaseStop, ShutdownPhase{Name: "broker", Run: noop}); err == nil {
+		t.Error("duplicate phase added")
+	}
+	if err := h.Server.AddShutdownPhase(PhaseStop, ShutdownPhase{Name: "nil"}); err == nil {
+		t.Error("phase without a function added")
+	}
+}
+
+func TestShutdownRunsEveryPhase(t *testing.T) {
+	h := newHarness(t, nil)
+	var mu sync.Mutex
+	var ran []string
+	record := func(name string, err error) ShutdownPhase {
+		return ShutdownPhase{Name: name, Run: func(context.Context) error {
+			mu.Lock()
+			ran = append(ran, name)
+			mu.Unlock()
+			return err
+		}}
+	}
+	failed := errors.New("failed")
+	phases := []struct {
+		after string
+		phase ShutdownPhase
+	}{
+		{PhaseStop, record("failing", failed)},
+		{PhaseFreeze, ShutdownPhase{Name: "panicking", Run: func(context.Context) error { panic("boom") }}},
+		{PhaseFlush, ShutdownPhase{Name: "slow", Timeout: 10 * time.Millisecond, Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(time.Second)
+			return nil
+		}}},
+		{PhaseNode, record("last", nil)},
+		{"", record("first", nil)},
+	}
+	for _, p := range phases {
+		if err := h.Server.AddShutdownPhase(p.after, p.phase); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := h.Close()
+	if !errors.Is(err, failed) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("shutdown error %v, want the failing and slow phases", err)
+	}
+	if want := []string{"first", "failing", "last"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %v, want %v", ran, want)
+	}
+	if !h.Server.stopping.Load() {
+		t.Error("stop phase didn't run")
+	}
+}
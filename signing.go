@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/centrifugal/centrifuge"
+	centrigo "github.com/centrifugal/centrifuge-go"
+)
+
+var (
+	// ErrUnsigned is returned for unsigned messages and RPCs of clients
+	// that must sign them.
+	ErrUnsigned = errors.New("message not signed")
+	// ErrBadSignature is returned for messages and RPCs whose signature
+	// doesn't match.
+	ErrBadSignature = errors.New("bad message signature")
+)
+
+// SigningConfig holds the settings of the HMAC signing of the messages of
+// trusted clients, such as internal bots, so that a compromised
+// intermediary can't forge or alter them.
+type SigningConfig struct {
+	// Key is the HMAC-SHA256 key shared with the clients, ClientOptions.
+	// SigningKey on their side.
+	Key []byte
+	// Roles are the connection roles whose publications and RPCs must be
+	// signed, none when empty.
+	Roles []string
+}
+
+func (c SigningConfig) validate() error {
+	if len(c.Roles) > 0 && len(c.Key) == 0 {
+		return errors.New("message signing required without a key")
+	}
+	return nil
+}
+
+// rpcSignatureField is the field of a signed RPC payload holding its
+// signature, in base64.
+const rpcSignatureField = "sig"
+
+// signMessage returns msg signed with key. Its JSON payload is compacted
+// first, as encoding the envelope does, so that the signature survives the
+// encoding.
+func signMessage(key []byte, msg Message) Message {
+	if len(msg.Payload) > 0 {
+		if payload, err := json.Marshal(msg.Payload); err == nil {
+			msg.Payload = payload
+		}
+	}
+	msg.Signature = messageMAC(key, msg)
+	return msg
+}
+
+// verifyMessage checks the signature of msg.
+func verifyMessage(key []byte, msg Message) error {
+	if len(msg.Signature) == 0 {
+		return ErrUnsigned
+	}
+	if !hmac.Equal(msg.Signature, messageMAC(key, msg)) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// messageMAC signs the protobuf encoding of msg without its signature,
+// which is deterministic.
+func messageMAC(key []byte, msg Message) []byte {
+	msg.Signature = nil
+	mac := hmac.New(sha256.New, key)
+	mac.Write(marshalMessageProto(msg))
+	return mac.Sum(nil)
+}
+
+// signRPC returns the payload of an RPC call of method, which must be empty
+// or a JSON object, with its signature.
+func signRPC(key []byte, method string, data []byte) ([]byte, error) {
+	fields, sig, err := rpcFields(data)
+	if err != nil {
+		return nil, fmt.Errorf("rpc payload is not an object, not signed: %w", err)
+	}
+	if sig != nil {
+		return nil, fmt.Errorf("rpc payload has a %s field, not signed", rpcSignatureField)
+	}
+	mac, err := rpcMAC(key, method, fields)
+	if err != nil {
+		return nil, err
+	}
+	if fields[rpcSignatureField], err = json.Marshal(mac); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// verifyRPC checks the signature of the payload of an RPC call of method.
+func verifyRPC(key []byte, method string, data []byte) error {
+	fields, sig, err := rpcFields(data)
+	if err != nil || sig == nil {
+		return ErrUnsigned
+	}
+	var got []byte
+	if err := json.Unmarshal(sig, &got); err != nil {
+		return ErrBadSignature
+	}
+	mac, err := rpcMAC(key, method, fields)
+	if err != nil || !hmac.Equal(got, mac) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// rpcFields splits an RPC payload into its fields and its signature.
+func rpcFields(data []byte) (map[string]json.RawMessage, json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, nil, err
+		}
+	}
+	sig := fields[rpcSignatureField]
+	delete(fields, rpcSignatureField)
+	return fields, sig, nil
+}
+
+// rpcMAC signs method and fields encoded as JSON, which sorts their keys
+// and compacts their values.
+func rpcMAC(key []byte, method string, fields map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(method))
+	mac.Write([]byte{0})
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+// mustSign reports whether the messages of client must be signed, as its
+// role requires.
+func (s *Server) mustSign(client *centrifuge.Client) bool {
+	if len(s.config.Signing.Roles) == 0 {
+		return false
+	}
+	role := s.roles.role(roleKey(client.UserID(), client.ID()))
+	for _, r := range s.config.Signing.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyPublication checks the signature of the envelope data published by
+// client, if it must be signed.
+func (s *Server) verifyPublication(client *centrifuge.Client, data []byte) error {
+	if !s.mustSign(client) {
+		return nil
+	}
+	msg, err := unmarshalMessage(client.Transport().Protocol(), data)
+	if err != nil {
+		return ErrUnsigned
+	}
+	return verifyMessage(s.config.Signing.Key, msg)
+}
+
+// verifyCall checks the signature of an RPC call of client, if it must be
+// signed.
+func (s *Server) verifyCall(client *centrifuge.Client, method string, data []byte) error {
+	if !s.mustSign(client) {
+		return nil
+	}
+	return verifyRPC(s.config.Signing.Key, method, data)
+}
+
+// RPC calls method with data, signing the call when the client has a
+// signing key. The room keys of the replies are recorded.
+func (c *GameClient) RPC(ctx context.Context, method string, data []byte) (centrigo.RPCResult, error) {
+	if len(c.signingKey) > 0 {
+		var err error
+		if data, err = signRPC(c.signingKey, method, data); err != nil {
+			return centrigo.RPCResult{}, err
+		}
+	}
+	res, err := c.Client.RPC(ctx, method, data)
+	if err == nil {
+		c.recordRoomKey(res.Data)
+	}
+	return res, err
+}
+
+// PublishMessage publishes msg to channel, signed when the client has a
+// signing key.
+func (c *GameClient) PublishMessage(ctx context.Context, channel string, msg Message) error {
+	if len(c.signingKey) > 0 {
+		msg = signMessage(c.signingKey, msg)
+	}
+	data, err := marshalMessage(c.protocol, msg)
+	if err != nil {
+		return err
+	}
+	_, err = c.Client.Publish(ctx, channel, data)
+	return err
+}
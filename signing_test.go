@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+var testSigningKey = []byte("shared secret")
+
+func TestVerifyMessage(t *testing.T) {
+	signed := signMessage(testSigningKey, Message{Type: msgChat, Payload: json.RawMessage(`{ "text": "hi" }`), Seq: 3})
+	tampered := signed
+	tampered.Payload = json.RawMessage(`{"text":"bye"}`)
+	unsigned := signed
+	unsigned.Signature = nil
+	for _, tc := range []struct {
+		name string
+		key  []byte
+		msg  Message
+		want error
+	}{
+		{"valid", testSigningKey, signed, nil},
+		{"missing", testSigningKey, unsigned, ErrUnsigned},
+		{"tampered", testSigningKey, tampered, ErrBadSignature},
+		{"other key", []byte("other"), signed, ErrBadSignature},
+	} {
+		if err := verifyMessage(tc.key, tc.msg); !errors.Is(err, tc.want) {
+			t.Errorf("%s: %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	// The signature survives the encoding of the envelope.
+	for _, proto := range []centrifuge.ProtocolType{centrifuge.ProtocolTypeJSON, centrifuge.ProtocolTypeProtobuf} {
+		data, err := marshalMessage(proto, signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := unmarshalMessage(proto, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := verifyMessage(testSigningKey, decoded); err != nil {
+			t.Errorf("decoded %s envelope: %v", proto, err)
+		}
+	}
+}
+
+func TestVerifyRPC(t *testing.T) {
+	signed, err := signRPC(testSigningKey, "joinRoom", []byte(`{"room":"r1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(signed, &fields); err != nil {
+		t.Fatal(err)
+	}
+	fields["room"] = json.RawMessage(`"r2"`)
+	tampered, _ := json.Marshal(fields)
+	for _, tc := range []struct {
+		name   string
+		method string
+		data   []byte
+		want   error
+	}{
+		{"valid", "joinRoom", signed, nil},
+		{"missing", "joinRoom", []byte(`{"room":"r1"}`), ErrUnsigned},
+		{"empty", "joinRoom", nil, ErrUnsigned},
+		{"tampered", "joinRoom", tampered, ErrBadSignature},
+		{"other method", "leaveRoom", signed, ErrBadSignature},
+		{"bad encoding", "joinRoom", []byte(`{"room":"r1","sig":12}`), ErrBadSignature},
+	} {
+		if err := verifyRPC(testSigningKey, tc.method, tc.data); !errors.Is(err, tc.want) {
+			t.Errorf("%s: %v, want %v", tc.name, err, tc.want)
+		}
+	}
+	if _, err := signRPC(testSigningKey, "move", []byte(`[1]`)); err == nil {
+		t.Error("payload other than an object signed")
+	}
+}
+
+func TestSignedRoles(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.Signing = SigningConfig{Key: testSigningKey, Roles: []string{RoleReferee}}
+	})
+	referee := connect(t, h, "referee")
+	player := connect(t, h, "player")
+
+	// Players needn't sign.
+	call(t, player, "role", nil, nil)
+	if err := player.Publish(serverChannel, Message{Type: msgChat}); err != nil {
+		t.Errorf("unsigned player publication: %v", err)
+	}
+
+	signed, err := signRPC(testSigningKey, "role", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply roleReply
+	call(t, referee, "role", json.RawMessage(signed), &reply)
+	if reply.Role != RoleReferee {
+		t.Fatalf("role %s, want %s", reply.Role, RoleReferee)
+	}
+	if code := callError(t, referee, "role", nil); code != CodePermissionDenied {
+		t.Errorf("unsigned RPC: code %d, want %d", code, CodePermissionDenied)
+	}
+	forged, _ := signRPC([]byte("other"), "role", nil)
+	if code := callError(t, referee, "role", json.RawMessage(forged)); code != CodePermissionDenied {
+		t.Errorf("badly signed RPC: code %d, want %d", code, CodePermissionDenied)
+	}
+
+	msg := signMessage(testSigningKey, Message{Type: msgChat, Payload: json.RawMessage(`{"text":"hi"}`)})
+	if err := referee.Publish(serverChannel, msg); err != nil {
+		t.Errorf("signed publication: %v", err)
+	}
+	tampered := msg
+	tampered.Payload = json.RawMessage(`{"text":"bye"}`)
+	for name, m := range map[string]Message{"unsigned": {Type: msgChat}, "tampered": tampered} {
+		if err := referee.Publish(serverChannel, m); errorCode(err) != CodePermissionDenied {
+			t.Errorf("%s publication: %v, want code %d", name, err, CodePermissionDenied)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// gamesSnapshotKey is the StateStore key of the games saved on shutdown.
+	gamesSnapshotKey = "games"
+
+	msgServerRestart = "server.restart"
+)
+
+// GameSnapshot is an in-progress game saved on shutdown.
+type GameSnapshot struct {
+	Room      string           `json:"room"`
+	Owner     string           `json:"owner"`
+	State     string           `json:"state"`
+	Players   []PlayerSnapshot `json:"players"`
+	TurnOrder []string         `json:"turn_order"`
+	Turn      int              `json:"turn"`
+	Seq       uint64           `json:"seq"`
+	SavedAt   time.Time        `json:"saved_at"`
+	// Elapsed is the playing time of the game when saved, which counts
+	// against MaxDuration after the restart too.
+	Elapsed  time.Duration   `json:"elapsed,omitempty"`
+	Topology ChannelTopology `json:"topology,omitempty"`
+	// Key is the key of encrypted rooms, for their players to keep reading
+	// them after the restart.
+	Key []byte `json:"key,omitempty"`
+}
+
+// PlayerSnapshot is a player of a GameSnapshot. Only players with a user
+// ID can claim their seat back after a restart.
+type PlayerSnapshot struct {
+	Client string `json:"client"`
+	User   string `json:"user,omitempty"`
+	State  string `json:"state"`
+	Ready  bool   `json:"ready"`
+}
+
+// restartEvent is the payload of msgServerRestart.
+type restartEvent struct {
+	Room    string `json:"room"`
+	Message string `json:"message"`
+}
+
+// snapshotGames saves the games being played or paused to the state store
+// and tells their players about the restart. FSMs must be frozen so the
+// games don't move while saved.
+func (s *Server) snapshotGames() error {
+	var games []GameSnapshot
+	for _, r := range s.rooms.Rooms() {
+		state := r.Game.Current()
+		if state != gamePlaying && state != gamePaused {
+			continue
+		}
+		// Published first so that the sequence number saved counts it.
+		_ = s.publishMessage(r.Channel(), msgServerRestart, restartEvent{Room: r.ID, Message: s.config.RestartMessage})
+		games = append(games, s.snapshotGame(r, state))
+	}
+	data, err := encodeSnapshot(s.codec, games)
+	if err != nil {
+		return fmt.Errorf("games serialization error: %w", err)
+	}
+	if err := s.store.Save(gamesSnapshotKey, data); err != nil {
+		return fmt.Errorf("games snapshot error: %w", err)
+	}
+	log.Info().Msgf("%d in-progress games saved", len(games))
+	return nil
+}
+
+func (s *Server) snapshotGame(r *Room, state string) GameSnapshot {
+	snap := GameSnapshot{Room: r.ID, Owner: s.rooms.Owner(r.ID), State: state, Seq: r.Seq(), SavedAt: time.Now().UTC(), Topology: r.Topology(), Key: r.Key()}
+	r.mu.Lock()
+	if !r.startedAt.IsZero() {
+		snap.Elapsed = r.clock.Now().Sub(r.startedAt)
+	}
+	ready := make(map[string]bool, len(r.players))
+	for id, ok := range r.players {
+		ready[id] = ok
+	}
+	snap.TurnOrder = append([]string{}, r.turnOrder...)
+	snap.Turn = r.turn
+	r.mu.Unlock()
+
+	for id, ok := range ready {
+		ps := PlayerSnapshot{Client: id, Ready: ok}
+		if p, found := s.players.Get(id); found {
+			ps.User = p.UserID
+			ps.State = p.FSM.Current()
+		}
+		snap.Players = append(snap.Players, ps)
+	}
+	return snap
+}
+
+// RestoreGames recreates the games saved by the previous shutdown. Their
+// players get their seats back when their user reconnects.
+func (s *Server) RestoreGames() (int, error) {
+	data, err := s.store.Load(gamesSnapshotKey)
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var games []GameSnapshot
+	if err := decodeSnapshot(data, &games); err != nil {
+		return 0, fmt.Errorf("games snapshot deserialization error: %w", err)
+	}
+	restored := 0
+	for _, snap := range games {
+		if _, err := s.rooms.Restore(snap); err != nil {
+			log.Warn().Msgf("room %s: not restored: %s", snap.Room, err.Error())
+			continue
+		}
+		restored++
+	}
+	// Restored once only: a crash mustn't bring back finished games.
+	empty, err := encodeSnapshot(s.codec, []GameSnapshot{})
+	if err != nil {
+		return restored, err
+	}
+	if err := s.store.Save(gamesSnapshotKey, empty); err != nil {
+		return restored, err
+	}
+	return restored, nil
+}
+
+// Restore recreates the room of snap with its game and seats. It fails if
+// the state of the game can't be restored, as RoomConfig.Restore decides.
+func (g *RoomRegistry) Restore(snap GameSnapshot) (*Room, error) {
+	r := newRoom(snap.Room, g.config, g.clock)
+	// Checked before the room is registered; the state itself is restored
+	// once the hooks are, so that they see its timeouts.
+	if !r.Game.HasState(snap.State) && g.config.Restore.Policy != RestoreFallback {
+		return nil, fmt.Errorf("%w: %q can't be restored", ErrUnknownState, snap.State)
+	}
+	for _, p := range snap.Players {
+		r.addPlayer(p.Client, p.Ready)
+	}
+	r.turnOrder = snap.TurnOrder
+	if snap.Turn < len(snap.TurnOrder) {
+		r.turn = snap.Turn
+	}
+	r.seq = snap.Seq
+	r.key = snap.Key
+	if snap.Topology != "" {
+		if err := r.SetTopology(snap.Topology); err != nil {
+			return nil, err
+		}
+	}
+
+	g.mu.Lock()
+	for _, p := range snap.Players {
+		if p.User != "" {
+			g.seats[p.User] = seat{room: r.ID, client: p.Client, state: p.State}
+		}
+	}
+	hooks := g.insert(r, snap.Owner)
+	// Until a player claims a seat, as for a room nobody joined.
+	g.scheduleDestroy(r)
+	g.mu.Unlock()
+	for _, fn := range hooks {
+		fn(r)
+	}
+	_ = r.Game.Restore(snap.State) // known, or falls back
+	if state := r.Game.Current(); state == gamePlaying || state == gamePaused {
+		r.mu.Lock()
+		r.startedAt = g.clock.Now().Add(-snap.Elapsed)
+		r.armExpiry(r.config.MaxDuration - snap.Elapsed)
+		r.mu.Unlock()
+	}
+	log.Info().Msgf("room %s: restored in %s with %d players", r.ID, r.Game.Current(), len(snap.Players))
+	return r, nil
+}
+
+// seat is the place of a player in a restored game.
+type seat struct {
+	room   string
+	client string // client ID before the restart
+	state  string // Player FSM state
+}
+
+// ClaimSeat returns the seat userID had in a restored game, if any, and
+// moves it to the connection clientID. The room is then kept.
+func (g *RoomRegistry) ClaimSeat(userID, clientID string) (*Room, seat, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	st, ok := g.seats[userID]
+	if !ok {
+		return nil, seat{}, false
+	}
+	delete(g.seats, userID)
+	r, ok := g.rooms[st.room]
+	if !ok {
+		return nil, seat{}, false
+	}
+	r.Rename(st.client, clientID)
+	g.cancelDestroy(r.ID, clientID)
+	return r, st, true
+}
+
+// Owner returns the owner of the room id.
+func (g *RoomRegistry) Owner(id string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.owners[id]
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownCodec is returned for snapshots or configs naming a codec that
+// isn't registered.
+var ErrUnknownCodec = errors.New("unknown snapshot codec")
+
+// SnapshotCodec serializes snapshots. JSON is portable, gob is faster for
+// Go-to-Go persistence.
+type SnapshotCodec interface {
+	// Name is recorded in the header of the snapshots the codec encodes.
+	Name() string
+	Encode(v any) ([]byte, error)
+	Decode(data []byte, v any) error
+}
+
+// snapshotCodecs are the codecs Config.SnapshotCodec can name.
+var snapshotCodecs = map[string]SnapshotCodec{
+	"json": jsonCodec{},
+	"gob":  gobCodec{},
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                    { return "json" }
+func (jsonCodec) Encode(v any) ([]byte, error)    { return json.Marshal(v) }
+func (jsonCodec) Decode(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Encode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Decode(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// snapshotCodec returns the codec registered as name, JSON when empty.
+func snapshotCodec(name string) (SnapshotCodec, error) {
+	if name == "" {
+		return jsonCodec{}, nil
+	}
+	c, ok := snapshotCodecs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, name)
+	}
+	return c, nil
+}
+
+// encodeSnapshot encodes v with c behind a header line naming c.
+func encodeSnapshot(c SnapshotCodec, v any) ([]byte, error) {
+	data, err := c.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(c.Name()+"\n"), data...), nil
+}
+
+// decodeSnapshot decodes data into v with the codec named by its header.
+// Snapshots without a header predate codecs and are JSON.
+func decodeSnapshot(data []byte, v any) error {
+	name, payload, ok := bytes.Cut(data, []byte("\n"))
+	if !ok || len(name) == 0 || name[0] == '[' || name[0] == '{' {
+		return json.Unmarshal(data, v)
+	}
+	c, err := snapshotCodec(string(name))
+	if err != nil {
+		return err
+	}
+	return c.Decode(payload, v)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshotCodecRoundTrip(t *testing.T) {
+	snap := GameSnapshot{
+		Room:  "r1",
+		Owner: "user0",
+		State: gamePlaying,
+		Players: []PlayerSnapshot{
+			{Client: "c0", User: "user0", State: playerPlaying, Ready: true},
+			{Client: "c1", User: "user1", State: playerPlaying, Ready: true},
+		},
+		TurnOrder: []string{"c1", "c0"},
+		Turn:      1,
+		Seq:       42,
+		SavedAt:   time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Elapsed:   90 * time.Second,
+		Topology:  TopologySplit,
+		Key:       []byte("0123456789abcdef"),
+	}
+	for _, name := range []string{"json", "gob"} {
+		t.Run(name, func(t *testing.T) {
+			c, err := snapshotCodec(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := encodeSnapshot(c, snap)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(data, []byte(name+"\n")) {
+				t.Errorf("snapshot %q without a %q header line", data, name)
+			}
+			var got GameSnapshot
+			if err := decodeSnapshot(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, snap) {
+				t.Errorf("decoded %+v, want %+v", got, snap)
+			}
+		})
+	}
+}
+
+func TestDecodeSnapshotWithoutHeader(t *testing.T) {
+	var got GameSnapshot
+	if err := decodeSnapshot([]byte(`{"room":"r1","state":"playing"}`), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Room != "r1" || got.State != gamePlaying {
+		t.Errorf("decoded %+v", got)
+	}
+}
+
+func TestUnknownSnapshotCodec(t *testing.T) {
+	if _, err := snapshotCodec("yaml"); !errors.Is(err, ErrUnknownCodec) {
+		t.Errorf("codec yaml: %v, want %v", err, ErrUnknownCodec)
+	}
+	var got GameSnapshot
+	if err := decodeSnapshot([]byte("yaml\nroom: r1\n"), &got); !errors.Is(err, ErrUnknownCodec) {
+		t.Errorf("decode a yaml snapshot: %v, want %v", err, ErrUnknownCodec)
+	}
+}
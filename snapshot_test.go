@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	if _, err := store.Load("roster:node"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("load of a missing key: %v, want %v", err, ErrNotFound)
+	}
+	for _, data := range []string{"first", "second"} {
+		if err := store.Save("roster:node", []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Load("roster:node")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Errorf("loaded %q, want %q", got, data)
+		}
+	}
+}
+
+func TestRestoredGameKeepsMaxDuration(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	configure := func(c *Config) {
+		c.Store = store
+		c.RestoreGames = true
+		c.Room.MaxDuration = 10 * time.Minute
+		c.Room.TurnTimeout = 0
+	}
+	h := newHarness(t, configure)
+	r, _ := startGame(t, h, 2)
+	h.Clock.Advance(4 * time.Minute)
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	h = newHarness(t, configure)
+	restored, ok := h.Server.rooms.Room(r.ID)
+	if !ok {
+		t.Fatal("game not restored from the file store")
+	}
+	if restored.Game.Current() != gamePlaying {
+		t.Fatalf("restored game %s, want %s", restored.Game.Current(), gamePlaying)
+	}
+	// A player reconnecting keeps the game past EmptyRoomGrace.
+	connect(t, h, "user0")
+	h.Clock.Advance(5 * time.Minute)
+	if restored.Game.Current() != gamePlaying {
+		t.Fatalf("restored game %s before its MaxDuration", restored.Game.Current())
+	}
+	h.Clock.Advance(time.Minute)
+	if restored.Game.Current() != gameFinished {
+		t.Errorf("restored game %s after its MaxDuration, want %s", restored.Game.Current(), gameFinished)
+	}
+}
+
+func TestUnclaimedRestoredGameDestroyed(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	configure := func(c *Config) {
+		c.Store = store
+		c.RestoreGames = true
+	}
+	h := newHarness(t, configure)
+	r, _ := startGame(t, h, 2)
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	h = newHarness(t, configure)
+	if _, ok := h.Server.rooms.Room(r.ID); !ok {
+		t.Fatal("game not restored from the file store")
+	}
+	grace := h.Server.config.EmptyRoomGrace
+	h.Clock.Advance(grace)
+	if _, ok := h.Server.rooms.Room(r.ID); ok {
+		t.Fatalf("restored game kept %s without a claimed seat", grace)
+	}
+	// The seats went with the room.
+	if _, _, ok := h.Server.rooms.ClaimSeat("user0", "late"); ok {
+		t.Error("seat of a destroyed game claimed")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// StateMachine is what the server needs of a player's state machine, so
+// other implementations, e.g. hierarchical machines, can be plugged in with
+// Config.PlayerMachine. FSM is the default one.
+//
+// The server also uses the optional FireWith, Snapshot, Restore, SetRestore,
+// Freeze, SetClock and Close methods of FSM when a StateMachine has them.
+type StateMachine interface {
+	Current() string
+	Fire(event string) error
+	CanFire(event string) bool
+	OnTransition(fn func(Transition))
+}
+
+var _ StateMachine = (*FSM)(nil)
+
+// fireWith fires event on m, passing metadata if m accepts it.
+func fireWith(m StateMachine, event string, metadata map[string]any) error {
+	if m, ok := m.(interface {
+		FireWith(event string, metadata map[string]any) error
+	}); ok {
+		return m.FireWith(event, metadata)
+	}
+	return m.Fire(event)
+}
+
+// snapshotState returns the state of m and when it was entered, the zero
+// time if m doesn't tell.
+func snapshotState(m StateMachine) (string, time.Time) {
+	if m, ok := m.(interface{ Snapshot() (string, time.Time) }); ok {
+		return m.Snapshot()
+	}
+	return m.Current(), time.Time{}
+}
+
+// restoreState puts m in state without a transition. It fails if m
+// doesn't support it, or as its restore policy decides for an unknown state.
+func restoreState(m StateMachine, state string) error {
+	switch m := m.(type) {
+	case interface{ Restore(state string) error }:
+		return m.Restore(state)
+	case interface{ Restore(state string) }:
+		m.Restore(state)
+		return nil
+	}
+	return errors.New("machine does not support restoring")
+}
+
+// freezeState stops m from accepting events, if it supports it.
+func freezeState(m StateMachine) {
+	if m, ok := m.(interface{ Freeze() }); ok {
+		m.Freeze()
+	}
+}
+
+// setRestore sets the restore policy of m, if it supports it.
+func setRestore(m StateMachine, config RestoreConfig) error {
+	if m, ok := m.(interface {
+		SetRestore(config RestoreConfig) error
+	}); ok {
+		return m.SetRestore(config)
+	}
+	return nil
+}
+
+// closeState disposes of m, if it supports it.
+func closeState(m StateMachine) {
+	if m, ok := m.(interface{ Close() }); ok {
+		m.Close()
+	}
+}
+
+// setClock makes m run on c, if it supports it.
+func setClock(m StateMachine, c Clock) {
+	if m, ok := m.(interface{ SetClock(c Clock) }); ok {
+		m.SetClock(c)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// mapMachine is a minimal StateMachine, without any of the optional
+// methods of FSM, looking its transitions up in a map.
+type mapMachine struct {
+	mu        sync.Mutex
+	current   string
+	next      map[[2]string]string // {event, from} -> to
+	listeners []func(Transition)
+}
+
+func newMapMachine(def FSMDefinition) *mapMachine {
+	m := &mapMachine{current: def.Initial, next: make(map[[2]string]string)}
+	for _, t := range def.Transitions {
+		m.next[[2]string{t.Event, t.From}] = t.To
+	}
+	return m
+}
+
+func (m *mapMachine) Current() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current
+}
+
+func (m *mapMachine) CanFire(event string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.next[[2]string{event, m.current}]
+	return ok
+}
+
+func (m *mapMachine) Fire(event string) error {
+	m.mu.Lock()
+	to, ok := m.next[[2]string{event, m.current}]
+	if !ok {
+		defer m.mu.Unlock()
+		return fmt.Errorf("%w: %s from %s", ErrIllegalTransition, event, m.current)
+	}
+	t := Transition{Event: event, From: m.current, To: to}
+	m.current = to
+	listeners := append([]func(Transition){}, m.listeners...)
+	m.mu.Unlock()
+	for _, fn := range listeners {
+		fn(t)
+	}
+	return nil
+}
+
+func (m *mapMachine) OnTransition(fn func(Transition)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+func TestPlayerMachinePlugged(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.Room.MinPlayers = 2
+		c.PlayerMachine = func() StateMachine {
+			return newMapMachine(NewPlayerFSM().(*FSM).Definition())
+		}
+	})
+	r, players := startGame(t, h, 2)
+	for _, c := range players {
+		p, _ := h.Server.players.Get(c.ID)
+		if _, ok := p.FSM.(*mapMachine); !ok || p.FSM.Current() != playerPlaying {
+			t.Fatalf("player machine %T in %s, want a mapMachine playing", p.FSM, p.FSM.Current())
+		}
+	}
+
+	call(t, players[0], "move", moveRequest{}, nil)
+	if code := callError(t, players[0], "ready", nil); code != CodeIllegalTransition {
+		t.Errorf("ready while playing: code %d, want %d", code, CodeIllegalTransition)
+	}
+	call(t, players[1], "forfeit", nil, nil)
+	if r.Game.Current() != gameFinished {
+		t.Errorf("game %s after the forfeit, want %s", r.Game.Current(), gameFinished)
+	}
+	if p, _ := h.Server.players.Get(players[1].ID); p.FSM.Current() != playerForfeited {
+		t.Errorf("forfeited player %s, want %s", p.FSM.Current(), playerForfeited)
+	}
+}
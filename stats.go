@@ -0,0 +1,43 @@
+package main
+
+import "time"
+
+const msgServerStats = "server.stats"
+
+// StatsConfig configures the live stats feed.
+type StatsConfig struct {
+	// Channel receives the stats publications.
+	Channel string
+	// Interval is the publication period. Zero disables the feed.
+	Interval time.Duration
+	// Sessions also publishes a SessionSummary to Channel whenever a client
+	// disconnects.
+	Sessions bool
+}
+
+// ServerStats is the payload of msgServerStats.
+type ServerStats struct {
+	Clients           int     `json:"clients"`
+	Rooms             int     `json:"rooms"`
+	TransitionsPerSec float64 `json:"transitions_per_sec"`
+	// Labels counts the rooms per "key=value" label of their Game FSM.
+	Labels map[string]int `json:"labels,omitempty"`
+}
+
+// runStats publishes ServerStats to the stats channel every interval until
+// s.done is closed.
+func (s *Server) runStats(config StatsConfig) {
+	last, lastAt := fsmTransitions.Load(), s.clock.Now()
+	every(s.clock, s.done, func() time.Duration { return config.Interval }, func(now time.Time) {
+		n := fsmTransitions.Load()
+		rooms := s.rooms.Rooms()
+		stats := ServerStats{
+			Clients:           s.node.Hub().NumClients(),
+			Rooms:             len(rooms),
+			TransitionsPerSec: float64(n-last) / now.Sub(lastAt).Seconds(),
+			Labels:            labelCounts(rooms),
+		}
+		last, lastAt = n, now
+		_ = s.publishMessage(config.Channel, msgServerStats, stats)
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// Strategy is the difficulty and the parameters a bot plays with, assigned
+// by the server so that it can balance the matches.
+type Strategy struct {
+	Difficulty string             `json:"difficulty"`
+	Params     map[string]float64 `json:"params,omitempty"`
+}
+
+// Param returns the parameter name of the strategy, def if it isn't set.
+func (s Strategy) Param(name string, def float64) float64 {
+	if v, ok := s.Params[name]; ok {
+		return v
+	}
+	return def
+}
+
+// StrategyConfig holds the strategies handed out by the strategy RPC.
+type StrategyConfig struct {
+	// Levels are handed out in turn to the bots of each room, so that the
+	// bots of a match mix difficulties.
+	Levels []Strategy
+	// Choose chooses the strategy of bot instead of Levels when set, e.g.
+	// from the ratings of the players of its room r, nil for a bot in no
+	// room. assigned are the strategies of the other bots of r.
+	Choose func(bot *Player, r *Room, assigned []Strategy) Strategy
+}
+
+// assignedStrategy returns the strategy assigned to the player in roomID.
+func (p *Player) assignedStrategy(roomID string) (Strategy, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.strategy == nil || p.strategyRoom != roomID {
+		return Strategy{}, false
+	}
+	return *p.strategy, true
+}
+
+func (p *Player) setStrategy(roomID string, s Strategy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.strategy = &s
+	p.strategyRoom = roomID
+}
+
+// AssignStrategy returns the strategy of the bot clientID, chosen on its
+// first call in its current room and kept until it changes room.
+func (s *Server) AssignStrategy(clientID string) (Strategy, error) {
+	p, ok := s.players.Get(clientID)
+	if !ok {
+		return Strategy{}, fmt.Errorf("%w: %s", ErrPlayerNotFound, clientID)
+	}
+	roomID := p.Room()
+	// Serialized so that the bots of a room see each other's strategies.
+	s.strategyMu.Lock()
+	defer s.strategyMu.Unlock()
+	if st, ok := p.assignedStrategy(roomID); ok {
+		return st, nil
+	}
+	var assigned []Strategy
+	for _, other := range s.players.All() {
+		if other == p || other.Room() != roomID {
+			continue
+		}
+		if st, ok := other.assignedStrategy(roomID); ok {
+			assigned = append(assigned, st)
+		}
+	}
+	var st Strategy
+	if choose := s.config.Strategy.Choose; choose != nil {
+		r, _ := s.rooms.Room(roomID)
+		st = choose(p, r, assigned)
+	} else if levels := s.config.Strategy.Levels; len(levels) > 0 {
+		st = levels[len(assigned)%len(levels)]
+	}
+	p.setStrategy(roomID, st)
+	log.Info().Msgf("bot %s assigned strategy %q in room %q", clientID, st.Difficulty, roomID)
+	return st, nil
+}
+
+// rpcStrategy returns the strategy assigned to the caller.
+func (s *Server) rpcStrategy(client *centrifuge.Client, _ []byte) ([]byte, error) {
+	st, err := s.AssignStrategy(client.ID())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(st)
+}
+
+// FetchStrategy fetches the strategy the server assigned to the bot in its
+// current room, which Strategy then returns to its decider.
+func (b *Bot) FetchStrategy() (Strategy, error) {
+	data, err := b.Call("strategy", nil)
+	if err != nil {
+		return Strategy{}, err
+	}
+	var st Strategy
+	if err := json.Unmarshal(data, &st); err != nil {
+		return Strategy{}, err
+	}
+	b.mu.Lock()
+	b.strategy = st
+	b.mu.Unlock()
+	return st, nil
+}
+
+// Strategy returns the strategy last fetched by the bot, on Join or with
+// FetchStrategy, for its decider to play by.
+func (b *Bot) Strategy() Strategy {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.strategy
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestStrategyLevelsPerRoom(t *testing.T) {
+	h := newHarness(t, nil)
+	levels := h.Server.config.Strategy.Levels
+	first := createRoom(t, connect(t, h, "owner0"), createRoomRequest{}).Room
+	second := createRoom(t, connect(t, h, "owner1"), createRoomRequest{}).Room
+
+	var bots []*HarnessClient
+	for i := 0; i < 2; i++ {
+		c := connect(t, h, fmt.Sprintf("bot%d", i))
+		call(t, c, "joinRoom", roomRequest{Room: first}, nil)
+		bots = append(bots, c)
+	}
+	var a, b, again Strategy
+	call(t, bots[0], "strategy", nil, &a)
+	call(t, bots[1], "strategy", nil, &b)
+	call(t, bots[0], "strategy", nil, &again)
+	if a.Difficulty != levels[0].Difficulty || b.Difficulty != levels[1].Difficulty {
+		t.Errorf("strategies %q and %q, want %q and %q", a.Difficulty, b.Difficulty, levels[0].Difficulty, levels[1].Difficulty)
+	}
+	if again.Difficulty != a.Difficulty {
+		t.Errorf("strategy changed to %q in the same room", again.Difficulty)
+	}
+
+	// The levels are handed out again from the first in another room.
+	call(t, bots[1], "leaveRoom", roomRequest{Room: first}, nil)
+	call(t, bots[1], "joinRoom", roomRequest{Room: second}, nil)
+	call(t, bots[1], "strategy", nil, &b)
+	if b.Difficulty != levels[0].Difficulty {
+		t.Errorf("strategy %q in a new room, want %q", b.Difficulty, levels[0].Difficulty)
+	}
+}
+
+func TestStrategyChoose(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.Strategy.Choose = func(bot *Player, r *Room, assigned []Strategy) Strategy {
+			return Strategy{Difficulty: bot.UserID, Params: map[string]float64{"rank": float64(len(assigned))}}
+		}
+	})
+	owner := connect(t, h, "owner")
+	room := createRoom(t, owner, createRoomRequest{}).Room
+	for i := 0; i < 2; i++ {
+		c := connect(t, h, fmt.Sprintf("bot%d", i))
+		call(t, c, "joinRoom", roomRequest{Room: room}, nil)
+		var st Strategy
+		call(t, c, "strategy", nil, &st)
+		if st.Difficulty != fmt.Sprintf("bot%d", i) || st.Param("rank", -1) != float64(i) {
+			t.Errorf("bot %d strategy %+v", i, st)
+		}
+	}
+}
+
+func TestBotsPlayByTheirStrategy(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.Referees = 0 })
+	levels := h.Server.config.Strategy.Levels
+	// The deciders record the skill they play the start of the game with.
+	var mu sync.Mutex
+	skills := make(map[string]float64)
+	decide := func(b *Bot, msg Message) {
+		if msg.Type != msgGameState {
+			return
+		}
+		mu.Lock()
+		skills[b.ID()] = b.Strategy().Param("skill", -1)
+		mu.Unlock()
+	}
+	var bots []*Bot
+	for i := 0; i < 2; i++ {
+		bots = append(bots, NewBot(servedClient(t, h), decide))
+	}
+	data, err := bots[0].Call("createRoom", createRoomRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var room roomReply
+	if err := json.Unmarshal(data, &room); err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range bots {
+		if err := b.Join(room.Room); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := b.Strategy().Difficulty, levels[i].Difficulty; got != want {
+			t.Errorf("bot %d plays %q, want %q", i, got, want)
+		}
+		eventually(t, "the room subscription", func() bool { return subscribed(h, b.ID(), room.Channel) })
+		if _, err := b.Call("ready", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, _ := h.Server.rooms.Room(room.Room)
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the bots to decide", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(skills) == 2
+	})
+	for i, b := range bots {
+		if want := levels[i].Param("skill", -1); skills[b.ID()] != want {
+			t.Errorf("bot %d played with skill %v, want %v", i, skills[b.ID()], want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import "sync"
+
+// subscriptions tracks the channels each client is subscribed to, so that
+// resources scoped to a subscription are released when it ends, whether
+// the client unsubscribes or disconnects.
+type subscriptions struct {
+	mu        sync.Mutex
+	channels  map[string]map[string]bool // client ID -> subscribed channels
+	onRelease []func(clientID, channel string)
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{channels: make(map[string]map[string]bool)}
+}
+
+// OnRelease registers a hook called once a subscription ended.
+func (t *subscriptions) OnRelease(fn func(clientID, channel string)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onRelease = append(t.onRelease, fn)
+}
+
+func (t *subscriptions) add(clientID, channel string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.channels[clientID] == nil {
+		t.channels[clientID] = make(map[string]bool)
+	}
+	t.channels[clientID][channel] = true
+}
+
+// remove ends the subscription of clientID to channel.
+func (t *subscriptions) remove(clientID, channel string) {
+	t.mu.Lock()
+	channels, ok := t.channels[clientID]
+	if !ok || !channels[channel] {
+		t.mu.Unlock()
+		return
+	}
+	delete(channels, channel)
+	if len(channels) == 0 {
+		delete(t.channels, clientID)
+	}
+	hooks := append([]func(string, string){}, t.onRelease...)
+	t.mu.Unlock()
+
+	for _, fn := range hooks {
+		fn(clientID, channel)
+	}
+}
+
+// removeClient ends every subscription of clientID.
+func (t *subscriptions) removeClient(clientID string) {
+	t.mu.Lock()
+	channels := t.channels[clientID]
+	delete(t.channels, clientID)
+	hooks := append([]func(string, string){}, t.onRelease...)
+	t.mu.Unlock()
+
+	for channel := range channels {
+		for _, fn := range hooks {
+			fn(clientID, channel)
+		}
+	}
+}
+
+// Len returns the number of live subscriptions.
+func (t *subscriptions) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, channels := range t.channels {
+		n += len(channels)
+	}
+	return n
+}
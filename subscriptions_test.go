@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSubscriptionsReleasedOnDisconnect(t *testing.T) {
+	h := newHarness(t, nil)
+	baseline := h.Server.subs.Len()
+	for round := 0; round < 3; round++ {
+		var clients []*HarnessClient
+		for i := 0; i < 5; i++ {
+			c := connect(t, h, fmt.Sprintf("user%d", i))
+			for _, channel := range []string{playersChannel, h.Server.config.Stats.Channel} {
+				if err := c.Subscribe(channel); err != nil {
+					t.Fatalf("subscribe %s: %s", channel, err)
+				}
+			}
+			clients = append(clients, c)
+		}
+		if n := h.Server.subs.Len(); n != baseline+10 {
+			t.Fatalf("round %d: %d subscriptions, want %d", round, n, baseline+10)
+		}
+		for _, c := range clients {
+			if err := c.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		eventually(t, "the subscriptions to be released", func() bool { return h.Server.subs.Len() == baseline })
+	}
+	h.Server.subs.mu.Lock()
+	defer h.Server.subs.mu.Unlock()
+	if n := len(h.Server.subs.channels); n != 0 {
+		t.Errorf("%d clients still tracked", n)
+	}
+}
+
+func TestSubscriptionsReleaseHooks(t *testing.T) {
+	subs := newSubscriptions()
+	released := make(map[string]int)
+	subs.OnRelease(func(clientID, channel string) { released[clientID+" "+channel]++ })
+
+	subs.add("a", "x")
+	subs.add("a", "y")
+	subs.add("b", "x")
+	subs.remove("a", "x")
+	subs.remove("a", "x")
+	subs.removeClient("a")
+	subs.removeClient("b")
+
+	want := map[string]int{"a x": 1, "a y": 1, "b x": 1}
+	if fmt.Sprint(released) != fmt.Sprint(want) {
+		t.Errorf("released %v, want %v", released, want)
+	}
+	if n := subs.Len(); n != 0 || len(subs.channels) != 0 {
+		t.Errorf("%d subscriptions of %d clients left", n, len(subs.channels))
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "time"
+
+// testModeEpoch is the time FakeClocks of TestMode start at, so that runs
+// are reproducible.
+var testModeEpoch = time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// withTestMode returns config adjusted for TestMode: the clock is a
+// FakeClock unless one was given, no internal client is expected since
+// they would connect through the network, and the connection rate limit,
+// running on the system time, is disabled.
+func (c Config) withTestMode() Config {
+	if c.Clock == nil {
+		c.Clock = NewFakeClock(testModeEpoch)
+	}
+	c.InternalClients = 0
+	c.ConnectRate = ConnectRateConfig{}
+	return c
+}
+
+// FakeClock returns the clock of a server in TestMode, nil in production
+// mode or when the configured clock isn't a FakeClock.
+func (s *Server) FakeClock() *FakeClock {
+	if !s.config.TestMode {
+		return nil
+	}
+	c, _ := s.config.Clock.(*FakeClock)
+	return c
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTestModeConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.InternalClients = 3
+	config.TestMode = true
+	h, err := NewTestHarness(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if h.Clock == nil || !h.Clock.Now().Equal(testModeEpoch) {
+		t.Fatalf("clock %v, want a FakeClock at %s", h.Clock, testModeEpoch)
+	}
+	got := h.Server.config
+	if got.InternalClients != 0 || got.ConnectRate.Rate != 0 {
+		t.Errorf("internal clients %d, %v connections per second, want none", got.InternalClients, got.ConnectRate.Rate)
+	}
+	if !h.Server.ready.wait(time.Second) {
+		t.Error("server waits for internal clients in TestMode")
+	}
+}
+
+func TestGameRunsOnFakeTime(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.Room.AutoStart = true
+		c.Room.Countdown = 10 * time.Second
+		c.Room.TurnTimeout = 30 * time.Second
+		c.Room.MaxDuration = 5 * time.Minute
+	})
+	owner := connect(t, h, "user0")
+	roomID := createRoom(t, owner, createRoomRequest{}).Room
+	clients := map[string]*HarnessClient{}
+	for i := 0; i < 2; i++ {
+		c := owner
+		if i > 0 {
+			c = connect(t, h, fmt.Sprintf("user%d", i))
+		}
+		call(t, c, "joinRoom", roomRequest{Room: roomID}, nil)
+		call(t, c, "ready", nil, nil)
+		clients[c.ID] = c
+	}
+	r, _ := h.Server.rooms.Room(roomID)
+
+	h.Clock.Advance(10 * time.Second)
+	if r.Game.Current() != gamePlaying {
+		t.Fatalf("game %s after the countdown, want %s", r.Game.Current(), gamePlaying)
+	}
+	turn, _ := r.CurrentTurn()
+	call(t, clients[turn], "move", moveRequest{Move: json.RawMessage(`{"cell":1}`)}, nil)
+	next, _ := r.CurrentTurn()
+	h.Clock.Advance(30 * time.Second)
+	if now, _ := r.CurrentTurn(); now != turn {
+		t.Errorf("turn of %s after %s timed out, want %s", now, next, turn)
+	}
+
+	h.Clock.Advance(5 * time.Minute)
+	if r.Game.Current() != gameFinished {
+		t.Errorf("game %s after MaxDuration, want %s", r.Game.Current(), gameFinished)
+	}
+}
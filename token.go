@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+	centrigo "github.com/centrifugal/centrifuge-go"
+	"github.com/rs/zerolog"
+)
+
+// TokenProvider returns a fresh connection token, e.g. a JWT for AuthJWT.
+type TokenProvider func(ctx context.Context) (string, error)
+
+// TokenRefreshConfig lets a GameClient renew its connection token before it
+// expires instead of being disconnected.
+type TokenRefreshConfig struct {
+	// Provider is called for the first token and for every refresh. Nil
+	// connects without a token.
+	Provider TokenProvider
+	// Retries is how many more times a failing Provider is called before
+	// the client gives up and disconnects. Zero means 3.
+	Retries int
+	// Backoff is the delay before the first retry, doubled after each
+	// one. Zero means a second.
+	Backoff time.Duration
+	// Timeout bounds each call of Provider. Zero means 10 seconds.
+	Timeout time.Duration
+}
+
+func (c TokenRefreshConfig) withDefaults() TokenRefreshConfig {
+	if c.Retries == 0 {
+		c.Retries = 3
+	}
+	if c.Backoff == 0 {
+		c.Backoff = time.Second
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+	return c
+}
+
+// tokenSource fetches tokens for a centrifuge-go client. The last token is
+// also set in header, the headers of the WebSocket upgrade, which the auth
+// middleware checks when the client reconnects.
+type tokenSource struct {
+	config TokenRefreshConfig
+	log    *zerolog.Logger
+	header http.Header
+}
+
+func newTokenSource(log *zerolog.Logger, config TokenRefreshConfig) *tokenSource {
+	return &tokenSource{
+		config: config.withDefaults(),
+		log:    log,
+		header: http.Header{},
+	}
+}
+
+// fetch calls the provider, retrying with backoff. It returns
+// centrigo.ErrUnauthorized once out of retries so that the client
+// disconnects instead of reconnecting with an expired token.
+func (t *tokenSource) fetch() (string, error) {
+	backoff := t.config.Backoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), t.config.Timeout)
+		token, err := t.config.Provider(ctx)
+		cancel()
+		if err == nil {
+			t.header.Set("Authorization", "Bearer "+token)
+			return token, nil
+		}
+		if attempt >= t.config.Retries {
+			t.log.Error().Msgf("token provider failed %d times, disconnecting: %s", attempt+1, err.Error())
+			return "", centrigo.ErrUnauthorized
+		}
+		t.log.Warn().Msgf("token provider failed, retrying in %s: %s", backoff, err.Error())
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// getToken implements centrigo.Config.GetToken.
+func (t *tokenSource) getToken(_ centrigo.ConnectionTokenEvent) (string, error) {
+	t.log.Info().Msg("refreshing connection token")
+	return t.fetch()
+}
+
+// TokenVerifier is implemented by authenticators able to check a token sent
+// by a client to refresh its connection.
+type TokenVerifier interface {
+	VerifyToken(token string) (*centrifuge.Credentials, error)
+}
+
+// onRefresh extends the connection of client with the token it sent. An
+// invalid token, or one of another user, expires the connection.
+func (s *Server) onRefresh(client *centrifuge.Client, e centrifuge.RefreshEvent, cb centrifuge.RefreshCallback) {
+	l := s.clientLog(client.ID())
+	cred, err := s.tokens.VerifyToken(e.Token)
+	if err != nil {
+		l.Warn().Msgf("client %s refresh rejected: %s", client.ID(), err.Error())
+		cb(centrifuge.RefreshReply{Expired: true}, nil)
+		return
+	}
+	if cred.UserID != client.UserID() {
+		l.Warn().Msgf("client %s refresh rejected: token of %s", client.ID(), cred.UserID)
+		cb(centrifuge.RefreshReply{Expired: true}, nil)
+		return
+	}
+	l.Info().Msgf("client %s refreshed its token until %s", client.ID(), time.Unix(cred.ExpireAt, 0).Format(time.RFC3339))
+	cb(centrifuge.RefreshReply{ExpireAt: cred.ExpireAt}, nil)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	centrigo "github.com/centrifugal/centrifuge-go"
+)
+
+func TestNearExpiryTokenRefreshed(t *testing.T) {
+	const secret = "secret"
+	h := newHarness(t, func(c *Config) { c.Auth = AuthConfig{Backend: AuthJWT, JWTSecret: secret} })
+	authenticator, err := NewAuthenticator(h.Server.config.Auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(auth(authenticator, h.Server.WebsocketHandler()))
+	t.Cleanup(ts.Close)
+
+	// Every token expires within two seconds.
+	var issued atomic.Int32
+	provider := func(context.Context) (string, error) {
+		issued.Add(1)
+		return signJWT(secret, jwtClaims{Subject: "alice", ExpiresAt: time.Now().Add(2 * time.Second).Unix()}), nil
+	}
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/connection/websocket"
+	c, err := newClient(&log, url, h.Server.config.Client, ClientOptions{Token: TokenRefreshConfig{Provider: provider}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the client to connect", func() bool { return c.ID() != "" })
+	id := c.ID()
+
+	eventually(t, "a token refresh", func() bool { return issued.Load() >= 2 })
+	// Past the expiry of the first token, the connection is still there.
+	time.Sleep(3 * time.Second)
+	if _, ok := h.Server.node.Hub().Connections()[id]; !ok || c.ID() != id {
+		t.Errorf("client %s disconnected despite the refresh", id)
+	}
+}
+
+func TestTokenProviderRetries(t *testing.T) {
+	failed := errors.New("provider down")
+	source := func(failures int32) (*tokenSource, *atomic.Int32) {
+		var calls atomic.Int32
+		return newTokenSource(&log, TokenRefreshConfig{
+			Retries: 2,
+			Backoff: time.Millisecond,
+			Provider: func(context.Context) (string, error) {
+				if calls.Add(1) <= failures {
+					return "", failed
+				}
+				return "token", nil
+			},
+		}), &calls
+	}
+
+	s, calls := source(2)
+	if token, err := s.fetch(); err != nil || token != "token" {
+		t.Errorf("fetch after 2 failures: %q, %v", token, err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("provider called %d times, want 3", calls.Load())
+	}
+	if got := s.header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("upgrade header %q, want the new token", got)
+	}
+
+	s, calls = source(3)
+	if _, err := s.fetch(); !errors.Is(err, centrigo.ErrUnauthorized) {
+		t.Errorf("fetch out of retries: %v, want %v", err, centrigo.ErrUnauthorized)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("provider called %d times, want 3", calls.Load())
+	}
+}
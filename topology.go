@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ChannelTopology selects the channels a room publishes on.
+type ChannelTopology string
+
+const (
+	// TopologySplit gives the state updates, the chat and the presence of
+	// the room a channel each.
+	TopologySplit ChannelTopology = "split"
+	// TopologySingle carries them all on the room channel.
+	TopologySingle ChannelTopology = "single"
+)
+
+func (t ChannelTopology) validate() error {
+	switch t {
+	case "", TopologySplit, TopologySingle:
+		return nil
+	}
+	return fmt.Errorf("unknown channel topology %q", t)
+}
+
+const presenceSuffix = ":presence"
+
+// RoomChannels are the channels of a room, for clients to subscribe to
+// those of its topology. With TopologySingle they are all the same.
+type RoomChannels struct {
+	Topology ChannelTopology `json:"topology"`
+	State    string          `json:"state"`
+	Chat     string          `json:"chat"`
+	Presence string          `json:"presence"`
+}
+
+// Topology returns the channel topology of the room.
+func (r *Room) Topology() ChannelTopology {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.topology
+}
+
+// SetTopology changes the channel topology of the room, RoomConfig.Topology
+// by default. It must be called before the room is handed out.
+func (r *Room) SetTopology(t ChannelTopology) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+	if t == "" {
+		t = TopologySplit
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.topology = t
+	return nil
+}
+
+// Channels returns the channels of the room.
+func (r *Room) Channels() RoomChannels {
+	return RoomChannels{
+		Topology: r.Topology(),
+		State:    r.Channel(),
+		Chat:     r.ChatChannel(),
+		Presence: r.PresenceChannel(),
+	}
+}
+
+// PresenceChannel returns the channel whose subscribers are the presence of
+// the room.
+func (r *Room) PresenceChannel() string {
+	if r.Topology() == TopologySingle {
+		return r.Channel()
+	}
+	return r.Channel() + presenceSuffix
+}
+
+// roomChannelID returns the ID of the room whose state, chat or presence
+// channel is channel.
+func roomChannelID(channel string) (string, bool) {
+	info, ok := parseRoomChannel(channel)
+	return info.room, ok
+}
+
+// chatRoom returns the ID of the room whose chat data is published on
+// channel: its chat channel, or its room channel for the chat messages of
+// TopologySingle.
+func (s *Server) chatRoom(channel string, data []byte) (string, bool) {
+	if id, ok := chatRoomID(channel); ok {
+		return id, true
+	}
+	r, ok := s.channelRoom(channel)
+	if !ok || r.Topology() != TopologySingle {
+		return "", false
+	}
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Type != msgChat {
+		return "", false
+	}
+	return r.ID, true
+}
@@ -0,0 +1,81 @@
+package main
+
+import "testing"
+
+func TestEventsFollowTheTopology(t *testing.T) {
+	for _, tc := range []struct {
+		topology ChannelTopology
+		chat     string // suffix of the chat channel
+		presence string // suffix of the presence channel
+	}{
+		{TopologySplit, chatSuffix, presenceSuffix},
+		{TopologySingle, "", ""},
+	} {
+		t.Run(string(tc.topology), func(t *testing.T) {
+			h := newHarness(t, nil)
+			owner := connect(t, h, "owner")
+			reply := createRoom(t, owner, createRoomRequest{Topology: tc.topology})
+			state := "game:" + reply.Room
+			want := RoomChannels{Topology: tc.topology, State: state, Chat: state + tc.chat, Presence: state + tc.presence}
+			if reply.Channels != want {
+				t.Fatalf("room channels %+v, want %+v", reply.Channels, want)
+			}
+
+			var players []*HarnessClient
+			for _, user := range []string{"alice", "bob"} {
+				c := connect(t, h, user)
+				call(t, c, "joinRoom", roomRequest{Room: reply.Room}, nil)
+				for _, channel := range uniqueChannels(want) {
+					if err := c.Subscribe(channel); err != nil {
+						t.Fatalf("subscribe to %s: %s", channel, err)
+					}
+				}
+				call(t, c, "ready", nil, nil)
+				players = append(players, c)
+			}
+			r, _ := h.Server.rooms.Room(reply.Room)
+			if err := r.Start(); err != nil {
+				t.Fatal(err)
+			}
+			if pub := nextMessage(t, players[1], msgGameState); pub.Channel != want.State {
+				t.Errorf("state update on %s, want %s", pub.Channel, want.State)
+			}
+			if err := chat(players[0], r, "hi"); err != nil {
+				t.Fatal(err)
+			}
+			if pub := nextMessage(t, players[1], msgChat); pub.Channel != want.Chat {
+				t.Errorf("chat on %s, want %s", pub.Channel, want.Chat)
+			}
+			eventually(t, "the presence of the players", func() bool {
+				stats, err := h.Server.node.PresenceStats(want.Presence)
+				return err == nil && stats.NumClients == 2
+			})
+		})
+	}
+}
+
+func TestDefaultTopology(t *testing.T) {
+	h := newHarness(t, func(c *Config) { c.Room.Topology = TopologySingle })
+	if got := createRoom(t, connect(t, h, "owner0"), createRoomRequest{}).Channels.Topology; got != TopologySingle {
+		t.Errorf("topology %s, want the configured %s", got, TopologySingle)
+	}
+	if got := createRoom(t, connect(t, h, "owner1"), createRoomRequest{Topology: TopologySplit}).Channels.Topology; got != TopologySplit {
+		t.Errorf("topology %s, want the requested %s", got, TopologySplit)
+	}
+	if code := callError(t, connect(t, h, "owner2"), "createRoom", createRoomRequest{Topology: "mesh"}); code != CodeInvalid {
+		t.Errorf("unknown topology: code %d, want %d", code, CodeInvalid)
+	}
+}
+
+// uniqueChannels returns the distinct channels of c.
+func uniqueChannels(c RoomChannels) []string {
+	var channels []string
+	seen := make(map[string]bool)
+	for _, channel := range []string{c.State, c.Chat, c.Presence} {
+		if !seen[channel] {
+			seen[channel] = true
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
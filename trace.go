@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+	"github.com/rs/zerolog"
+)
+
+// tracer keeps the clients marked for debug logging, each until a deadline.
+type tracer struct {
+	mu     sync.Mutex
+	traced map[string]time.Time // client ID -> end of tracing
+}
+
+func newTracer() *tracer {
+	return &tracer{traced: make(map[string]time.Time)}
+}
+
+// trace marks clientID for ttl, or clears it when ttl is zero.
+func (t *tracer) trace(clientID string, ttl time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ttl <= 0 {
+		delete(t.traced, clientID)
+		return
+	}
+	t.traced[clientID] = time.Now().Add(ttl)
+}
+
+// rename moves the trace of oldID, if any, to newID.
+func (t *tracer) rename(oldID, newID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until, ok := t.traced[oldID]; ok {
+		delete(t.traced, oldID)
+		t.traced[newID] = until
+	}
+}
+
+func (t *tracer) enabled(clientID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until, ok := t.traced[clientID]
+	if ok && time.Now().After(until) {
+		delete(t.traced, clientID)
+		return false
+	}
+	return ok
+}
+
+// clientLog returns the logger for messages about clientID: the global one,
+// or a debug-level one tagged trace=true while the client is traced. Debug
+// messages are only emitted for traced clients if the global zerolog level
+// lets them through.
+func (s *Server) clientLog(clientID string) *zerolog.Logger {
+	if !s.tracer.enabled(clientID) {
+		return &log
+	}
+	l := log.Level(zerolog.DebugLevel).With().Str("client", clientID).Bool("trace", true).Logger()
+	return &l
+}
+
+type traceRequest struct {
+	Client string `json:"client"`
+	// TTL is the tracing duration in seconds, Config.TraceTTL when zero.
+	TTL int `json:"ttl,omitempty"`
+	// Off clears the trace flag.
+	Off bool `json:"off,omitempty"`
+}
+
+type traceReply struct {
+	Client string    `json:"client"`
+	Until  time.Time `json:"until,omitempty"`
+}
+
+// rpcTraceClient lets admins turn debug logging on or off for one client.
+func (s *Server) rpcTraceClient(client *centrifuge.Client, data []byte) ([]byte, error) {
+	if !s.isAdmin(client) {
+		return nil, centrifuge.ErrorPermissionDenied
+	}
+	var req traceRequest
+	if err := json.Unmarshal(data, &req); err != nil || req.Client == "" {
+		return nil, centrifuge.ErrorBadRequest
+	}
+	if req.Off {
+		s.tracer.trace(req.Client, 0)
+		log.Info().Msgf("client %s: tracing of %s stopped", client.ID(), req.Client)
+		return json.Marshal(traceReply{Client: req.Client})
+	}
+	ttl := s.config.TraceTTL
+	if req.TTL > 0 {
+		ttl = time.Duration(req.TTL) * time.Second
+	}
+	s.tracer.trace(req.Client, ttl)
+	log.Info().Msgf("client %s: tracing %s for %s", client.ID(), req.Client, ttl)
+	return json.Marshal(traceReply{Client: req.Client, Until: time.Now().Add(ttl).UTC()})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// ErrAlreadyInRoom is returned by Transfer to the room the player is in.
+var ErrAlreadyInRoom = errors.New("player already in room")
+
+// Published on the channels of the rooms a player is transferred from and
+// to.
+const (
+	msgGameLeft   = "game.left"
+	msgGameJoined = "game.joined"
+)
+
+// transferEvent is the payload of msgGameLeft and msgGameJoined.
+type transferEvent struct {
+	Player string `json:"player"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// Transfer moves clientID from the room from to the room to at once, if
+// admit accepts it: the player is never in both rooms nor in neither.
+// Nothing changes when a room doesn't exist, clientID isn't in from or
+// admit fails. admit is called with g.mu held. Left empty, from is
+// destroyed after the grace period.
+func (g *RoomRegistry) Transfer(from, to, clientID string, admit func(*Room) error) (*Room, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	src, ok := g.rooms[from]
+	if !ok || !src.Has(clientID) {
+		return nil, fmt.Errorf("%w: %s is not in room %s", ErrRoomNotFound, clientID, from)
+	}
+	dst, ok := g.rooms[to]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRoomNotFound, to)
+	}
+	if err := admit(dst); err != nil {
+		return nil, err
+	}
+	g.leave(src, clientID)
+	g.join(dst, clientID)
+	return dst, nil
+}
+
+// Transfer moves the player clientID from the room from to the room to,
+// e.g. for a rematch or to migrate a lobby. The player must be allowed in
+// to, whose match mustn't have started, or it stays in from untouched.
+// Otherwise it is reset to idle, its subscriptions to the channels of from
+// are moved to the matching channels of to, and game.left and game.joined
+// are published on the channels of the rooms.
+func (s *Server) Transfer(clientID, from, to string) (*Room, error) {
+	p, ok := s.players.Get(clientID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPlayerNotFound, clientID)
+	}
+	if from == to {
+		return nil, fmt.Errorf("%w: %s is in room %s", ErrAlreadyInRoom, clientID, to)
+	}
+	src, ok := s.rooms.Room(from)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRoomNotFound, from)
+	}
+	owner := p.UserID
+	if owner == "" {
+		owner = p.ID()
+	}
+	r, err := s.rooms.Transfer(from, to, clientID, func(r *Room) error {
+		if !r.Invited(owner) {
+			log.Warn().Msgf("player %s denied transfer to room %s", clientID, r.ID)
+			return centrifuge.ErrorPermissionDenied
+		}
+		return r.admit()
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.SetRoom(r.ID)
+	if p.FSM.Current() != playerIdle {
+		if err := p.FSM.Fire(eventReset); err != nil {
+			log.Warn().Msgf("room %s: transferred player %s can't reset: %s", r.ID, clientID, err.Error())
+		}
+	}
+	log.Info().Msgf("player %s transferred from room %s to room %s", clientID, from, to)
+
+	client, connected := s.node.Hub().Connections()[clientID]
+	if connected {
+		s.moveSubscriptions(client, from, r)
+	}
+	ev := transferEvent{Player: clientID, From: from, To: to}
+	_ = s.publishMessage(src.Channel(), msgGameLeft, ev)
+	_ = s.publishMessage(r.Channel(), msgGameJoined, ev)
+	if connected {
+		s.arrive(client, r)
+	}
+	return r, nil
+}
+
+// moveSubscriptions unsubscribes client from the channels of the room from
+// and subscribes it, server-side, to the matching channels of r.
+func (s *Server) moveSubscriptions(client *centrifuge.Client, from string, r *Room) {
+	var old []string
+	s.subs.mu.Lock()
+	for channel := range s.subs.channels[client.ID()] {
+		if info, ok := parseRoomChannel(channel); ok && info.room == from {
+			old = append(old, channel)
+		}
+	}
+	s.subs.mu.Unlock()
+
+	moved := make(map[string]bool, len(old))
+	for _, channel := range old {
+		// The unsubscription is reported to OnUnsubscribe.
+		client.Unsubscribe(channel)
+		info, _ := parseRoomChannel(channel)
+		channel := r.Channel()
+		switch info.kind {
+		case channelChat:
+			channel = r.ChatChannel()
+		case channelPresence:
+			channel = r.PresenceChannel()
+		}
+		if moved[channel] {
+			continue
+		}
+		moved[channel] = true
+		presence := channel == r.PresenceChannel()
+		if err := client.Subscribe(channel, centrifuge.WithEmitPresence(presence)); err != nil {
+			log.Warn().Msgf("client %s not subscribed to %s: %s", client.ID(), channel, err.Error())
+			continue
+		}
+		s.subs.add(client.ID(), channel)
+	}
+}
+
+type transferRequest struct {
+	Player string `json:"player,omitempty"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to"`
+}
+
+// rpcTransfer transfers the caller's player, or any player for admins,
+// from its room, or from, to the room to.
+func (s *Server) rpcTransfer(client *centrifuge.Client, data []byte) ([]byte, error) {
+	var req transferRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, centrifuge.ErrorBadRequest
+	}
+	p, err := s.authorize(client, req.Player)
+	if err != nil {
+		return nil, err
+	}
+	if req.From == "" {
+		req.From = p.Room()
+	}
+	r, err := s.Transfer(p.ID(), req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(newRoomReply(r))
+}
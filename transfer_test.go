@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// nextMessage returns the next message of type msgType c receives.
+func nextMessage(t *testing.T, c *HarnessClient, msgType string) HarnessPublication {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		pub, err := c.Next(ctx)
+		if err != nil {
+			t.Fatalf("waiting for %s: %s", msgType, err)
+		}
+		if pub.Message.Type == msgType {
+			return pub
+		}
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	h := newHarness(t, nil)
+	player := connect(t, h, "player")
+	from := createRoom(t, player, createRoomRequest{})
+	call(t, player, "joinRoom", roomRequest{Room: from.Room}, nil)
+	call(t, player, "ready", nil, nil)
+	if err := player.Subscribe(from.Channel); err != nil {
+		t.Fatal(err)
+	}
+	host := connect(t, h, "host")
+	to := createRoom(t, host, createRoomRequest{})
+	call(t, host, "joinRoom", roomRequest{Room: to.Room}, nil)
+	if err := host.Subscribe(to.Channel); err != nil {
+		t.Fatal(err)
+	}
+
+	var reply roomReply
+	call(t, player, "transfer", transferRequest{To: to.Room}, &reply)
+	if reply.Room != to.Room {
+		t.Fatalf("transferred to %s, want %s", reply.Room, to.Room)
+	}
+	src, _ := h.Server.rooms.Room(from.Room)
+	dst, _ := h.Server.rooms.Room(to.Room)
+	if src.Has(player.ID) || !dst.Has(player.ID) {
+		t.Errorf("player in the source room %v, in the target room %v", src.Has(player.ID), dst.Has(player.ID))
+	}
+	p, _ := h.Server.players.Get(player.ID)
+	if p.Room() != to.Room || p.FSM.Current() != playerIdle {
+		t.Errorf("player in room %s as %s, want %s as %s", p.Room(), p.FSM.Current(), to.Room, playerIdle)
+	}
+	if subscribed(h, player.ID, from.Channel) || !subscribed(h, player.ID, to.Channel) {
+		t.Error("subscription not moved to the target room")
+	}
+	if pub := nextMessage(t, host, msgGameJoined); pub.Channel != to.Channel {
+		t.Errorf("%s published on %s, want %s", msgGameJoined, pub.Channel, to.Channel)
+	}
+}
+
+func TestTransferRejectedKeepsPlayer(t *testing.T) {
+	h := newHarness(t, nil)
+	player := connect(t, h, "player")
+	from := createRoom(t, player, createRoomRequest{})
+	call(t, player, "joinRoom", roomRequest{Room: from.Room}, nil)
+	call(t, player, "ready", nil, nil)
+	var match matchReply
+	call(t, connect(t, h, "owner"), "createMatch", nil, &match)
+
+	for _, tc := range []struct {
+		name string
+		to   string
+		code ErrorCode
+	}{
+		{"missing room", "missing", CodeRoomNotFound},
+		{"uninvited", match.Room, CodePermissionDenied},
+		{"same room", from.Room, CodeAlreadyInRoom},
+	} {
+		if code := callError(t, player, "transfer", transferRequest{To: tc.to}); code != tc.code {
+			t.Errorf("%s: code %d, want %d", tc.name, code, tc.code)
+		}
+	}
+	src, _ := h.Server.rooms.Room(from.Room)
+	p, _ := h.Server.players.Get(player.ID)
+	if !src.Has(player.ID) || p.Room() != from.Room || p.FSM.Current() != playerReady {
+		t.Errorf("player in room %s as %s, want %s as %s", p.Room(), p.FSM.Current(), from.Room, playerReady)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+	"github.com/centrifugal/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// rawPeer connects a bare WebSocket peer to the endpoint of h, upgrading
+// with header, which only reads the connect reply and then what the test
+// asks for. It returns the server side of the connection.
+func rawPeer(t *testing.T, h *TestHarness, header http.Header) (*websocket.Conn, *centrifuge.Client) {
+	t.Helper()
+	authenticator, err := NewAuthenticator(h.Server.config.Auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(auth(authenticator, h.Server.WebsocketHandler()))
+	t.Cleanup(ts.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	info := h.Server.config.Client
+	cmd, err := protocol.NewJSONCommandEncoder().Encode(&protocol.Command{
+		Id:      1,
+		Connect: &protocol.ConnectRequest{Name: info.Name, Version: info.Version},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, cmd); err != nil {
+		t.Fatal(err)
+	}
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := protocol.NewJSONReplyDecoder(data).Decode()
+	if err != nil || reply.Connect == nil {
+		t.Fatalf("connect reply %s: %v", data, err)
+	}
+	client, ok := h.Server.node.Hub().Connections()[reply.Connect.Client]
+	if !ok {
+		t.Fatalf("client %s not connected", reply.Connect.Client)
+	}
+	return conn, client
+}
+
+func TestBlockedWriterDisconnectedAsSlowConsumer(t *testing.T) {
+	m := &countingMetrics{counts: make(map[string]float64)}
+	h := newHarness(t, func(c *Config) {
+		c.Metrics = m
+		c.Transport.WriteTimeout = 100 * time.Millisecond
+		// Only the write timeout can catch the peer.
+		c.Transport.QueueMaxSize = 1 << 30
+	})
+	_, client := rawPeer(t, h, nil)
+
+	// The peer reads nothing: once the socket buffers are full, writes
+	// block until the timeout.
+	big := []byte(`"` + strings.Repeat("x", 1<<18) + `"`)
+	deadline := time.Now().Add(10 * time.Second)
+	for m.count("slow_consumer_disconnects_total") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("blocked writer not disconnected")
+		}
+		if err := client.Send(big); err != nil {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	eventually(t, "the client to be gone", func() bool {
+		_, ok := h.Server.node.Hub().Connections()[client.ID()]
+		return !ok
+	})
+}
+
+func TestUnansweredPingsDisconnect(t *testing.T) {
+	m := &countingMetrics{counts: make(map[string]float64)}
+	h := newHarness(t, func(c *Config) {
+		c.Metrics = m
+		c.Transport.PingInterval = 200 * time.Millisecond
+		c.Transport.PongTimeout = 100 * time.Millisecond
+	})
+	conn, client := rawPeer(t, h, nil)
+
+	// The peer reads the pings but never answers them.
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var err error
+	for err == nil {
+		_, _, err = conn.ReadMessage()
+	}
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != int(DisconnectKeepaliveTimeout.Code) {
+		t.Fatalf("connection ended with %v, want code %d", err, DisconnectKeepaliveTimeout.Code)
+	}
+	eventually(t, "the disconnect to be counted", func() bool {
+		return m.count("keepalive_timeout_disconnects_total") == 1
+	})
+	if _, ok := h.Server.node.Hub().Connections()[client.ID()]; ok {
+		t.Error("client still connected")
+	}
+}
+
+func TestAnsweredPingsKeepTheConnection(t *testing.T) {
+	h := newHarness(t, func(c *Config) {
+		c.Transport.PingInterval = 100 * time.Millisecond
+		c.Transport.PongTimeout = 50 * time.Millisecond
+	})
+	conn, client := rawPeer(t, h, nil)
+
+	// Pings are empty JSON objects, answered with one.
+	pings := 0
+	for pings < 3 {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("after %d pings: %v", pings, err)
+		}
+		if string(data) != "{}" {
+			continue
+		}
+		pings++
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := h.Server.node.Hub().Connections()[client.ID()]; !ok {
+		t.Error("client answering the pings disconnected")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// TurnOrder selects how the ready players are ordered for turns when a
+// game starts.
+type TurnOrder string
+
+const (
+	// TurnOrderID sorts the players by client ID.
+	TurnOrderID TurnOrder = ""
+	// TurnOrderJoin sorts the players by the time they joined the room.
+	TurnOrderJoin TurnOrder = "join"
+	// TurnOrderShuffle shuffles the players with RoomConfig.TurnSeed.
+	TurnOrderShuffle TurnOrder = "shuffle"
+)
+
+func (o TurnOrder) validate() error {
+	switch o {
+	case TurnOrderID, TurnOrderJoin, TurnOrderShuffle:
+		return nil
+	}
+	return fmt.Errorf("unknown turn order %q", o)
+}
+
+// Seat is a ready player to order for turns. Join numbers the players in
+// the order they joined the room, from 1.
+type Seat struct {
+	ID   string
+	Join uint64
+}
+
+// addPlayer seats clientID, numbering its join. It must be called with
+// r.mu held.
+func (r *Room) addPlayer(clientID string, ready bool) {
+	r.players[clientID] = ready
+	r.joins++
+	r.joined[clientID] = r.joins
+}
+
+// orderTurns returns the ready players in turn order, as configured. The
+// players are sorted by client ID first, so that every order only depends
+// on the seats and the seed. It must be called with r.mu held.
+func (r *Room) orderTurns() []string {
+	var seats []Seat
+	for id, ready := range r.players {
+		if ready {
+			seats = append(seats, Seat{ID: id, Join: r.joined[id]})
+		}
+	}
+	sort.Slice(seats, func(i, j int) bool { return seats[i].ID < seats[j].ID })
+	switch {
+	case r.config.TurnLess != nil:
+		sort.SliceStable(seats, func(i, j int) bool { return r.config.TurnLess(seats[i], seats[j]) })
+	case r.config.TurnOrder == TurnOrderJoin:
+		sort.SliceStable(seats, func(i, j int) bool { return seats[i].Join < seats[j].Join })
+	case r.config.TurnOrder == TurnOrderShuffle:
+		seed := r.config.TurnSeed
+		if seed == 0 {
+			seed = r.clock.Now().UnixNano()
+		}
+		rand.New(rand.NewSource(seed)).Shuffle(len(seats), func(i, j int) {
+			seats[i], seats[j] = seats[j], seats[i]
+		})
+	}
+	order := make([]string, len(seats))
+	for i, seat := range seats {
+		order[i] = seat.ID
+	}
+	return order
+}
+
+// TurnOrder returns the client IDs of the players in turn order, empty
+// until the game starts.
+func (r *Room) TurnOrder() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.turnOrder...)
+}
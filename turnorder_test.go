@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// seatOrder seats the ready players ids, in this join order, in a room
+// configured by configure and returns their turn order.
+func seatOrder(configure func(*RoomConfig), ids ...string) []string {
+	config := DefaultRoomConfig()
+	configure(&config)
+	r := newRoom("r1", config, NewFakeClock(time.Now()))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		r.addPlayer(id, true)
+	}
+	return r.orderTurns()
+}
+
+func TestSeededShuffleReproducible(t *testing.T) {
+	seeded := func(seed int64) func(*RoomConfig) {
+		return func(c *RoomConfig) {
+			c.TurnOrder = TurnOrderShuffle
+			c.TurnSeed = seed
+		}
+	}
+	ids := []string{"a", "b", "c", "d", "e", "f"}
+	first := seatOrder(seeded(42), ids...)
+	for i := 0; i < 5; i++ {
+		// The join order doesn't matter, only the seats and the seed.
+		again := seatOrder(seeded(42), "f", "d", "b", "a", "e", "c")
+		if !reflect.DeepEqual(again, first) {
+			t.Fatalf("seed 42 ordered %v, then %v", first, again)
+		}
+	}
+	if other := seatOrder(seeded(7), ids...); reflect.DeepEqual(other, first) {
+		t.Errorf("seeds 42 and 7 both ordered %v", first)
+	}
+}
+
+func TestTurnOrders(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		configure func(*RoomConfig)
+		want      []string
+	}{
+		{"id", func(*RoomConfig) {}, []string{"a", "b", "c"}},
+		{"join", func(c *RoomConfig) { c.TurnOrder = TurnOrderJoin }, []string{"c", "a", "b"}},
+		{"less", func(c *RoomConfig) { c.TurnLess = func(a, b Seat) bool { return a.ID > b.ID } }, []string{"c", "b", "a"}},
+	} {
+		if got := seatOrder(tc.configure, "c", "a", "b"); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s order %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+)
+
+// Reasons of failed WebSocket upgrades, derived from the response status.
+const (
+	upgradeOK        = ""
+	upgradeAuth      = "auth"
+	upgradeOrigin    = "origin"
+	upgradeHandshake = "handshake"
+	upgradeInternal  = "internal"
+)
+
+// UpgradeLogConfig controls the personal data logged for WebSocket
+// upgrades.
+type UpgradeLogConfig struct {
+	// HashIPs logs a salted hash of client IPs instead of the IPs, still
+	// telling apart the upgrades of different clients.
+	HashIPs bool
+	// IPSalt is mixed into the hashed IPs.
+	IPSalt string
+	// OmitUserAgent leaves the user agent out of the logs.
+	OmitUserAgent bool
+}
+
+// clientIP returns the IP of r as configured to be logged.
+func (c UpgradeLogConfig) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !c.HashIPs {
+		return ip
+	}
+	sum := sha256.Sum256([]byte(c.IPSalt + ip))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (c UpgradeLogConfig) userAgent(r *http.Request) string {
+	if c.OmitUserAgent {
+		return "-"
+	}
+	return r.UserAgent()
+}
+
+// upgradeFailure returns the reason of an upgrade answered with status.
+func upgradeFailure(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return upgradeAuth
+	case status == http.StatusForbidden:
+		return upgradeOrigin
+	case status >= http.StatusInternalServerError:
+		return upgradeInternal
+	default:
+		return upgradeHandshake
+	}
+}
+
+// observeUpgrades logs and counts the WebSocket upgrades served by h, the
+// auth middleware and WebSocket handler. Upgrades succeed once the
+// connection is hijacked; any other response is a failure whose reason is
+// told by its status.
+func observeUpgrades(config UpgradeLogConfig, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, ua := config.clientIP(r), config.userAgent(r)
+		rec := &upgradeRecorder{ResponseWriter: w, status: http.StatusOK}
+		rec.onHijack = func() {
+			metrics().websocketUpgrades.Add(1, "success", upgradeOK)
+			log.Info().Msgf("websocket upgrade from %s (%s)", ip, ua)
+		}
+		h.ServeHTTP(rec, r)
+		if rec.hijacked {
+			return
+		}
+		reason := upgradeFailure(rec.status)
+		metrics().websocketUpgrades.Add(1, "failure", reason)
+		log.Warn().Msgf("websocket upgrade from %s (%s) failed: %s (%d)", ip, ua, reason, rec.status)
+	})
+}
+
+// upgradeRecorder records the response status, or whether the connection
+// was hijacked.
+type upgradeRecorder struct {
+	http.ResponseWriter
+	status   int
+	hijacked bool
+	onHijack func()
+}
+
+func (w *upgradeRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack implements http.Hijacker for the WebSocket upgrader.
+func (w *upgradeRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.hijacked = true
+	w.onHijack()
+	return conn, rw, nil
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer.
+func (w *upgradeRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// WaitForState blocks until the game reaches state, as reported by the
+// game.state events of the room channels the client is subscribed to, or
+// until ctx is done. It returns at once if the last state reported is
+// already state. Any number of goroutines may wait at the same time, for
+// the same or different states.
+func (c *GameClient) WaitForState(ctx context.Context, state string) error {
+	c.mu.Lock()
+	if c.gameState == state {
+		c.mu.Unlock()
+		return nil
+	}
+	reached := make(chan struct{})
+	c.stateWaiters[state] = append(c.stateWaiters[state], reached)
+	c.mu.Unlock()
+
+	select {
+	case <-reached:
+		return nil
+	case <-ctx.Done():
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	waiters := c.stateWaiters[state]
+	for i, ch := range waiters {
+		if ch == reached {
+			c.stateWaiters[state] = append(waiters[:i], waiters[i+1:]...)
+			return ctx.Err()
+		}
+	}
+	// The state was reached before the waiter could be removed.
+	return nil
+}
+
+// trackState records the state reported by a game.state event and wakes up
+// the goroutines waiting for it.
+func (c *GameClient) trackState(payload json.RawMessage) {
+	var ev gameStateEvent
+	if err := json.Unmarshal(payload, &ev); err != nil || ev.To == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gameState = ev.To
+	for _, reached := range c.stateWaiters[ev.To] {
+		close(reached)
+	}
+	delete(c.stateWaiters, ev.To)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// offlineClient returns a GameClient that never connects, fed by the test.
+func offlineClient(t *testing.T) *GameClient {
+	t.Helper()
+	c, err := newClient(&log, "ws://localhost:0/connection/websocket", DefaultConfig().Client, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// reportState hands c a game.state event of the game reaching to.
+func reportState(c *GameClient, to string) {
+	payload, _ := json.Marshal(gameStateEvent{Room: "r1", To: to})
+	c.handle("game:r1", Message{Type: msgGameState, Payload: payload})
+}
+
+func TestWaitForStateTimeout(t *testing.T) {
+	c := offlineClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.WaitForState(ctx, gamePlaying); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wait: %v, want %v", err, context.DeadlineExceeded)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := len(c.stateWaiters[gamePlaying]); n != 0 {
+		t.Errorf("%d waiters left after the timeout", n)
+	}
+}
+
+func TestWaitForStateAlreadyReached(t *testing.T) {
+	c := offlineClient(t)
+	reportState(c, gamePlaying)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.WaitForState(ctx, gamePlaying); err != nil {
+		t.Errorf("wait for the current state: %v", err)
+	}
+}
+
+func TestWaitForStateConcurrentWaiters(t *testing.T) {
+	c := offlineClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := map[string]chan error{gamePlaying: make(chan error, 1), gameFinished: make(chan error, 1)}
+	for state, ch := range done {
+		state, ch := state, ch
+		go func() { ch <- c.WaitForState(ctx, state) }()
+	}
+	eventually(t, "the waiters", func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.stateWaiters) == 2
+	})
+
+	reportState(c, gamePlaying)
+	if err := <-done[gamePlaying]; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done[gameFinished]:
+		t.Fatalf("waiter for %s returned %v in %s", gameFinished, err, gamePlaying)
+	case <-time.After(20 * time.Millisecond):
+	}
+	reportState(c, gameFinished)
+	if err := <-done[gameFinished]; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+	"github.com/centrifugal/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// websocketReadLimit bounds the frames read from clients, as centrifuge's
+// handler does by default.
+const websocketReadLimit = 65536
+
+// pingPong returns the centrifuge ping settings of c.
+func (c TransportConfig) pingPong() centrifuge.PingPongConfig {
+	return centrifuge.PingPongConfig{PingInterval: c.PingInterval, PongTimeout: c.PongTimeout}
+}
+
+func (c TransportConfig) validate() error {
+	if err := c.Overflow.validate(); err != nil {
+		return err
+	}
+	if c.PingInterval > 0 && c.PongTimeout >= c.PingInterval {
+		return fmt.Errorf("pong timeout %s must be shorter than ping interval %s", c.PongTimeout, c.PingInterval)
+	}
+	return nil
+}
+
+// bufferedWebsocketHandler serves WebSocket connections like centrifuge's
+// handler, but through a sendBuffer applying the configured overflow policy
+// instead of centrifuge's queue, which can only disconnect slow clients.
+type bufferedWebsocketHandler struct {
+	node     *centrifuge.Node
+	config   TransportConfig
+	upgrader websocket.Upgrader
+}
+
+func newBufferedWebsocketHandler(node *centrifuge.Node, config TransportConfig) *bufferedWebsocketHandler {
+	return &bufferedWebsocketHandler{
+		node:     node,
+		config:   config,
+		upgrader: websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024},
+	}
+}
+
+func (h *bufferedWebsocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	proto := centrifuge.ProtocolTypeJSON
+	if r.URL.Query().Get("format") == "protobuf" {
+		proto = centrifuge.ProtocolTypeProtobuf
+	}
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Debug().Msgf("websocket upgrade error: %s", err.Error())
+		return
+	}
+	conn.SetReadLimit(websocketReadLimit)
+	if conn.Subprotocol() == "centrifuge-protobuf" {
+		proto = centrifuge.ProtocolTypeProtobuf
+	}
+
+	writeTimeout := h.config.WriteTimeout
+	if writeTimeout == 0 {
+		writeTimeout = time.Second
+	}
+	transport := &websocketTransport{conn: conn, proto: proto, writeTimeout: writeTimeout, pingPong: h.config.pingPong()}
+	buf := newSendBuffer(transport, h.config.SendBuffer, h.config.Overflow)
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	client, closeFn, err := centrifuge.NewClient(ctx, h.node, buf)
+	if err != nil {
+		log.Error().Msgf("error creating websocket client: %s", err.Error())
+		_ = buf.Close(centrifuge.DisconnectServerError)
+		return
+	}
+	buf.setClient(client.ID())
+	defer func() { _ = closeFn() }()
+	for {
+		_, frame, err := conn.NextReader()
+		if err != nil {
+			return
+		}
+		if !centrifuge.HandleReadFrame(client, frame) {
+			return
+		}
+	}
+}
+
+// websocketTransport is the centrifuge.Transport of a gorilla connection
+// written by a sendBuffer.
+type websocketTransport struct {
+	conn         *websocket.Conn
+	proto        centrifuge.ProtocolType
+	writeTimeout time.Duration
+	pingPong     centrifuge.PingPongConfig
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func (t *websocketTransport) Name() string {
+	return "websocket"
+}
+
+func (t *websocketTransport) Protocol() centrifuge.ProtocolType {
+	return t.proto
+}
+
+func (t *websocketTransport) ProtocolVersion() centrifuge.ProtocolVersion {
+	return centrifuge.ProtocolVersion2
+}
+
+func (t *websocketTransport) Unidirectional() bool {
+	return false
+}
+
+func (t *websocketTransport) Emulation() bool {
+	return false
+}
+
+// DisabledPushFlags disables disconnect pushes, sent as close frames.
+func (t *websocketTransport) DisabledPushFlags() uint64 {
+	return centrifuge.PushFlagDisconnect
+}
+
+// PingPongConfig returns the application-level ping settings of the
+// handler.
+func (t *websocketTransport) PingPongConfig() centrifuge.PingPongConfig {
+	return t.pingPong
+}
+
+func (t *websocketTransport) Write(data []byte) error {
+	return t.WriteMany(data)
+}
+
+// WriteMany writes messages in a single frame.
+func (t *websocketTransport) WriteMany(messages ...[]byte) error {
+	kind := websocket.TextMessage
+	if t.proto == centrifuge.ProtocolTypeProtobuf {
+		kind = websocket.BinaryMessage
+	}
+	proto := protocol.TypeJSON
+	if t.proto == centrifuge.ProtocolTypeProtobuf {
+		proto = protocol.TypeProtobuf
+	}
+	encoder := protocol.GetDataEncoder(proto)
+	defer protocol.PutDataEncoder(proto, encoder)
+	for _, data := range messages {
+		_ = encoder.Encode(data)
+	}
+	_ = t.conn.SetWriteDeadline(time.Now().Add(t.writeTimeout))
+	return t.conn.WriteMessage(kind, encoder.Finish())
+}
+
+// Close sends a close frame telling the disconnect reason, then closes
+// the connection.
+func (t *websocketTransport) Close(disconnect centrifuge.Disconnect) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	if disconnect.Code != centrifuge.DisconnectConnectionClosed.Code {
+		msg := websocket.FormatCloseMessage(int(disconnect.Code), disconnect.Reason)
+		_ = t.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	}
+	return t.conn.Close()
+}